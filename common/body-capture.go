@@ -0,0 +1,130 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BodyCaptureEnabled 是否保存转发请求的请求体与响应体，用于排查问题与处理争议，默认关闭
+var BodyCaptureEnabled = false
+
+// BodyCaptureUserIds、BodyCaptureTokenIds、BodyCaptureGroups 需要保存请求体的用户、令牌与分组，
+// 请求命中任意一项即保存；三项均为空时对所有请求生效
+var BodyCaptureUserIds = map[int]bool{}
+var BodyCaptureTokenIds = map[int]bool{}
+var BodyCaptureGroups = map[string]bool{}
+
+// BodyCaptureSampleRate 命中条件的请求中保存的比例，取值范围 0~1
+var BodyCaptureSampleRate = 1.0
+
+// BodyCaptureMaxSize 请求体与响应体各自保存的最大字节数，超出部分截断
+var BodyCaptureMaxSize = 64 * 1024
+
+// BodyCaptureRetentionDays 保存的天数，过期后自动删除，为 0 时不删除
+var BodyCaptureRetentionDays = 7
+
+// BodyCaptureRedactionRules 自定义脱敏规则，每行一个正则表达式，匹配的内容替换为 [REDACTED]；
+// 邮箱、手机号与各类密钥始终会被脱敏
+var BodyCaptureRedactionRules []*regexp.Regexp
+
+func IdSet2String(ids map[int]bool) string {
+	list := make([]int, 0, len(ids))
+	for id := range ids {
+		list = append(list, id)
+	}
+	sort.Ints(list)
+	result := make([]string, 0, len(list))
+	for _, id := range list {
+		result = append(result, strconv.Itoa(id))
+	}
+	return strings.Join(result, ",")
+}
+
+// ParseIdSet 解析以逗号分隔的 id 列表
+func ParseIdSet(s string) (map[int]bool, error) {
+	ids := make(map[int]bool)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id: %s", item)
+		}
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+func StringSet2String(set map[string]bool) string {
+	list := make([]string, 0, len(set))
+	for item := range set {
+		list = append(list, item)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+// ParseStringSet 解析以逗号分隔的字符串列表
+func ParseStringSet(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			set[item] = true
+		}
+	}
+	return set
+}
+
+func BodyCaptureRedactionRules2String() string {
+	rules := make([]string, 0, len(BodyCaptureRedactionRules))
+	for _, rule := range BodyCaptureRedactionRules {
+		rules = append(rules, rule.String())
+	}
+	return strings.Join(rules, "\n")
+}
+
+// ParseBodyCaptureRedactionRules 解析每行一个的正则表达式，任意一行不合法时返回错误
+func ParseBodyCaptureRedactionRules(s string) ([]*regexp.Regexp, error) {
+	rules := make([]*regexp.Regexp, 0)
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		rule, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction rule %s: %s", line, err.Error())
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// bodyCaptureIdKey 保存请求体时捕获 id 在请求 context 中的键
+type bodyCaptureIdKey struct{}
+
+// WithBodyCaptureId 标记请求的请求体与响应体将以 id 保存，消费日志据此关联
+func WithBodyCaptureId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, bodyCaptureIdKey{}, id)
+}
+
+// GetBodyCaptureId 返回请求的捕获 id，请求未被保存时返回空字符串
+func GetBodyCaptureId(ctx context.Context) string {
+	if c, ok := ctx.(*gin.Context); ok {
+		if c.Request == nil {
+			return ""
+		}
+		ctx = c.Request.Context()
+	}
+	id, _ := ctx.Value(bodyCaptureIdKey{}).(string)
+	return id
+}
@@ -61,7 +61,7 @@ var EmailDomainWhitelist = []string{
 }
 
 var DebugEnabled = os.Getenv("DEBUG") == "true"
-var MemoryCacheEnabled = false
+var MemoryCacheEnabled = os.Getenv("MEMORY_CACHE_ENABLED") == "true"
 
 var LogConsumeEnabled = true
 
@@ -91,6 +91,29 @@ var QuotaForInvitee = 0
 var ChannelDisableThreshold = 5.0
 var AutomaticDisableChannelEnabled = false
 var AutomaticEnableChannelEnabled = false
+
+// 渠道熔断：窗口内请求数达到 ChannelBreakerMinRequests 且失败率不低于 ChannelBreakerErrorRate 时熔断
+// ChannelBreakerOpenSeconds 秒，之后放行 ChannelBreakerHalfOpenProbes 个探测请求
+var ChannelBreakerEnabled = false
+var ChannelBreakerErrorRate = 0.5
+var ChannelBreakerMinRequests = 20
+var ChannelBreakerWindowSeconds = 60
+var ChannelBreakerOpenSeconds = 60
+var ChannelBreakerHalfOpenProbes = 3
+
+// 按延迟路由：统计 ChannelRoutingWindowSeconds 秒内的首字时间、总耗时与成功率，
+// 请求数少于 ChannelRoutingMinRequests 的渠道不做调整
+var ChannelRoutingWindowSeconds = 300
+var ChannelRoutingMinRequests = 10
+
+// 多密钥渠道中的密钥返回 429 后冷却的秒数
+var ChannelKeyCooldownSeconds = 60
+
+// 渠道亲和：按 ChannelAffinityHeader 请求头、OpenAI 的 user 字段或系统提示词与首条消息识别会话，
+// 会话在 ChannelAffinitySeconds 秒内优先使用上次的渠道与密钥
+var ChannelAffinityEnabled = false
+var ChannelAffinityHeader = "X-Session-Id"
+var ChannelAffinitySeconds = 3600
 var QuotaRemindThreshold = 1000
 var PreConsumedQuota = 500
 
@@ -112,6 +135,17 @@ var RelayTimeout = GetEnvOrDefault("RELAY_TIMEOUT", 0) // unit is second
 
 var GeminiSafetySetting = GetEnvOrDefaultString("GEMINI_SAFETY_SETTING", "BLOCK_NONE")
 
+var FileStorageDir = GetEnvOrDefaultString("FILE_STORAGE_DIR", "./files")
+var MaxFileSize = GetEnvOrDefault("MAX_FILE_SIZE", 512) // unit is MB
+
+// FileStorageQuotaPerMB 文件每 MB 每天收取的存储额度，上传时预付首日，0 表示不收费
+var FileStorageQuotaPerMB = 0
+
+var BatchConcurrency = GetEnvOrDefault("BATCH_CONCURRENCY", 5)
+
+// BatchRatio 批处理请求在分组倍率上额外乘以的折扣倍率
+var BatchRatio = 0.5
+
 const (
 	RequestIdKey = "X-Oneapi-Request-Id"
 )
@@ -210,6 +244,7 @@ const (
 	ChannelTypeCohere         = 34
 	ChannelTypeMiniMax        = 35
 	ChannelTypeSunoAPI        = 36
+	ChannelTypeJina           = 37
 
 	ChannelTypeDummy // this one is only for count, do not add any channel after this
 
@@ -253,4 +288,5 @@ var ChannelBaseURLs = []string{
 	"https://api.cohere.ai",                     //34
 	"https://api.minimax.chat",                  //35
 	"",                                          //36
+	"https://api.jina.ai",                       //37
 }
@@ -3,8 +3,11 @@ package common
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"io"
+	"mime"
+	"mime/multipart"
 	"strings"
 )
 
@@ -43,3 +46,26 @@ func UnmarshalBodyReusable(c *gin.Context, v any) error {
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 	return nil
 }
+
+// ParseMultipartFormReusable 解析 multipart 请求体，请求体保留以便重试时重新读取
+func ParseMultipartFormReusable(c *gin.Context) (*multipart.Form, error) {
+	requestBody, err := GetRequestBody(c)
+	if err != nil {
+		return nil, err
+	}
+	_, params, err := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	boundary, ok := params["boundary"]
+	if !ok {
+		return nil, errors.New("missing multipart boundary")
+	}
+	form, err := multipart.NewReader(bytes.NewReader(requestBody), boundary).ReadForm(32 << 20)
+	if err != nil {
+		return nil, err
+	}
+	// Reset request body
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	return form, nil
+}
@@ -0,0 +1,31 @@
+package common
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// GroupFirstTokenTimeout 分组 -> 流式请求的首字超时（秒）。上游在此时间内没有返回任何内容时中断请求并重试其他渠道，
+// 渠道单独设置了首字超时时以渠道为准，未配置或不大于 0 的分组不限制
+var GroupFirstTokenTimeout = map[string]int{}
+
+func GroupFirstTokenTimeout2JSONString() string {
+	jsonBytes, err := json.Marshal(GroupFirstTokenTimeout)
+	if err != nil {
+		SysError("error marshalling group first token timeout: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupFirstTokenTimeoutByJSONString(jsonStr string) error {
+	GroupFirstTokenTimeout = make(map[string]int)
+	return json.Unmarshal([]byte(jsonStr), &GroupFirstTokenTimeout)
+}
+
+func GetGroupFirstTokenTimeout(group string) time.Duration {
+	timeout := GroupFirstTokenTimeout[group]
+	if timeout <= 0 {
+		return 0
+	}
+	return time.Duration(timeout) * time.Second
+}
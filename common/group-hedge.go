@@ -0,0 +1,31 @@
+package common
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// GroupHedgeDelay 分组 -> 对冲请求延迟（毫秒）。请求在此时间内没有输出首个 token 时，
+// 向另一个渠道发送相同的请求，先输出的请求胜出，未配置或不大于 0 的分组不发送对冲请求
+var GroupHedgeDelay = map[string]int{}
+
+func GroupHedgeDelay2JSONString() string {
+	jsonBytes, err := json.Marshal(GroupHedgeDelay)
+	if err != nil {
+		SysError("error marshalling group hedge delay: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupHedgeDelayByJSONString(jsonStr string) error {
+	GroupHedgeDelay = make(map[string]int)
+	return json.Unmarshal([]byte(jsonStr), &GroupHedgeDelay)
+}
+
+func GetGroupHedgeDelay(group string) time.Duration {
+	delay := GroupHedgeDelay[group]
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(delay) * time.Millisecond
+}
@@ -0,0 +1,36 @@
+package common
+
+import (
+	"encoding/json"
+)
+
+const (
+	// RoutingStrategyWeighted 按渠道权重随机选择（默认）
+	RoutingStrategyWeighted = "weighted"
+	// RoutingStrategyLatency 按渠道权重并结合近期首字时间、总耗时与成功率调整后随机选择
+	RoutingStrategyLatency = "latency"
+)
+
+// GroupRoutingStrategy 分组 -> 渠道选择策略，未配置的分组使用 RoutingStrategyWeighted
+var GroupRoutingStrategy = map[string]string{}
+
+func GroupRoutingStrategy2JSONString() string {
+	jsonBytes, err := json.Marshal(GroupRoutingStrategy)
+	if err != nil {
+		SysError("error marshalling group routing strategy: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupRoutingStrategyByJSONString(jsonStr string) error {
+	GroupRoutingStrategy = make(map[string]string)
+	return json.Unmarshal([]byte(jsonStr), &GroupRoutingStrategy)
+}
+
+func GetGroupRoutingStrategy(group string) string {
+	strategy, ok := GroupRoutingStrategy[group]
+	if !ok || strategy == "" {
+		return RoutingStrategyWeighted
+	}
+	return strategy
+}
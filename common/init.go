@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 var (
@@ -23,7 +24,12 @@ func printHelp() {
 }
 
 func init() {
-	flag.Parse()
+	// go test 的命令行参数由 testing 包解析，测试时也不创建日志目录
+	if strings.HasSuffix(os.Args[0], ".test") {
+		*LogDir = ""
+	} else {
+		flag.Parse()
+	}
 
 	if *PrintVersion {
 		fmt.Println(Version)
@@ -1,25 +1,76 @@
 package common
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+type LogLevel int
+
 const (
-	loggerINFO  = "INFO"
-	loggerWarn  = "WARN"
-	loggerError = "ERR"
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+	LogLevelFatal
 )
 
+var logLevelNames = []string{"debug", "info", "warn", "error", "fatal"}
+
+// logLevelTags 文本格式下各级别的前缀
+var logLevelTags = []string{"DEBUG", "INFO", "WARN", "ERR", "FATAL"}
+
+func (l LogLevel) String() string {
+	return logLevelNames[l]
+}
+
+// LogFormat 日志格式：text（默认，便于阅读）、json 或 logfmt
+var LogFormat = strings.ToLower(os.Getenv("LOG_FORMAT"))
+
+// MinLogLevel 低于该级别的日志不输出，可通过 LOG_LEVEL 环境变量或 LogLevel 设置修改
+var MinLogLevel = initLogLevel()
+
+// LogInfoSampleRate 请求内 info 日志的采样比例，按请求 Id 采样，同一请求的日志要么全部保留要么全部丢弃；
+// 系统日志与 warn 及以上级别的日志不采样
+var LogInfoSampleRate = 1.0
+
+func initLogLevel() LogLevel {
+	if DebugEnabled {
+		return LogLevelDebug
+	}
+	if level, err := ParseLogLevel(os.Getenv("LOG_LEVEL")); err == nil {
+		return level
+	}
+	return LogLevelInfo
+}
+
+func ParseLogLevel(name string) (LogLevel, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "warning" {
+		name = "warn"
+	}
+	for i, levelName := range logLevelNames[:LogLevelFatal] {
+		if name == levelName {
+			return LogLevel(i), nil
+		}
+	}
+	return LogLevelInfo, fmt.Errorf("unknown log level: %s", name)
+}
+
 const maxLogCount = 1000000
 
 var logCount int
@@ -47,41 +98,195 @@ func SetupLogger() {
 	}
 }
 
+// logFieldsKey 请求日志字段在 context 中的键
+type logFieldsKey struct{}
+
+// logFields 随请求传递的日志字段，由各中间件在确定用户、渠道等信息后填充。
+// 保存在请求的 context 中而不是 gin.Context 中，请求结束后的异步日志也能安全读取
+type logFields struct {
+	mu     sync.RWMutex
+	keys   []string
+	values map[string]any
+}
+
+// WithLogFields 为请求创建日志字段容器，之后通过 SetLogField 添加的字段会自动附加到该请求的日志中
+func WithLogFields(ctx context.Context) context.Context {
+	return context.WithValue(ctx, logFieldsKey{}, &logFields{values: make(map[string]any)})
+}
+
+func logFieldsFromContext(ctx context.Context) *logFields {
+	if c, ok := ctx.(*gin.Context); ok {
+		if c.Request == nil {
+			return nil
+		}
+		ctx = c.Request.Context()
+	}
+	fields, _ := ctx.Value(logFieldsKey{}).(*logFields)
+	return fields
+}
+
+// SetLogField 设置请求日志字段，如 user_id、channel_id、model、retry，ctx 没有日志字段容器时忽略
+func SetLogField(ctx context.Context, key string, value any) {
+	fields := logFieldsFromContext(ctx)
+	if fields == nil {
+		return
+	}
+	fields.mu.Lock()
+	defer fields.mu.Unlock()
+	if _, ok := fields.values[key]; !ok {
+		fields.keys = append(fields.keys, key)
+	}
+	fields.values[key] = value
+}
+
+type logField struct {
+	key   string
+	value any
+}
+
+func (f *logFields) snapshot() []logField {
+	if f == nil {
+		return nil
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	result := make([]logField, 0, len(f.keys))
+	for _, key := range f.keys {
+		result = append(result, logField{key: key, value: f.values[key]})
+	}
+	return result
+}
+
+// logSampled 按请求 Id 的哈希决定请求内的 info 日志是否输出
+func logSampled(requestId string) bool {
+	rate := LogInfoSampleRate
+	if rate >= 1 || requestId == "" {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(requestId))
+	return float64(hash.Sum32()%10000) < rate*10000
+}
+
+// writeLog 按 LogFormat 输出一条日志，system 为 true 时表示与请求无关的系统日志
+func writeLog(level LogLevel, system bool, requestId string, msg string, fields []logField) {
+	writer := gin.DefaultErrorWriter
+	if level < LogLevelWarn {
+		writer = gin.DefaultWriter
+	}
+	now := time.Now()
+	var buf bytes.Buffer
+	switch LogFormat {
+	case "json":
+		buf.WriteString(`{"time":`)
+		writeJSONValue(&buf, now.Format(time.RFC3339Nano))
+		buf.WriteString(`,"level":`)
+		writeJSONValue(&buf, level.String())
+		if requestId != "" {
+			buf.WriteString(`,"request_id":`)
+			writeJSONValue(&buf, requestId)
+		}
+		for _, field := range fields {
+			buf.WriteByte(',')
+			writeJSONValue(&buf, field.key)
+			buf.WriteByte(':')
+			writeJSONValue(&buf, field.value)
+		}
+		buf.WriteString(`,"msg":`)
+		writeJSONValue(&buf, msg)
+		buf.WriteString("}\n")
+	case "logfmt":
+		buf.WriteString("time=" + now.Format(time.RFC3339Nano) + " level=" + level.String())
+		if requestId != "" {
+			buf.WriteString(" request_id=" + logfmtValue(requestId))
+		}
+		for _, field := range fields {
+			buf.WriteString(" " + field.key + "=" + logfmtValue(field.value))
+		}
+		buf.WriteString(" msg=" + logfmtValue(msg) + "\n")
+	default:
+		tag := logLevelTags[level]
+		if system && (level == LogLevelInfo || level == LogLevelError) {
+			tag = "SYS"
+		}
+		buf.WriteString(fmt.Sprintf("[%s] %v | ", tag, now.Format("2006/01/02 - 15:04:05")))
+		if !system {
+			buf.WriteString(requestId + " | ")
+		}
+		buf.WriteString(msg)
+		if len(fields) > 0 {
+			buf.WriteString(" |")
+			for _, field := range fields {
+				buf.WriteString(" " + field.key + "=" + logfmtValue(field.value))
+			}
+		}
+		buf.WriteString(" \n")
+	}
+	_, _ = writer.Write(buf.Bytes())
+}
+
+func writeJSONValue(buf *bytes.Buffer, value any) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(data)
+}
+
+func logfmtValue(value any) string {
+	s := fmt.Sprint(value)
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
 func SysLog(s string) {
-	t := time.Now()
-	_, _ = fmt.Fprintf(gin.DefaultWriter, "[SYS] %v | %s \n", t.Format("2006/01/02 - 15:04:05"), s)
+	if MinLogLevel > LogLevelInfo {
+		return
+	}
+	writeLog(LogLevelInfo, true, "", s, nil)
 }
 
 func DebugLog(s string) {
-	t := time.Now()
-	_, _ = fmt.Fprintf(gin.DefaultWriter, "[DEBUG] %v | %s \n", t.Format("2006/01/02 - 15:04:05"), s)
+	if MinLogLevel > LogLevelDebug {
+		return
+	}
+	writeLog(LogLevelDebug, true, "", s, nil)
 }
 
 func SysError(s string) {
-	t := time.Now()
-	_, _ = fmt.Fprintf(gin.DefaultErrorWriter, "[SYS] %v | %s \n", t.Format("2006/01/02 - 15:04:05"), s)
+	writeLog(LogLevelError, true, "", s, nil)
+}
+
+func LogDebug(ctx context.Context, msg string) {
+	logHelper(ctx, LogLevelDebug, msg)
 }
 
 func LogInfo(ctx context.Context, msg string) {
-	logHelper(ctx, loggerINFO, msg)
+	logHelper(ctx, LogLevelInfo, msg)
 }
 
 func LogWarn(ctx context.Context, msg string) {
-	logHelper(ctx, loggerWarn, msg)
+	logHelper(ctx, LogLevelWarn, msg)
 }
 
 func LogError(ctx context.Context, msg string) {
-	logHelper(ctx, loggerError, msg)
+	logHelper(ctx, LogLevelError, msg)
 }
 
-func logHelper(ctx context.Context, level string, msg string) {
-	writer := gin.DefaultErrorWriter
-	if level == loggerINFO {
-		writer = gin.DefaultWriter
+func logHelper(ctx context.Context, level LogLevel, msg string) {
+	if level < MinLogLevel {
+		return
 	}
-	id := ctx.Value(RequestIdKey)
-	now := time.Now()
-	_, _ = fmt.Fprintf(writer, "[%s] %v | %s | %s \n", level, now.Format("2006/01/02 - 15:04:05"), id, msg)
+	requestId, _ := ctx.Value(RequestIdKey).(string)
+	if level == LogLevelInfo && !logSampled(requestId) {
+		return
+	}
+	writeLog(level, false, requestId, msg, logFieldsFromContext(ctx).snapshot())
 	logCount++ // we don't need accurate count, so no lock here
 	if logCount > maxLogCount && !setupLogWorking {
 		logCount = 0
@@ -93,11 +298,33 @@ func logHelper(ctx context.Context, level string, msg string) {
 }
 
 func FatalLog(v ...any) {
-	t := time.Now()
-	_, _ = fmt.Fprintf(gin.DefaultErrorWriter, "[FATAL] %v | %v \n", t.Format("2006/01/02 - 15:04:05"), v)
+	writeLog(LogLevelFatal, true, "", strings.TrimSuffix(fmt.Sprintln(v...), "\n"), nil)
 	os.Exit(1)
 }
 
+// UpdateLogLevel 运行时修改日志级别
+func UpdateLogLevel(name string) error {
+	level, err := ParseLogLevel(name)
+	if err != nil {
+		return err
+	}
+	MinLogLevel = level
+	return nil
+}
+
+// UpdateLogInfoSampleRate 运行时修改请求内 info 日志的采样比例，取值范围 0~1
+func UpdateLogInfoSampleRate(value string) error {
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	if rate < 0 || rate > 1 {
+		return errors.New("log info sample rate must be between 0 and 1")
+	}
+	LogInfoSampleRate = rate
+	return nil
+}
+
 func LogQuota(quota int) string {
 	if DisplayInCurrencyEnabled {
 		return fmt.Sprintf("＄%.6f 额度", float64(quota)/QuotaPerUnit)
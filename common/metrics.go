@@ -0,0 +1,108 @@
+package common
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// MetricsToken 访问 /metrics 所需的 Bearer Token，为空时不校验
+var MetricsToken = os.Getenv("METRICS_TOKEN")
+
+var (
+	metricRelayRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "one_api_relay_requests_total",
+		Help: "Number of upstream relay attempts.",
+	}, []string{"model", "channel", "group", "status_code"})
+	metricRelayDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "one_api_relay_request_duration_seconds",
+		Help:    "Duration of upstream relay attempts.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"model", "channel", "group", "status_code"})
+	metricRelayFirstToken = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "one_api_relay_first_token_seconds",
+		Help:    "Time to first token of streaming relay attempts.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 10, 20, 30, 60},
+	}, []string{"model", "channel", "group", "status_code"})
+	metricRelayRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "one_api_relay_retries_total",
+		Help: "Number of relay retries, labelled by the channel retried on.",
+	}, []string{"model", "channel", "group"})
+	metricChannelAutoDisabled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "one_api_channel_auto_disabled_total",
+		Help: "Number of channels or channel keys disabled automatically.",
+	}, []string{"channel", "target"})
+	metricQuotaPreConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "one_api_quota_pre_consumed_total",
+		Help: "Quota pre-consumed before relaying.",
+	}, []string{"model", "channel", "group"})
+	metricQuotaConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "one_api_quota_consumed_total",
+		Help: "Quota finally consumed after relaying.",
+	}, []string{"model", "channel", "group"})
+	metricUpstreamTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "one_api_upstream_tokens_total",
+		Help: "Tokens sent to (prompt) and received from (completion) upstream.",
+	}, []string{"model", "channel", "type"})
+	metricDBErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "one_api_db_errors_total",
+		Help: "Number of failed database operations.",
+	}, []string{"operation"})
+	metricRedisErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "one_api_redis_errors_total",
+		Help: "Number of failed Redis commands.",
+	}, []string{"command"})
+	metricTaskBacklog = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "one_api_task_backlog",
+		Help: "Number of unfinished asynchronous tasks seen by the last poll.",
+	}, []string{"platform"})
+)
+
+// MetricsRecordRelay 记录一次上游请求，firstToken 为 0 时不记录首字时间
+func MetricsRecordRelay(model string, channelId int, group string, statusCode int, duration time.Duration, firstToken time.Duration) {
+	channel := strconv.Itoa(channelId)
+	status := strconv.Itoa(statusCode)
+	metricRelayRequests.WithLabelValues(model, channel, group, status).Inc()
+	metricRelayDuration.WithLabelValues(model, channel, group, status).Observe(duration.Seconds())
+	if firstToken > 0 {
+		metricRelayFirstToken.WithLabelValues(model, channel, group, status).Observe(firstToken.Seconds())
+	}
+}
+
+func MetricsRecordRetry(model string, channelId int, group string) {
+	metricRelayRetries.WithLabelValues(model, strconv.Itoa(channelId), group).Inc()
+}
+
+// MetricsRecordChannelAutoDisabled target 为 channel 或 key
+func MetricsRecordChannelAutoDisabled(channelId int, target string) {
+	metricChannelAutoDisabled.WithLabelValues(strconv.Itoa(channelId), target).Inc()
+}
+
+func MetricsRecordPreConsumedQuota(model string, channelId int, group string, quota int) {
+	metricQuotaPreConsumed.WithLabelValues(model, strconv.Itoa(channelId), group).Add(float64(quota))
+}
+
+func MetricsRecordConsumedQuota(model string, channelId int, group string, quota int) {
+	metricQuotaConsumed.WithLabelValues(model, strconv.Itoa(channelId), group).Add(float64(quota))
+}
+
+func MetricsRecordUpstreamTokens(model string, channelId int, promptTokens int, completionTokens int) {
+	channel := strconv.Itoa(channelId)
+	metricUpstreamTokens.WithLabelValues(model, channel, "prompt").Add(float64(promptTokens))
+	metricUpstreamTokens.WithLabelValues(model, channel, "completion").Add(float64(completionTokens))
+}
+
+func MetricsRecordDBError(operation string) {
+	metricDBErrors.WithLabelValues(operation).Inc()
+}
+
+func MetricsRecordRedisError(command string) {
+	metricRedisErrors.WithLabelValues(command).Inc()
+}
+
+func MetricsSetTaskBacklog(platform string, count int) {
+	metricTaskBacklog.WithLabelValues(platform).Set(float64(count))
+}
@@ -0,0 +1,113 @@
+package common
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// defaultModelContextWindow 模型的上下文窗口（提示词与补全的 token 总数），
+// 键为模型名称或含 * 通配符的模式，如 gpt-4-turbo-* 匹配 gpt-4-turbo-2024-04-09；
+// 不做前缀匹配，避免未列出的新模型（如 gpt-4.1）套用旧模型较小的窗口
+var defaultModelContextWindow = map[string]int{
+	"gpt-3.5-turbo":          16385,
+	"gpt-3.5-turbo-0125":     16385,
+	"gpt-3.5-turbo-1106":     16385,
+	"gpt-3.5-turbo-16k":      16385,
+	"gpt-3.5-turbo-instruct": 4096,
+	"gpt-4":                  8192,
+	"gpt-4-0314":             8192,
+	"gpt-4-0613":             8192,
+	"gpt-4-32k":              32768,
+	"gpt-4-32k-0314":         32768,
+	"gpt-4-32k-0613":         32768,
+	"gpt-4-turbo":            128000,
+	"gpt-4-turbo-*":          128000,
+	"gpt-4-1106-preview":     128000,
+	"gpt-4-0125-preview":     128000,
+	"gpt-4-vision-preview":   128000,
+	"gpt-4o":                 128000,
+	"gpt-4o-*":               128000,
+	"gpt-4-gizmo-*":          128000,
+	"chatgpt-4o-latest":      128000,
+	"o1-preview":             128000,
+	"o1-preview-*":           128000,
+	"o1-mini":                128000,
+	"o1-mini-*":              128000,
+	"claude-instant-1":       100000,
+	"claude-instant-1.2":     100000,
+	"claude-2.0":             100000,
+	"claude-2.1":             200000,
+	"claude-3-*":             200000,
+	"gemini-1.0-pro":         32760,
+	"gemini-1.0-pro-*":       32760,
+	"gemini-1.5-flash":       1048576,
+	"gemini-1.5-flash-*":     1048576,
+	"gemini-1.5-pro":         2097152,
+	"gemini-1.5-pro-*":       2097152,
+	"deepseek-chat":          65536,
+	"deepseek-coder":         65536,
+	"glm-4":                  128000,
+	"moonshot-v1-8k":         8192,
+	"moonshot-v1-32k":        32768,
+	"moonshot-v1-128k":       131072,
+}
+
+var modelContextWindow map[string]int = nil
+
+func ModelContextWindow2JSONString() string {
+	if modelContextWindow == nil {
+		modelContextWindow = defaultModelContextWindow
+	}
+	jsonBytes, err := json.Marshal(modelContextWindow)
+	if err != nil {
+		SysError("error marshalling model context window: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelContextWindowByJSONString(jsonStr string) error {
+	modelContextWindow = make(map[string]int)
+	return json.Unmarshal([]byte(jsonStr), &modelContextWindow)
+}
+
+// matchModelPattern 判断模型名称是否匹配含 * 通配符的模式，* 匹配任意长度的字符
+func matchModelPattern(pattern string, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(name, parts[0]) {
+		return false
+	}
+	name = name[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if i == len(parts)-2 {
+			return strings.HasSuffix(name, part)
+		}
+		index := strings.Index(name, part)
+		if index < 0 {
+			return false
+		}
+		name = name[index+len(part):]
+	}
+	return name == ""
+}
+
+// GetModelContextWindow 返回模型的上下文窗口，先按名称精确匹配，再按通配符模式匹配（不含 * 的字符最多的模式优先），
+// 未知模型返回 0，表示不限制
+func GetModelContextWindow(name string) int {
+	if modelContextWindow == nil {
+		modelContextWindow = defaultModelContextWindow
+	}
+	if window, ok := modelContextWindow[name]; ok {
+		return window
+	}
+	window, matched, matchedLength := 0, "", -1
+	for pattern, value := range modelContextWindow {
+		if !strings.Contains(pattern, "*") || !matchModelPattern(pattern, name) {
+			continue
+		}
+		length := len(pattern) - strings.Count(pattern, "*")
+		if length > matchedLength || (length == matchedLength && pattern < matched) {
+			window, matched, matchedLength = value, pattern, length
+		}
+	}
+	return window
+}
@@ -0,0 +1,78 @@
+package common
+
+import "testing"
+
+func TestGetModelContextWindow(t *testing.T) {
+	modelContextWindow = defaultModelContextWindow
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{model: "gpt-4", want: 8192},
+		{model: "gpt-4-turbo-2024-04-09", want: 128000},
+		{model: "gpt-4o-mini-2024-07-18", want: 128000},
+		{model: "claude-3-5-sonnet-20240620", want: 200000},
+		// 未列出的模型不套用名称前缀相同的旧模型的窗口
+		{model: "gpt-4.1", want: 0},
+		{model: "gpt-4.5-preview", want: 0},
+		{model: "gpt-4-unknown", want: 0},
+		{model: "glm-4v", want: 0},
+		{model: "unknown-model", want: 0},
+		{model: "", want: 0},
+	}
+	for _, tt := range tests {
+		if got := GetModelContextWindow(tt.model); got != tt.want {
+			t.Errorf("GetModelContextWindow(%q) = %d, want %d", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestGetModelContextWindowPatterns(t *testing.T) {
+	defer func() {
+		modelContextWindow = defaultModelContextWindow
+	}()
+	err := UpdateModelContextWindowByJSONString(`{"qwen-*": 32768, "qwen-long*": 1000000, "*-128k": 131072, "qwen-max": 8192, "a*": 1, "*a": 2}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{model: "qwen-max", want: 8192},
+		{model: "qwen-plus", want: 32768},
+		// 不含 * 的字符更多的模式优先
+		{model: "qwen-long-latest", want: 1000000},
+		{model: "yi-128k", want: 131072},
+		{model: "qwen-plus-128k", want: 131072},
+		// 匹配长度相同时按模式的字典序选择，结果与 map 的遍历顺序无关
+		{model: "aa", want: 2},
+		{model: "qwen", want: 0},
+	}
+	for _, tt := range tests {
+		if got := GetModelContextWindow(tt.model); got != tt.want {
+			t.Errorf("GetModelContextWindow(%q) = %d, want %d", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestMatchModelPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "gpt-4o-*", name: "gpt-4o-mini", want: true},
+		{pattern: "gpt-4o-*", name: "gpt-4o", want: false},
+		{pattern: "*-128k", name: "moonshot-v1-128k", want: true},
+		{pattern: "claude-*-sonnet-*", name: "claude-3-5-sonnet-20240620", want: true},
+		{pattern: "claude-*-sonnet-*", name: "claude-3-opus-20240229", want: false},
+		{pattern: "a*a", name: "a", want: false},
+		{pattern: "gpt-4", name: "gpt-4-turbo", want: false},
+	}
+	for _, tt := range tests {
+		if got := matchModelPattern(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchModelPattern(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package common
+
+import (
+	"encoding/json"
+)
+
+// ModelFallback 分组 -> 模型 -> 备用模型列表。请求的模型没有可用渠道或全部重试失败时，
+// 依次使用备用模型转发，如 {"default": {"gpt-4o": ["gpt-4-turbo", "claude-3-5-sonnet-20240620"]}}
+var ModelFallback = map[string]map[string][]string{}
+
+func ModelFallback2JSONString() string {
+	jsonBytes, err := json.Marshal(ModelFallback)
+	if err != nil {
+		SysError("error marshalling model fallback: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelFallbackByJSONString(jsonStr string) error {
+	ModelFallback = make(map[string]map[string][]string)
+	return json.Unmarshal([]byte(jsonStr), &ModelFallback)
+}
+
+func GetModelFallback(group string, model string) []string {
+	return ModelFallback[group][model]
+}
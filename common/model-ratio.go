@@ -146,11 +146,18 @@ var defaultModelRatio = map[string]float64{
 	"command-r-plus	":       1.5,
 	"deepseek-chat":         0.07,
 	"deepseek-coder":        0.07,
+	// Jina rerank 按 token 计费
+	"jina-reranker-v2-base-multilingual": 0.02 / 1000 * USD,
+	"jina-reranker-v1-base-en":           0.02 / 1000 * USD,
+	"jina-reranker-v1-turbo-en":          0.02 / 1000 * USD,
 	// Perplexity online 模型对搜索额外收费，有需要应自行调整，此处不计入搜索费用
 	"llama-3-sonar-small-32k-chat":   0.2 / 1000 * USD,
 	"llama-3-sonar-small-32k-online": 0.2 / 1000 * USD,
 	"llama-3-sonar-large-32k-chat":   1 / 1000 * USD,
 	"llama-3-sonar-large-32k-online": 1 / 1000 * USD,
+	// Realtime 模型文本输入 $5 / 1M tokens，音频按音频倍率另行计算
+	"gpt-4o-realtime-preview":            2.5,
+	"gpt-4o-realtime-preview-2024-10-01": 2.5,
 }
 
 var defaultModelPrice = map[string]float64{
@@ -171,6 +178,22 @@ var defaultModelPrice = map[string]float64{
 	"mj_describe":       0.05,
 	"mj_upscale":        0.05,
 	"swap_face":         0.05,
+	// Cohere rerank 按搜索单元计费，每个搜索单元为一次查询最多 100 个文档
+	"rerank-english-v3.0":      0.002,
+	"rerank-multilingual-v3.0": 0.002,
+	"rerank-english-v2.0":      0.002,
+	"rerank-multilingual-v2.0": 0.002,
+}
+
+// 音频倍率为音频 token 相对文本 token 的价格倍数，输入与输出分别计算
+var defaultAudioRatio = map[string]float64{
+	"gpt-4o-realtime-preview":            20,
+	"gpt-4o-realtime-preview-2024-10-01": 20,
+}
+
+var defaultAudioCompletionRatio = map[string]float64{
+	"gpt-4o-realtime-preview":            10,
+	"gpt-4o-realtime-preview-2024-10-01": 10,
 }
 
 var modelPrice map[string]float64 = nil
@@ -297,6 +320,9 @@ func GetCompletionRatio(name string) float64 {
 		}
 		return 4.0 / 3.0
 	}
+	if strings.HasPrefix(name, "gpt-4o-realtime") {
+		return 4
+	}
 	if strings.HasPrefix(name, "gpt-4") && !strings.HasSuffix(name, "-all") && !strings.HasSuffix(name, "-gizmo-*") {
 		if strings.HasPrefix(name, "gpt-4-turbo") || strings.HasSuffix(name, "preview") || strings.HasPrefix(name, "gpt-4o") {
 			return 3
@@ -358,3 +384,17 @@ func GetCompletionRatioMap() map[string]float64 {
 	}
 	return CompletionRatio
 }
+
+func GetAudioRatio(name string) float64 {
+	if ratio, ok := defaultAudioRatio[name]; ok {
+		return ratio
+	}
+	return 1
+}
+
+func GetAudioCompletionRatio(name string) float64 {
+	if ratio, ok := defaultAudioCompletionRatio[name]; ok {
+		return ratio
+	}
+	return 1
+}
@@ -0,0 +1,255 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/template"
+)
+
+// 通知事件类型
+const (
+	NotifyEventChannelDisabled    = "channel_disabled"
+	NotifyEventChannelKeyDisabled = "channel_key_disabled"
+	NotifyEventChannelEnabled     = "channel_enabled"
+	NotifyEventChannelBalanceLow  = "channel_balance_low"
+	NotifyEventUserQuotaLow       = "user_quota_low"
+	NotifyEventTaskFailureSpike   = "task_failure_spike"
+	NotifyEventPaymentReceived    = "payment_received"
+)
+
+// 通知渠道类型
+const (
+	NotifyChannelTypeEmail    = "email"
+	NotifyChannelTypeWebhook  = "webhook"
+	NotifyChannelTypeTelegram = "telegram"
+	NotifyChannelTypeDingTalk = "dingtalk"
+	NotifyChannelTypeFeishu   = "feishu"
+	NotifyChannelTypeSlack    = "slack"
+)
+
+// NotifyChannelEmail 内置的邮件通知渠道，系统事件发送给超级管理员，用户事件发送给对应用户
+const NotifyChannelEmail = "email"
+
+// NotificationChannel 通知渠道配置，Name 供通知规则引用
+type NotificationChannel struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Url webhook、钉钉、飞书、Slack 的请求地址
+	Url string `json:"url,omitempty"`
+	// Secret webhook 签名密钥，或钉钉、飞书机器人的加签密钥
+	Secret string `json:"secret,omitempty"`
+	// Token Telegram 机器人 token，为空时使用 TelegramBotToken 设置
+	Token  string `json:"token,omitempty"`
+	ChatId string `json:"chat_id,omitempty"`
+	// To 邮件收件人，为空时按事件发送给超级管理员或对应用户
+	To string `json:"to,omitempty"`
+}
+
+// NotificationTemplate 通知的标题与内容模板，使用 Go text/template 语法，可引用事件的字段
+type NotificationTemplate struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// NotificationChannels 已配置的通知渠道，内置的 email 渠道无需配置
+var NotificationChannels = []NotificationChannel{}
+
+// NotificationRules 事件类型 -> 通知渠道名称列表，未配置的事件不发送通知
+var NotificationRules = map[string][]string{
+	NotifyEventChannelDisabled:    {NotifyChannelEmail},
+	NotifyEventChannelKeyDisabled: {NotifyChannelEmail},
+	NotifyEventChannelEnabled:     {NotifyChannelEmail},
+	NotifyEventUserQuotaLow:       {NotifyChannelEmail},
+}
+
+// defaultNotificationTemplates 各事件的默认模板，NotificationTemplates 中的同名配置优先
+var defaultNotificationTemplates = map[string]NotificationTemplate{
+	NotifyEventChannelDisabled: {
+		Title:   "通道「{{.channel_name}}」（#{{.channel_id}}）已被禁用",
+		Content: "通道「{{.channel_name}}」（#{{.channel_id}}）已被禁用，原因：{{.reason}}",
+	},
+	NotifyEventChannelKeyDisabled: {
+		Title:   "通道「{{.channel_name}}」（#{{.channel_id}}）的密钥 #{{.key_id}} 已被禁用",
+		Content: "通道「{{.channel_name}}」（#{{.channel_id}}）的密钥 #{{.key_id}} 已被禁用，原因：{{.reason}}",
+	},
+	NotifyEventChannelEnabled: {
+		Title:   "通道「{{.channel_name}}」（#{{.channel_id}}）已被启用",
+		Content: "通道「{{.channel_name}}」（#{{.channel_id}}）已被启用",
+	},
+	NotifyEventChannelBalanceLow: {
+		Title:   "通道「{{.channel_name}}」（#{{.channel_id}}）余额不足",
+		Content: "通道「{{.channel_name}}」（#{{.channel_id}}）当前余额为 {{.balance}}，低于提醒阈值 {{.threshold}}，请及时充值",
+	},
+	NotifyEventUserQuotaLow: {
+		Title:   "{{.prompt}}",
+		Content: "{{.prompt}}，当前剩余额度为 {{.quota}}，为了不影响您的使用，请及时充值。充值链接：{{.top_up_link}}",
+	},
+	NotifyEventTaskFailureSpike: {
+		Title:   "{{.platform}} 任务失败数激增",
+		Content: "最近 {{.window_minutes}} 分钟内共有 {{.count}} 个 {{.platform}} 任务失败，请检查相关渠道",
+	},
+	NotifyEventPaymentReceived: {
+		Title:   "收到用户充值",
+		Content: "用户 {{.username}}（#{{.user_id}}）充值成功，充值额度：{{.quota}}，支付金额：{{.money}}，订单号：{{.trade_no}}",
+	},
+}
+
+// NotificationTemplates 自定义的事件模板，事件类型 -> 模板
+var NotificationTemplates = map[string]NotificationTemplate{}
+
+// NotificationRateLimitSeconds 相同的通知（同一事件的同一对象）在此时间内只发送一次，为 0 时不限制
+var NotificationRateLimitSeconds = 300
+
+// ChannelBalanceLowThreshold 渠道余额低于该值（美元）时发送余额不足通知，为 0 时不提醒
+var ChannelBalanceLowThreshold = 0.0
+
+// TaskFailureSpikeThreshold 最近 TaskFailureSpikeWindowMinutes 分钟内失败的任务数达到该值时发送通知，为 0 时不提醒
+var TaskFailureSpikeThreshold = 0
+
+const TaskFailureSpikeWindowMinutes = 10
+
+func NotificationChannels2JSONString() string {
+	jsonBytes, err := json.Marshal(NotificationChannels)
+	if err != nil {
+		SysError("error marshalling notification channels: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func ParseNotificationChannels(jsonStr string) ([]NotificationChannel, error) {
+	channels := make([]NotificationChannel, 0)
+	if err := json.Unmarshal([]byte(jsonStr), &channels); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, channel := range channels {
+		if channel.Name == "" || channel.Name == NotifyChannelEmail || names[channel.Name] {
+			return nil, fmt.Errorf("通知渠道名称不能为空、重复或为 %s", NotifyChannelEmail)
+		}
+		names[channel.Name] = true
+		switch channel.Type {
+		case NotifyChannelTypeEmail, NotifyChannelTypeTelegram:
+		case NotifyChannelTypeWebhook, NotifyChannelTypeDingTalk, NotifyChannelTypeFeishu, NotifyChannelTypeSlack:
+			if channel.Url == "" {
+				return nil, fmt.Errorf("通知渠道 %s 缺少 url", channel.Name)
+			}
+		default:
+			return nil, fmt.Errorf("通知渠道 %s 的类型 %s 不支持", channel.Name, channel.Type)
+		}
+	}
+	return channels, nil
+}
+
+// MaskNotificationChannels 隐藏通知渠道配置中的 secret 与 token，用于管理接口展示
+func MaskNotificationChannels(jsonStr string) string {
+	channels := make([]NotificationChannel, 0)
+	if err := json.Unmarshal([]byte(jsonStr), &channels); err != nil {
+		return "[]"
+	}
+	for i := range channels {
+		channels[i].Secret = MaskSecret(channels[i].Secret)
+		channels[i].Token = MaskSecret(channels[i].Token)
+	}
+	jsonBytes, _ := json.Marshal(channels)
+	return string(jsonBytes)
+}
+
+// RestoreNotificationChannelSecrets 校验提交的通知渠道配置，secret 或 token 为已保存的同名渠道隐藏后的值时保留已保存的值
+func RestoreNotificationChannelSecrets(jsonStr string) (string, error) {
+	channels, err := ParseNotificationChannels(jsonStr)
+	if err != nil {
+		return "", err
+	}
+	saved := make(map[string]NotificationChannel, len(NotificationChannels))
+	for _, channel := range NotificationChannels {
+		saved[channel.Name] = channel
+	}
+	for i, channel := range channels {
+		old, ok := saved[channel.Name]
+		if !ok {
+			continue
+		}
+		if channel.Secret != "" && channel.Secret == MaskSecret(old.Secret) {
+			channels[i].Secret = old.Secret
+		}
+		if channel.Token != "" && channel.Token == MaskSecret(old.Token) {
+			channels[i].Token = old.Token
+		}
+	}
+	jsonBytes, err := json.Marshal(channels)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func NotificationRules2JSONString() string {
+	jsonBytes, err := json.Marshal(NotificationRules)
+	if err != nil {
+		SysError("error marshalling notification rules: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func ParseNotificationRules(jsonStr string) (map[string][]string, error) {
+	rules := make(map[string][]string)
+	if err := json.Unmarshal([]byte(jsonStr), &rules); err != nil {
+		return nil, err
+	}
+	for event := range rules {
+		if _, ok := defaultNotificationTemplates[event]; !ok {
+			return nil, fmt.Errorf("通知事件 %s 不存在", event)
+		}
+	}
+	return rules, nil
+}
+
+func NotificationTemplates2JSONString() string {
+	jsonBytes, err := json.Marshal(NotificationTemplates)
+	if err != nil {
+		SysError("error marshalling notification templates: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func ParseNotificationTemplates(jsonStr string) (map[string]NotificationTemplate, error) {
+	templates := make(map[string]NotificationTemplate)
+	if err := json.Unmarshal([]byte(jsonStr), &templates); err != nil {
+		return nil, err
+	}
+	for event, tmpl := range templates {
+		for _, text := range []string{tmpl.Title, tmpl.Content} {
+			if _, err := template.New(event).Parse(text); err != nil {
+				return nil, fmt.Errorf("事件 %s 的模板不合法：%s", event, err.Error())
+			}
+		}
+	}
+	return templates, nil
+}
+
+// GetNotificationTemplate 返回事件的模板，未自定义的部分使用默认模板
+func GetNotificationTemplate(event string) NotificationTemplate {
+	tmpl := defaultNotificationTemplates[event]
+	if custom, ok := NotificationTemplates[event]; ok {
+		if custom.Title != "" {
+			tmpl.Title = custom.Title
+		}
+		if custom.Content != "" {
+			tmpl.Content = custom.Content
+		}
+	}
+	return tmpl
+}
+
+// GetNotificationChannel 按名称查找通知渠道，email 为内置的邮件渠道
+func GetNotificationChannel(name string) (NotificationChannel, bool) {
+	if name == NotifyChannelEmail {
+		return NotificationChannel{Name: NotifyChannelEmail, Type: NotifyChannelTypeEmail}, true
+	}
+	for _, channel := range NotificationChannels {
+		if channel.Name == name {
+			return channel, true
+		}
+	}
+	return NotificationChannel{}, false
+}
@@ -0,0 +1,149 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNotificationChannels(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr bool
+	}{
+		{name: "empty", json: `[]`},
+		{name: "all types", json: `[{"name":"hook","type":"webhook","url":"https://example.com"},{"name":"tg","type":"telegram","chat_id":"1"},{"name":"ding","type":"dingtalk","url":"https://example.com"},{"name":"fs","type":"feishu","url":"https://example.com"},{"name":"slack","type":"slack","url":"https://example.com"},{"name":"ops","type":"email","to":"ops@example.com"}]`},
+		{name: "invalid json", json: `{`, wantErr: true},
+		{name: "empty name", json: `[{"name":"","type":"telegram"}]`, wantErr: true},
+		{name: "builtin email name", json: `[{"name":"email","type":"email"}]`, wantErr: true},
+		{name: "duplicate name", json: `[{"name":"tg","type":"telegram"},{"name":"tg","type":"telegram"}]`, wantErr: true},
+		{name: "webhook without url", json: `[{"name":"hook","type":"webhook"}]`, wantErr: true},
+		{name: "dingtalk without url", json: `[{"name":"ding","type":"dingtalk"}]`, wantErr: true},
+		{name: "feishu without url", json: `[{"name":"fs","type":"feishu"}]`, wantErr: true},
+		{name: "slack without url", json: `[{"name":"slack","type":"slack"}]`, wantErr: true},
+		{name: "unknown type", json: `[{"name":"x","type":"sms"}]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		_, err := ParseNotificationChannels(tt.json)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: ParseNotificationChannels error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseNotificationRules(t *testing.T) {
+	rules, err := ParseNotificationRules(`{"channel_disabled":["email","hook"],"payment_received":[]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rules[NotifyEventChannelDisabled]; len(got) != 2 || got[0] != NotifyChannelEmail || got[1] != "hook" {
+		t.Errorf("rules[%s] = %v, want [email hook]", NotifyEventChannelDisabled, got)
+	}
+	if _, err = ParseNotificationRules(`{"unknown_event":["email"]}`); err == nil {
+		t.Error("ParseNotificationRules accepted an unknown event")
+	}
+	if _, err = ParseNotificationRules(`{"channel_disabled":"email"}`); err == nil {
+		t.Error("ParseNotificationRules accepted a non-list channel")
+	}
+}
+
+func TestParseNotificationTemplates(t *testing.T) {
+	if _, err := ParseNotificationTemplates(`{"channel_disabled":{"title":"{{.channel_name}} 已禁用","content":""}}`); err != nil {
+		t.Errorf("ParseNotificationTemplates rejected a valid template: %v", err)
+	}
+	if _, err := ParseNotificationTemplates(`{"channel_disabled":{"title":"{{.channel_name","content":""}}`); err == nil {
+		t.Error("ParseNotificationTemplates accepted an invalid title")
+	}
+	if _, err := ParseNotificationTemplates(`{"channel_disabled":{"title":"","content":"{{if .reason}}"}}`); err == nil {
+		t.Error("ParseNotificationTemplates accepted an invalid content")
+	}
+}
+
+func TestGetNotificationTemplate(t *testing.T) {
+	defer func() {
+		NotificationTemplates = map[string]NotificationTemplate{}
+	}()
+	NotificationTemplates = map[string]NotificationTemplate{
+		NotifyEventChannelDisabled: {Title: "自定义标题"},
+	}
+	tmpl := GetNotificationTemplate(NotifyEventChannelDisabled)
+	if tmpl.Title != "自定义标题" {
+		t.Errorf("Title = %q, want the custom title", tmpl.Title)
+	}
+	// 未自定义的部分使用默认模板
+	if tmpl.Content != defaultNotificationTemplates[NotifyEventChannelDisabled].Content {
+		t.Errorf("Content = %q, want the default content", tmpl.Content)
+	}
+	if tmpl = GetNotificationTemplate(NotifyEventChannelEnabled); tmpl != defaultNotificationTemplates[NotifyEventChannelEnabled] {
+		t.Errorf("GetNotificationTemplate(%s) = %+v, want the default template", NotifyEventChannelEnabled, tmpl)
+	}
+}
+
+func TestGetNotificationChannel(t *testing.T) {
+	defer func() {
+		NotificationChannels = []NotificationChannel{}
+	}()
+	NotificationChannels = []NotificationChannel{{Name: "hook", Type: NotifyChannelTypeWebhook, Url: "https://example.com"}}
+	if channel, ok := GetNotificationChannel(NotifyChannelEmail); !ok || channel.Type != NotifyChannelTypeEmail {
+		t.Errorf("GetNotificationChannel(email) = %+v, %v, want the builtin email channel", channel, ok)
+	}
+	if channel, ok := GetNotificationChannel("hook"); !ok || channel.Url != "https://example.com" {
+		t.Errorf("GetNotificationChannel(hook) = %+v, %v, want the configured channel", channel, ok)
+	}
+	if _, ok := GetNotificationChannel("missing"); ok {
+		t.Error("GetNotificationChannel found a channel that is not configured")
+	}
+}
+
+func TestMaskAndRestoreNotificationChannelSecrets(t *testing.T) {
+	defer func() {
+		NotificationChannels = []NotificationChannel{}
+	}()
+	NotificationChannels = []NotificationChannel{
+		{Name: "hook", Type: NotifyChannelTypeWebhook, Url: "https://example.com", Secret: "webhook-secret-value"},
+		{Name: "tg", Type: NotifyChannelTypeTelegram, Token: "123456:telegram-token", ChatId: "1"},
+	}
+	masked := MaskNotificationChannels(NotificationChannels2JSONString())
+	if strings.Contains(masked, "webhook-secret-value") || strings.Contains(masked, "123456:telegram-token") {
+		t.Fatalf("MaskNotificationChannels leaked a secret: %s", masked)
+	}
+	if got := MaskNotificationChannels("{"); got != "[]" {
+		t.Errorf("MaskNotificationChannels(invalid) = %q, want []", got)
+	}
+
+	// 提交隐藏后的值时保留已保存的值
+	restored, err := RestoreNotificationChannelSecrets(masked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	channels, err := ParseNotificationChannels(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channels[0].Secret != "webhook-secret-value" || channels[1].Token != "123456:telegram-token" {
+		t.Errorf("RestoreNotificationChannelSecrets(masked) = %s, want the saved secrets", restored)
+	}
+
+	// 提交新的值或清空时使用提交的值
+	restored, err = RestoreNotificationChannelSecrets(`[{"name":"hook","type":"webhook","url":"https://example.com","secret":"new-secret-value"},{"name":"tg","type":"telegram","chat_id":"1"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	channels, _ = ParseNotificationChannels(restored)
+	if channels[0].Secret != "new-secret-value" || channels[1].Token != "" {
+		t.Errorf("RestoreNotificationChannelSecrets(new) = %s, want the submitted secrets", restored)
+	}
+
+	// 隐藏后的值不会套用到其他名称的渠道
+	restored, err = RestoreNotificationChannelSecrets(`[{"name":"other","type":"webhook","url":"https://example.com","secret":"` + MaskSecret("webhook-secret-value") + `"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(restored, "webhook-secret-value") {
+		t.Errorf("RestoreNotificationChannelSecrets restored a secret for another channel: %s", restored)
+	}
+
+	if _, err = RestoreNotificationChannelSecrets(`[{"name":"hook","type":"webhook"}]`); err == nil {
+		t.Error("RestoreNotificationChannelSecrets accepted an invalid channel")
+	}
+}
@@ -27,6 +27,7 @@ func InitRedisClient() (err error) {
 		FatalLog("failed to parse Redis connection string: " + err.Error())
 	}
 	RDB = redis.NewClient(opt)
+	RDB.AddHook(redisMetricsHook{})
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -38,6 +39,33 @@ func InitRedisClient() (err error) {
 	return err
 }
 
+// redisMetricsHook 统计执行失败的 Redis 命令，键不存在（redis.Nil）不计为错误
+type redisMetricsHook struct{}
+
+func (redisMetricsHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (redisMetricsHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		MetricsRecordRedisError(cmd.Name())
+	}
+	return nil
+}
+
+func (redisMetricsHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (redisMetricsHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && err != redis.Nil {
+			MetricsRecordRedisError(cmd.Name())
+		}
+	}
+	return nil
+}
+
 func ParseRedisOption() *redis.Options {
 	opt, err := redis.ParseURL(os.Getenv("REDIS_CONN_STRING"))
 	if err != nil {
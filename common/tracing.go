@@ -0,0 +1,116 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingExporter 链路追踪的导出方式：otlp 通过 OTLP/HTTP 上报到 OTEL_EXPORTER_OTLP_ENDPOINT，
+// stdout 输出到标准输出便于本地调试，为空时不记录 span
+var TracingExporter = strings.ToLower(os.Getenv("TRACING_EXPORTER"))
+
+var tracer = otel.Tracer("one-api")
+
+// InitTracer 初始化链路追踪，返回的函数在退出前调用以导出剩余的 span。
+// 未开启时同样透传入站请求的 W3C trace context，上游仍能与调用方的链路关联
+func InitTracer() (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch TracingExporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background())
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter: %s", TracingExporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "new-api"
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String(serviceName),
+		semconv.ServiceVersionKey.String(Version),
+	))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	SysLog("tracing enabled with exporter " + TracingExporter)
+	return provider.Shutdown, nil
+}
+
+// StartSpan 以 ctx 中的 span 为父开始一个新的 span
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartRequestSpan 以请求当前的 context 为父开始 span，并让请求在 span 结束前使用新的 context。
+// 返回的 end 可重复调用，结束 span 并恢复请求原来的 context；请求已被中止时 span 标记为错误
+func StartRequestSpan(c *gin.Context, name string, attrs ...attribute.KeyValue) (trace.Span, func()) {
+	parent := c.Request.Context()
+	ctx, span := StartSpan(parent, name, attrs...)
+	c.Request = c.Request.WithContext(ctx)
+	ended := false
+	return span, func() {
+		if ended {
+			return
+		}
+		ended = true
+		if c.IsAborted() {
+			span.SetStatus(codes.Error, fmt.Sprintf("aborted with status %d", c.Writer.Status()))
+		}
+		span.End()
+		c.Request = c.Request.WithContext(parent)
+	}
+}
+
+// SetSpanError 记录错误并将 span 标记为失败
+func SetSpanError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// ExtractTraceContext 从请求头中读取调用方的 W3C trace context
+func ExtractTraceContext(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// InjectTraceContext 把 ctx 中的 trace context 以 W3C traceparent 请求头写入上游请求
+func InjectTraceContext(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// TraceId 返回 ctx 中 span 的 trace id，没有有效的 span 时返回空字符串
+func TraceId(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
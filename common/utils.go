@@ -247,3 +247,11 @@ func StrToMap(str string) map[string]interface{} {
 	}
 	return m
 }
+
+// MaskSecret 隐藏密钥的中间部分，较短的密钥全部隐藏
+func MaskSecret(value string) string {
+	if len(value) <= 8 {
+		return strings.Repeat("*", len(value))
+	}
+	return value[:4] + strings.Repeat("*", 8) + value[len(value)-4:]
+}
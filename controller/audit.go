@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func auditLogQueryParams(c *gin.Context) model.AuditLogQueryParams {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return model.AuditLogQueryParams{
+		OperatorName:   c.Query("operator"),
+		Action:         c.Query("action"),
+		TargetType:     c.Query("target_type"),
+		TargetId:       c.Query("target_id"),
+		Keyword:        c.Query("keyword"),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+	}
+}
+
+func GetAuditLogs(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if p < 0 {
+		p = 0
+	}
+	if pageSize <= 0 {
+		pageSize = common.ItemsPerPage
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	logs, err := model.GetAuditLogs(auditLogQueryParams(c), p*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    logs,
+	})
+}
+
+// ExportAuditLogs 以 CSV 格式导出符合条件的审计日志
+func ExportAuditLogs(c *gin.Context) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=audit-%s.csv", time.Now().Format("20060102150405")))
+	c.Status(http.StatusOK)
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"id", "created_at", "operator_id", "operator_name", "ip", "action", "target_type", "target_id", "content", "changes"})
+	err := model.ExportAuditLogs(auditLogQueryParams(c), func(logs []*model.AuditLog) error {
+		for _, log := range logs {
+			err := writer.Write([]string{
+				strconv.Itoa(log.Id),
+				time.Unix(log.CreatedAt, 0).Format(time.RFC3339),
+				strconv.Itoa(log.OperatorId),
+				log.OperatorName,
+				log.Ip,
+				log.Action,
+				log.TargetType,
+				log.TargetId,
+				log.Content,
+				log.Changes,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		common.LogError(c.Request.Context(), "failed to export audit logs: "+err.Error())
+	}
+	writer.Flush()
+}
@@ -0,0 +1,327 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	batchCompletionWindow = "24h"
+	maxBatchRequests      = 50000
+)
+
+var batchEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/embeddings":       true,
+}
+
+// batchStatus 将任务状态转换为 OpenAI 批处理状态
+func batchStatus(status model.TaskStatus) string {
+	switch status {
+	case model.TaskStatusNotStart:
+		return "validating"
+	case model.TaskStatusInProgress:
+		return "in_progress"
+	case model.TaskStatusSuccess:
+		return "completed"
+	case model.TaskStatusFailure:
+		return "failed"
+	case model.TaskStatusCancelling:
+		return "cancelling"
+	case model.TaskStatusCancelled:
+		return "cancelled"
+	}
+	return "in_progress"
+}
+
+func batchTask2OpenAIBatch(task *model.Task) dto.OpenAIBatch {
+	var data dto.BatchTaskData
+	_ = task.GetData(&data)
+	batch := dto.OpenAIBatch{
+		Id:               task.TaskID,
+		Object:           "batch",
+		Endpoint:         data.Endpoint,
+		InputFileId:      data.InputFileId,
+		CompletionWindow: data.CompletionWindow,
+		Status:           batchStatus(task.Status),
+		CreatedAt:        task.SubmitTime,
+		RequestCounts:    data.RequestCounts,
+		Metadata:         data.Metadata,
+	}
+	expiresAt := task.SubmitTime + 24*60*60
+	batch.ExpiresAt = &expiresAt
+	if task.StartTime > 0 {
+		batch.InProgressAt = &task.StartTime
+	}
+	if data.OutputFileId != "" {
+		batch.OutputFileId = &data.OutputFileId
+	}
+	if data.ErrorFileId != "" {
+		batch.ErrorFileId = &data.ErrorFileId
+	}
+	if data.CancellingAt > 0 {
+		batch.CancellingAt = &data.CancellingAt
+	}
+	if len(data.Errors) > 0 {
+		batch.Errors = &dto.BatchErrors{Object: "list", Data: data.Errors}
+	}
+	if task.FinishTime > 0 {
+		switch task.Status {
+		case model.TaskStatusSuccess:
+			batch.CompletedAt = &task.FinishTime
+		case model.TaskStatusFailure:
+			batch.FailedAt = &task.FinishTime
+		case model.TaskStatusCancelled:
+			batch.CancelledAt = &task.FinishTime
+		}
+	}
+	return batch
+}
+
+// validateBatchInputFile 校验输入文件的每一行并返回请求数
+func validateBatchInputFile(file *model.File, endpoint string) (int, *dto.BatchError) {
+	reader, err := service.GetFileStorage().Open(file.StorageKey)
+	if err != nil {
+		return 0, &dto.BatchError{Code: "file_not_found", Message: err.Error()}
+	}
+	defer reader.Close()
+	bufReader := bufio.NewReader(reader)
+	customIds := make(map[string]bool)
+	total := 0
+	for lineNum := 1; ; lineNum++ {
+		line, err := bufReader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return 0, &dto.BatchError{Code: "file_read_error", Message: err.Error()}
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			var request dto.BatchRequestLine
+			if jsonErr := json.Unmarshal(line, &request); jsonErr != nil {
+				return 0, &dto.BatchError{Code: "invalid_json_line", Message: "This line is not parseable as valid JSON.", Line: lineNum}
+			}
+			if request.CustomId == "" {
+				return 0, &dto.BatchError{Code: "missing_required_parameter", Message: "Missing required parameter: 'custom_id'.", Param: "custom_id", Line: lineNum}
+			}
+			if customIds[request.CustomId] {
+				return 0, &dto.BatchError{Code: "duplicate_custom_id", Message: "The custom_id for this request is a duplicate of another request.", Param: "custom_id", Line: lineNum}
+			}
+			customIds[request.CustomId] = true
+			if request.Method != http.MethodPost {
+				return 0, &dto.BatchError{Code: "invalid_method", Message: "The method must be POST.", Param: "method", Line: lineNum}
+			}
+			if request.Url != endpoint {
+				return 0, &dto.BatchError{Code: "mismatched_endpoint", Message: fmt.Sprintf("The url must match the batch endpoint %s.", endpoint), Param: "url", Line: lineNum}
+			}
+			var body struct {
+				Model  string `json:"model"`
+				Stream bool   `json:"stream"`
+			}
+			if len(request.Body) == 0 || json.Unmarshal(request.Body, &body) != nil {
+				return 0, &dto.BatchError{Code: "invalid_request", Message: "The body must be a JSON object.", Param: "body", Line: lineNum}
+			}
+			if body.Model == "" {
+				return 0, &dto.BatchError{Code: "missing_required_parameter", Message: "Missing required parameter: 'body.model'.", Param: "body.model", Line: lineNum}
+			}
+			if body.Stream {
+				return 0, &dto.BatchError{Code: "invalid_request", Message: "Streaming is not supported in batch requests.", Param: "body.stream", Line: lineNum}
+			}
+			total++
+			if total > maxBatchRequests {
+				return 0, &dto.BatchError{Code: "too_many_requests", Message: fmt.Sprintf("The batch input file contains more than %d requests.", maxBatchRequests)}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if total == 0 {
+		return 0, &dto.BatchError{Code: "empty_file", Message: "The batch input file is empty."}
+	}
+	return total, nil
+}
+
+func getUserBatchTask(c *gin.Context) (*model.Task, bool) {
+	task, exist, err := model.GetByTaskId(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(err, "get_batch_failed", http.StatusInternalServerError))
+		return nil, false
+	}
+	if !exist || task.Platform != constant.TaskPlatformBatch {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(fmt.Errorf("no such batch: %s", c.Param("id")), "batch_not_found", http.StatusNotFound))
+		return nil, false
+	}
+	return task, true
+}
+
+func CreateBatch(c *gin.Context) {
+	userId := c.GetInt("id")
+	var request dto.BatchRequest
+	err := c.ShouldBindJSON(&request)
+	if err != nil {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(err, "invalid_batch_request", http.StatusBadRequest))
+		return
+	}
+	if !batchEndpoints[request.Endpoint] {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(fmt.Errorf("unsupported endpoint: %s", request.Endpoint), "invalid_batch_request", http.StatusBadRequest))
+		return
+	}
+	if request.CompletionWindow != batchCompletionWindow {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(errors.New("completion_window must be 24h"), "invalid_batch_request", http.StatusBadRequest))
+		return
+	}
+	file, err := model.GetUserFileById(userId, request.InputFileId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(fmt.Errorf("no such file: %s", request.InputFileId), "file_not_found", http.StatusNotFound))
+		return
+	}
+	if err != nil {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(err, "get_file_failed", http.StatusInternalServerError))
+		return
+	}
+	if file.Purpose != "batch" {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(errors.New("the input file must be uploaded with purpose batch"), "invalid_batch_request", http.StatusBadRequest))
+		return
+	}
+	userQuota, err := model.CacheGetUserQuota(userId)
+	if err != nil {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError))
+		return
+	}
+	if userQuota <= 0 {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden))
+		return
+	}
+
+	total, batchErr := validateBatchInputFile(file, request.Endpoint)
+	if batchErr != nil {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(errors.New(batchErr.Message), batchErr.Code, http.StatusBadRequest))
+		return
+	}
+	task := &model.Task{
+		TaskID:     fmt.Sprintf("batch_%s", common.GetUUID()),
+		Platform:   constant.TaskPlatformBatch,
+		UserId:     userId,
+		Action:     request.Endpoint,
+		Status:     model.TaskStatusNotStart,
+		Progress:   "0%",
+		SubmitTime: common.GetTimestamp(),
+		Properties: model.Properties{Input: request.InputFileId},
+	}
+	task.SetData(dto.BatchTaskData{
+		TokenId:          c.GetInt("token_id"),
+		Endpoint:         request.Endpoint,
+		InputFileId:      request.InputFileId,
+		CompletionWindow: request.CompletionWindow,
+		RequestCounts:    dto.BatchRequestCounts{Total: total},
+		Metadata:         request.Metadata,
+	})
+	err = task.Insert()
+	if err != nil {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(err, "create_batch_failed", http.StatusInternalServerError))
+		return
+	}
+	if common.IsMasterNode {
+		startBatchTask(task)
+	}
+	c.JSON(http.StatusOK, batchTask2OpenAIBatch(task))
+}
+
+func ListBatches(c *gin.Context) {
+	userId := c.GetInt("id")
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	var beforeId int64
+	if after := c.Query("after"); after != "" {
+		task, exist, err := model.GetByTaskId(userId, after)
+		if err == nil && exist {
+			beforeId = task.ID
+		}
+	}
+	// 多取一条用于判断是否还有更多
+	tasks, err := model.TaskGetUserTasksBefore(userId, constant.TaskPlatformBatch, beforeId, limit+1)
+	if err != nil {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(err, "get_batches_failed", http.StatusInternalServerError))
+		return
+	}
+	hasMore := len(tasks) > limit
+	if hasMore {
+		tasks = tasks[:limit]
+	}
+	list := dto.OpenAIBatchList{
+		Object:  "list",
+		Data:    make([]dto.OpenAIBatch, 0, len(tasks)),
+		HasMore: hasMore,
+	}
+	for _, task := range tasks {
+		list.Data = append(list.Data, batchTask2OpenAIBatch(task))
+	}
+	if len(tasks) > 0 {
+		list.FirstId = &tasks[0].TaskID
+		list.LastId = &tasks[len(tasks)-1].TaskID
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func RetrieveBatch(c *gin.Context) {
+	task, ok := getUserBatchTask(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, batchTask2OpenAIBatch(task))
+}
+
+func CancelBatch(c *gin.Context) {
+	task, ok := getUserBatchTask(c)
+	if !ok {
+		return
+	}
+	now := common.GetTimestamp()
+	switch task.Status {
+	case model.TaskStatusNotStart:
+		if cancelRunningBatchTask(task.TaskID) {
+			// 任务已在本节点开始执行，由执行协程负责收尾
+			task.Status = model.TaskStatusCancelling
+			break
+		}
+		task.Status = model.TaskStatusCancelled
+		task.Progress = "100%"
+		task.FinishTime = now
+	case model.TaskStatusInProgress:
+		task.Status = model.TaskStatusCancelling
+		cancelRunningBatchTask(task.TaskID)
+	case model.TaskStatusCancelling, model.TaskStatusCancelled:
+		c.JSON(http.StatusOK, batchTask2OpenAIBatch(task))
+		return
+	default:
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(fmt.Errorf("cannot cancel a batch with status %s", batchStatus(task.Status)), "invalid_batch_status", http.StatusConflict))
+		return
+	}
+	err := updateBatchTaskData(task, func(data *dto.BatchTaskData) {
+		data.CancellingAt = now
+	}, map[string]any{
+		"status":      task.Status,
+		"progress":    task.Progress,
+		"finish_time": task.FinishTime,
+	})
+	if err != nil {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(err, "cancel_batch_failed", http.StatusInternalServerError))
+		return
+	}
+	c.JSON(http.StatusOK, batchTask2OpenAIBatch(task))
+}
@@ -282,6 +282,9 @@ func UpdateChannelBalance(c *gin.Context) {
 		})
 		return
 	}
+	if balance > 0 {
+		service.NotifyChannelBalanceLow(channel.Id, channel.Name, balance)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -310,6 +313,8 @@ func updateAllChannelsBalance() error {
 			// err is nil & balance <= 0 means quota is used up
 			if balance <= 0 {
 				service.DisableChannel(channel.Id, channel.Name, "余额不足")
+			} else {
+				service.NotifyChannelBalanceLow(channel.Id, channel.Name, balance)
 			}
 		}
 		time.Sleep(common.RequestInterval)
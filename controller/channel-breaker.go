@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetChannelBreakers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"enabled":  common.ChannelBreakerEnabled,
+			"breakers": model.GetChannelBreakerStatuses(),
+		},
+	})
+}
+
+type ChannelBreakerResetRequest struct {
+	ChannelId int    `json:"channel_id"`
+	Model     string `json:"model"`
+}
+
+func ResetChannelBreaker(c *gin.Context) {
+	request := ChannelBreakerResetRequest{}
+	err := c.ShouldBindJSON(&request)
+	if err != nil || request.ChannelId == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "参数错误",
+		})
+		return
+	}
+	count := model.ResetChannelBreaker(request.ChannelId, request.Model)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    count,
+	})
+}
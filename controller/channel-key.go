@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"one-api/service"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetChannelKeys(c *gin.Context) {
+	channelId, _ := strconv.Atoi(c.Param("id"))
+	keys, err := model.GetChannelKeys(channelId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// 管理接口只展示隐藏中间部分的密钥
+	for _, key := range keys {
+		key.Key = key.MaskedKey()
+	}
+	service.RecordAudit(c, "channel.key.view", "channel", channelId, fmt.Sprintf("查看渠道密钥池，共 %d 个密钥", len(keys)), nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    keys,
+	})
+}
+
+type AddChannelKeysRequest struct {
+	// Keys 每行一个密钥
+	Keys string `json:"keys"`
+}
+
+func AddChannelKeys(c *gin.Context) {
+	channelId, _ := strconv.Atoi(c.Param("id"))
+	request := AddChannelKeysRequest{}
+	err := c.ShouldBindJSON(&request)
+	if err != nil || strings.TrimSpace(request.Keys) == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "参数错误",
+		})
+		return
+	}
+	if _, err = model.GetChannelById(channelId, false); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "渠道不存在",
+		})
+		return
+	}
+	count, err := model.AddChannelKeys(channelId, strings.Split(request.Keys, "\n"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	service.RecordAudit(c, "channel.key.add", "channel", channelId, fmt.Sprintf("向渠道密钥池添加 %d 个密钥", count), nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    count,
+	})
+}
+
+func DeleteChannelKey(c *gin.Context) {
+	channelId, _ := strconv.Atoi(c.Param("id"))
+	keyId, _ := strconv.Atoi(c.Param("key_id"))
+	err := model.DeleteChannelKey(channelId, keyId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	service.RecordAudit(c, "channel.key.delete", "channel", channelId, fmt.Sprintf("删除渠道密钥 #%d", keyId), nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+type UpdateChannelKeyStatusRequest struct {
+	Status int `json:"status"`
+}
+
+func UpdateChannelKeyStatus(c *gin.Context) {
+	channelId, _ := strconv.Atoi(c.Param("id"))
+	keyId, _ := strconv.Atoi(c.Param("key_id"))
+	request := UpdateChannelKeyStatusRequest{}
+	err := c.ShouldBindJSON(&request)
+	if err != nil || (request.Status != common.ChannelStatusEnabled && request.Status != common.ChannelStatusManuallyDisabled) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "参数错误",
+		})
+		return
+	}
+	err = model.UpdateChannelKeyStatus(channelId, keyId, request.Status, "")
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	service.RecordAudit(c, "channel.key.status", "channel", channelId, fmt.Sprintf("修改渠道密钥 #%d 的状态为 %d", keyId, request.Status), nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -0,0 +1,380 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/model"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 能力探测：对渠道的每个模型依次发送流式、系统提示词、工具调用、n=2/logprobs、图片与逐档加长的上下文请求，
+// 按结果更新渠道与 abilities 中的能力字段。与能力无关的失败（网络错误、限流、5xx 等）不修改原有设置
+
+const (
+	capabilityPassed  = "passed"
+	capabilityFailed  = "failed"
+	capabilityUnknown = "unknown"
+)
+
+// capabilityProbeContextSteps 上下文探测请求的提示词 token 数，从小到大依次发送，上游拒绝时停止并从错误信息中解析上限，
+// 全部接受时说明上下文不小于最后一档。每档请求按提示词 token 数计费，全部接受时每个模型约消耗 168K 提示词 token
+var capabilityProbeContextSteps = []int{8 * 1024, 32 * 1024, 128 * 1024}
+
+// capabilityProbeImage 1x1 的 PNG 图片
+const capabilityProbeImage = "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8z8BQDwAEhQGAhKmMIQAAAABJRU5ErkJggg=="
+
+var contextLimitNumberRegex = regexp.MustCompile(`\d+`)
+
+type capabilityProbeResult struct {
+	Name    string `json:"name"`
+	Result  string `json:"result"`
+	Message string `json:"message,omitempty"`
+}
+
+// capabilityProbeReport 单个模型的探测报告，ContextWindow 为探测到的上下文窗口，0 表示未探测到，
+// contextWindowAtLeast 表示上游接受了探测请求，ContextWindow 只是窗口的下限
+type capabilityProbeReport struct {
+	Model         string                   `json:"model"`
+	Error         string                   `json:"error,omitempty"`
+	Probes        []*capabilityProbeResult `json:"probes"`
+	ContextWindow int                      `json:"context_window"`
+
+	contextWindowAtLeast bool
+}
+
+type capabilityProbe struct {
+	name   string
+	column string
+	build  func(request *dto.GeneralOpenAIRequest)
+	check  func(response *testResponse) error
+}
+
+var capabilityProbes = []capabilityProbe{
+	{
+		name:   "stream",
+		column: "is_support_stream",
+		build: func(request *dto.GeneralOpenAIRequest) {
+			request.Stream = true
+		},
+		check: func(response *testResponse) error {
+			if !response.Stream {
+				return errors.New("response is not a stream")
+			}
+			return nil
+		},
+	},
+	{
+		name:   "system_prompt",
+		column: "is_support_system_prompt",
+		build: func(request *dto.GeneralOpenAIRequest) {
+			content, _ := json.Marshal("You are a helpful assistant.")
+			request.Messages = append([]dto.Message{{Role: "system", Content: content}}, request.Messages...)
+		},
+	},
+	{
+		name:   "function_call",
+		column: "is_support_function_call",
+		build: func(request *dto.GeneralOpenAIRequest) {
+			content, _ := json.Marshal("What is the weather like in Paris?")
+			request.Messages = []dto.Message{{Role: "user", Content: content}}
+			request.MaxTokens = 64
+			request.Tools = []dto.OpenAITools{{
+				Type: "function",
+				Function: dto.OpenAIFunction{
+					Description: "Get the current weather in a given city",
+					Name:        "get_weather",
+					Parameters: map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"city": map[string]any{"type": "string"},
+						},
+						"required": []string{"city"},
+					},
+				},
+			}}
+			request.ToolChoice = map[string]any{"type": "function", "function": map[string]any{"name": "get_weather"}}
+		},
+		check: func(response *testResponse) error {
+			choices, err := parseProbeChoices(response)
+			if err != nil {
+				return err
+			}
+			for _, choice := range choices {
+				if len(choice.Message.ToolCalls) > 0 {
+					return nil
+				}
+			}
+			return errors.New("no tool calls in response")
+		},
+	},
+	{
+		name:   "nor_logprobs",
+		column: "is_support_nor_logprobs",
+		build: func(request *dto.GeneralOpenAIRequest) {
+			request.N = 2
+			request.LogProbs = true
+		},
+		check: func(response *testResponse) error {
+			choices, err := parseProbeChoices(response)
+			if err != nil {
+				return err
+			}
+			if len(choices) < 2 {
+				return fmt.Errorf("expected 2 choices, got %d", len(choices))
+			}
+			for _, choice := range choices {
+				if len(choice.Logprobs) == 0 || string(choice.Logprobs) == "null" {
+					return errors.New("no logprobs in response")
+				}
+			}
+			return nil
+		},
+	},
+	{
+		name:   "image",
+		column: "is_image",
+		build: func(request *dto.GeneralOpenAIRequest) {
+			content, _ := json.Marshal([]dto.MediaMessage{
+				{Type: dto.ContentTypeText, Text: "What color is this image?"},
+				{Type: dto.ContentTypeImageURL, ImageUrl: dto.MessageImageUrl{Url: capabilityProbeImage, Detail: "low"}},
+			})
+			request.Messages = []dto.Message{{Role: "user", Content: content}}
+		},
+	},
+}
+
+type probeChoice struct {
+	Message struct {
+		ToolCalls []json.RawMessage `json:"tool_calls"`
+	} `json:"message"`
+	Logprobs json.RawMessage `json:"logprobs"`
+}
+
+func parseProbeChoices(response *testResponse) ([]probeChoice, error) {
+	var body struct {
+		Choices []probeChoice `json:"choices"`
+	}
+	if err := json.Unmarshal(response.Body, &body); err != nil {
+		return nil, fmt.Errorf("unmarshal response failed: %w", err)
+	}
+	return body.Choices, nil
+}
+
+// probeFailureResult 请求失败时判断能力是否不支持：上游明确拒绝请求（4xx，鉴权与限流除外）时为不支持，其余情况无法判断
+func probeFailureResult(response *testResponse) string {
+	if response == nil {
+		return capabilityUnknown
+	}
+	switch response.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return capabilityUnknown
+	}
+	if response.StatusCode/100 == 4 {
+		return capabilityFailed
+	}
+	return capabilityUnknown
+}
+
+func runCapabilityProbe(channel *model.Channel, upstreamModel string, probe capabilityProbe) *capabilityProbeResult {
+	result := &capabilityProbeResult{Name: probe.name}
+	request := buildTestRequest()
+	request.Model = upstreamModel
+	probe.build(request)
+	response, err, _ := doTestRequest(channel, request)
+	if err != nil {
+		result.Result = probeFailureResult(response)
+		result.Message = err.Error()
+		return result
+	}
+	if probe.check != nil {
+		if err = probe.check(response); err != nil {
+			result.Result = capabilityFailed
+			result.Message = err.Error()
+			return result
+		}
+	}
+	result.Result = capabilityPassed
+	return result
+}
+
+// probeContextLength 按 capabilityProbeContextSteps 依次发送更长的提示词，在第一次被拒绝时停止，从上游的错误信息中解析上下文窗口，如
+// "maximum context length is 128000 tokens" 或 "prompt is too long: 40000 tokens > 32768 maximum"。
+// 返回的 atLeast 为 true 时上游接受了已发送的请求，上下文窗口只能确定不小于返回值
+func probeContextLength(channel *model.Channel, upstreamModel string) (result *capabilityProbeResult, contextWindow int, atLeast bool) {
+	result = &capabilityProbeResult{Name: "context_length"}
+	accepted := 0
+	for _, tokens := range capabilityProbeContextSteps {
+		request := buildTestRequest()
+		request.Model = upstreamModel
+		content, _ := json.Marshal(strings.Repeat("hi ", tokens))
+		request.Messages = []dto.Message{{Role: "user", Content: content}}
+		response, err, _ := doTestRequest(channel, request)
+		if err == nil {
+			accepted = tokens
+			continue
+		}
+		result.Message = err.Error()
+		if probeFailureResult(response) == capabilityFailed {
+			limit := 0
+			for _, number := range contextLimitNumberRegex.FindAllString(err.Error(), -1) {
+				value, _ := strconv.Atoi(number)
+				if value >= 1024 && value > accepted && value < tokens && (limit == 0 || value < limit) {
+					limit = value
+				}
+			}
+			if limit > 0 {
+				result.Result = capabilityPassed
+				return result, limit, false
+			}
+		}
+		break
+	}
+	if accepted == 0 {
+		result.Result = capabilityUnknown
+		return result, 0, false
+	}
+	result.Result = capabilityPassed
+	result.Message = fmt.Sprintf("accepted %d tokens", accepted)
+	return result, accepted, true
+}
+
+func probeChannelModel(channel *model.Channel, modelName string) *capabilityProbeReport {
+	report := &capabilityProbeReport{Model: modelName, Probes: make([]*capabilityProbeResult, 0, len(capabilityProbes)+1)}
+	upstreamModel, err := mapTestModel(channel, modelName)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	// 基础请求失败时渠道本身不可用，无法判断能力
+	request := buildTestRequest()
+	request.Model = upstreamModel
+	if _, err, _ = doTestRequest(channel, request); err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	for _, probe := range capabilityProbes {
+		report.Probes = append(report.Probes, runCapabilityProbe(channel, upstreamModel, probe))
+	}
+	result, contextWindow, atLeast := probeContextLength(channel, upstreamModel)
+	report.Probes = append(report.Probes, result)
+	report.ContextWindow = contextWindow
+	report.contextWindowAtLeast = atLeast
+	return report
+}
+
+// probeChannelCapabilities 探测渠道各模型的能力并写回：abilities 按模型更新，
+// 渠道本身的能力为所有模型的交集，探测到的上下文窗口写入渠道的模型上下文窗口设置
+func probeChannelCapabilities(channel *model.Channel, models []string) ([]*capabilityProbeReport, error) {
+	reports := make([]*capabilityProbeReport, 0, len(models))
+	channelValues := make(map[string]interface{})
+	contextWindows := channel.GetContextWindows()
+	contextWindowsChanged := false
+	for i, modelName := range models {
+		if i > 0 {
+			time.Sleep(common.RequestInterval)
+		}
+		common.SysLog(fmt.Sprintf("probing capabilities of channel #%d with model %s", channel.Id, modelName))
+		report := probeChannelModel(channel, modelName)
+		reports = append(reports, report)
+		if report.Error != "" {
+			continue
+		}
+		values := make(map[string]interface{})
+		for j, probe := range capabilityProbes {
+			result := report.Probes[j]
+			if result.Result == capabilityUnknown {
+				continue
+			}
+			supported := result.Result == capabilityPassed
+			values[probe.column] = supported
+			if previous, ok := channelValues[probe.column]; !ok || previous.(bool) {
+				channelValues[probe.column] = supported
+			}
+		}
+		if report.ContextWindow > 0 {
+			contextWindow := report.ContextWindow
+			current := contextWindows[modelName]
+			if current <= 0 {
+				current = common.GetModelContextWindow(modelName)
+			}
+			// 上游接受了探测请求时只能确定上下文窗口不小于探测长度，不降低已有的设置
+			if !report.contextWindowAtLeast || current < contextWindow {
+				values["context_window"] = contextWindow
+				contextWindows[modelName] = contextWindow
+				contextWindowsChanged = true
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if err := model.UpdateAbilityCapabilities(channel.Id, modelName, values); err != nil {
+			return reports, err
+		}
+	}
+	if contextWindowsChanged {
+		contextWindowsJSON, _ := json.Marshal(contextWindows)
+		channelValues["context_windows"] = string(contextWindowsJSON)
+	}
+	if len(channelValues) > 0 {
+		if err := channel.UpdateCapabilities(channelValues); err != nil {
+			return reports, err
+		}
+	}
+	if common.MemoryCacheEnabled {
+		model.InitChannelCache()
+	}
+	return reports, nil
+}
+
+func ProbeChannel(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if channel.Type == common.ChannelTypeMidjourney || channel.Type == common.ChannelTypeSunoAPI {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该类型的渠道不支持能力探测",
+		})
+		return
+	}
+	models := strings.Split(channel.Models, ",")
+	if testModel := c.Query("model"); testModel != "" {
+		models = []string{testModel}
+	}
+	reports, err := probeChannelCapabilities(channel, models)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+			"data":    reports,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    reports,
+	})
+}
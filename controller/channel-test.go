@@ -17,6 +17,7 @@ import (
 	"one-api/relay/constant"
 	"one-api/service"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -30,8 +31,74 @@ func testChannel(channel *model.Channel, testModel string) (err error, openaiErr
 	if channel.Type == common.ChannelTypeSunoAPI {
 		return errors.New("suno channel test is not supported"), nil
 	}
+	apiType, _ := constant.ChannelType2APIType(channel.Type)
+	adaptor := relay.GetAdaptor(apiType)
+	if adaptor == nil {
+		return fmt.Errorf("invalid api type: %d, adaptor is nil", apiType), nil
+	}
+	if testModel == "" {
+		if channel.TestModel != nil && *channel.TestModel != "" {
+			testModel = *channel.TestModel
+		} else {
+			testModel = adaptor.GetModelList()[0]
+		}
+	} else {
+		testModel, err = mapTestModel(channel, testModel)
+		if err != nil {
+			openaiErr := service.OpenAIErrorWrapperLocal(err, "unmarshal_model_mapping_failed", http.StatusInternalServerError).Error
+			return err, &openaiErr
+		}
+	}
+
+	request := buildTestRequest()
+	request.Model = testModel
+	common.SysLog(fmt.Sprintf("testing channel %d with model %s", channel.Id, testModel))
+	response, err, openaiErr := doTestRequest(channel, request)
+	if err != nil {
+		return err, openaiErr
+	}
+	common.SysLog(fmt.Sprintf("testing channel #%d, response: \n%s", channel.Id, string(response.Body)))
+	return nil, nil
+}
+
+func mapTestModel(channel *model.Channel, testModel string) (string, error) {
+	if channel.ModelMapping == nil {
+		return testModel, nil
+	}
+	modelMapping := *channel.ModelMapping
+	if modelMapping != "" && modelMapping != "{}" {
+		modelMap := make(map[string]string)
+		err := json.Unmarshal([]byte(modelMapping), &modelMap)
+		if err != nil {
+			return "", err
+		}
+		if modelMap[testModel] != "" {
+			testModel = modelMap[testModel]
+		}
+	}
+	return testModel, nil
+}
+
+// testResponse 测试请求写给客户端的响应，Stream 表示上游是否以流式返回
+type testResponse struct {
+	StatusCode int
+	Stream     bool
+	Body       []byte
+}
+
+// testResponseRecorder 流式响应需要 http.CloseNotifier，测试请求没有客户端连接，不会通知
+type testResponseRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (testResponseRecorder) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+// doTestRequest 使用渠道转发一次测试请求，request.Model 为上游模型名称
+func doTestRequest(channel *model.Channel, request *dto.GeneralOpenAIRequest) (*testResponse, error, *dto.OpenAIError) {
 	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
+	c, _ := gin.CreateTestContext(testResponseRecorder{w})
 	c.Request = &http.Request{
 		Method: "POST",
 		URL:    &url.URL{Path: "/v1/chat/completions"},
@@ -59,69 +126,51 @@ func testChannel(channel *model.Channel, testModel string) (err error, openaiErr
 	apiType, _ := constant.ChannelType2APIType(channel.Type)
 	adaptor := relay.GetAdaptor(apiType)
 	if adaptor == nil {
-		return fmt.Errorf("invalid api type: %d, adaptor is nil", apiType), nil
-	}
-	if testModel == "" {
-		if channel.TestModel != nil && *channel.TestModel != "" {
-			testModel = *channel.TestModel
-		} else {
-			testModel = adaptor.GetModelList()[0]
-		}
-	} else {
-		modelMapping := *channel.ModelMapping
-		if modelMapping != "" && modelMapping != "{}" {
-			modelMap := make(map[string]string)
-			err := json.Unmarshal([]byte(modelMapping), &modelMap)
-			if err != nil {
-				openaiErr := service.OpenAIErrorWrapperLocal(err, "unmarshal_model_mapping_failed", http.StatusInternalServerError).Error
-				return err, &openaiErr
-			}
-			if modelMap[testModel] != "" {
-				testModel = modelMap[testModel]
-			}
-		}
+		return nil, fmt.Errorf("invalid api type: %d, adaptor is nil", apiType), nil
 	}
-
-	request := buildTestRequest()
-	request.Model = testModel
-	meta.UpstreamModelName = testModel
-	common.SysLog(fmt.Sprintf("testing channel %d with model %s", channel.Id, testModel))
+	meta.UpstreamModelName = request.Model
+	meta.IsStream = request.Stream
 
 	adaptor.Init(meta, *request)
 
 	convertedRequest, err := adaptor.ConvertRequest(c, constant.RelayModeChatCompletions, request)
 	if err != nil {
-		return err, nil
+		return nil, err, nil
 	}
 	jsonData, err := json.Marshal(convertedRequest)
 	if err != nil {
-		return err, nil
+		return nil, err, nil
 	}
 	requestBody := bytes.NewBuffer(jsonData)
 	c.Request.Body = io.NopCloser(requestBody)
 	resp, err := adaptor.DoRequest(c, meta, requestBody)
 	if err != nil {
-		return err, nil
+		return nil, err, nil
 	}
-	if resp != nil && resp.StatusCode != http.StatusOK {
-		err := relaycommon.RelayErrorHandler(resp)
-		return fmt.Errorf("status code %d: %s", resp.StatusCode, err.Error.Message), &err.Error
+	response := &testResponse{StatusCode: http.StatusOK}
+	if resp != nil {
+		response.StatusCode = resp.StatusCode
+		if resp.StatusCode != http.StatusOK {
+			err := relaycommon.RelayErrorHandler(resp)
+			return response, fmt.Errorf("status code %d: %s", resp.StatusCode, err.Error.Message), &err.Error
+		}
+		response.Stream = strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+		meta.IsStream = meta.IsStream || response.Stream
 	}
 	usage, respErr := adaptor.DoResponse(c, resp, meta)
 	if respErr != nil {
-		return fmt.Errorf("%s", respErr.Error.Message), &respErr.Error
+		response.StatusCode = respErr.StatusCode
+		return response, fmt.Errorf("%s", respErr.Error.Message), &respErr.Error
 	}
 	if usage == nil {
-		return errors.New("usage is nil"), nil
+		return response, errors.New("usage is nil"), nil
 	}
 	result := w.Result()
-	// print result.Body
-	respBody, err := io.ReadAll(result.Body)
+	response.Body, err = io.ReadAll(result.Body)
 	if err != nil {
-		return err, nil
+		return response, err, nil
 	}
-	common.SysLog(fmt.Sprintf("testing channel #%d, response: \n%s", channel.Id, string(respBody)))
-	return nil, nil
+	return response, nil, nil
 }
 
 func buildTestRequest() *dto.GeneralOpenAIRequest {
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"one-api/common"
 	"one-api/model"
+	"one-api/service"
 	"strconv"
 	"strings"
 
@@ -187,9 +188,15 @@ func GetChannel(c *gin.Context) {
 	return
 }
 
+type AddChannelRequest struct {
+	model.Channel
+	// MultiKey 为 true 时多行密钥作为一个渠道的密钥池，否则每行密钥创建一个渠道
+	MultiKey bool `json:"multi_key"`
+}
+
 func AddChannel(c *gin.Context) {
-	channel := model.Channel{}
-	err := c.ShouldBindJSON(&channel)
+	request := AddChannelRequest{}
+	err := c.ShouldBindJSON(&request)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -197,8 +204,13 @@ func AddChannel(c *gin.Context) {
 		})
 		return
 	}
+	channel := request.Channel
 	channel.CreatedTime = common.GetTimestamp()
 	keys := strings.Split(channel.Key, "\n")
+	if request.MultiKey {
+		addMultiKeyChannel(c, channel, keys)
+		return
+	}
 	channels := make([]model.Channel, 0, len(keys))
 	for _, key := range keys {
 		if key == "" {
@@ -216,6 +228,9 @@ func AddChannel(c *gin.Context) {
 		})
 		return
 	}
+	for _, channel := range channels {
+		service.RecordAudit(c, "channel.create", "channel", channel.Id, "创建渠道 "+channel.Name, service.AuditDiff(nil, channel))
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -223,8 +238,44 @@ func AddChannel(c *gin.Context) {
 	return
 }
 
+// addMultiKeyChannel 创建一个渠道并将所有密钥加入其密钥池，渠道本身的密钥为第一个密钥
+func addMultiKeyChannel(c *gin.Context, channel model.Channel, keys []string) {
+	channelKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			channelKeys = append(channelKeys, key)
+		}
+	}
+	if len(channelKeys) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "密钥不能为空",
+		})
+		return
+	}
+	channel.Key = channelKeys[0]
+	err := channel.Insert()
+	if err == nil {
+		_, err = model.AddChannelKeys(channel.Id, channelKeys)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	service.RecordAudit(c, "channel.create", "channel", channel.Id, fmt.Sprintf("创建渠道 %s，密钥池共 %d 个密钥", channel.Name, len(channelKeys)), service.AuditDiff(nil, channel))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
 func DeleteChannel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	origin, _ := model.GetChannelById(id, false)
 	channel := model.Channel{Id: id}
 	err := channel.Delete()
 	if err != nil {
@@ -234,6 +285,7 @@ func DeleteChannel(c *gin.Context) {
 		})
 		return
 	}
+	service.RecordAudit(c, "channel.delete", "channel", id, "删除渠道 "+origin.Name, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -250,6 +302,7 @@ func DeleteDisabledChannel(c *gin.Context) {
 		})
 		return
 	}
+	service.RecordAudit(c, "channel.delete_disabled", "channel", nil, fmt.Sprintf("删除所有已禁用的渠道，共 %d 个", rows), nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -280,6 +333,7 @@ func DeleteChannelBatch(c *gin.Context) {
 		})
 		return
 	}
+	service.RecordAudit(c, "channel.delete_batch", "channel", nil, fmt.Sprintf("批量删除渠道 %v", channelBatch.Ids), nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -298,6 +352,7 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	origin, _ := model.GetChannelById(channel.Id, true)
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -306,6 +361,9 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	if updated, err := model.GetChannelById(channel.Id, true); err == nil {
+		service.RecordAudit(c, "channel.update", "channel", channel.Id, "修改渠道 "+updated.Name, service.AuditDiff(origin, updated))
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -0,0 +1,297 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/service"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const bytesPerMB = 1024 * 1024
+
+func abortWithFileError(c *gin.Context, err *dto.OpenAIErrorWithStatusCode) {
+	err.Error.Message = common.MessageWithRequestId(err.Error.Message, c.GetString(common.RequestIdKey))
+	c.JSON(err.StatusCode, gin.H{
+		"error": err.Error,
+	})
+}
+
+func file2OpenAIFile(file *model.File) dto.OpenAIFile {
+	return dto.OpenAIFile{
+		Id:        file.FileId,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedTime,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    "processed",
+	}
+}
+
+func getUserFile(c *gin.Context) (*model.File, bool) {
+	file, err := model.GetUserFileById(c.GetInt("id"), c.Param("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(fmt.Errorf("no such file: %s", c.Param("id")), "file_not_found", http.StatusNotFound))
+		return nil, false
+	}
+	if err != nil {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(err, "get_file_failed", http.StatusInternalServerError))
+		return nil, false
+	}
+	return file, true
+}
+
+// fileStorageQuota 按文件大小（不足 1 MB 按 1 MB 计）、存储天数与分组倍率计算存储费用
+func fileStorageQuota(size int64, days int64, group string) int {
+	if common.FileStorageQuotaPerMB <= 0 {
+		return 0
+	}
+	mb := math.Ceil(float64(size) / bytesPerMB)
+	return int(mb * float64(days) * float64(common.FileStorageQuotaPerMB) * common.GetGroupRatio(group))
+}
+
+func UploadFile(c *gin.Context) {
+	userId := c.GetInt("id")
+	tokenId := c.GetInt("token_id")
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(common.MaxFileSize)*bytesPerMB+bytesPerMB)
+	purpose := c.PostForm("purpose")
+	if purpose == "" {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(errors.New("field purpose is required"), "invalid_file_request", http.StatusBadRequest))
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(err, "invalid_file_request", http.StatusBadRequest))
+		return
+	}
+	if fileHeader.Size > int64(common.MaxFileSize)*bytesPerMB {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(fmt.Errorf("file size exceeds the limit of %d MB", common.MaxFileSize), "file_too_large", http.StatusBadRequest))
+		return
+	}
+	group, _ := model.CacheGetUserGroup(userId)
+	quota := fileStorageQuota(fileHeader.Size, 1, group)
+	userQuota, err := model.CacheGetUserQuota(userId)
+	if err != nil {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError))
+		return
+	}
+	if quota > 0 && (userQuota < quota || (!c.GetBool("token_unlimited_quota") && c.GetInt("token_quota") < quota)) {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden))
+		return
+	}
+
+	src, err := fileHeader.Open()
+	if err != nil {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(err, "read_file_failed", http.StatusBadRequest))
+		return
+	}
+	defer src.Close()
+	fileId := fmt.Sprintf("file-%s", common.GetUUID())
+	storageKey := fmt.Sprintf("%d/%s", userId, fileId)
+	size, err := service.GetFileStorage().Save(storageKey, src)
+	if err != nil {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(err, "save_file_failed", http.StatusInternalServerError))
+		return
+	}
+	file := &model.File{
+		FileId:     fileId,
+		UserId:     userId,
+		TokenId:    tokenId,
+		Filename:   fileHeader.Filename,
+		Purpose:    purpose,
+		Bytes:      size,
+		StorageKey: storageKey,
+	}
+	err = file.Insert()
+	if err != nil {
+		_ = service.GetFileStorage().Delete(storageKey)
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(err, "save_file_failed", http.StatusInternalServerError))
+		return
+	}
+
+	if quota > 0 {
+		err = model.PostConsumeTokenQuota(tokenId, userQuota, quota, 0, true)
+		if err != nil {
+			common.LogError(c, "error consuming token remain quota: "+err.Error())
+		}
+		err = model.CacheUpdateUserQuota(userId)
+		if err != nil {
+			common.LogError(c, "error update user quota cache: "+err.Error())
+		}
+		logContent := fmt.Sprintf("文件存储 %s 首日，%.2f MB，每 MB 每天额度 %d，分组倍率 %.2f", fileId, float64(size)/bytesPerMB, common.FileStorageQuotaPerMB, common.GetGroupRatio(group))
+		other := make(map[string]interface{})
+		other["file_id"] = fileId
+		other["file_bytes"] = size
+		model.RecordConsumeLog(c, userId, 0, 0, 0, "file-storage", c.GetString("token_name"), quota, logContent, tokenId, userQuota, 0, false, other)
+		model.UpdateUserUsedQuotaAndRequestCount(userId, quota)
+	}
+	c.JSON(http.StatusOK, file2OpenAIFile(file))
+}
+
+func ListFiles(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 10000 {
+		limit = 10000
+	}
+	files, err := model.GetUserFiles(c.GetInt("id"), c.Query("purpose"), limit)
+	if err != nil {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(err, "get_files_failed", http.StatusInternalServerError))
+		return
+	}
+	data := make([]dto.OpenAIFile, 0, len(files))
+	for _, file := range files {
+		data = append(data, file2OpenAIFile(file))
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileList{
+		Object: "list",
+		Data:   data,
+	})
+}
+
+func RetrieveFile(c *gin.Context) {
+	file, ok := getUserFile(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, file2OpenAIFile(file))
+}
+
+func RetrieveFileContent(c *gin.Context) {
+	file, ok := getUserFile(c)
+	if !ok {
+		return
+	}
+	reader, err := service.GetFileStorage().Open(file.StorageKey)
+	if err != nil {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(err, "read_file_failed", http.StatusInternalServerError))
+		return
+	}
+	defer reader.Close()
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Filename))
+	c.Header("Content-Length", strconv.FormatInt(file.Bytes, 10))
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "application/octet-stream")
+	_, err = io.Copy(c.Writer, reader)
+	if err != nil {
+		common.LogError(c, "write file content failed: "+err.Error())
+	}
+}
+
+func DeleteFile(c *gin.Context) {
+	file, ok := getUserFile(c)
+	if !ok {
+		return
+	}
+	upstreamFiles, err := model.DeleteFile(file)
+	if err != nil {
+		abortWithFileError(c, service.OpenAIErrorWrapperLocal(err, "delete_file_failed", http.StatusInternalServerError))
+		return
+	}
+	err = service.GetFileStorage().Delete(file.StorageKey)
+	if err != nil {
+		common.LogError(c, "delete file from storage failed: "+err.Error())
+	}
+	if len(upstreamFiles) > 0 {
+		go service.DeleteUpstreamFiles(upstreamFiles)
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileDeleteResponse{
+		Id:      file.FileId,
+		Object:  "file",
+		Deleted: true,
+	})
+}
+
+// fileStorageBillingBatchSize 每次查询到期文件的数量
+const fileStorageBillingBatchSize = 1000
+
+// AutomaticallyBillFileStorage 每小时收取已到期文件的存储费用，删除的文件不再收费
+func AutomaticallyBillFileStorage() {
+	for {
+		billFileStorage(common.GetTimestamp())
+		time.Sleep(time.Hour)
+	}
+}
+
+// billFileStorage 对存储费用在 now 之前到期的文件按天收费，同一用户的费用合并扣除并记录一条日志。
+// 余额不足时仍然扣除，用户需删除不再使用的文件以停止收费
+func billFileStorage(now int64) {
+	type storageCharge struct {
+		quota  int
+		files  int
+		mbDays int64
+	}
+	charges := make(map[int]*storageCharge)
+	for {
+		files, err := model.GetFilesDueForStorageBilling(now, fileStorageBillingBatchSize)
+		if err != nil {
+			common.SysError("failed to get files due for storage billing: " + err.Error())
+			break
+		}
+		failed := false
+		for _, file := range files {
+			paidUntil := file.BilledUntil
+			if paidUntil == 0 {
+				paidUntil = file.CreatedTime + model.FileStorageBillingSeconds
+			}
+			var days int64
+			if paidUntil <= now {
+				days = (now-paidUntil)/model.FileStorageBillingSeconds + 1
+			}
+			group, _ := model.CacheGetUserGroup(file.UserId)
+			quota := fileStorageQuota(file.Bytes, days, group)
+			ok, err := model.AdvanceFileBilledUntil(file, paidUntil+days*model.FileStorageBillingSeconds)
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to update billing time of file %s: %s", file.FileId, err.Error()))
+				failed = true
+				break
+			}
+			if !ok || quota <= 0 {
+				continue
+			}
+			charge, ok := charges[file.UserId]
+			if !ok {
+				charge = &storageCharge{}
+				charges[file.UserId] = charge
+			}
+			charge.quota += quota
+			charge.files++
+			charge.mbDays += int64(math.Ceil(float64(file.Bytes)/bytesPerMB)) * days
+		}
+		if failed || len(files) < fileStorageBillingBatchSize {
+			break
+		}
+	}
+	for userId, charge := range charges {
+		userQuota, err := model.GetUserQuota(userId)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to get quota of user %d: %s", userId, err.Error()))
+		}
+		err = model.DecreaseUserQuota(userId, charge.quota)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to charge file storage quota of user %d: %s", userId, err.Error()))
+			continue
+		}
+		err = model.CacheUpdateUserQuota(userId)
+		if err != nil {
+			common.SysError("error update user quota cache: " + err.Error())
+		}
+		group, _ := model.CacheGetUserGroup(userId)
+		logContent := fmt.Sprintf("文件存储 %d 个文件，共 %d MB·天，每 MB 每天额度 %d，分组倍率 %.2f", charge.files, charge.mbDays, common.FileStorageQuotaPerMB, common.GetGroupRatio(group))
+		other := make(map[string]interface{})
+		other["file_count"] = charge.files
+		other["file_mb_days"] = charge.mbDays
+		model.RecordConsumeLog(context.Background(), userId, 0, 0, 0, "file-storage", "", charge.quota, logContent, 0, userQuota, 0, false, other)
+		model.UpdateUserUsedQuotaAndRequestCount(userId, charge.quota)
+	}
+}
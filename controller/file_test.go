@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"one-api/common"
+	"one-api/model"
+	"path/filepath"
+	"testing"
+)
+
+func TestBillFileStorage(t *testing.T) {
+	common.RedisEnabled = false
+	common.SQLitePath = filepath.Join(t.TempDir(), "one-api.db")
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("failed to init database: %v", err)
+	}
+	defer func() {
+		_ = model.CloseDB()
+	}()
+	quotaPerMB := common.FileStorageQuotaPerMB
+	common.FileStorageQuotaPerMB = 10
+	defer func() {
+		common.FileStorageQuotaPerMB = quotaPerMB
+	}()
+
+	user := &model.User{Username: "storage", Password: "12345678", Group: "default", Quota: 1000, AffCode: "storage"}
+	if err := model.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	const day = model.FileStorageBillingSeconds
+	now := common.GetTimestamp()
+	files := []*model.File{
+		// 已到期 1 天：5 MB × 1 天
+		{FileId: "file-due", Bytes: 5 * bytesPerMB, CreatedTime: now - day, BilledUntil: now - 1},
+		// 已到期 3 天，不足 1 MB 按 1 MB 计：1 MB × 3 天
+		{FileId: "file-overdue", Bytes: 1, CreatedTime: now - 3*day, BilledUntil: now - 2*day},
+		{FileId: "file-prepaid", Bytes: bytesPerMB, CreatedTime: now, BilledUntil: now + 100},
+		// 未记录支付时间的文件视为上传时预付首日：1 MB × 1 天
+		{FileId: "file-legacy-due", Bytes: bytesPerMB, CreatedTime: now - day},
+		{FileId: "file-legacy-new", Bytes: bytesPerMB, CreatedTime: now},
+	}
+	for _, file := range files {
+		file.UserId = user.Id
+		if err := model.DB.Create(file).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	billFileStorage(now)
+	quota, err := model.GetUserQuota(user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 1000 - 50 - 30 - 10; quota != want {
+		t.Errorf("user quota = %d, want %d", quota, want)
+	}
+	wantBilledUntil := map[string]int64{
+		"file-due":        now - 1 + day,
+		"file-overdue":    now + day,
+		"file-prepaid":    now + 100,
+		"file-legacy-due": now + day,
+		"file-legacy-new": now + day,
+	}
+	for fileId, want := range wantBilledUntil {
+		file, err := model.GetUserFileById(user.Id, fileId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.BilledUntil != want {
+			t.Errorf("%s billed until %d, want %d", fileId, file.BilledUntil, want)
+		}
+	}
+
+	// 已支付的时间内不重复收费，删除的文件不再收费
+	if _, err = model.DeleteFile(files[0]); err != nil {
+		t.Fatal(err)
+	}
+	billFileStorage(now + 50)
+	if got, _ := model.GetUserQuota(user.Id); got != quota {
+		t.Errorf("user quota after billing again = %d, want %d", got, quota)
+	}
+	billFileStorage(now + day)
+	if got, _ := model.GetUserQuota(user.Id); got != quota-10*4 {
+		t.Errorf("user quota after next day = %d, want %d", got, quota-10*4)
+	}
+}
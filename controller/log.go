@@ -1,10 +1,12 @@
 package controller
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"one-api/common"
 	"one-api/model"
+	"one-api/service"
 	"strconv"
 )
 
@@ -190,6 +192,7 @@ func DeleteHistoryLogs(c *gin.Context) {
 		})
 		return
 	}
+	service.RecordAudit(c, "log.delete_history", "log", nil, fmt.Sprintf("清除 %d 之前的历史日志，共 %d 条", targetTimestamp, count), nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -197,3 +200,38 @@ func DeleteHistoryLogs(c *gin.Context) {
 	})
 	return
 }
+
+// GetLogBodyCapture 获取消费日志关联的请求体与响应体，仅管理员可用
+func GetLogBodyCapture(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	log, err := model.GetLogById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	captureId, _ := common.StrToMap(log.Other)["capture_id"].(string)
+	if captureId == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该日志没有保存请求体",
+		})
+		return
+	}
+	capture, err := model.GetBodyCaptureByRequestId(captureId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "请求体不存在或已过期",
+		})
+		return
+	}
+	service.RecordAudit(c, "log.capture.view", "log", log.Id, "查看请求体 "+captureId, nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    capture,
+	})
+}
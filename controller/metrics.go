@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"one-api/common"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var metricsHandler = promhttp.Handler()
+
+// Metrics 以 Prometheus 格式输出监控指标，设置了 METRICS_TOKEN 时需携带 Authorization: Bearer <token>
+func Metrics(c *gin.Context) {
+	if common.MetricsToken != "" {
+		token := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(common.MetricsToken)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "无权访问监控指标",
+			})
+			return
+		}
+	}
+	metricsHandler.ServeHTTP(c.Writer, c.Request)
+}
@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"io"
-	"log"
 	"net/http"
 	"one-api/common"
 	"one-api/constant"
@@ -25,6 +24,7 @@ func UpdateMidjourneyTaskBulk() {
 		time.Sleep(time.Duration(15) * time.Second)
 
 		tasks := model.GetAllUnFinishTasks()
+		common.MetricsSetTaskBacklog(constant.TaskPlatformMidjourney, len(tasks))
 		if len(tasks) == 0 {
 			continue
 		}
@@ -149,6 +149,7 @@ func UpdateMidjourneyTaskBulk() {
 
 				if (task.Progress != "100%" && responseItem.FailReason != "") || (task.Progress == "100%" && task.Status == "FAILURE") {
 					common.LogInfo(ctx, task.MjId+" 构建失败，"+task.FailReason)
+					service.RecordTaskFailure(constant.TaskPlatformMidjourney)
 					task.Progress = "100%"
 					err = model.CacheUpdateUserQuota(task.UserId)
 					if err != nil {
@@ -253,7 +254,6 @@ func GetUserMidjourney(c *gin.Context) {
 	}
 
 	userId := c.GetInt("id")
-	log.Printf("userId = %d \n", userId)
 
 	queryParams := model.TaskQueryParams{
 		MjID:           c.Query("mj_id"),
@@ -2,9 +2,12 @@ package controller
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"one-api/common"
 	"one-api/model"
+	"one-api/service"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -17,9 +20,13 @@ func GetOptions(c *gin.Context) {
 		if strings.HasSuffix(k, "Token") || strings.HasSuffix(k, "Secret") || strings.HasSuffix(k, "Key") {
 			continue
 		}
+		value := common.Interface2String(v)
+		if k == "NotificationChannels" {
+			value = common.MaskNotificationChannels(value)
+		}
 		options = append(options, &model.Option{
 			Key:   k,
-			Value: common.Interface2String(v),
+			Value: value,
 		})
 	}
 	common.OptionMapRWMutex.Unlock()
@@ -74,7 +81,119 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "LogLevel":
+		if _, err = common.ParseLogLevel(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无效的日志级别，可选值为 debug、info、warn、error",
+			})
+			return
+		}
+	case "LogInfoSampleRate":
+		if rate, err := strconv.ParseFloat(option.Value, 64); err != nil || rate < 0 || rate > 1 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "日志采样比例必须是 0 到 1 之间的数字",
+			})
+			return
+		}
+	case "BodyCaptureUserIds", "BodyCaptureTokenIds":
+		if _, err = common.ParseIdSet(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "用户或令牌 id 列表格式错误，请使用英文逗号分隔的数字 id",
+			})
+			return
+		}
+	case "BodyCaptureSampleRate":
+		if rate, err := strconv.ParseFloat(option.Value, 64); err != nil || rate < 0 || rate > 1 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "请求体采样比例必须是 0 到 1 之间的数字",
+			})
+			return
+		}
+	case "BodyCaptureMaxSize":
+		if size, err := strconv.Atoi(option.Value); err != nil || size <= 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "请求体最大保存字节数必须是正整数",
+			})
+			return
+		}
+	case "BodyCaptureRetentionDays":
+		if days, err := strconv.Atoi(option.Value); err != nil || days < 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "请求体保存天数必须是非负整数",
+			})
+			return
+		}
+	case "BodyCaptureRedactionRules":
+		if _, err = common.ParseBodyCaptureRedactionRules(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "NotificationChannels":
+		// 查询时隐藏了 secret 与 token，提交隐藏后的值表示不修改
+		value, err := common.RestoreNotificationChannelSecrets(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "通知渠道配置错误：" + err.Error(),
+			})
+			return
+		}
+		option.Value = value
+	case "NotificationRules":
+		rules, err := common.ParseNotificationRules(option.Value)
+		if err == nil {
+			for _, names := range rules {
+				for _, name := range names {
+					if _, ok := common.GetNotificationChannel(name); !ok {
+						err = fmt.Errorf("通知渠道 %s 不存在，请先在通知渠道中配置", name)
+					}
+				}
+			}
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "通知规则配置错误：" + err.Error(),
+			})
+			return
+		}
+	case "NotificationTemplates":
+		if _, err = common.ParseNotificationTemplates(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "通知模板配置错误：" + err.Error(),
+			})
+			return
+		}
+	case "NotificationRateLimitSeconds", "TaskFailureSpikeThreshold":
+		if value, err := strconv.Atoi(option.Value); err != nil || value < 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "通知限流时间与任务失败阈值必须是非负整数",
+			})
+			return
+		}
+	case "ChannelBalanceLowThreshold":
+		if value, err := strconv.ParseFloat(option.Value, 64); err != nil || value < 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "渠道余额提醒阈值必须是非负数",
+			})
+			return
+		}
 	}
+	common.OptionMapRWMutex.RLock()
+	before := common.OptionMap[option.Key]
+	common.OptionMapRWMutex.RUnlock()
 	err = model.UpdateOption(option.Key, option.Value)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -83,9 +202,37 @@ func UpdateOption(c *gin.Context) {
 		})
 		return
 	}
+	service.RecordAudit(c, "option.update", "option", option.Key, "修改系统设置 "+option.Key, service.AuditValueChange(option.Key, before, option.Value))
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
 	})
 	return
 }
+
+type TestNotificationRequest struct {
+	Channel string `json:"channel"`
+}
+
+// TestNotification 向指定的通知渠道发送一条测试通知，用于检查渠道配置是否正确
+func TestNotification(c *gin.Context) {
+	var request TestNotificationRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Channel == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "参数错误",
+		})
+		return
+	}
+	if err := service.SendTestNotification(request.Channel); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "发送测试通知失败：" + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
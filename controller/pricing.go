@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"one-api/common"
 	"one-api/model"
+	"one-api/service"
 )
 
 func GetPricing(c *gin.Context) {
@@ -24,6 +25,7 @@ func GetPricing(c *gin.Context) {
 
 func ResetModelRatio(c *gin.Context) {
 	defaultStr := common.DefaultModelRatio2JSONString()
+	before := common.ModelRatio2JSONString()
 	err := model.UpdateOption("ModelRatio", defaultStr)
 	if err != nil {
 		c.JSON(200, gin.H{
@@ -40,6 +42,7 @@ func ResetModelRatio(c *gin.Context) {
 		})
 		return
 	}
+	service.RecordAudit(c, "option.reset_model_ratio", "option", "ModelRatio", "重置模型倍率", service.AuditValueChange("ModelRatio", before, defaultStr))
 	c.JSON(200, gin.H{
 		"success": true,
 		"message": "重置模型倍率成功",
@@ -1,10 +1,12 @@
 package controller
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"one-api/common"
 	"one-api/model"
+	"one-api/service"
 	"strconv"
 )
 
@@ -123,6 +125,7 @@ func AddRedemption(c *gin.Context) {
 			return
 		}
 		keys = append(keys, key)
+		service.RecordAudit(c, "redemption.create", "redemption", cleanRedemption.Id, fmt.Sprintf("创建兑换码 %s，额度 %s", cleanRedemption.Name, common.LogQuota(cleanRedemption.Quota)), service.AuditDiff(nil, cleanRedemption))
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -142,6 +145,7 @@ func DeleteRedemption(c *gin.Context) {
 		})
 		return
 	}
+	service.RecordAudit(c, "redemption.delete", "redemption", id, fmt.Sprintf("删除兑换码 #%d", id), nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -168,6 +172,7 @@ func UpdateRedemption(c *gin.Context) {
 		})
 		return
 	}
+	originRedemption := *cleanRedemption
 	if statusOnly != "" {
 		cleanRedemption.Status = redemption.Status
 	} else {
@@ -183,6 +188,7 @@ func UpdateRedemption(c *gin.Context) {
 		})
 		return
 	}
+	service.RecordAudit(c, "redemption.update", "redemption", cleanRedemption.Id, "修改兑换码 "+cleanRedemption.Name, service.AuditDiff(originRedemption, cleanRedemption))
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
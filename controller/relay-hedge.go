@@ -0,0 +1,311 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/middleware"
+	"one-api/model"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/service"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 对冲请求：配置了对冲延迟的分组，请求在延迟内没有输出首个 token 时，向另一个渠道发送相同的请求。
+// 每个请求使用独立的 gin.Context 副本，第一个向客户端写出响应的请求胜出并取消另一个请求，
+// 落败的请求不向用户计费，按提示词估算的上游消耗计入渠道的对冲开销。
+// 落败请求被取消时收不到上游的用量，已生成的补全 token 无法计入，因此对冲开销是实际消耗的下限。
+
+var errHedgeLost = errors.New("hedged request lost")
+
+// hedgeMaxSelectTimes 选择对冲渠道时为避开首个渠道最多重新选择的次数
+const hedgeMaxSelectTimes = 3
+
+type hedgeAttempt struct {
+	ctx       *gin.Context
+	cancel    context.CancelFunc
+	channel   *model.Channel
+	startTime time.Time
+	latency   time.Duration
+	err       *dto.OpenAIErrorWithStatusCode
+	done      chan struct{}
+	// cancelled 为 true 表示因其他请求胜出而被取消
+	cancelled bool
+}
+
+type hedgeGate struct {
+	mutex    sync.Mutex
+	writer   gin.ResponseWriter
+	attempts []*hedgeAttempt
+	winner   *hedgeAttempt
+	claimed  chan struct{}
+}
+
+// claim 请求开始写响应时调用，第一个调用的请求胜出，其余请求被取消
+func (g *hedgeGate) claim(attempt *hedgeAttempt, header http.Header) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.winner != nil {
+		return g.winner == attempt
+	}
+	g.winner = attempt
+	for key, values := range header {
+		g.writer.Header()[key] = values
+	}
+	for _, other := range g.attempts {
+		if other != attempt {
+			other.cancelled = true
+			other.cancel()
+		}
+	}
+	close(g.claimed)
+	return true
+}
+
+// hedgeWriter 胜出前响应头写入自身，胜出后直接写给客户端，落败后丢弃所有写入
+type hedgeWriter struct {
+	gin.ResponseWriter
+	gate    *hedgeGate
+	attempt *hedgeAttempt
+	header  http.Header
+	status  int
+	won     bool
+}
+
+func (w *hedgeWriter) claim() bool {
+	if !w.won {
+		w.won = w.gate.claim(w.attempt, w.header)
+		if w.won && w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+	}
+	return w.won
+}
+
+func (w *hedgeWriter) Header() http.Header {
+	if w.won {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *hedgeWriter) WriteHeader(code int) {
+	if w.won {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *hedgeWriter) WriteHeaderNow() {
+	if w.claim() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *hedgeWriter) Write(data []byte) (int, error) {
+	if !w.claim() {
+		return 0, errHedgeLost
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *hedgeWriter) WriteString(s string) (int, error) {
+	if !w.claim() {
+		return 0, errHedgeLost
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *hedgeWriter) Flush() {
+	if w.won {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *hedgeWriter) Status() int {
+	if w.won {
+		return w.ResponseWriter.Status()
+	}
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *hedgeWriter) Size() int {
+	if w.won {
+		return w.ResponseWriter.Size()
+	}
+	return -1
+}
+
+func (w *hedgeWriter) Written() bool {
+	return w.won && w.ResponseWriter.Written()
+}
+
+// getHedgeDelay 返回请求的对冲延迟，不发送对冲请求时为 0
+func getHedgeDelay(c *gin.Context, relayMode int, group string) time.Duration {
+	if relayMode != relayconstant.RelayModeChatCompletions && relayMode != relayconstant.RelayModeCompletions {
+		return 0
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return 0
+	}
+	return common.GetGroupHedgeDelay(group)
+}
+
+// start 使用 gin.Context 的副本发送请求，channel 为 nil 时使用已选择的渠道，
+// release 为选择 channel 时占用的限流额度的释放函数
+func (g *hedgeGate) start(c *gin.Context, relayMode int, channel *model.Channel, release func(), modelName string) *hedgeAttempt {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.winner != nil {
+		if release != nil {
+			release()
+		}
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	attemptCtx := c.Copy()
+	attemptCtx.Request = c.Request.Clone(c.Request.Context())
+	requestBody, _ := common.GetRequestBody(c)
+	attemptCtx.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	attemptCtx.Set(relaycommon.UpstreamContextKey, ctx)
+	attemptCtx.Set(relaycommon.RelayInfoKey, nil)
+	attempt := &hedgeAttempt{
+		ctx:     attemptCtx,
+		cancel:  cancel,
+		channel: channel,
+		done:    make(chan struct{}),
+	}
+	attemptCtx.Writer = &hedgeWriter{
+		ResponseWriter: c.Writer,
+		gate:           g,
+		attempt:        attempt,
+		header:         make(http.Header),
+	}
+	if channel != nil {
+		// 对冲请求单独占用渠道的并发数
+		attemptCtx.Set("channel_limit_release", nil)
+		middleware.SetupContextForSelectedChannel(attemptCtx, channel, modelName, release)
+		attemptCtx.Set("use_channel", append(c.GetStringSlice("use_channel"), fmt.Sprintf("%d", channel.Id)))
+	}
+	g.attempts = append(g.attempts, attempt)
+	go func() {
+		defer close(attempt.done)
+		attempt.startTime = time.Now()
+		attempt.err = relayHandler(attemptCtx, relayMode)
+		attempt.latency = time.Since(attempt.startTime)
+		if attempt.err == nil {
+			g.claim(attempt, nil)
+		}
+	}()
+	return attempt
+}
+
+// selectHedgeChannel 为对冲请求选择一个不同于首个请求的渠道，返回渠道及其限流额度的释放函数
+func selectHedgeChannel(c *gin.Context, group string, modelName string, channelId int) (*model.Channel, func()) {
+	meta := service.GetRequestMeta(c)
+	for i := 0; i < hedgeMaxSelectTimes; i++ {
+		channel, release, err := model.CacheGetRandomSatisfiedChannel(group, modelName, 0, meta.IsImage, meta.IsStream, meta.IsSystemPrompt, meta.IsNORLogprobs, meta.IsFunctionCall, meta.PromptTokens, meta.MaxTokens)
+		if err != nil || channel == nil {
+			return nil, nil
+		}
+		if channel.Id != channelId {
+			return channel, release
+		}
+		// 选中了首个请求的渠道，释放这次占用的额度后重新选择
+		release()
+	}
+	return nil, nil
+}
+
+// relayHedged 发送请求，首个 token 在 delay 内未输出时向另一个渠道发送对冲请求，返回胜出请求的渠道与错误
+func relayHedged(c *gin.Context, relayMode int, group string, modelName string, delay time.Duration) (int, *dto.OpenAIErrorWithStatusCode) {
+	gate := &hedgeGate{writer: c.Writer, claimed: make(chan struct{})}
+	c.Set("use_channel", []string{fmt.Sprintf("%d", c.GetInt("channel_id"))})
+	primary := gate.start(c, relayMode, nil, nil, modelName)
+	timer := time.NewTimer(delay)
+	select {
+	case <-primary.done:
+	case <-gate.claimed:
+	case <-timer.C:
+		if channel, release := selectHedgeChannel(c, group, modelName, c.GetInt("channel_id")); channel != nil {
+			common.LogInfo(c.Request.Context(), fmt.Sprintf("no first token from channel #%d in %v, sending hedged request to channel #%d", c.GetInt("channel_id"), delay, channel.Id))
+			gate.start(c, relayMode, channel, release, modelName)
+		}
+	}
+	timer.Stop()
+
+	gate.mutex.Lock()
+	attempts := gate.attempts
+	gate.mutex.Unlock()
+	for _, attempt := range attempts {
+		<-attempt.done
+	}
+	winner := gate.winner
+	if winner == nil {
+		winner = primary
+	}
+
+	useChannel := make([]string, 0, len(attempts))
+	for _, attempt := range attempts {
+		attempt.cancel()
+		useChannel = append(useChannel, fmt.Sprintf("%d", attempt.ctx.GetInt("channel_id")))
+		if attempt == winner {
+			continue
+		}
+		middleware.ReleaseChannelLimit(attempt.ctx)
+		channelId := attempt.ctx.GetInt("channel_id")
+		if attempt.cancelled {
+			recordHedgeOverhead(attempt.ctx)
+			continue
+		}
+		if attempt.err != nil {
+			recordChannelResult(attempt.ctx, relayMode, channelId, modelName, attempt.err, attempt.latency)
+			go processChannelError(attempt.ctx, channelId, attempt.ctx.GetInt("channel_type"), attempt.ctx.GetInt("channel_key_id"), attempt.err)
+		}
+	}
+
+	for key, value := range winner.ctx.Keys {
+		c.Set(key, value)
+	}
+	c.Set(relaycommon.UpstreamContextKey, nil)
+	c.Set("use_channel", useChannel)
+	channelId := c.GetInt("channel_id")
+	recordChannelResult(c, relayMode, channelId, modelName, winner.err, winner.latency)
+	if winner.err != nil {
+		go processChannelError(c, channelId, c.GetInt("channel_type"), c.GetInt("channel_key_id"), winner.err)
+	}
+	return channelId, winner.err
+}
+
+// recordHedgeOverhead 按提示词 token 估算落败请求的上游消耗，计入渠道的对冲开销；
+// 不包含取消前上游已生成的补全 token，是实际消耗的下限
+func recordHedgeOverhead(c *gin.Context) {
+	relayInfo, ok := c.Value(relaycommon.RelayInfoKey).(*relaycommon.RelayInfo)
+	if !ok || relayInfo == nil || relayInfo.UpstreamModelName == "" {
+		return
+	}
+	groupRatio := common.GetGroupRatio(relayInfo.Group)
+	var quota int
+	if modelPrice, usePrice := common.GetModelPrice(relayInfo.UpstreamModelName, false); usePrice {
+		quota = int(modelPrice * common.QuotaPerUnit * groupRatio)
+	} else {
+		quota = int(float64(relayInfo.PromptTokens) * common.GetModelRatio(relayInfo.UpstreamModelName) * groupRatio)
+	}
+	common.LogInfo(c.Request.Context(), fmt.Sprintf("hedged request to channel #%d lost, overhead quota at least %d", relayInfo.ChannelId, quota))
+	model.UpdateChannelHedgeOverheadQuota(relayInfo.ChannelId, quota)
+}
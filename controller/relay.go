@@ -2,16 +2,16 @@ package controller
 
 import (
 	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"one-api/common"
 	"one-api/dto"
 	"one-api/middleware"
 	"one-api/model"
 	"one-api/relay"
+	relaycommon "one-api/relay/common"
 	"one-api/relay/constant"
 	relayconstant "one-api/relay/constant"
 	"one-api/service"
@@ -19,27 +19,52 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// relayHandler 使用当前选中的渠道转发一次请求，首次请求、重试与对冲请求各记录为一个 span
 func relayHandler(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
+	// 重试时当前渠道已加入 use_channel，首次请求时 use_channel 还未设置
+	attempt := len(c.GetStringSlice("use_channel"))
+	if attempt == 0 {
+		attempt = 1
+	}
+	span, endSpan := common.StartRequestSpan(c, "RelayAttempt",
+		attribute.Int("channel_id", c.GetInt("channel_id")),
+		attribute.Int("channel_type", c.GetInt("channel_type")),
+		attribute.String("model", c.GetString("original_model")),
+		attribute.Int("attempt", attempt),
+	)
+	defer endSpan()
 	var err *dto.OpenAIErrorWithStatusCode
 	switch relayMode {
 	case relayconstant.RelayModeImagesGenerations:
 		err = relay.RelayImageHelper(c, relayMode)
+	case relayconstant.RelayModeImagesEdits, relayconstant.RelayModeImagesVariations:
+		err = relay.RelayImageEditHelper(c, relayMode)
 	case relayconstant.RelayModeAudioSpeech:
 		fallthrough
 	case relayconstant.RelayModeAudioTranslation:
 		fallthrough
 	case relayconstant.RelayModeAudioTranscription:
 		err = relay.AudioHelper(c, relayMode)
+	case relayconstant.RelayModeRerank:
+		err = relay.RerankHelper(c)
+	case relayconstant.RelayModeRealtime:
+		err = relay.RealtimeHelper(c)
 	default:
 		err = relay.TextHelper(c)
 	}
+	if err != nil {
+		span.SetAttributes(attribute.Int("http.status_code", err.StatusCode))
+		common.SetSpanError(span, errors.New(err.Error.Message))
+	}
 	return err
 }
 
 func Relay(c *gin.Context) {
 	startTime := time.Now()
+	defer service.StartBodyCapture(c)()
 	relayMode := constant.Path2RelayMode(c.Request.URL.Path)
 	retryTimes := common.RetryTimes
 	requestId := c.GetString(common.RequestIdKey)
@@ -47,122 +72,48 @@ func Relay(c *gin.Context) {
 	channelType := c.GetInt("channel_type")
 	group := c.GetString("group")
 	originalModel := c.GetString("original_model")
-	openaiErr := relayHandler(c, relayMode)
+	meta := service.GetRequestMeta(c)
+	var openaiErr *dto.OpenAIErrorWithStatusCode
+	if hedgeDelay := getHedgeDelay(c, relayMode, group); hedgeDelay > 0 {
+		channelId, openaiErr = relayHedged(c, relayMode, group, originalModel, hedgeDelay)
+	} else {
+		relayStartTime := time.Now()
+		c.Set(relaycommon.RelayInfoKey, nil)
+		openaiErr = relayHandler(c, relayMode)
+		recordChannelResult(c, relayMode, channelId, originalModel, openaiErr, time.Since(relayStartTime))
 
-	input_tokens := 0
-	textRequest := &dto.GeneralOpenAIRequest{}
-	err := common.UnmarshalBodyReusable(c, textRequest)
-	if err == nil {
-		prompt_tokens, err := service.CountTokenChatRequest(*textRequest, textRequest.Model)
-		if err == nil {
-			input_tokens = prompt_tokens
+		c.Set("use_channel", []string{fmt.Sprintf("%d", channelId)})
+		if openaiErr != nil {
+			go processChannelError(c, channelId, channelType, c.GetInt("channel_key_id"), openaiErr)
 		}
 	}
-	fmt.Println("input_tokens: ", input_tokens)
-
-	c.Set("use_channel", []string{fmt.Sprintf("%d", channelId)})
-	if openaiErr != nil {
-		go processChannelError(c, channelId, channelType, openaiErr)
-	} else {
+	if openaiErr == nil {
 		retryTimes = 0
 	}
-	for i := 0; shouldRetry(c, channelId, openaiErr, retryTimes) && i < retryTimes; i++ {
-		var bodyBytes []byte
-		if c.Request.Body != nil {
-			bodyBytes, _ = io.ReadAll(c.Request.Body)
-		}
-
-		// 将 body 内容重新设置回 c.Request.Body
-		c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
-		// 解析 body 到请求的结构体
-
-		// 解析 JSON 请求数据
-		// 检查是否有 messages 字段并解析
-		isImage := false
-		isStream := false
-		isSystemPrompt := false
-		isNORLogprobs := false
-		isFunctionCall := false
-		var requestData map[string]interface{}
-		if err := json.Unmarshal(bodyBytes, &requestData); err != nil {
-			fmt.Println("解析 JSON 请求数据失败")
-		} else {
-			// 如果 包含 stream 字段，查看是否是 true
-			if stream, exists := requestData["stream"]; exists {
-				if stream == true {
-					isStream = true
-				}
-			}
-			// 如果 包含 logprobs 字段，查看是否是 NOR
-			if logprobs, exists := requestData["logprobs"]; exists {
-				// 打印下 logprobs 的值
-				// fmt.Println("logprobs: ", logprobs)
-				if logprobs == true {
-					isNORLogprobs = true
-				}
-			}
-			// 如果 包含 n 字段，如果不是 1， isNORLogprobs 为 true
-			if n, exists := requestData["n"]; exists {
-				// 转换成int类型,转换失败就是1
-				tmp_n := 1
-				if n_int, ok := n.(int); ok {
-					tmp_n = n_int
-				}
-
-				if tmp_n != 1 {
-					isNORLogprobs = true
-				}
-			}
-			// 如果 messages 是数组，遍历每个 message
-			if messages, ok := requestData["messages"].([]interface{}); ok {
-				for _, message := range messages {
-					if msgMap, ok := message.(map[string]interface{}); ok {
-						if content, exists := msgMap["content"]; exists {
-							switch content.(type) {
-							case []interface{}:
-								for _, item := range content.([]interface{}) {
-									if itemMap, ok := item.(map[string]interface{}); ok {
-										if t, exists := itemMap["type"]; exists && t == "image_url" {
-											isImage = true
-										}
-									}
-								}
-							}
-						}
-						// 如果tool_calls存在，说明是FunctionCall
-						if _, exists := msgMap["tool_calls"]; exists {
-							isFunctionCall = true
-						}
-						// 如果包含 role 字段，查看是否是 system
-						if role, exists := msgMap["role"]; exists {
-							if role == "system" {
-								isSystemPrompt = true
-							}
-						}
-					}
-				}
-			}
+	channelId, openaiErr = relayWithRetry(c, relayMode, group, originalModel, channelId, openaiErr, retryTimes)
+	// 请求的模型所有重试均失败时，按降级链依次改用其他模型
+	for _, fallbackModel := range remainingModelFallbackChain(c, group, originalModel) {
+		if !shouldRetry(c, channelId, openaiErr, 1) || c.Writer.Written() {
+			break
 		}
-		channel, err := model.CacheGetRandomSatisfiedChannel(group, originalModel, i, isImage, isStream, isSystemPrompt, isNORLogprobs, isFunctionCall, input_tokens)
+		fallbackPromptTokens, _ := meta.CountPromptTokens(fallbackModel)
+		channel, release, err := model.CacheGetRandomSatisfiedChannel(group, fallbackModel, 0, meta.IsImage, meta.IsStream, meta.IsSystemPrompt, meta.IsNORLogprobs, meta.IsFunctionCall, fallbackPromptTokens, meta.MaxTokens)
 		if err != nil {
-			common.LogError(c.Request.Context(), fmt.Sprintf("CacheGetRandomSatisfiedChannel failed: %s", err.Error()))
-			break
+			continue
 		}
-		fmt.Println("1: ")
-		channelId = channel.Id
-		useChannel := c.GetStringSlice("use_channel")
-		useChannel = append(useChannel, fmt.Sprintf("%d", channelId))
-		c.Set("use_channel", useChannel)
-		common.LogInfo(c.Request.Context(), fmt.Sprintf("using channel #%d to retry (remain times %d)", channel.Id, i))
-		middleware.SetupContextForSelectedChannel(c, channel, originalModel)
-
-		requestBody, _ := common.GetRequestBody(c)
-		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
-		openaiErr = relayHandler(c, relayMode)
-		if openaiErr != nil {
-			go processChannelError(c, channelId, channel.Type, openaiErr)
+		if err = middleware.SetModelFallback(c, originalModel, fallbackModel); err != nil {
+			release()
+			common.LogError(c.Request.Context(), "model fallback failed: "+err.Error())
+			break
 		}
+		common.LogInfo(c.Request.Context(), fmt.Sprintf("all channels for model %s failed, fallback to model %s", originalModel, fallbackModel))
+		originalModel = fallbackModel
+		channelId, openaiErr = relayWithChannel(c, relayMode, channel, release, originalModel)
+		channelId, openaiErr = relayWithRetry(c, relayMode, group, originalModel, channelId, openaiErr, common.RetryTimes)
+	}
+	if openaiErr == nil {
+		// 记录会话成功使用的渠道与密钥，后续请求优先使用
+		model.SetChannelAffinity(c.GetString("channel_affinity_key"), c.GetInt("channel_id"), c.GetInt("channel_key_id"))
 	}
 	useChannel := c.GetStringSlice("use_channel")
 	if len(useChannel) > 1 {
@@ -185,12 +136,121 @@ func Relay(c *gin.Context) {
 			openaiErr.Error.Message = "当前分组上游负载已饱和，请稍后再试"
 		}
 		openaiErr.Error.Message = common.MessageWithRequestId(openaiErr.Error.Message, requestId)
+		switch meta.RelayFormat {
+		case relayconstant.RelayFormatClaude:
+			c.JSON(openaiErr.StatusCode, dto.ClaudeErrorResponse{
+				Type:  "error",
+				Error: dto.ClaudeError{Type: claudeErrorType(openaiErr.StatusCode), Message: openaiErr.Error.Message},
+			})
+			return
+		case relayconstant.RelayFormatGemini:
+			c.JSON(openaiErr.StatusCode, dto.GeminiErrorResponse{
+				Error: dto.GeminiError{Code: openaiErr.StatusCode, Message: openaiErr.Error.Message, Status: geminiErrorStatus(openaiErr.StatusCode)},
+			})
+			return
+		}
 		c.JSON(openaiErr.StatusCode, gin.H{
 			"error": openaiErr.Error,
 		})
 	}
 }
 
+// relayWithRetry 请求失败时在同一模型的其他渠道上重试，返回最后使用的渠道与错误
+func relayWithRetry(c *gin.Context, relayMode int, group string, modelName string, channelId int, openaiErr *dto.OpenAIErrorWithStatusCode, retryTimes int) (int, *dto.OpenAIErrorWithStatusCode) {
+	meta := service.GetRequestMeta(c)
+	for i := 0; shouldRetry(c, channelId, openaiErr, retryTimes) && i < retryTimes; i++ {
+		channel, release, err := model.CacheGetRandomSatisfiedChannel(group, modelName, i, meta.IsImage, meta.IsStream, meta.IsSystemPrompt, meta.IsNORLogprobs, meta.IsFunctionCall, meta.PromptTokens, meta.MaxTokens)
+		if err != nil {
+			common.LogError(c.Request.Context(), fmt.Sprintf("CacheGetRandomSatisfiedChannel failed: %s", err.Error()))
+			break
+		}
+		common.LogInfo(c.Request.Context(), fmt.Sprintf("using channel #%d to retry (remain times %d)", channel.Id, i))
+		channelId, openaiErr = relayWithChannel(c, relayMode, channel, release, modelName)
+	}
+	return channelId, openaiErr
+}
+
+// relayWithChannel 使用指定渠道重新发送请求，release 为选择渠道时占用的限流额度的释放函数
+func relayWithChannel(c *gin.Context, relayMode int, channel *model.Channel, release func(), modelName string) (int, *dto.OpenAIErrorWithStatusCode) {
+	useChannel := c.GetStringSlice("use_channel")
+	useChannel = append(useChannel, fmt.Sprintf("%d", channel.Id))
+	c.Set("use_channel", useChannel)
+	common.SetLogField(c, "retry", len(useChannel)-1)
+	middleware.SetupContextForSelectedChannel(c, channel, modelName, release)
+	common.MetricsRecordRetry(modelName, channel.Id, c.GetString("group"))
+
+	requestBody, _ := common.GetRequestBody(c)
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	relayStartTime := time.Now()
+	c.Set(relaycommon.RelayInfoKey, nil)
+	openaiErr := relayHandler(c, relayMode)
+	recordChannelResult(c, relayMode, channel.Id, modelName, openaiErr, time.Since(relayStartTime))
+	if openaiErr != nil {
+		go processChannelError(c, channel.Id, channel.Type, c.GetInt("channel_key_id"), openaiErr)
+	}
+	return channel.Id, openaiErr
+}
+
+// remainingModelFallbackChain 返回降级链中位于当前模型之后、尚未尝试的模型
+func remainingModelFallbackChain(c *gin.Context, group string, currentModel string) []string {
+	requestedModel := c.GetString("model_fallback_from")
+	if requestedModel == "" {
+		requestedModel = currentModel
+	}
+	chain := middleware.GetModelFallbackChain(c, group, requestedModel)
+	if currentModel == requestedModel {
+		return chain
+	}
+	for i, fallbackModel := range chain {
+		if fallbackModel == currentModel {
+			return chain[i+1:]
+		}
+	}
+	return nil
+}
+
+// claudeErrorType 按状态码返回 Anthropic 错误类型
+func claudeErrorType(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	}
+	if statusCode >= 500 {
+		return "api_error"
+	}
+	return "invalid_request_error"
+}
+
+// geminiErrorStatus 按状态码返回 Google API 错误状态
+func geminiErrorStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	}
+	if statusCode >= 500 {
+		return "INTERNAL"
+	}
+	return "INVALID_ARGUMENT"
+}
+
 func shouldRetry(c *gin.Context, channelId int, openaiErr *dto.OpenAIErrorWithStatusCode, retryTimes int) bool {
 	if openaiErr == nil {
 		return false
@@ -207,6 +267,10 @@ func shouldRetry(c *gin.Context, channelId int, openaiErr *dto.OpenAIErrorWithSt
 	if openaiErr.StatusCode == 307 {
 		return true
 	}
+	if openaiErr.Error.Code == "first_token_timeout" {
+		// 首字超时时还没有向客户端写出内容，可以换渠道重试
+		return true
+	}
 	if openaiErr.StatusCode/100 == 5 {
 		// 超时不重试
 		if openaiErr.StatusCode == 504 || openaiErr.StatusCode == 524 {
@@ -230,11 +294,60 @@ func shouldRetry(c *gin.Context, channelId int, openaiErr *dto.OpenAIErrorWithSt
 	return true
 }
 
-func processChannelError(c *gin.Context, channelId int, channelType int, err *dto.OpenAIErrorWithStatusCode) {
+// recordChannelResult 将请求结果计入监控指标以及渠道熔断与按延迟路由的统计，本地错误（参数错误、额度不足等）与渠道无关，不计入渠道统计
+func recordChannelResult(c *gin.Context, relayMode int, channelId int, modelName string, openaiErr *dto.OpenAIErrorWithStatusCode, latency time.Duration) {
+	statusCode := http.StatusOK
+	if openaiErr != nil {
+		statusCode = openaiErr.StatusCode
+	}
+	var firstToken time.Duration
+	if info, ok := c.Get(relaycommon.RelayInfoKey); ok {
+		if relayInfo, ok := info.(*relaycommon.RelayInfo); ok && relayInfo != nil && relayInfo.IsStream && relayInfo.FirstResponseTime.After(relayInfo.StartTime) {
+			firstToken = relayInfo.FirstResponseTime.Sub(relayInfo.StartTime)
+		}
+	}
+	common.MetricsRecordRelay(modelName, channelId, c.GetString("group"), statusCode, latency, firstToken)
+	success := true
+	if openaiErr != nil {
+		if openaiErr.LocalError {
+			return
+		}
+		switch openaiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout:
+			success = false
+		default:
+			success = openaiErr.StatusCode/100 != 5
+		}
+	}
+	model.ChannelBreakerRecord(channelId, modelName, success, latency)
+	model.ChannelKeyRecord(c.GetInt("channel_key_id"), success)
+	// 实时会话的耗时是整个会话的时长，不反映渠道响应速度
+	if relayMode == relayconstant.RelayModeRealtime {
+		return
+	}
+	firstResponse := latency
+	if info, ok := c.Get(relaycommon.RelayInfoKey); ok {
+		if relayInfo, ok := info.(*relaycommon.RelayInfo); ok && relayInfo != nil && relayInfo.FirstResponseTime.After(relayInfo.StartTime) {
+			firstResponse = relayInfo.FirstResponseTime.Sub(relayInfo.StartTime)
+		}
+	}
+	model.ChannelRoutingRecord(channelId, modelName, success, latency, firstResponse)
+}
+
+// processChannelError keyId 为本次请求使用的密钥池密钥，为 0 时表示使用渠道本身的密钥
+func processChannelError(c *gin.Context, channelId int, channelType int, keyId int, err *dto.OpenAIErrorWithStatusCode) {
 	autoBan := c.GetBool("auto_ban")
-	common.LogError(c.Request.Context(), fmt.Sprintf("relay error (channel #%d, status code: %d): %s", channelId, err.StatusCode, err.Error.Message))
+	common.LogError(c.Request.Context(), fmt.Sprintf("relay error (channel #%d, key #%d, status code: %d): %s", channelId, keyId, err.StatusCode, err.Error.Message))
+	if keyId != 0 && err.StatusCode == http.StatusTooManyRequests {
+		model.CooldownChannelKey(keyId)
+	}
 	if service.ShouldDisableChannel(channelType, err) && autoBan {
 		channelName := c.GetString("channel_name")
+		if keyId != 0 {
+			// 多密钥渠道只禁用出错的密钥
+			service.DisableChannelKey(channelId, channelName, keyId, err.Error.Message)
+			return
+		}
 		service.DisableChannel(channelId, channelName, err.Error.Message)
 	}
 }
@@ -255,7 +368,6 @@ func RelayMidjourney(c *gin.Context) {
 		err = relay.RelayMidjourneySubmit(c, relayMode)
 	}
 	//err = relayMidjourneySubmit(c, relayMode)
-	log.Println(err)
 	if err != nil {
 		statusCode := http.StatusBadRequest
 		if err.Code == 30 {
@@ -302,110 +414,25 @@ func RelayTask(c *gin.Context) {
 	relayMode := c.GetInt("relay_mode")
 	group := c.GetString("group")
 	originalModel := c.GetString("original_model")
+	meta := service.GetRequestMeta(c)
 	c.Set("use_channel", []string{fmt.Sprintf("%d", channelId)})
 	taskErr := taskRelayHandler(c, relayMode)
 	if taskErr == nil {
 		retryTimes = 0
 	}
 
-	input_tokens := 0
-	textRequest := &dto.GeneralOpenAIRequest{}
-	err := common.UnmarshalBodyReusable(c, textRequest)
-	if err == nil {
-		prompt_tokens, err := service.CountTokenChatRequest(*textRequest, textRequest.Model)
-		if err == nil {
-			input_tokens = prompt_tokens
-		}
-	}
-	fmt.Println("input_tokens: ", input_tokens)
-
 	for i := 0; shouldRetryTaskRelay(c, channelId, taskErr, retryTimes) && i < retryTimes; i++ {
-		var bodyBytes []byte
-		if c.Request.Body != nil {
-			bodyBytes, _ = io.ReadAll(c.Request.Body)
-		}
-
-		// 将 body 内容重新设置回 c.Request.Body
-		c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-		isImage := false
-		isStream := false
-		isSystemPrompt := false
-		isNORLogprobs := false
-		isFunctionCall := false
-		var requestData map[string]interface{}
-		if err := json.Unmarshal(bodyBytes, &requestData); err != nil {
-			fmt.Println("解析 JSON 请求数据失败")
-		} else {
-			// 如果 包含 stream 字段，查看是否是 true
-			if stream, exists := requestData["stream"]; exists {
-				if stream == true {
-					isStream = true
-				}
-			}
-			// 如果 包含 logprobs 字段，查看是否是 true
-			if logprobs, exists := requestData["logprobs"]; exists {
-				// fmt.Println("logprobs: ", logprobs)
-				// 打印下 logprobs 的值
-				if logprobs == true {
-					isNORLogprobs = true
-				}
-			}
-			// 如果 包含 n 字段，如果不是 1， isNORLogprobs 为 true
-			if n, exists := requestData["n"]; exists {
-				// 转换成int类型,转换失败就是1
-				tmp_n := 1
-				if n_int, ok := n.(int); ok {
-					tmp_n = n_int
-				}
-
-				if tmp_n != 1 {
-					isNORLogprobs = true
-				}
-			}
-			// 如果 messages 是数组，遍历每个 message
-			if messages, ok := requestData["messages"].([]interface{}); ok {
-				for _, message := range messages {
-					if msgMap, ok := message.(map[string]interface{}); ok {
-						if content, exists := msgMap["content"]; exists {
-							switch content.(type) {
-							case []interface{}:
-								for _, item := range content.([]interface{}) {
-									if itemMap, ok := item.(map[string]interface{}); ok {
-										if t, exists := itemMap["type"]; exists && t == "image_url" {
-											isImage = true
-										}
-									}
-								}
-							}
-						}
-						// 如果tool_calls存在，说明是FunctionCall
-						if _, exists := msgMap["tool_calls"]; exists {
-							isFunctionCall = true
-						}
-						// 如果包含 role 字段，查看是否是 system
-						if role, exists := msgMap["role"]; exists {
-							if role == "system" {
-								isSystemPrompt = true
-							}
-						}
-					}
-				}
-			}
-		}
-
-		channel, err := model.CacheGetRandomSatisfiedChannel(group, originalModel, i, isImage, isStream, isSystemPrompt, isNORLogprobs, isFunctionCall, input_tokens)
+		channel, release, err := model.CacheGetRandomSatisfiedChannel(group, originalModel, i, meta.IsImage, meta.IsStream, meta.IsSystemPrompt, meta.IsNORLogprobs, meta.IsFunctionCall, meta.PromptTokens, meta.MaxTokens)
 		if err != nil {
 			common.LogError(c.Request.Context(), fmt.Sprintf("CacheGetRandomSatisfiedChannel failed: %s", err.Error()))
 			break
 		}
-
-		fmt.Println("2: ")
 		channelId = channel.Id
 		useChannel := c.GetStringSlice("use_channel")
 		useChannel = append(useChannel, fmt.Sprintf("%d", channelId))
 		c.Set("use_channel", useChannel)
 		common.LogInfo(c.Request.Context(), fmt.Sprintf("using channel #%d to retry (remain times %d)", channel.Id, i))
-		middleware.SetupContextForSelectedChannel(c, channel, originalModel)
+		middleware.SetupContextForSelectedChannel(c, channel, originalModel, release)
 
 		requestBody, _ := common.GetRequestBody(c)
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
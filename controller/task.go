@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/samber/lo"
+	"go.opentelemetry.io/otel/attribute"
 	"io"
 	"net/http"
 	"one-api/common"
@@ -14,6 +15,7 @@ import (
 	"one-api/dto"
 	"one-api/model"
 	"one-api/relay"
+	"one-api/service"
 	"sort"
 	"strconv"
 	"time"
@@ -25,12 +27,14 @@ func UpdateTaskBulk() {
 	for {
 		time.Sleep(time.Duration(15) * time.Second)
 		common.SysLog("任务进度轮询开始")
-		ctx := context.TODO()
+		ctx, span := common.StartSpan(context.Background(), "UpdateTaskBulk")
 		allTasks := model.GetAllUnFinishSyncTasks(500)
+		span.SetAttributes(attribute.Int("task_count", len(allTasks)))
 		platformTask := make(map[constant.TaskPlatform][]*model.Task)
 		for _, t := range allTasks {
 			platformTask[t.Platform] = append(platformTask[t.Platform], t)
 		}
+		common.MetricsSetTaskBacklog(string(constant.TaskPlatformSuno), len(platformTask[constant.TaskPlatformSuno]))
 		for platform, tasks := range platformTask {
 			if len(tasks) == 0 {
 				continue
@@ -62,18 +66,23 @@ func UpdateTaskBulk() {
 				continue
 			}
 
-			UpdateTaskByPlatform(platform, taskChannelM, taskM)
+			UpdateTaskByPlatform(ctx, platform, taskChannelM, taskM)
 		}
+		span.End()
 		common.SysLog("任务进度轮询完成")
 	}
 }
 
-func UpdateTaskByPlatform(platform constant.TaskPlatform, taskChannelM map[int][]string, taskM map[string]*model.Task) {
+func UpdateTaskByPlatform(ctx context.Context, platform constant.TaskPlatform, taskChannelM map[int][]string, taskM map[string]*model.Task) {
+	ctx, span := common.StartSpan(ctx, "UpdateTaskByPlatform", attribute.String("platform", string(platform)), attribute.Int("task_count", len(taskM)))
+	defer span.End()
 	switch platform {
 	case constant.TaskPlatformMidjourney:
 		//_ = UpdateMidjourneyTaskAll(context.Background(), tasks)
 	case constant.TaskPlatformSuno:
-		_ = UpdateSunoTaskAll(context.Background(), taskChannelM, taskM)
+		_ = UpdateSunoTaskAll(ctx, taskChannelM, taskM)
+	case constant.TaskPlatformBatch:
+		_ = UpdateBatchTaskAll(ctx, taskM)
 	default:
 		common.SysLog("未知平台")
 	}
@@ -81,9 +90,12 @@ func UpdateTaskByPlatform(platform constant.TaskPlatform, taskChannelM map[int][
 
 func UpdateSunoTaskAll(ctx context.Context, taskChannelM map[int][]string, taskM map[string]*model.Task) error {
 	for channelId, taskIds := range taskChannelM {
-		err := updateSunoTaskAll(ctx, channelId, taskIds, taskM)
+		channelCtx, span := common.StartSpan(ctx, "updateSunoTaskAll", attribute.Int("channel_id", channelId), attribute.Int("task_count", len(taskIds)))
+		err := updateSunoTaskAll(channelCtx, channelId, taskIds, taskM)
+		common.SetSpanError(span, err)
+		span.End()
 		if err != nil {
-			common.LogError(ctx, fmt.Sprintf("渠道 #%d 更新异步任务失败: %d", channelId, err.Error()))
+			common.LogError(ctx, fmt.Sprintf("渠道 #%d 更新异步任务失败: %s", channelId, err.Error()))
 		}
 	}
 	return nil
@@ -135,7 +147,7 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 		return err
 	}
 	if !responseItems.IsSuccess() {
-		common.SysLog(fmt.Sprintf("渠道 #%d 未完成的任务有: %d, 成功获取到任务数: %d", channelId, len(taskIds), string(responseBody)))
+		common.SysLog(fmt.Sprintf("渠道 #%d 未完成的任务有: %d, 成功获取到任务数: %s", channelId, len(taskIds), string(responseBody)))
 		return err
 	}
 
@@ -152,6 +164,7 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 		task.FinishTime = lo.If(responseItem.FinishTime != 0, responseItem.FinishTime).Else(task.FinishTime)
 		if responseItem.FailReason != "" || task.Status == model.TaskStatusFailure {
 			common.LogInfo(ctx, task.TaskID+" 构建失败，"+task.FailReason)
+			service.RecordTaskFailure(string(task.Platform))
 			task.Progress = "100%"
 			err = model.CacheUpdateUserQuota(task.UserId)
 			if err != nil {
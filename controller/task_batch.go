@@ -0,0 +1,391 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/middleware"
+	"one-api/model"
+	"one-api/service"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runningBatchTasks 当前节点正在执行的批处理任务，值为取消函数
+var runningBatchTasks sync.Map
+
+var batchRelayEngine *gin.Engine
+var batchRelayEngineOnce sync.Once
+
+// getBatchRelayEngine 返回执行批处理请求的内部路由，请求与普通接口一样经过令牌校验、渠道选择、重试与计费
+func getBatchRelayEngine() *gin.Engine {
+	batchRelayEngineOnce.Do(func() {
+		engine := gin.New()
+		engine.Use(middleware.RelayPanicRecover(), middleware.RequestId(), func(c *gin.Context) {
+			c.Set("batch", true)
+			c.Next()
+		}, middleware.TokenAuth(), middleware.Distribute())
+		for endpoint := range batchEndpoints {
+			engine.POST(endpoint, Relay)
+		}
+		batchRelayEngine = engine
+	})
+	return batchRelayEngine
+}
+
+func UpdateBatchTaskAll(ctx context.Context, taskM map[string]*model.Task) error {
+	for _, task := range taskM {
+		switch task.Status {
+		case model.TaskStatusNotStart:
+			startBatchTask(task)
+		case model.TaskStatusInProgress, model.TaskStatusCancelling:
+			if _, ok := runningBatchTasks.Load(task.TaskID); ok {
+				if task.Status == model.TaskStatusCancelling {
+					cancelRunningBatchTask(task.TaskID)
+				}
+				continue
+			}
+			// 任务不在当前节点执行，说明执行期间网关重启，已执行的请求已经计费，不再重新执行
+			common.LogError(ctx, fmt.Sprintf("batch task %s was interrupted", task.TaskID))
+			if task.Status == model.TaskStatusCancelling {
+				finishBatchTask(task, model.TaskStatusCancelled, nil)
+			} else {
+				finishBatchTask(task, model.TaskStatusFailure, &dto.BatchError{Code: "batch_interrupted", Message: "The batch was interrupted by a gateway restart."})
+			}
+		}
+	}
+	return nil
+}
+
+func startBatchTask(task *model.Task) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, loaded := runningBatchTasks.LoadOrStore(task.TaskID, cancel); loaded {
+		cancel()
+		return
+	}
+	common.SafeGoroutine(func() {
+		defer runningBatchTasks.Delete(task.TaskID)
+		defer cancel()
+		runBatchTask(ctx, task)
+	})
+}
+
+// cancelRunningBatchTask 取消当前节点正在执行的批处理任务，任务不在当前节点执行时返回 false
+func cancelRunningBatchTask(taskId string) bool {
+	cancel, ok := runningBatchTasks.Load(taskId)
+	if !ok {
+		return false
+	}
+	cancel.(context.CancelFunc)()
+	return true
+}
+
+// updateBatchTaskData 重新读取任务数据后修改并与其他字段一起保存，避免覆盖其他节点写入的数据
+func updateBatchTaskData(task *model.Task, update func(data *dto.BatchTaskData), params map[string]any) error {
+	var data dto.BatchTaskData
+	latest, exist, err := model.GetByOnlyTaskId(task.TaskID)
+	if err == nil && exist {
+		err = latest.GetData(&data)
+	} else {
+		err = task.GetData(&data)
+	}
+	if err != nil {
+		return err
+	}
+	update(&data)
+	task.SetData(data)
+	if params == nil {
+		params = make(map[string]any)
+	}
+	params["data"] = task.Data
+	return model.TaskBulkUpdateByID([]int64{task.ID}, params)
+}
+
+func finishBatchTask(task *model.Task, status model.TaskStatus, batchErr *dto.BatchError) {
+	task.Status = status
+	task.Progress = "100%"
+	task.FinishTime = common.GetTimestamp()
+	err := updateBatchTaskData(task, func(data *dto.BatchTaskData) {
+		if batchErr != nil {
+			data.Errors = append(data.Errors, *batchErr)
+		}
+	}, map[string]any{
+		"status":      task.Status,
+		"progress":    task.Progress,
+		"finish_time": task.FinishTime,
+		"fail_reason": batchErrorMessage(batchErr),
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch task %s: %s", task.TaskID, err.Error()))
+	}
+}
+
+func batchErrorMessage(batchErr *dto.BatchError) string {
+	if batchErr == nil {
+		return ""
+	}
+	return batchErr.Message
+}
+
+// batchOutputWriter 将批处理结果写入临时文件，结束后保存为用户文件
+type batchOutputWriter struct {
+	file  *os.File
+	count int
+}
+
+func newBatchOutputWriter() (*batchOutputWriter, error) {
+	file, err := os.CreateTemp("", "batch-*.jsonl")
+	if err != nil {
+		return nil, err
+	}
+	return &batchOutputWriter{file: file}, nil
+}
+
+func (w *batchOutputWriter) Write(line *dto.BatchResponseLine) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	_, err = w.file.Write(append(data, '\n'))
+	if err == nil {
+		w.count++
+	}
+	return err
+}
+
+// Save 将结果保存为用户文件并返回文件 id，没有结果时返回空字符串
+func (w *batchOutputWriter) Save(userId int, filename string) (string, error) {
+	if w.count == 0 {
+		return "", nil
+	}
+	_, err := w.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	fileId := fmt.Sprintf("file-%s", common.GetUUID())
+	storageKey := fmt.Sprintf("%d/%s", userId, fileId)
+	size, err := service.GetFileStorage().Save(storageKey, w.file)
+	if err != nil {
+		return "", err
+	}
+	file := &model.File{
+		FileId:     fileId,
+		UserId:     userId,
+		Filename:   filename,
+		Purpose:    "batch_output",
+		Bytes:      size,
+		StorageKey: storageKey,
+	}
+	err = file.Insert()
+	if err != nil {
+		_ = service.GetFileStorage().Delete(storageKey)
+		return "", err
+	}
+	return fileId, nil
+}
+
+func (w *batchOutputWriter) Close() {
+	_ = w.file.Close()
+	_ = os.Remove(w.file.Name())
+}
+
+func runBatchTask(ctx context.Context, task *model.Task) {
+	var data dto.BatchTaskData
+	err := task.GetData(&data)
+	if err != nil {
+		finishBatchTask(task, model.TaskStatusFailure, &dto.BatchError{Code: "invalid_batch", Message: err.Error()})
+		return
+	}
+	token, err := model.GetTokenById(data.TokenId)
+	if err != nil || token.UserId != task.UserId {
+		finishBatchTask(task, model.TaskStatusFailure, &dto.BatchError{Code: "token_not_found", Message: "The token used to create the batch no longer exists."})
+		return
+	}
+	inputFile, err := model.GetUserFileById(task.UserId, data.InputFileId)
+	if err != nil {
+		finishBatchTask(task, model.TaskStatusFailure, &dto.BatchError{Code: "file_not_found", Message: fmt.Sprintf("The input file %s no longer exists.", data.InputFileId)})
+		return
+	}
+	reader, err := service.GetFileStorage().Open(inputFile.StorageKey)
+	if err != nil {
+		finishBatchTask(task, model.TaskStatusFailure, &dto.BatchError{Code: "file_not_found", Message: err.Error()})
+		return
+	}
+	defer reader.Close()
+	outputWriter, err := newBatchOutputWriter()
+	if err != nil {
+		finishBatchTask(task, model.TaskStatusFailure, &dto.BatchError{Code: "server_error", Message: err.Error()})
+		return
+	}
+	defer outputWriter.Close()
+	errorWriter, err := newBatchOutputWriter()
+	if err != nil {
+		finishBatchTask(task, model.TaskStatusFailure, &dto.BatchError{Code: "server_error", Message: err.Error()})
+		return
+	}
+	defer errorWriter.Close()
+
+	task.Status = model.TaskStatusInProgress
+	task.StartTime = common.GetTimestamp()
+	err = model.TaskBulkUpdateByID([]int64{task.ID}, map[string]any{
+		"status":     task.Status,
+		"start_time": task.StartTime,
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch task %s: %s", task.TaskID, err.Error()))
+	}
+	common.SysLog(fmt.Sprintf("batch task %s started, %d requests", task.TaskID, data.RequestCounts.Total))
+
+	var mu sync.Mutex
+	counts := dto.BatchRequestCounts{Total: data.RequestCounts.Total}
+	flushCounts := func() {
+		mu.Lock()
+		current := counts
+		mu.Unlock()
+		progress := 0
+		if current.Total > 0 {
+			progress = (current.Completed + current.Failed) * 100 / current.Total
+		}
+		// 100% 表示任务已结束，执行期间最多显示 99%
+		if progress > 99 {
+			progress = 99
+		}
+		err := updateBatchTaskData(task, func(data *dto.BatchTaskData) {
+			data.RequestCounts = current
+		}, map[string]any{
+			"progress": fmt.Sprintf("%d%%", progress),
+		})
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to update batch task %s: %s", task.TaskID, err.Error()))
+		}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				flushCounts()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	concurrency := common.BatchConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	bufReader := bufio.NewReader(reader)
+	for ctx.Err() == nil {
+		line, readErr := bufReader.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			wg.Add(1)
+			go func(line []byte) {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+				result, success := doBatchRequest(ctx, token.Key, data.Endpoint, line)
+				mu.Lock()
+				defer mu.Unlock()
+				writer := outputWriter
+				if success {
+					counts.Completed++
+				} else {
+					counts.Failed++
+					writer = errorWriter
+				}
+				if err := writer.Write(result); err != nil {
+					common.SysError(fmt.Sprintf("failed to write batch task %s result: %s", task.TaskID, err.Error()))
+				}
+			}(line)
+		}
+		if readErr != nil {
+			if readErr != io.EOF {
+				common.SysError(fmt.Sprintf("failed to read batch task %s input: %s", task.TaskID, readErr.Error()))
+			}
+			break
+		}
+	}
+	wg.Wait()
+	close(done)
+	<-stopped
+	flushCounts()
+
+	status := model.TaskStatus(model.TaskStatusSuccess)
+	if ctx.Err() != nil {
+		status = model.TaskStatusCancelled
+	}
+	outputFileId, err := outputWriter.Save(task.UserId, fmt.Sprintf("%s_output.jsonl", task.TaskID))
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to save batch task %s output: %s", task.TaskID, err.Error()))
+	}
+	errorFileId, err := errorWriter.Save(task.UserId, fmt.Sprintf("%s_error.jsonl", task.TaskID))
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to save batch task %s errors: %s", task.TaskID, err.Error()))
+	}
+	err = updateBatchTaskData(task, func(data *dto.BatchTaskData) {
+		data.OutputFileId = outputFileId
+		data.ErrorFileId = errorFileId
+	}, nil)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch task %s: %s", task.TaskID, err.Error()))
+	}
+	finishBatchTask(task, status, nil)
+	common.SysLog(fmt.Sprintf("batch task %s finished with status %s, completed %d, failed %d", task.TaskID, status, counts.Completed, counts.Failed))
+}
+
+// doBatchRequest 通过内部路由执行一条批处理请求，返回结果行以及请求是否成功
+func doBatchRequest(ctx context.Context, tokenKey string, endpoint string, line []byte) (*dto.BatchResponseLine, bool) {
+	result := &dto.BatchResponseLine{
+		Id: fmt.Sprintf("batch_req_%s", common.GetUUID()),
+	}
+	var request dto.BatchRequestLine
+	err := json.Unmarshal(line, &request)
+	if err != nil {
+		result.Error = &dto.BatchError{Code: "invalid_json_line", Message: err.Error()}
+		return result, false
+	}
+	result.CustomId = request.CustomId
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(request.Body))
+	if err != nil {
+		result.Error = &dto.BatchError{Code: "server_error", Message: err.Error()}
+		return result, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-"+tokenKey)
+	recorder := httptest.NewRecorder()
+	getBatchRelayEngine().ServeHTTP(recorder, req)
+	body := recorder.Body.Bytes()
+	if !json.Valid(body) {
+		body, _ = json.Marshal(string(body))
+	}
+	result.Response = &dto.BatchResponseBody{
+		StatusCode: recorder.Code,
+		RequestId:  recorder.Header().Get(common.RequestIdKey),
+		Body:       body,
+	}
+	return result, recorder.Code == http.StatusOK
+}
@@ -213,6 +213,18 @@ func EpayNotify(c *gin.Context) {
 			}
 			log.Printf("易支付回调更新用户成功 %v", topUp)
 			model.RecordLog(topUp.UserId, model.LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%f", common.LogQuota(topUp.Amount*int(common.QuotaPerUnit)), topUp.Money))
+			username, _ := model.GetUsernameById(topUp.UserId)
+			service.Notify(service.Notification{
+				Event: common.NotifyEventPaymentReceived,
+				Key:   topUp.TradeNo,
+				Data: map[string]any{
+					"user_id":  topUp.UserId,
+					"username": username,
+					"quota":    common.LogQuota(topUp.Amount * int(common.QuotaPerUnit)),
+					"money":    fmt.Sprintf("%.2f", topUp.Money),
+					"trade_no": topUp.TradeNo,
+				},
+			})
 		}
 	} else {
 		log.Printf("易支付异常回调: %v", verifyInfo)
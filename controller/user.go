@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"one-api/common"
 	"one-api/model"
+	"one-api/service"
 	"strconv"
 	"sync"
 
@@ -463,6 +464,13 @@ func UpdateUser(c *gin.Context) {
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", common.LogQuota(originUser.Quota), common.LogQuota(updatedUser.Quota)))
 	}
+	if user, err := model.GetUserById(updatedUser.Id, false); err == nil {
+		changes := service.AuditDiff(originUser, user)
+		if updatePassword {
+			changes = append(changes, service.AuditValueChange("password", "********", "********")...)
+		}
+		service.RecordAudit(c, "user.update", "user", user.Id, "修改用户 "+user.Username, changes)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -620,6 +628,7 @@ func CreateUser(c *gin.Context) {
 		})
 		return
 	}
+	service.RecordAudit(c, "user.create", "user", cleanUser.Id, "创建用户 "+cleanUser.Username, service.AuditDiff(nil, cleanUser))
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -665,6 +674,7 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	originUser := user
 	switch req.Action {
 	case "disable":
 		user.Status = common.UserStatusDisabled
@@ -733,6 +743,7 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	service.RecordAudit(c, "user."+req.Action, "user", user.Id, fmt.Sprintf("管理用户 %s：%s", user.Username, req.Action), service.AuditDiff(originUser, user))
 	clearUser := model.User{
 		Role:   user.Role,
 		Status: user.Status,
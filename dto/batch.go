@@ -0,0 +1,95 @@
+package dto
+
+import "encoding/json"
+
+type BatchRequest struct {
+	InputFileId      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+type BatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+type BatchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Param   any    `json:"param"`
+	Line    any    `json:"line"`
+}
+
+type BatchErrors struct {
+	Object string       `json:"object"`
+	Data   []BatchError `json:"data"`
+}
+
+type OpenAIBatch struct {
+	Id               string             `json:"id"`
+	Object           string             `json:"object"`
+	Endpoint         string             `json:"endpoint"`
+	Errors           *BatchErrors       `json:"errors"`
+	InputFileId      string             `json:"input_file_id"`
+	CompletionWindow string             `json:"completion_window"`
+	Status           string             `json:"status"`
+	OutputFileId     *string            `json:"output_file_id"`
+	ErrorFileId      *string            `json:"error_file_id"`
+	CreatedAt        int64              `json:"created_at"`
+	InProgressAt     *int64             `json:"in_progress_at"`
+	ExpiresAt        *int64             `json:"expires_at"`
+	FinalizingAt     *int64             `json:"finalizing_at"`
+	CompletedAt      *int64             `json:"completed_at"`
+	FailedAt         *int64             `json:"failed_at"`
+	ExpiredAt        *int64             `json:"expired_at"`
+	CancellingAt     *int64             `json:"cancelling_at"`
+	CancelledAt      *int64             `json:"cancelled_at"`
+	RequestCounts    BatchRequestCounts `json:"request_counts"`
+	Metadata         map[string]string  `json:"metadata"`
+}
+
+type OpenAIBatchList struct {
+	Object  string        `json:"object"`
+	Data    []OpenAIBatch `json:"data"`
+	FirstId *string       `json:"first_id"`
+	LastId  *string       `json:"last_id"`
+	HasMore bool          `json:"has_more"`
+}
+
+// BatchRequestLine 批处理输入文件中的一行
+type BatchRequestLine struct {
+	CustomId string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	Url      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+type BatchResponseBody struct {
+	StatusCode int             `json:"status_code"`
+	RequestId  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// BatchResponseLine 批处理输出文件与错误文件中的一行
+type BatchResponseLine struct {
+	Id       string             `json:"id"`
+	CustomId string             `json:"custom_id"`
+	Response *BatchResponseBody `json:"response"`
+	Error    *BatchError        `json:"error"`
+}
+
+// BatchTaskData 批处理任务保存在 Task.Data 中的信息
+type BatchTaskData struct {
+	TokenId          int                `json:"token_id"`
+	Endpoint         string             `json:"endpoint"`
+	InputFileId      string             `json:"input_file_id"`
+	CompletionWindow string             `json:"completion_window"`
+	OutputFileId     string             `json:"output_file_id,omitempty"`
+	ErrorFileId      string             `json:"error_file_id,omitempty"`
+	RequestCounts    BatchRequestCounts `json:"request_counts"`
+	Metadata         map[string]string  `json:"metadata,omitempty"`
+	Errors           []BatchError       `json:"errors,omitempty"`
+	CancellingAt     int64              `json:"cancelling_at,omitempty"`
+}
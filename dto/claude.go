@@ -0,0 +1,268 @@
+package dto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ClaudeRequest Anthropic Messages API 原生请求
+type ClaudeRequest struct {
+	Model         string          `json:"model"`
+	System        json.RawMessage `json:"system,omitempty"`
+	Messages      []ClaudeMessage `json:"messages"`
+	MaxTokens     uint            `json:"max_tokens,omitempty"`
+	StopSequences []string        `json:"stop_sequences,omitempty"`
+	Temperature   float64         `json:"temperature,omitempty"`
+	TopP          float64         `json:"top_p,omitempty"`
+	TopK          int             `json:"top_k,omitempty"`
+	Stream        bool            `json:"stream,omitempty"`
+	Tools         []ClaudeTool    `json:"tools,omitempty"`
+	ToolChoice    *ClaudeChoice   `json:"tool_choice,omitempty"`
+	Metadata      *ClaudeMetadata `json:"metadata,omitempty"`
+}
+
+type ClaudeMetadata struct {
+	UserId string `json:"user_id,omitempty"`
+}
+
+type ClaudeMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type ClaudeContentBlock struct {
+	Type      string               `json:"type"`
+	Text      string               `json:"text,omitempty"`
+	Source    *ClaudeContentSource `json:"source,omitempty"`
+	Id        string               `json:"id,omitempty"`
+	Name      string               `json:"name,omitempty"`
+	Input     json.RawMessage      `json:"input,omitempty"`
+	ToolUseId string               `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage      `json:"content,omitempty"`
+	IsError   bool                 `json:"is_error,omitempty"`
+}
+
+type ClaudeContentSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	Url       string `json:"url,omitempty"`
+}
+
+type ClaudeTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema,omitempty"`
+}
+
+type ClaudeChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+// ClaudeResponse Anthropic Messages API 原生响应，流式事件 message_start 中的 message 也使用该结构
+type ClaudeResponse struct {
+	Id           string               `json:"id"`
+	Type         string               `json:"type"`
+	Role         string               `json:"role"`
+	Model        string               `json:"model"`
+	Content      []ClaudeContentBlock `json:"content"`
+	StopReason   *string              `json:"stop_reason"`
+	StopSequence *string              `json:"stop_sequence"`
+	Usage        ClaudeUsage          `json:"usage"`
+}
+
+type ClaudeUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// ClaudeStreamEvent Anthropic Messages API 流式事件
+type ClaudeStreamEvent struct {
+	Type         string              `json:"type"`
+	Message      *ClaudeResponse     `json:"message,omitempty"`
+	Index        *int                `json:"index,omitempty"`
+	ContentBlock *ClaudeContentBlock `json:"content_block,omitempty"`
+	Delta        *ClaudeStreamDelta  `json:"delta,omitempty"`
+	Usage        *ClaudeUsage        `json:"usage,omitempty"`
+}
+
+type ClaudeStreamDelta struct {
+	Type         string  `json:"type,omitempty"`
+	Text         string  `json:"text,omitempty"`
+	PartialJson  *string `json:"partial_json,omitempty"`
+	StopReason   *string `json:"stop_reason,omitempty"`
+	StopSequence *string `json:"stop_sequence,omitempty"`
+}
+
+type ClaudeErrorResponse struct {
+	Type  string      `json:"type"`
+	Error ClaudeError `json:"error"`
+}
+
+type ClaudeError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+func parseClaudeContent(content json.RawMessage) (string, []ClaudeContentBlock, error) {
+	var stringContent string
+	if err := json.Unmarshal(content, &stringContent); err == nil {
+		return stringContent, nil, nil
+	}
+	var blocks []ClaudeContentBlock
+	if err := json.Unmarshal(content, &blocks); err != nil {
+		return "", nil, err
+	}
+	return "", blocks, nil
+}
+
+func claudeBlocksText(content json.RawMessage) string {
+	if len(content) == 0 {
+		return ""
+	}
+	text, blocks, err := parseClaudeContent(content)
+	if err != nil {
+		return string(content)
+	}
+	for _, block := range blocks {
+		if block.Type == "text" {
+			text += block.Text
+		}
+	}
+	return text
+}
+
+func claudeImage2MediaMessage(source *ClaudeContentSource) (MediaMessage, error) {
+	if source == nil {
+		return MediaMessage{}, errors.New("image source is required")
+	}
+	imageUrl := MessageImageUrl{Detail: "auto"}
+	switch source.Type {
+	case "base64":
+		imageUrl.Url = fmt.Sprintf("data:%s;base64,%s", source.MediaType, source.Data)
+	case "url":
+		imageUrl.Url = source.Url
+	default:
+		return MediaMessage{}, fmt.Errorf("unsupported image source type: %s", source.Type)
+	}
+	return MediaMessage{Type: ContentTypeImageURL, ImageUrl: imageUrl}, nil
+}
+
+// ToOpenAIRequest 将 Anthropic Messages 请求转换为 OpenAI Chat Completions 请求
+func (r *ClaudeRequest) ToOpenAIRequest() (*GeneralOpenAIRequest, error) {
+	request := &GeneralOpenAIRequest{
+		Model:       r.Model,
+		Stream:      r.Stream,
+		MaxTokens:   r.MaxTokens,
+		Temperature: r.Temperature,
+		TopP:        r.TopP,
+		TopK:        r.TopK,
+	}
+	if len(r.StopSequences) > 0 {
+		request.Stop = r.StopSequences
+	}
+	if r.Metadata != nil {
+		request.User = r.Metadata.UserId
+	}
+	if len(r.System) > 0 {
+		content, _ := json.Marshal(claudeBlocksText(r.System))
+		request.Messages = append(request.Messages, Message{Role: "system", Content: content})
+	}
+	for _, claudeMessage := range r.Messages {
+		text, blocks, err := parseClaudeContent(claudeMessage.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content of %s message: %w", claudeMessage.Role, err)
+		}
+		if blocks == nil {
+			content, _ := json.Marshal(text)
+			request.Messages = append(request.Messages, Message{Role: claudeMessage.Role, Content: content})
+			continue
+		}
+		mediaMessages := make([]MediaMessage, 0, len(blocks))
+		var toolCalls []ToolCall
+		for _, block := range blocks {
+			switch block.Type {
+			case "text":
+				mediaMessages = append(mediaMessages, MediaMessage{Type: ContentTypeText, Text: block.Text})
+			case "image":
+				mediaMessage, err := claudeImage2MediaMessage(block.Source)
+				if err != nil {
+					return nil, err
+				}
+				mediaMessages = append(mediaMessages, mediaMessage)
+			case "tool_use":
+				arguments := string(block.Input)
+				if arguments == "" {
+					arguments = "{}"
+				}
+				toolCalls = append(toolCalls, ToolCall{
+					ID:       block.Id,
+					Type:     "function",
+					Function: FunctionCall{Name: block.Name, Arguments: arguments},
+				})
+			case "tool_result":
+				// tool_result 在 OpenAI 中是独立的 tool 消息，需要排在同轮用户内容之前
+				content, _ := json.Marshal(claudeBlocksText(block.Content))
+				request.Messages = append(request.Messages, Message{Role: "tool", Content: content, ToolCallId: block.ToolUseId})
+			}
+		}
+		if len(mediaMessages) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+		message := Message{Role: claudeMessage.Role}
+		if len(mediaMessages) == 1 && mediaMessages[0].Type == ContentTypeText {
+			message.Content, _ = json.Marshal(mediaMessages[0].Text)
+		} else if len(mediaMessages) > 0 {
+			message.Content, _ = json.Marshal(mediaMessages)
+		} else {
+			message.Content, _ = json.Marshal("")
+		}
+		if toolCalls != nil {
+			message.ToolCalls = toolCalls
+		}
+		request.Messages = append(request.Messages, message)
+	}
+	if len(r.Tools) > 0 {
+		tools := make([]OpenAITools, 0, len(r.Tools))
+		for _, tool := range r.Tools {
+			tools = append(tools, OpenAITools{
+				Type: "function",
+				Function: OpenAIFunction{
+					Name:        tool.Name,
+					Description: tool.Description,
+					Parameters:  tool.InputSchema,
+				},
+			})
+		}
+		request.Tools = tools
+	}
+	if r.ToolChoice != nil {
+		switch r.ToolChoice.Type {
+		case "auto":
+			request.ToolChoice = "auto"
+		case "any":
+			request.ToolChoice = "required"
+		case "tool":
+			request.ToolChoice = map[string]any{
+				"type":     "function",
+				"function": map[string]string{"name": r.ToolChoice.Name},
+			}
+		}
+	}
+	return request, nil
+}
+
+// StopReasonOpenAI2Claude 将 OpenAI 的 finish_reason 转换为 Anthropic 的 stop_reason
+func StopReasonOpenAI2Claude(reason string) string {
+	switch strings.ToLower(reason) {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	default:
+		return "end_turn"
+	}
+}
@@ -0,0 +1,257 @@
+package dto
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// GeminiRequest Gemini generateContent 原生请求，模型与是否流式由请求路径决定
+type GeminiRequest struct {
+	Contents          []GeminiContent         `json:"contents"`
+	SystemInstruction *GeminiContent          `json:"systemInstruction,omitempty"`
+	GenerationConfig  *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+	Tools             []GeminiTool            `json:"tools,omitempty"`
+	ToolConfig        *GeminiToolConfig       `json:"toolConfig,omitempty"`
+	SafetySettings    json.RawMessage         `json:"safetySettings,omitempty"`
+}
+
+type GeminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []GeminiPart `json:"parts"`
+}
+
+type GeminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	InlineData       *GeminiInlineData       `json:"inlineData,omitempty"`
+	FileData         *GeminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *GeminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type GeminiInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type GeminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileUri  string `json:"fileUri"`
+}
+
+type GeminiFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type GeminiFunctionResponse struct {
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+type GeminiGenerationConfig struct {
+	Temperature     float64  `json:"temperature,omitempty"`
+	TopP            float64  `json:"topP,omitempty"`
+	TopK            int      `json:"topK,omitempty"`
+	MaxOutputTokens uint     `json:"maxOutputTokens,omitempty"`
+	CandidateCount  int      `json:"candidateCount,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+}
+
+type GeminiTool struct {
+	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations,omitempty"`
+}
+
+type GeminiFunctionDeclaration struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+type GeminiToolConfig struct {
+	FunctionCallingConfig *struct {
+		Mode                 string   `json:"mode,omitempty"`
+		AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+	} `json:"functionCallingConfig,omitempty"`
+}
+
+// GeminiResponse Gemini generateContent 原生响应，流式响应的每一块也使用该结构
+type GeminiResponse struct {
+	Candidates    []GeminiCandidate    `json:"candidates"`
+	UsageMetadata *GeminiUsageMetadata `json:"usageMetadata,omitempty"`
+}
+
+type GeminiCandidate struct {
+	Content      GeminiContent `json:"content"`
+	FinishReason string        `json:"finishReason,omitempty"`
+	Index        int           `json:"index"`
+}
+
+type GeminiUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+type GeminiErrorResponse struct {
+	Error GeminiError `json:"error"`
+}
+
+type GeminiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+func geminiParts2MediaMessages(parts []GeminiPart) []MediaMessage {
+	mediaMessages := make([]MediaMessage, 0, len(parts))
+	for _, part := range parts {
+		if part.Text != "" {
+			mediaMessages = append(mediaMessages, MediaMessage{Type: ContentTypeText, Text: part.Text})
+		}
+		if part.InlineData != nil {
+			mediaMessages = append(mediaMessages, MediaMessage{
+				Type: ContentTypeImageURL,
+				ImageUrl: MessageImageUrl{
+					Url:    fmt.Sprintf("data:%s;base64,%s", part.InlineData.MimeType, part.InlineData.Data),
+					Detail: "auto",
+				},
+			})
+		}
+		if part.FileData != nil {
+			mediaMessages = append(mediaMessages, MediaMessage{
+				Type:     ContentTypeImageURL,
+				ImageUrl: MessageImageUrl{Url: part.FileData.FileUri, Detail: "auto"},
+			})
+		}
+	}
+	return mediaMessages
+}
+
+func mediaMessages2Content(mediaMessages []MediaMessage) json.RawMessage {
+	var content json.RawMessage
+	if len(mediaMessages) == 1 && mediaMessages[0].Type == ContentTypeText {
+		content, _ = json.Marshal(mediaMessages[0].Text)
+	} else if len(mediaMessages) > 0 {
+		content, _ = json.Marshal(mediaMessages)
+	} else {
+		content, _ = json.Marshal("")
+	}
+	return content
+}
+
+// ToOpenAIRequest 将 Gemini generateContent 请求转换为 OpenAI Chat Completions 请求
+func (r *GeminiRequest) ToOpenAIRequest(model string, stream bool) *GeneralOpenAIRequest {
+	request := &GeneralOpenAIRequest{
+		Model:  model,
+		Stream: stream,
+	}
+	if config := r.GenerationConfig; config != nil {
+		request.Temperature = config.Temperature
+		request.TopP = config.TopP
+		request.TopK = config.TopK
+		request.MaxTokens = config.MaxOutputTokens
+		request.N = config.CandidateCount
+		if len(config.StopSequences) > 0 {
+			request.Stop = config.StopSequences
+		}
+	}
+	if r.SystemInstruction != nil {
+		mediaMessages := geminiParts2MediaMessages(r.SystemInstruction.Parts)
+		request.Messages = append(request.Messages, Message{Role: "system", Content: mediaMessages2Content(mediaMessages)})
+	}
+	// Gemini 的函数调用没有 id，按函数名依次为调用与结果生成匹配的 tool_call_id
+	toolCallCount := 0
+	pendingToolCallIds := make(map[string][]string)
+	for _, content := range r.Contents {
+		role := content.Role
+		if role == "model" {
+			role = "assistant"
+		} else if role == "" {
+			role = "user"
+		}
+		var toolCalls []ToolCall
+		for _, part := range content.Parts {
+			if part.FunctionCall != nil {
+				toolCallCount++
+				id := fmt.Sprintf("call_%d", toolCallCount)
+				pendingToolCallIds[part.FunctionCall.Name] = append(pendingToolCallIds[part.FunctionCall.Name], id)
+				arguments := string(part.FunctionCall.Args)
+				if arguments == "" {
+					arguments = "{}"
+				}
+				toolCalls = append(toolCalls, ToolCall{
+					ID:       id,
+					Type:     "function",
+					Function: FunctionCall{Name: part.FunctionCall.Name, Arguments: arguments},
+				})
+			}
+			if part.FunctionResponse != nil {
+				name := part.FunctionResponse.Name
+				id := ""
+				if ids := pendingToolCallIds[name]; len(ids) > 0 {
+					id = ids[0]
+					pendingToolCallIds[name] = ids[1:]
+				}
+				responseContent, _ := json.Marshal(string(part.FunctionResponse.Response))
+				request.Messages = append(request.Messages, Message{Role: "tool", Content: responseContent, Name: &name, ToolCallId: id})
+			}
+		}
+		mediaMessages := geminiParts2MediaMessages(content.Parts)
+		if len(mediaMessages) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+		message := Message{Role: role, Content: mediaMessages2Content(mediaMessages)}
+		if toolCalls != nil {
+			message.ToolCalls = toolCalls
+		}
+		request.Messages = append(request.Messages, message)
+	}
+	var tools []OpenAITools
+	for _, tool := range r.Tools {
+		for _, declaration := range tool.FunctionDeclarations {
+			tools = append(tools, OpenAITools{
+				Type: "function",
+				Function: OpenAIFunction{
+					Name:        declaration.Name,
+					Description: declaration.Description,
+					Parameters:  declaration.Parameters,
+				},
+			})
+		}
+	}
+	if len(tools) > 0 {
+		request.Tools = tools
+	}
+	if r.ToolConfig != nil && r.ToolConfig.FunctionCallingConfig != nil {
+		switch strings.ToUpper(r.ToolConfig.FunctionCallingConfig.Mode) {
+		case "AUTO":
+			request.ToolChoice = "auto"
+		case "NONE":
+			request.ToolChoice = "none"
+		case "ANY":
+			allowed := r.ToolConfig.FunctionCallingConfig.AllowedFunctionNames
+			if len(allowed) == 1 {
+				request.ToolChoice = map[string]any{
+					"type":     "function",
+					"function": map[string]string{"name": allowed[0]},
+				}
+			} else {
+				request.ToolChoice = "required"
+			}
+		}
+	}
+	return request
+}
+
+// FinishReasonOpenAI2Gemini 将 OpenAI 的 finish_reason 转换为 Gemini 的 finishReason
+func FinishReasonOpenAI2Gemini(reason string) string {
+	switch strings.ToLower(reason) {
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
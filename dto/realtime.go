@@ -0,0 +1,49 @@
+package dto
+
+const (
+	RealtimeEventTypeError           = "error"
+	RealtimeEventTypeSessionUpdate   = "session.update"
+	RealtimeEventTypeResponseCreate  = "response.create"
+	RealtimeEventTypeResponseCreated = "response.created"
+	RealtimeEventTypeResponseDone    = "response.done"
+)
+
+type RealtimeEvent struct {
+	EventId  string            `json:"event_id,omitempty"`
+	Type     string            `json:"type"`
+	Session  *RealtimeSession  `json:"session,omitempty"`
+	Response *RealtimeResponse `json:"response,omitempty"`
+	Error    *OpenAIError      `json:"error,omitempty"`
+}
+
+type RealtimeSession struct {
+	// MaxResponseOutputTokens 整数或 "inf"
+	MaxResponseOutputTokens any `json:"max_response_output_tokens,omitempty"`
+}
+
+type RealtimeResponse struct {
+	Id     string         `json:"id"`
+	Status string         `json:"status"`
+	Usage  *RealtimeUsage `json:"usage"`
+	// MaxResponseOutputTokens 客户端 response.create 事件中的最大输出 token 数，整数或 "inf"
+	MaxResponseOutputTokens any `json:"max_response_output_tokens,omitempty"`
+}
+
+type RealtimeUsage struct {
+	TotalTokens        int                 `json:"total_tokens"`
+	InputTokens        int                 `json:"input_tokens"`
+	OutputTokens       int                 `json:"output_tokens"`
+	InputTokenDetails  RealtimeInputTokens `json:"input_token_details"`
+	OutputTokenDetails RealtimeTokens      `json:"output_token_details"`
+}
+
+type RealtimeInputTokens struct {
+	CachedTokens int `json:"cached_tokens"`
+	TextTokens   int `json:"text_tokens"`
+	AudioTokens  int `json:"audio_tokens"`
+}
+
+type RealtimeTokens struct {
+	TextTokens  int `json:"text_tokens"`
+	AudioTokens int `json:"audio_tokens"`
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"fmt"
 	"log"
@@ -97,6 +98,12 @@ func main() {
 		common.SafeGoroutine(func() {
 			controller.UpdateTaskBulk()
 		})
+		common.SafeGoroutine(func() {
+			model.CleanExpiredBodyCaptures()
+		})
+		common.SafeGoroutine(func() {
+			controller.AutomaticallyBillFileStorage()
+		})
 	}
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		common.BatchUpdateEnabled = true
@@ -112,6 +119,14 @@ func main() {
 		common.SysLog("pprof enabled")
 	}
 
+	shutdownTracer, err := common.InitTracer()
+	if err != nil {
+		common.FatalLog("failed to initialize tracing: " + err.Error())
+	}
+	defer func() {
+		_ = shutdownTracer(context.Background())
+	}()
+
 	service.InitTokenEncoders()
 
 	// Initialize HTTP server
@@ -128,6 +143,7 @@ func main() {
 	// This will cause SSE not to work!!!
 	//server.Use(gzip.Gzip(gzip.DefaultCompression))
 	server.Use(middleware.RequestId())
+	server.Use(middleware.Tracing())
 	middleware.SetUpLogger(server)
 	// Initialize session store
 	store := cookie.NewStore([]byte(common.SessionSecret))
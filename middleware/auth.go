@@ -3,6 +3,8 @@ package middleware
 import (
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
 	"net/http"
 	"one-api/common"
 	"one-api/model"
@@ -95,9 +97,31 @@ func RootAuth() func(c *gin.Context) {
 
 func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		span, endSpan := common.StartRequestSpan(c, "TokenAuth")
+		defer endSpan()
 		key := c.Request.Header.Get("Authorization")
 		parts := make([]string, 0)
 		key = strings.TrimPrefix(key, "Bearer ")
+		if key == "" {
+			// Anthropic 客户端通过 x-api-key 传递令牌
+			key = c.Request.Header.Get("x-api-key")
+		}
+		if key == "" && websocket.IsWebSocketUpgrade(c.Request) {
+			// 浏览器 WebSocket 客户端无法设置请求头，令牌通过 openai-insecure-api-key.<key> 子协议传递
+			for _, protocol := range websocket.Subprotocols(c.Request) {
+				if strings.HasPrefix(protocol, "openai-insecure-api-key.") {
+					key = strings.TrimPrefix(protocol, "openai-insecure-api-key.")
+					break
+				}
+			}
+		}
+		if key == "" && strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") {
+			// Google GenAI 客户端通过 x-goog-api-key 或 key 查询参数传递令牌，仅 Gemini 原生接口接受，避免其他接口的令牌出现在 URL 中
+			key = c.Request.Header.Get("x-goog-api-key")
+			if key == "" {
+				key = c.Query("key")
+			}
+		}
 		if key == "" || key == "midjourney-proxy" {
 			key = c.Request.Header.Get("mj-api-secret")
 			key = strings.TrimPrefix(key, "Bearer ")
@@ -123,10 +147,14 @@ func TokenAuth() func(c *gin.Context) {
 			abortWithOpenAiMessage(c, http.StatusForbidden, "用户已被封禁")
 			return
 		}
+		span.SetAttributes(attribute.Int("user_id", token.UserId), attribute.Int("token_id", token.Id))
+		common.SetLogField(c, "user_id", token.UserId)
+		common.SetLogField(c, "token_id", token.Id)
 		c.Set("id", token.UserId)
 		c.Set("token_id", token.Id)
 		c.Set("token_name", token.Name)
 		c.Set("token_unlimited_quota", token.UnlimitedQuota)
+		c.Set("token_model_fallback_enabled", token.ModelFallbackEnabled)
 		if !token.UnlimitedQuota {
 			c.Set("token_quota", token.RemainQuota)
 		}
@@ -144,6 +172,7 @@ func TokenAuth() func(c *gin.Context) {
 				return
 			}
 		}
+		endSpan()
 		c.Next()
 	}
 }
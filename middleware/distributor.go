@@ -1,11 +1,8 @@
 package middleware
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"one-api/common"
 	"one-api/constant"
@@ -17,46 +14,28 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ModelRequest struct {
 	Model string `json:"model"`
 }
 
-func geTexttRequest(c *gin.Context) (*dto.GeneralOpenAIRequest, error) {
-	textRequest := &dto.GeneralOpenAIRequest{}
-	err := common.UnmarshalBodyReusable(c, textRequest)
-	if err != nil {
-		return nil, err
-	}
-	if textRequest.Messages == nil || len(textRequest.Messages) == 0 {
-		return nil, errors.New("field messages is required")
-	}
-	return textRequest, nil
-}
-
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		span, endSpan := common.StartRequestSpan(c, "Distribute")
+		defer endSpan()
 		userId := c.GetInt("id")
-		input_tokens := 0
-		textRequest, err := geTexttRequest(c)
-		if err != nil {
-			fmt.Println(err)
-		}
-		prompt_tokens, err := service.CountTokenChatRequest(*textRequest, textRequest.Model)
-		if err == nil {
-			input_tokens = prompt_tokens
-		}
-		fmt.Println("input_tokens: ", input_tokens)
-
 		var channel *model.Channel
+		var release func()
 		channelId, ok := c.Get("specific_channel_id")
 		modelRequest, shouldSelectChannel, err := getModelRequest(c)
 		if err != nil {
-			fmt.Println(err)
+			return
 		}
 		userGroup, _ := model.CacheGetUserGroup(userId)
 		c.Set("group", userGroup)
+		span.SetAttributes(attribute.String("group", userGroup), attribute.String("model", modelRequest.Model))
 		if ok {
 			id, err := strconv.Atoi(channelId.(string))
 			if err != nil {
@@ -72,18 +51,14 @@ func Distribute() func(c *gin.Context) {
 				abortWithOpenAiMessage(c, http.StatusForbidden, "该渠道已被禁用")
 				return
 			}
+			// 指定渠道的请求不受限流限制，但仍计入渠道的用量
+			release = model.ChannelLimitAcquire(channel, modelRequest.Model, service.GetRequestMeta(c).PromptTokens)
 		} else {
 			// Select a channel for the user
 			// check token model mapping
 			modelLimitEnable := c.GetBool("token_model_limit_enabled")
 			if modelLimitEnable {
-				s, ok := c.Get("token_model_limit")
-				var tokenModelLimit map[string]bool
-				if ok {
-					tokenModelLimit = s.(map[string]bool)
-				} else {
-					tokenModelLimit = map[string]bool{}
-				}
+				tokenModelLimit := getTokenModelLimit(c)
 				if tokenModelLimit != nil {
 					if _, ok := tokenModelLimit[modelRequest.Model]; !ok {
 						abortWithOpenAiMessage(c, http.StatusForbidden, "该令牌无权访问模型 "+modelRequest.Model)
@@ -95,91 +70,55 @@ func Distribute() func(c *gin.Context) {
 					return
 				}
 			}
-			// 在不影响后续通过c.Request.Body 获取 body 的情况下，将 body 读取出来
-
-			// 读取 body
-			var bodyBytes []byte
-			if c.Request.Body != nil {
-				bodyBytes, _ = io.ReadAll(c.Request.Body)
-			}
-
-			// 将 body 内容重新设置回 c.Request.Body
-			c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
-			// 解析 body 到请求的结构体
-
-			// 解析 JSON 请求数据
-			// 检查是否有 messages 字段并解析
-			isImage := false
-			isStream := false
-			isSystemPrompt := false
-			isNORLogprobs := false
-			isFunctionCall := false
-			var requestData map[string]interface{}
-			if err := json.Unmarshal(bodyBytes, &requestData); err != nil {
-				fmt.Println("解析 JSON 请求数据失败")
-			} else {
-				// 如果 包含 stream 字段，查看是否是 true
-				if stream, exists := requestData["stream"]; exists {
-					if stream == true {
-						isStream = true
-					}
+			if shouldSelectChannel {
+				meta := service.GetRequestMeta(c)
+				_, selectSpan := common.StartSpan(c.Request.Context(), "SelectChannel",
+					attribute.Bool("is_image", meta.IsImage),
+					attribute.Bool("is_stream", meta.IsStream),
+					attribute.Bool("is_system_prompt", meta.IsSystemPrompt),
+					attribute.Bool("is_nor_logprobs", meta.IsNORLogprobs),
+					attribute.Bool("is_function_call", meta.IsFunctionCall),
+					attribute.Int("prompt_tokens", meta.PromptTokens),
+					attribute.Int("max_tokens", meta.MaxTokens),
+				)
+				channel, release = getAffinityChannel(c, userGroup, modelRequest.Model, meta)
+				selectSpan.SetAttributes(attribute.Bool("affinity_hit", channel != nil))
+				if channel == nil {
+					channel, release, err = model.CacheGetRandomSatisfiedChannel(userGroup, modelRequest.Model, 0, meta.IsImage, meta.IsStream, meta.IsSystemPrompt, meta.IsNORLogprobs, meta.IsFunctionCall, meta.PromptTokens, meta.MaxTokens)
 				}
-				// 如果 包含 logprobs 字段，查看是否是 NOR
-				if logprobs, exists := requestData["logprobs"]; exists {
-					// fmt.Println("logprobs: ", logprobs)
-					// 打印下 logprobs 的值
-					if logprobs == true {
-						isNORLogprobs = true
+				if err != nil || channel == nil {
+					// 请求的模型无可用渠道时，按降级链选择第一个有可用渠道的模型
+					for _, fallbackModel := range GetModelFallbackChain(c, userGroup, modelRequest.Model) {
+						// 降级模型的分词器可能不同，按降级模型计算提示词 token 数选择渠道
+						fallbackPromptTokens, _ := meta.CountPromptTokens(fallbackModel)
+						fallbackChannel, fallbackRelease, fallbackErr := model.CacheGetRandomSatisfiedChannel(userGroup, fallbackModel, 0, meta.IsImage, meta.IsStream, meta.IsSystemPrompt, meta.IsNORLogprobs, meta.IsFunctionCall, fallbackPromptTokens, meta.MaxTokens)
+						if fallbackErr != nil || fallbackChannel == nil {
+							continue
+						}
+						if fallbackErr = SetModelFallback(c, modelRequest.Model, fallbackModel); fallbackErr != nil {
+							fallbackRelease()
+							common.LogError(c.Request.Context(), "model fallback failed: "+fallbackErr.Error())
+							break
+						}
+						common.LogInfo(c.Request.Context(), fmt.Sprintf("no available channel for model %s, fallback to model %s", modelRequest.Model, fallbackModel))
+						modelRequest.Model = fallbackModel
+						channel, release, err = fallbackChannel, fallbackRelease, nil
+						break
 					}
 				}
-				// 如果 包含 n 字段，如果不是 1， isNORLogprobs 为 true
-				if n, exists := requestData["n"]; exists {
-					// 转换成int类型,转换失败就是1
-					tmp_n, err := strconv.Atoi(fmt.Sprintf("%v", n))
-					if err != nil {
-						tmp_n = 1
-					}
-
-					// fmt.Println("n: ", tmp_n)
-					if tmp_n != 1 {
-						isNORLogprobs = true
-					}
+				if channel != nil {
+					selectSpan.SetAttributes(attribute.Int("channel_id", channel.Id), attribute.String("selected_model", modelRequest.Model))
 				}
-				// 如果 messages 是数组，遍历每个 message
-				if messages, ok := requestData["messages"].([]interface{}); ok {
-					for _, message := range messages {
-						if msgMap, ok := message.(map[string]interface{}); ok {
-							if content, exists := msgMap["content"]; exists {
-								switch content.(type) {
-								case []interface{}:
-									for _, item := range content.([]interface{}) {
-										if itemMap, ok := item.(map[string]interface{}); ok {
-											if t, exists := itemMap["type"]; exists && t == "image_url" {
-												isImage = true
-											}
-										}
-									}
-								}
-							}
-							// 如果tool_calls存在，说明是FunctionCall
-							if _, exists := msgMap["tool_calls"]; exists {
-								isFunctionCall = true
-							}
-							// 如果包含 role 字段，查看是否是 system
-							if role, exists := msgMap["role"]; exists {
-								if role == "system" {
-									isSystemPrompt = true
-								}
-							}
-						}
-					}
+				common.SetSpanError(selectSpan, err)
+				selectSpan.End()
+				if errors.Is(err, model.ErrContextLengthExceeded) {
+					abortWithOpenAiErrorCode(c, http.StatusBadRequest, "context_length_exceeded", fmt.Sprintf("请求的 token 数（提示词 %d + max_tokens %d）超过了当前分组 %s 下模型 %s 所有渠道的上下文窗口", meta.PromptTokens, meta.MaxTokens, userGroup, modelRequest.Model))
+					return
+				}
+				if errors.Is(err, model.ErrChannelSaturated) {
+					abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf("当前分组 %s 下对于模型 %s 的渠道均已达到并发或速率限制，请稍后再试", userGroup, modelRequest.Model))
+					return
 				}
-			}
-			if shouldSelectChannel {
-				channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, modelRequest.Model, 0, isImage, isStream, isSystemPrompt, isNORLogprobs, isFunctionCall, input_tokens)
-
-				fmt.Println("3: ")
 				if err != nil {
 					message := fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道", userGroup, modelRequest.Model)
 					// 如果错误，但是渠道不为空，说明是数据库一致性问题
@@ -197,11 +136,89 @@ func Distribute() func(c *gin.Context) {
 				}
 			}
 		}
-		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
+		defer ReleaseChannelLimit(c)
+		SetupContextForSelectedChannel(c, channel, modelRequest.Model, release)
+		if channel != nil {
+			span.SetAttributes(attribute.Int("channel_id", channel.Id), attribute.Int("channel_type", channel.Type))
+		}
+		endSpan()
 		c.Next()
 	}
 }
 
+// getAffinityChannel 返回会话上次使用且仍然可用的渠道及其限流额度的释放函数，未命中时返回 nil 并按正常方式选择渠道
+func getAffinityChannel(c *gin.Context, group string, modelName string, meta *service.RequestMeta) (*model.Channel, func()) {
+	key, source := service.GetChannelAffinityKey(c, group, modelName)
+	if key == "" {
+		return nil, nil
+	}
+	c.Set("channel_affinity_key", key)
+	c.Set("channel_affinity_source", source)
+	channelId, keyId := model.GetChannelAffinity(key)
+	if channelId == 0 {
+		c.Set("channel_affinity", "miss")
+		return nil, nil
+	}
+	channel, release := model.CacheGetAffinityChannel(group, modelName, channelId, meta.IsImage, meta.IsStream, meta.IsSystemPrompt, meta.IsNORLogprobs, meta.IsFunctionCall, meta.PromptTokens, meta.MaxTokens)
+	if channel == nil {
+		// 渠道已不可用，回退到正常选择
+		c.Set("channel_affinity", "fallback")
+		return nil, nil
+	}
+	c.Set("channel_affinity", "hit")
+	c.Set("channel_affinity_key_id", keyId)
+	return channel, release
+}
+
+func getTokenModelLimit(c *gin.Context) map[string]bool {
+	s, ok := c.Get("token_model_limit")
+	if !ok {
+		return map[string]bool{}
+	}
+	return s.(map[string]bool)
+}
+
+// GetModelFallbackChain 返回请求的模型在分组中配置的降级模型，令牌开启模型降级且请求格式支持改用其他模型时才生效，
+// 令牌限制了可用模型时跳过无权访问的模型
+func GetModelFallbackChain(c *gin.Context, group string, modelName string) []string {
+	if !c.GetBool("token_model_fallback_enabled") || !service.GetRequestMeta(c).SupportsModelFallback() {
+		return nil
+	}
+	modelLimitEnable := c.GetBool("token_model_limit_enabled")
+	tokenModelLimit := getTokenModelLimit(c)
+	chain := make([]string, 0)
+	for _, fallbackModel := range common.GetModelFallback(group, modelName) {
+		if fallbackModel == "" || fallbackModel == modelName {
+			continue
+		}
+		if modelLimitEnable && !tokenModelLimit[fallbackModel] {
+			continue
+		}
+		chain = append(chain, fallbackModel)
+	}
+	return chain
+}
+
+// SetModelFallback 将请求改为使用降级模型，并记录原始请求的模型
+func SetModelFallback(c *gin.Context, requestedModel string, fallbackModel string) error {
+	err := service.SetRequestModel(c, fallbackModel)
+	if err != nil {
+		return err
+	}
+	if c.GetString("model_fallback_from") == "" {
+		c.Set("model_fallback_from", requestedModel)
+	}
+	return nil
+}
+
+// ReleaseChannelLimit 释放当前请求占用的渠道并发数
+func ReleaseChannelLimit(c *gin.Context) {
+	if release, ok := c.Value("channel_limit_release").(func()); ok {
+		release()
+		c.Set("channel_limit_release", nil)
+	}
+}
+
 func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 	var modelRequest ModelRequest
 	shouldSelectChannel := true
@@ -248,6 +265,20 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 		}
 		c.Set("platform", string(constant.TaskPlatformSuno))
 		c.Set("relay_mode", relayMode)
+	} else if strings.HasPrefix(c.Request.URL.Path, "/v1/images/edits") || strings.HasPrefix(c.Request.URL.Path, "/v1/images/variations") {
+		// 图片编辑与变体为 multipart 请求，模型在表单字段中
+		form, formErr := common.ParseMultipartFormReusable(c)
+		if formErr != nil {
+			err = formErr
+		} else {
+			if models := form.Value["model"]; len(models) > 0 {
+				modelRequest.Model = models[0]
+			}
+			_ = form.RemoveAll()
+		}
+		if modelRequest.Model == "" {
+			modelRequest.Model = "dall-e-2"
+		}
 	} else if !strings.HasPrefix(c.Request.URL.Path, "/v1/audio/transcriptions") {
 		err = common.UnmarshalBodyReusable(c, &modelRequest)
 	}
@@ -265,6 +296,20 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 			modelRequest.Model = c.Param("model")
 		}
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") {
+		if modelRequest.Model == "" {
+			modelRequest.Model, _ = relayconstant.ParseGeminiPath(c.Request.URL.Path)
+		}
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/realtime") {
+		// Realtime 为 WebSocket 请求，模型在查询参数中
+		if modelRequest.Model == "" {
+			modelRequest.Model = c.Query("model")
+		}
+		if modelRequest.Model == "" {
+			modelRequest.Model = "gpt-4o-realtime-preview"
+		}
+	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/generations") {
 		if modelRequest.Model == "" {
 			modelRequest.Model = "dall-e"
@@ -282,13 +327,21 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 	return &modelRequest, shouldSelectChannel, nil
 }
 
-func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) {
+// SetupContextForSelectedChannel 设置选中渠道的上下文，release 为选择渠道时占用的限流额度的释放函数，在请求结束或重试时调用
+func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string, release func()) {
 	c.Set("original_model", modelName) // for retry
+	common.SetLogField(c, "model", modelName)
 	if channel == nil {
 		return
 	}
+	// 重试时先释放上一个渠道占用的并发数
+	ReleaseChannelLimit(c)
+	if release != nil {
+		c.Set("channel_limit_release", release)
+	}
 	c.Set("channel", channel.Type)
 	c.Set("channel_id", channel.Id)
+	common.SetLogField(c, "channel_id", channel.Id)
 	c.Set("channel_name", channel.Name)
 	c.Set("channel_type", channel.Type)
 	ban := true
@@ -302,7 +355,17 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	c.Set("auto_ban", ban)
 	c.Set("model_mapping", channel.GetModelMapping())
 	c.Set("status_code_mapping", channel.GetStatusCodeMapping())
-	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+	c.Set("channel_first_token_timeout", channel.GetFirstTokenTimeout())
+	key := channel.Key
+	c.Set("channel_key_id", 0)
+	// 渠道亲和命中时优先使用会话上次的密钥
+	preferredKeyId := c.GetInt("channel_affinity_key_id")
+	c.Set("channel_affinity_key_id", 0)
+	if channelKey := model.SelectChannelKey(channel, preferredKeyId); channelKey != nil {
+		key = channelKey.Key
+		c.Set("channel_key_id", channelKey.Id)
+	}
+	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
 	c.Set("base_url", channel.GetBaseURL())
 	// TODO: api_version统一
 	switch channel.Type {
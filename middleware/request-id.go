@@ -11,6 +11,7 @@ func RequestId() func(c *gin.Context) {
 		id := common.GetTimeString() + common.GetRandomString(8)
 		c.Set(common.RequestIdKey, id)
 		ctx := context.WithValue(c.Request.Context(), common.RequestIdKey, id)
+		ctx = common.WithLogFields(ctx)
 		c.Request = c.Request.WithContext(ctx)
 		c.Header(common.RequestIdKey, id)
 		c.Next()
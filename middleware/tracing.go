@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"one-api/common"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Tracing 为每个请求开始根 span，延续调用方的 W3C trace context，并与请求 Id 互相关联：
+// span 上记录请求 Id，响应头 X-Trace-Id 返回 trace id
+func Tracing() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		ctx := common.ExtractTraceContext(c.Request.Context(), c.Request.Header)
+		ctx, span := common.StartSpan(ctx, c.Request.Method+" "+route,
+			attribute.String("http.method", c.Request.Method),
+			attribute.String("http.route", route),
+			attribute.String("request_id", c.GetString(common.RequestIdKey)),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+		if span.IsRecording() {
+			c.Header("X-Trace-Id", common.TraceId(ctx))
+			common.SetLogField(ctx, "trace_id", common.TraceId(ctx))
+		}
+		c.Next()
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, fmt.Sprintf("status %d", status))
+		}
+	}
+}
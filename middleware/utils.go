@@ -16,6 +16,19 @@ func abortWithOpenAiMessage(c *gin.Context, statusCode int, message string) {
 	common.LogError(c.Request.Context(), message)
 }
 
+// abortWithOpenAiErrorCode 与 abortWithOpenAiMessage 相同，附带 OpenAI 格式的错误码，便于客户端识别
+func abortWithOpenAiErrorCode(c *gin.Context, statusCode int, code string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": gin.H{
+			"message": common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
+			"type":    "new_api_error",
+			"code":    code,
+		},
+	})
+	c.Abort()
+	common.LogError(c.Request.Context(), message)
+}
+
 func abortWithMidjourneyMessage(c *gin.Context, statusCode int, code int, description string) {
 	c.JSON(statusCode, gin.H{
 		"description": description,
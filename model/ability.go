@@ -18,12 +18,11 @@ type Ability struct {
 	Priority              *int64 `json:"priority" gorm:"bigint;default:0;index"`
 	Weight                uint   `json:"weight" gorm:"default:0;index"`
 	IsImage               bool   `json:"is_image" gorm:"default:false"`
-	MaxInputTokensLow     *int   `json:"max_input_tokens_low" gorm:"default:0"`
-	MaxInputTokensHigh    *int   `json:"max_input_tokens_high" gorm:"default:0"`
 	IsSupportStream       *bool  `json:"is_support_stream" gorm:"default:false"`
 	IsSupportSystemPrompt *bool  `json:"is_support_system_prompt" gorm:"default:false"`
 	IsSupportNORLogprobs  *bool  `json:"is_support_nor_logprobs" gorm:"default:false"`
 	IsSupportFunctionCall *bool  `json:"is_support_function_call" gorm:"default:false"`
+	ContextWindow         int    `json:"context_window" gorm:"default:0"`
 }
 
 func GetGroupModels(group string) []string {
@@ -101,7 +100,33 @@ func getChannelQuery(group string, model string, retry int) *gorm.DB {
 	return channelQuery
 }
 
-func GetRandomSatisfiedChannel(group string, model string, retry int, isImage bool, isStream bool, isSystemPrompt bool, isNORLogprobs bool, isFunctionCall bool, inputTokens int) (*Channel, error) {
+func GetRandomSatisfiedChannel(group string, model string, retry int, isImage bool, isStream bool, isSystemPrompt bool, isNORLogprobs bool, isFunctionCall bool, inputTokens int, maxTokens int) (*Channel, func(), error) {
+	channel, release, err := getRandomSatisfiedChannelByRetry(group, model, retry, isImage, isStream, isSystemPrompt, isNORLogprobs, isFunctionCall, inputTokens, maxTokens)
+	if !errors.Is(err, ErrChannelSaturated) && !errors.Is(err, ErrContextLengthExceeded) {
+		return channel, release, err
+	}
+	// 该优先级的渠道全部达到限流或上下文窗口不足时，依次尝试更低的优先级
+	saturated := errors.Is(err, ErrChannelSaturated)
+	var priorityCount int64
+	groupCol := "`group`"
+	if common.UsingPostgreSQL {
+		groupCol = `"group"`
+	}
+	DB.Model(&Ability{}).Where(groupCol+" = ? and model = ? and enabled = ?", group, model, true).Distinct("priority").Count(&priorityCount)
+	for r := retry + 1; r < int(priorityCount); r++ {
+		channel, release, err = getRandomSatisfiedChannelByRetry(group, model, r, isImage, isStream, isSystemPrompt, isNORLogprobs, isFunctionCall, inputTokens, maxTokens)
+		if err == nil {
+			return channel, release, nil
+		}
+		saturated = saturated || errors.Is(err, ErrChannelSaturated)
+	}
+	if saturated {
+		return nil, nil, ErrChannelSaturated
+	}
+	return nil, nil, ErrContextLengthExceeded
+}
+
+func getRandomSatisfiedChannelByRetry(group string, model string, retry int, isImage bool, isStream bool, isSystemPrompt bool, isNORLogprobs bool, isFunctionCall bool, inputTokens int, maxTokens int) (*Channel, func(), error) {
 	var abilities []Ability
 
 	var err error = nil
@@ -115,23 +140,7 @@ func GetRandomSatisfiedChannel(group string, model string, retry int, isImage bo
 	// }
 	// 这里 根据 isImage, isStream, isSystemPrompt, isNORLogprobs, isFunctionCall 过滤
 	// 如果 需要 过滤的字段 是 true, 则过滤掉不是 true 的
-	if isImage {
-		channelQuery = channelQuery.Where("is_image = ?", true)
-	}
-	if isStream {
-		channelQuery = channelQuery.Where("is_support_stream = ?", true)
-	}
-	if isSystemPrompt {
-		channelQuery = channelQuery.Where("is_support_system_prompt = ?", true)
-	}
-	if isNORLogprobs {
-		channelQuery = channelQuery.Where("is_support_nor_logprobs = ?", true)
-	}
-	if isFunctionCall {
-		channelQuery = channelQuery.Where("is_support_function_call = ?", true)
-	}
-	// 这里是根据 inputTokens 过滤
-	channelQuery = channelQuery.Where("max_input_tokens_low <= ? and max_input_tokens_high >= ?", inputTokens, inputTokens)
+	channelQuery = whereCapability(channelQuery, isImage, isStream, isSystemPrompt, isNORLogprobs, isFunctionCall)
 	// 打印下 channelQuery
 	// fmt.Println(channelQuery)
 	if common.UsingSQLite || common.UsingPostgreSQL {
@@ -140,35 +149,72 @@ func GetRandomSatisfiedChannel(group string, model string, retry int, isImage bo
 		err = channelQuery.Order("weight DESC").Find(&abilities).Error
 	}
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	// 按提示词与 max_tokens 之和过滤上下文窗口不足的渠道
+	fitted := make([]Ability, 0, len(abilities))
+	for _, ability := range abilities {
+		if fitContextWindow(ability.ContextWindow, model, inputTokens+maxTokens) {
+			fitted = append(fitted, ability)
+		}
 	}
+	if len(abilities) > 0 && len(fitted) == 0 {
+		return nil, nil, ErrContextLengthExceeded
+	}
+	abilities = fitted
 	channel := Channel{}
-	if len(abilities) > 0 {
-		// Randomly choose one
-		weightSum := uint(0)
-		for _, ability_ := range abilities {
-			weightSum += ability_.Weight + 10
+	var release func()
+	indexes, breaker := filterChannelBreaker(len(abilities), func(i int) int {
+		return abilities[i].ChannelId
+	}, model)
+	if len(indexes) > 0 {
+		channelIds := make([]int, 0, len(indexes))
+		for _, i := range indexes {
+			channelIds = append(channelIds, abilities[i].ChannelId)
+		}
+		var channels []*Channel
+		err = DB.Where("id in (?)", channelIds).Find(&channels).Error
+		if err != nil {
+			return nil, nil, err
 		}
-		// Randomly choose one
-		weight := common.GetRandomInt(int(weightSum))
-		for _, ability_ := range abilities {
-			weight -= int(ability_.Weight) + 10
-			//log.Printf("weight: %d, ability weight: %d", weight, *ability_.Weight)
-			if weight <= 0 {
-				channel.Id = ability_.ChannelId
-				break
+		id2channel := make(map[int]*Channel, len(channels))
+		for _, c := range channels {
+			id2channel[c.Id] = c
+		}
+
+		weights := channelRoutingWeights(group, model, indexes, func(i int) int {
+			return abilities[i].ChannelId
+		}, func(i int) int {
+			return int(abilities[i].Weight)
+		})
+		// 按权重随机选择一个渠道，并占用其限流额度与熔断器的探测名额
+		var i int
+		i, release = acquireWeightedChannel(indexes, weights, func(i int) *Channel {
+			if c, ok := id2channel[abilities[i].ChannelId]; ok {
+				return c
 			}
+			return &Channel{Id: abilities[i].ChannelId}
+		}, model, inputTokens, breaker)
+		if i < 0 {
+			return nil, nil, ErrChannelSaturated
 		}
+		channel.Id = abilities[i].ChannelId
 	} else {
-		return nil, errors.New("channel not found")
+		return nil, nil, errors.New("channel not found")
 	}
 	err = DB.First(&channel, "id = ?", channel.Id).Error
-	return &channel, err
+	if err != nil {
+		// 渠道已不存在，返回渠道 id 供调用方记录
+		release()
+		return &channel, nil, err
+	}
+	return &channel, release, nil
 }
 
 func (channel *Channel) AddAbilities() error {
 	models_ := strings.Split(channel.Models, ",")
 	groups_ := strings.Split(channel.Group, ",")
+	contextWindows := channel.GetContextWindows()
 	abilities := make([]Ability, 0, len(models_))
 	for _, model := range models_ {
 		for _, group := range groups_ {
@@ -184,8 +230,7 @@ func (channel *Channel) AddAbilities() error {
 				IsSupportSystemPrompt: channel.IsSupportSystemPrompt,
 				IsSupportNORLogprobs:  channel.IsSupportNORLogprobs,
 				IsSupportFunctionCall: channel.IsSupportFunctionCall,
-				MaxInputTokensLow:     channel.MaxInputTokensLow,
-				MaxInputTokensHigh:    channel.MaxInputTokensHigh,
+				ContextWindow:         contextWindows[model],
 			}
 			abilities = append(abilities, ability)
 		}
@@ -274,3 +319,8 @@ func FixAbility() (int, error) {
 	InitChannelCache()
 	return count, nil
 }
+
+// UpdateAbilityCapabilities 更新渠道某个模型在所有分组下的能力，values 的键为 abilities 表的列名
+func UpdateAbilityCapabilities(channelId int, model string, values map[string]interface{}) error {
+	return DB.Model(&Ability{}).Where("channel_id = ? and model = ?", channelId, model).Updates(values).Error
+}
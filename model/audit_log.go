@@ -0,0 +1,101 @@
+package model
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"one-api/common"
+)
+
+// AuditLog 管理员的配置变更与资金相关操作的审计记录，单独保存，只能新增，不能修改或删除，清理历史日志时不受影响
+type AuditLog struct {
+	Id           int    `json:"id"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;index"`
+	OperatorId   int    `json:"operator_id" gorm:"index"`
+	OperatorName string `json:"operator_name" gorm:"index;default:''"`
+	Ip           string `json:"ip" gorm:"default:''"`
+	Action       string `json:"action" gorm:"type:varchar(64);index"`
+	TargetType   string `json:"target_type" gorm:"type:varchar(32);index:idx_audit_target,priority:1"`
+	TargetId     string `json:"target_id" gorm:"type:varchar(64);index:idx_audit_target,priority:2"`
+	Content      string `json:"content"`
+	// Changes 字段级变更，JSON 数组，每项为 {"field","before","after"}，密钥类字段已脱敏
+	Changes string `json:"changes"`
+}
+
+var ErrAuditLogImmutable = errors.New("审计日志不可修改或删除")
+
+func (log *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+func (log *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+func (log *AuditLog) Insert() error {
+	log.CreatedAt = common.GetTimestamp()
+	return DB.Create(log).Error
+}
+
+type AuditLogQueryParams struct {
+	OperatorName   string
+	Action         string
+	TargetType     string
+	TargetId       string
+	Keyword        string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+func auditLogQuery(params AuditLogQueryParams) *gorm.DB {
+	tx := DB.Model(&AuditLog{})
+	if params.OperatorName != "" {
+		tx = tx.Where("operator_name = ?", params.OperatorName)
+	}
+	if params.Action != "" {
+		tx = tx.Where("action = ?", params.Action)
+	}
+	if params.TargetType != "" {
+		tx = tx.Where("target_type = ?", params.TargetType)
+	}
+	if params.TargetId != "" {
+		tx = tx.Where("target_id = ?", params.TargetId)
+	}
+	if params.Keyword != "" {
+		tx = tx.Where("content LIKE ?", "%"+params.Keyword+"%")
+	}
+	if params.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", params.StartTimestamp)
+	}
+	if params.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", params.EndTimestamp)
+	}
+	return tx
+}
+
+func GetAuditLogs(params AuditLogQueryParams, startIdx int, num int) (logs []*AuditLog, err error) {
+	err = auditLogQuery(params).Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	return logs, err
+}
+
+// ExportAuditLogs 按 id 倒序分批读取符合条件的审计日志，每批交给 fn 处理
+func ExportAuditLogs(params AuditLogQueryParams, fn func(logs []*AuditLog) error) error {
+	lastId := 0
+	for {
+		var logs []*AuditLog
+		tx := auditLogQuery(params)
+		if lastId > 0 {
+			tx = tx.Where("id < ?", lastId)
+		}
+		err := tx.Order("id desc").Limit(500).Find(&logs).Error
+		if err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		if err = fn(logs); err != nil {
+			return err
+		}
+		lastId = logs[len(logs)-1].Id
+	}
+}
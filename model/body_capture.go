@@ -0,0 +1,60 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"one-api/common"
+	"time"
+)
+
+// BodyCapture 保存的转发请求的请求体与响应体，以请求 Id 作为捕获 id，消费日志的 other.capture_id 指向该记录
+type BodyCapture struct {
+	Id                int    `json:"id"`
+	RequestId         string `json:"request_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId            int    `json:"user_id" gorm:"index"`
+	TokenId           int    `json:"token_id"`
+	ChannelId         int    `json:"channel_id"`
+	ModelName         string `json:"model_name" gorm:"default:''"`
+	Path              string `json:"path" gorm:"default:''"`
+	StatusCode        int    `json:"status_code"`
+	RequestBody       string `json:"request_body"`
+	ResponseBody      string `json:"response_body"`
+	RequestTruncated  bool   `json:"request_truncated"`
+	ResponseTruncated bool   `json:"response_truncated"`
+	CreatedAt         int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (capture *BodyCapture) Insert() error {
+	capture.CreatedAt = common.GetTimestamp()
+	return DB.Create(capture).Error
+}
+
+func GetBodyCaptureByRequestId(requestId string) (*BodyCapture, error) {
+	if requestId == "" {
+		return nil, errors.New("capture id 为空！")
+	}
+	capture := BodyCapture{}
+	err := DB.Where("request_id = ?", requestId).First(&capture).Error
+	return &capture, err
+}
+
+func DeleteBodyCapturesBefore(targetTimestamp int64) (int64, error) {
+	result := DB.Where("created_at < ?", targetTimestamp).Delete(&BodyCapture{})
+	return result.RowsAffected, result.Error
+}
+
+// CleanExpiredBodyCaptures 定期删除超过保存天数的请求体记录，关闭保存后已保存的记录同样会按期删除
+func CleanExpiredBodyCaptures() {
+	for {
+		if common.BodyCaptureRetentionDays > 0 {
+			targetTimestamp := time.Now().AddDate(0, 0, -common.BodyCaptureRetentionDays).Unix()
+			count, err := DeleteBodyCapturesBefore(targetTimestamp)
+			if err != nil {
+				common.SysError("failed to clean expired body captures: " + err.Error())
+			} else if count > 0 {
+				common.SysLog(fmt.Sprintf("cleaned %d expired body captures", count))
+			}
+		}
+		time.Sleep(time.Hour)
+	}
+}
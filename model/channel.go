@@ -2,6 +2,7 @@ package model
 
 import (
 	"encoding/json"
+	"fmt"
 	"one-api/common"
 
 	"gorm.io/gorm"
@@ -26,9 +27,8 @@ type Channel struct {
 	Models                string  `json:"models"`
 	Group                 string  `json:"group" gorm:"type:varchar(64);default:'default'"`
 	UsedQuota             int64   `json:"used_quota" gorm:"bigint;default:0"`
+	HedgeOverheadQuota    int64   `json:"hedge_overhead_quota" gorm:"bigint;default:0"`
 	ModelMapping          *string `json:"model_mapping" gorm:"type:varchar(1024);default:''"`
-	MaxInputTokensLow     *int    `json:"max_input_tokens_low" gorm:"default:0"`
-	MaxInputTokensHigh    *int    `json:"max_input_tokens_high" gorm:"default:0"`
 	StatusCodeMapping     *string `json:"status_code_mapping" gorm:"type:varchar(1024);default:''"`
 	Priority              *int64  `json:"priority" gorm:"bigint;default:0"`
 	AutoBan               *int    `json:"auto_ban" gorm:"default:1"`
@@ -38,6 +38,19 @@ type Channel struct {
 	IsSupportSystemPrompt *bool   `json:"is_support_system_prompt" gorm:"default:false"`
 	IsSupportNORLogprobs  *bool   `json:"is_support_nor_logprobs" gorm:"default:false"`
 	IsSupportFunctionCall *bool   `json:"is_support_function_call" gorm:"default:false"`
+	// KeySelection 密钥池的选择方式：round_robin（默认）或 random
+	KeySelection *string `json:"key_selection" gorm:"type:varchar(16);default:'round_robin'"`
+	// 渠道限流，0 表示不限制；ModelLimits 为 JSON，键为模型名称，值为该模型单独的限流
+	MaxConcurrency *int    `json:"max_concurrency" gorm:"default:0"`
+	RPMLimit       *int    `json:"rpm_limit" gorm:"default:0"`
+	TPMLimit       *int    `json:"tpm_limit" gorm:"default:0"`
+	ModelLimits    *string `json:"model_limits" gorm:"type:varchar(1024);default:''"`
+	// FirstTokenTimeout 流式请求的首字超时（秒），0 表示使用分组的设置
+	FirstTokenTimeout *int `json:"first_token_timeout" gorm:"default:0"`
+	// ContextWindows 为 JSON，键为模型名称，值为该渠道上模型的上下文窗口，覆盖全局的模型上下文窗口
+	ContextWindows *string `json:"context_windows" gorm:"type:varchar(1024);default:''"`
+	// modelLimits 缓存中的渠道在建立索引时解析的 ModelLimits
+	modelLimits map[string]ChannelLimit
 }
 
 func (channel *Channel) GetOtherInfo() map[string]interface{} {
@@ -155,6 +168,11 @@ func BatchDeleteChannels(ids []int) error {
 		tx.Rollback()
 		return err
 	}
+	err = deleteChannelKeysByChannelIds(tx, ids)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
 	// 提交事务
 	tx.Commit()
 	return err
@@ -195,6 +213,26 @@ func (channel *Channel) GetStatusCodeMapping() string {
 	return *channel.StatusCodeMapping
 }
 
+// GetContextWindows 返回渠道单独设置的模型上下文窗口
+func (channel *Channel) GetContextWindows() map[string]int {
+	contextWindows := make(map[string]int)
+	if channel.ContextWindows == nil || *channel.ContextWindows == "" {
+		return contextWindows
+	}
+	err := json.Unmarshal([]byte(*channel.ContextWindows), &contextWindows)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to unmarshal context windows of channel #%d: %s", channel.Id, err.Error()))
+	}
+	return contextWindows
+}
+
+func (channel *Channel) GetFirstTokenTimeout() int {
+	if channel.FirstTokenTimeout == nil {
+		return 0
+	}
+	return *channel.FirstTokenTimeout
+}
+
 func (channel *Channel) Insert() error {
 	var err error
 	err = DB.Create(channel).Error
@@ -216,6 +254,11 @@ func (channel *Channel) Update() error {
 	return err
 }
 
+// UpdateCapabilities 只更新渠道的能力字段，不重建 abilities，以保留按模型探测的结果
+func (channel *Channel) UpdateCapabilities(values map[string]interface{}) error {
+	return DB.Model(channel).Updates(values).Error
+}
+
 func (channel *Channel) UpdateResponseTime(responseTime int64) {
 	err := DB.Model(channel).Select("response_time", "test_time").Updates(Channel{
 		TestTime:     common.GetTimestamp(),
@@ -242,6 +285,10 @@ func (channel *Channel) Delete() error {
 	if err != nil {
 		return err
 	}
+	err = deleteChannelKeysByChannelIds(DB, []int{channel.Id})
+	if err != nil {
+		return err
+	}
 	err = channel.DeleteAbilities()
 	return err
 }
@@ -270,7 +317,7 @@ func UpdateChannelStatusById(id int, status int, reason string) {
 			common.SysError("failed to update channel status: " + err.Error())
 		}
 	}
-
+	CacheUpdateChannelStatus(id, status)
 }
 
 func UpdateChannelUsedQuota(id int, quota int) {
@@ -288,6 +335,25 @@ func updateChannelUsedQuota(id int, quota int) {
 	}
 }
 
+// UpdateChannelHedgeOverheadQuota 记录渠道上落败的对冲请求估算的上游消耗（实际消耗的下限），不向用户计费
+func UpdateChannelHedgeOverheadQuota(id int, quota int) {
+	if quota <= 0 {
+		return
+	}
+	if common.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeChannelHedgeOverheadQuota, id, quota)
+		return
+	}
+	updateChannelHedgeOverheadQuota(id, quota)
+}
+
+func updateChannelHedgeOverheadQuota(id int, quota int) {
+	err := DB.Model(&Channel{}).Where("id = ?", id).Update("hedge_overhead_quota", gorm.Expr("hedge_overhead_quota + ?", quota)).Error
+	if err != nil {
+		common.SysError("failed to update channel hedge overhead quota: " + err.Error())
+	}
+}
+
 func DeleteChannelByStatus(status int64) (int64, error) {
 	result := DB.Where("status = ?", status).Delete(&Channel{})
 	return result.RowsAffected, result.Error
@@ -0,0 +1,144 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 渠道亲和：同一会话的后续请求优先发往上次成功使用的渠道与密钥，以命中上游的提示词缓存。
+// 会话到渠道的映射在 ChannelAffinitySeconds 秒内有效，启用 Redis 时由所有节点共享，否则保存在内存中。
+// 渠道不再满足请求（已禁用、不支持该模型或能力、熔断、达到限流）时按正常方式选择渠道。
+
+type channelAffinityEntry struct {
+	channelId int
+	keyId     int
+	expiresAt int64
+}
+
+// channelAffinities 会话 -> 渠道，未启用 Redis 时使用
+var channelAffinities sync.Map
+var channelAffinitiesCleanedAt int64
+
+func channelAffinityRedisKey(key string) string {
+	return "channel_affinity:" + key
+}
+
+// GetChannelAffinity 返回会话上次使用的渠道与密钥，不存在时渠道为 0
+func GetChannelAffinity(key string) (int, int) {
+	if common.RedisEnabled {
+		value, err := common.RDB.Get(context.Background(), channelAffinityRedisKey(key)).Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) {
+				common.SysError("failed to get channel affinity: " + err.Error())
+			}
+			return 0, 0
+		}
+		var channelId, keyId int
+		_, _ = fmt.Sscanf(value, "%d:%d", &channelId, &keyId)
+		return channelId, keyId
+	}
+	value, ok := channelAffinities.Load(key)
+	if !ok {
+		return 0, 0
+	}
+	entry := value.(channelAffinityEntry)
+	if entry.expiresAt <= time.Now().Unix() {
+		channelAffinities.Delete(key)
+		return 0, 0
+	}
+	return entry.channelId, entry.keyId
+}
+
+// SetChannelAffinity 记录会话使用的渠道与密钥，并刷新有效期
+func SetChannelAffinity(key string, channelId int, keyId int) {
+	seconds := common.ChannelAffinitySeconds
+	if key == "" || channelId == 0 || seconds <= 0 {
+		return
+	}
+	if common.RedisEnabled {
+		err := common.RDB.Set(context.Background(), channelAffinityRedisKey(key), fmt.Sprintf("%d:%d", channelId, keyId), time.Duration(seconds)*time.Second).Err()
+		if err != nil {
+			common.SysError("failed to set channel affinity: " + err.Error())
+		}
+		return
+	}
+	now := time.Now().Unix()
+	channelAffinities.Store(key, channelAffinityEntry{
+		channelId: channelId,
+		keyId:     keyId,
+		expiresAt: now + int64(seconds),
+	})
+	cleanChannelAffinities(now)
+}
+
+// cleanChannelAffinities 清理内存中过期的会话，每分钟最多执行一次
+func cleanChannelAffinities(now int64) {
+	last := atomic.LoadInt64(&channelAffinitiesCleanedAt)
+	if now-last < 60 || !atomic.CompareAndSwapInt64(&channelAffinitiesCleanedAt, last, now) {
+		return
+	}
+	channelAffinities.Range(func(key, value any) bool {
+		if value.(channelAffinityEntry).expiresAt <= now {
+			channelAffinities.Delete(key)
+		}
+		return true
+	})
+}
+
+// channelSatisfies 渠道是否启用，且在分组中以满足能力与上下文窗口要求的方式提供该模型
+func channelSatisfies(group string, model string, channelId int, isImage bool, isStream bool, isSystemPrompt bool, isNORLogprobs bool, isFunctionCall bool, contextTokens int) (*Channel, bool) {
+	if common.MemoryCacheEnabled {
+		required := newChannelCapability(isImage, isStream, isSystemPrompt, isNORLogprobs, isFunctionCall)
+		channelSyncLock.RLock()
+		defer channelSyncLock.RUnlock()
+		for _, tier := range group2model2tiers[group][model] {
+			for _, ability := range tier.byCapability[required] {
+				if ability.channel.Id == channelId && ability.fitContextWindow(contextTokens) {
+					return ability.channel, true
+				}
+			}
+		}
+		return nil, false
+	}
+	groupCol := "`group`"
+	if common.UsingPostgreSQL {
+		groupCol = `"group"`
+	}
+	query := DB.Model(&Ability{}).Where(groupCol+" = ? and model = ? and channel_id = ? and enabled = ?", group, model, channelId, true)
+	query = whereCapability(query, isImage, isStream, isSystemPrompt, isNORLogprobs, isFunctionCall)
+	var ability Ability
+	err := query.First(&ability).Error
+	if err != nil || !fitContextWindow(ability.ContextWindow, model, contextTokens) {
+		return nil, false
+	}
+	channel, err := GetChannelById(channelId, true)
+	if err != nil || channel.Status != common.ChannelStatusEnabled {
+		return nil, false
+	}
+	return channel, true
+}
+
+// CacheGetAffinityChannel 返回会话上次使用的渠道并占用其限流额度，返回的函数在请求结束时调用以释放；
+// 渠道不满足请求、被熔断或达到限流时返回 nil
+func CacheGetAffinityChannel(group string, model string, channelId int, isImage bool, isStream bool, isSystemPrompt bool, isNORLogprobs bool, isFunctionCall bool, inputTokens int, maxTokens int) (*Channel, func()) {
+	if strings.HasPrefix(model, "gpt-4-gizmo") {
+		model = "gpt-4-gizmo-*"
+	}
+	channel, ok := channelSatisfies(group, model, channelId, isImage, isStream, isSystemPrompt, isNORLogprobs, isFunctionCall, inputTokens+maxTokens)
+	if !ok {
+		return nil, nil
+	}
+	release, ok := channelAcquire(channel, model, inputTokens, time.Now().Unix(), common.ChannelBreakerEnabled)
+	if !ok {
+		return nil, nil
+	}
+	return channel, release
+}
@@ -0,0 +1,751 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"one-api/common"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 渠道熔断器：按渠道以及渠道+模型统计滑动窗口内的失败率与延迟，
+// 失败率超过阈值时熔断（open），选择渠道时跳过；冷却结束后进入半开（half_open），
+// 只放行少量探测请求，探测全部成功则恢复（closed），任一失败则重新熔断。
+// 启用 Redis 时状态与统计保存在 Redis 中由所有节点共享，否则保存在内存中；
+// 探测名额在选择渠道时与限流额度一起检查并占用、请求结束时释放，启用 Redis 时由所有节点共享计数。
+// 使用 Redis 时各节点在本地缓存熔断状态 channelBreakerStateCacheTTL，状态转换与统计的写入在后台按顺序执行，
+// 除占用半开状态的探测名额外，选择渠道与转发请求时不访问 Redis。
+
+const (
+	ChannelBreakerStateClosed   = "closed"
+	ChannelBreakerStateOpen     = "open"
+	ChannelBreakerStateHalfOpen = "half_open"
+)
+
+// channelBreakerBuckets 滑动窗口被切分的桶数
+const channelBreakerBuckets = 10
+
+// channelBreakerProbeTimeoutSeconds 半开状态超过该时间没有探测结果时重新开始探测，避免探测名额泄漏后渠道一直无法被选择
+const channelBreakerProbeTimeoutSeconds = 600
+
+type channelBreakerState struct {
+	State     string `json:"state"`
+	OpenUntil int64  `json:"open_until"`
+	// HalfOpenAt 本轮半开开始的时间，用于区分不同轮次的探测名额
+	HalfOpenAt   int64 `json:"half_open_at"`
+	ProbeSuccess int   `json:"probe_success"`
+	UpdatedAt    int64 `json:"updated_at"`
+}
+
+// channelBreakerProbe 一轮半开中占用的探测名额，round 为该轮半开的 HalfOpenAt
+type channelBreakerProbe struct {
+	round    int64
+	inflight int
+}
+
+type channelBreakerStats struct {
+	Total     int
+	Failures  int
+	LatencyMs int64
+}
+
+type ChannelBreakerStatus struct {
+	Key          string  `json:"key"`
+	ChannelId    int     `json:"channel_id"`
+	Model        string  `json:"model"`
+	State        string  `json:"state"`
+	OpenUntil    int64   `json:"open_until"`
+	Total        int     `json:"total"`
+	Failures     int     `json:"failures"`
+	ErrorRate    float64 `json:"error_rate"`
+	AvgLatencyMs int64   `json:"avg_latency_ms"`
+	UpdatedAt    int64   `json:"updated_at"`
+}
+
+type channelBreakerStore interface {
+	getStates(keys []string) []channelBreakerState
+	setState(key string, state channelBreakerState)
+	addSample(key string, success bool, latencyMs int64, now int64)
+	getStats(key string, now int64) channelBreakerStats
+	reset(key string)
+	keys() []string
+	// probeInflight 返回第 round 轮半开中占用的探测名额数
+	probeInflight(key string, round int64) int
+	// acquireProbe 原子地检查并占用第 round 轮半开的探测名额，已达到 limit 时返回 false
+	acquireProbe(key string, round int64, limit int) bool
+	releaseProbe(key string, round int64)
+}
+
+// channelBreakerLock 保证同一节点内状态的读-改-写不会交错，多节点共享 Redis 时状态转换为尽力而为
+var channelBreakerLock sync.Mutex
+
+func getChannelBreakerStore() channelBreakerStore {
+	if common.RedisEnabled {
+		return redisBreakerStore
+	}
+	return memoryBreakerStore
+}
+
+// channelBreakerUpdates 使用 Redis 时在后台按顺序执行的状态更新，队列满时丢弃，熔断统计为尽力而为
+var channelBreakerUpdates = make(chan func(), 4096)
+var channelBreakerWorkerOnce sync.Once
+
+func runChannelBreakerUpdates() {
+	for update := range channelBreakerUpdates {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					common.SysError(fmt.Sprintf("channel breaker update panic: %v", r))
+				}
+			}()
+			update()
+		}()
+	}
+}
+
+// runChannelBreakerUpdate 执行会写入状态或统计的操作，使用 Redis 时放到后台执行，不阻塞请求
+func runChannelBreakerUpdate(store channelBreakerStore, update func()) {
+	if _, ok := store.(*redisChannelBreakerStore); !ok {
+		update()
+		return
+	}
+	channelBreakerWorkerOnce.Do(func() {
+		go runChannelBreakerUpdates()
+	})
+	select {
+	case channelBreakerUpdates <- update:
+	default:
+		common.SysError("channel breaker update queue is full, update dropped")
+	}
+}
+
+func getChannelBreakerBucketSeconds() int64 {
+	bucketSeconds := int64(common.ChannelBreakerWindowSeconds / channelBreakerBuckets)
+	if bucketSeconds < 1 {
+		bucketSeconds = 1
+	}
+	return bucketSeconds
+}
+
+func channelBreakerKey(channelId int, model string) string {
+	if model == "" {
+		return strconv.Itoa(channelId)
+	}
+	if strings.HasPrefix(model, "gpt-4-gizmo") {
+		model = "gpt-4-gizmo-*"
+	}
+	return fmt.Sprintf("%d:%s", channelId, model)
+}
+
+func parseChannelBreakerKey(key string) (int, string) {
+	parts := strings.SplitN(key, ":", 2)
+	channelId, _ := strconv.Atoi(parts[0])
+	if len(parts) == 1 {
+		return channelId, ""
+	}
+	return channelId, parts[1]
+}
+
+func channelBreakerKeys(channelId int, model string) []string {
+	return []string{channelBreakerKey(channelId, ""), channelBreakerKey(channelId, model)}
+}
+
+func normalizeChannelBreakerState(state channelBreakerState) channelBreakerState {
+	if state.State == "" {
+		state.State = ChannelBreakerStateClosed
+	}
+	return state
+}
+
+func logChannelBreakerTransition(key string, from string, to string, reason string) {
+	channelId, model := parseChannelBreakerKey(key)
+	target := fmt.Sprintf("渠道 #%d", channelId)
+	if model != "" {
+		target += fmt.Sprintf(" 模型 %s", model)
+	}
+	common.SysLog(fmt.Sprintf("%s 熔断状态 %s -> %s：%s", target, from, to, reason))
+}
+
+// channelBreakerProbeRound 返回熔断器当前这轮半开的标识：冷却结束或探测超时时为即将开始的新一轮，
+// 各节点按同一状态算出相同的值，状态转换写入前占用的探测名额也计入新一轮。熔断中返回 ok 为 false，未熔断时 round 为 0
+func channelBreakerProbeRound(state channelBreakerState, now int64) (round int64, start bool, ok bool) {
+	switch state.State {
+	case ChannelBreakerStateOpen:
+		if now < state.OpenUntil {
+			return 0, false, false
+		}
+		return state.OpenUntil, true, true
+	case ChannelBreakerStateHalfOpen:
+		if now-state.UpdatedAt >= channelBreakerProbeTimeoutSeconds {
+			return state.UpdatedAt + channelBreakerProbeTimeoutSeconds, true, true
+		}
+		return state.HalfOpenAt, false, true
+	}
+	return 0, false, true
+}
+
+// channelBreakerStartHalfOpen 冷却结束或上一轮探测超时时开始新一轮半开探测
+func channelBreakerStartHalfOpen(store channelBreakerStore, key string, now int64) {
+	channelBreakerLock.Lock()
+	defer channelBreakerLock.Unlock()
+	current := normalizeChannelBreakerState(store.getStates([]string{key})[0])
+	round, start, _ := channelBreakerProbeRound(current, now)
+	if !start {
+		return
+	}
+	if current.State == ChannelBreakerStateOpen {
+		logChannelBreakerTransition(key, ChannelBreakerStateOpen, ChannelBreakerStateHalfOpen, "冷却结束，开始探测")
+	} else {
+		logChannelBreakerTransition(key, ChannelBreakerStateHalfOpen, ChannelBreakerStateHalfOpen, "探测超时，重新开始探测")
+	}
+	store.setState(key, channelBreakerState{State: ChannelBreakerStateHalfOpen, HalfOpenAt: round, UpdatedAt: now})
+}
+
+// channelBreakerAllow 判断渠道是否可被选择（未熔断，半开时还有探测名额），冷却结束或探测超时的熔断器在此开始新一轮半开
+func channelBreakerAllow(store channelBreakerStore, channelId int, model string, now int64) bool {
+	keys := channelBreakerKeys(channelId, model)
+	for i, state := range store.getStates(keys) {
+		round, start, ok := channelBreakerProbeRound(state, now)
+		if !ok {
+			return false
+		}
+		if start {
+			key := keys[i]
+			runChannelBreakerUpdate(store, func() {
+				channelBreakerStartHalfOpen(store, key, now)
+			})
+		}
+		if round != 0 && store.probeInflight(keys[i], round) >= common.ChannelBreakerHalfOpenProbes {
+			return false
+		}
+	}
+	return true
+}
+
+// channelBreakerAcquire 检查渠道是否可被选择，并为处于半开状态的熔断器占用探测名额，
+// 不可选择或名额已满时返回 false；返回的函数在请求结束时调用以释放占用的名额
+func channelBreakerAcquire(store channelBreakerStore, channelId int, model string, now int64) (func(), bool) {
+	keys := channelBreakerKeys(channelId, model)
+	acquired := make(map[string]int64)
+	release := func() {
+		for key, round := range acquired {
+			store.releaseProbe(key, round)
+		}
+	}
+	for i, state := range store.getStates(keys) {
+		round, start, ok := channelBreakerProbeRound(state, now)
+		if !ok {
+			release()
+			return nil, false
+		}
+		if start {
+			key := keys[i]
+			runChannelBreakerUpdate(store, func() {
+				channelBreakerStartHalfOpen(store, key, now)
+			})
+		}
+		if round == 0 {
+			continue
+		}
+		if !store.acquireProbe(keys[i], round, common.ChannelBreakerHalfOpenProbes) {
+			release()
+			return nil, false
+		}
+		acquired[keys[i]] = round
+	}
+	if len(acquired) == 0 {
+		return func() {}, true
+	}
+	var once sync.Once
+	return func() {
+		once.Do(release)
+	}, true
+}
+
+// filterChannelBreaker 返回未被熔断的候选下标，以及占用限流额度时是否需要同时占用探测名额；
+// 若全部被熔断则不过滤，避免熔断导致完全不可用
+func filterChannelBreaker(count int, channelId func(i int) int, model string) ([]int, bool) {
+	indexes := make([]int, 0, count)
+	if !common.ChannelBreakerEnabled {
+		for i := 0; i < count; i++ {
+			indexes = append(indexes, i)
+		}
+		return indexes, false
+	}
+	store := getChannelBreakerStore()
+	now := time.Now().Unix()
+	for i := 0; i < count; i++ {
+		if channelBreakerAllow(store, channelId(i), model, now) {
+			indexes = append(indexes, i)
+		}
+	}
+	if len(indexes) == 0 && count > 0 {
+		common.SysLog(fmt.Sprintf("all channels for model %s are open, ignore channel breaker", model))
+		for i := 0; i < count; i++ {
+			indexes = append(indexes, i)
+		}
+		return indexes, false
+	}
+	return indexes, true
+}
+
+// ChannelBreakerRecord 记录一次请求结果并按需转换熔断状态
+func ChannelBreakerRecord(channelId int, model string, success bool, latency time.Duration) {
+	if !common.ChannelBreakerEnabled || channelId == 0 {
+		return
+	}
+	store := getChannelBreakerStore()
+	now := time.Now().Unix()
+	runChannelBreakerUpdate(store, func() {
+		channelBreakerRecord(store, channelId, model, success, latency, now)
+	})
+}
+
+func channelBreakerRecord(store channelBreakerStore, channelId int, model string, success bool, latency time.Duration, now int64) {
+	keys := channelBreakerKeys(channelId, model)
+	channelBreakerLock.Lock()
+	defer channelBreakerLock.Unlock()
+	for i, state := range store.getStates(keys) {
+		key := keys[i]
+		switch state.State {
+		case ChannelBreakerStateHalfOpen:
+			if !success {
+				store.setState(key, channelBreakerState{State: ChannelBreakerStateOpen, OpenUntil: now + int64(common.ChannelBreakerOpenSeconds), UpdatedAt: now})
+				logChannelBreakerTransition(key, ChannelBreakerStateHalfOpen, ChannelBreakerStateOpen, "探测请求失败")
+				continue
+			}
+			state.ProbeSuccess++
+			if state.ProbeSuccess >= common.ChannelBreakerHalfOpenProbes {
+				store.reset(key)
+				store.setState(key, channelBreakerState{State: ChannelBreakerStateClosed, UpdatedAt: now})
+				logChannelBreakerTransition(key, ChannelBreakerStateHalfOpen, ChannelBreakerStateClosed, fmt.Sprintf("%d 次探测请求成功", state.ProbeSuccess))
+				continue
+			}
+			state.UpdatedAt = now
+			store.setState(key, state)
+		case ChannelBreakerStateOpen:
+			// 熔断前已发出的请求，结果不计入统计
+		default:
+			store.addSample(key, success, latency.Milliseconds(), now)
+			stats := store.getStats(key, now)
+			if stats.Total < common.ChannelBreakerMinRequests || stats.Total == 0 {
+				continue
+			}
+			errorRate := float64(stats.Failures) / float64(stats.Total)
+			if errorRate >= common.ChannelBreakerErrorRate {
+				store.setState(key, channelBreakerState{State: ChannelBreakerStateOpen, OpenUntil: now + int64(common.ChannelBreakerOpenSeconds), UpdatedAt: now})
+				logChannelBreakerTransition(key, ChannelBreakerStateClosed, ChannelBreakerStateOpen,
+					fmt.Sprintf("%d 秒内 %d 次请求失败率 %.2f", common.ChannelBreakerWindowSeconds, stats.Total, errorRate))
+			}
+		}
+	}
+}
+
+func GetChannelBreakerStatuses() []*ChannelBreakerStatus {
+	store := getChannelBreakerStore()
+	now := time.Now().Unix()
+	keys := store.keys()
+	states := store.getStates(keys)
+	statuses := make([]*ChannelBreakerStatus, 0, len(keys))
+	for i, key := range keys {
+		channelId, model := parseChannelBreakerKey(key)
+		stats := store.getStats(key, now)
+		status := &ChannelBreakerStatus{
+			Key:       key,
+			ChannelId: channelId,
+			Model:     model,
+			State:     states[i].State,
+			OpenUntil: states[i].OpenUntil,
+			Total:     stats.Total,
+			Failures:  stats.Failures,
+			UpdatedAt: states[i].UpdatedAt,
+		}
+		if stats.Total > 0 {
+			status.ErrorRate = float64(stats.Failures) / float64(stats.Total)
+			status.AvgLatencyMs = stats.LatencyMs / int64(stats.Total)
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].ChannelId != statuses[j].ChannelId {
+			return statuses[i].ChannelId < statuses[j].ChannelId
+		}
+		return statuses[i].Model < statuses[j].Model
+	})
+	return statuses
+}
+
+// ResetChannelBreaker 手动恢复熔断器，model 为空时恢复该渠道的全部熔断器
+func ResetChannelBreaker(channelId int, model string) int {
+	store := getChannelBreakerStore()
+	channelBreakerLock.Lock()
+	defer channelBreakerLock.Unlock()
+	count := 0
+	for _, key := range store.keys() {
+		keyChannelId, keyModel := parseChannelBreakerKey(key)
+		if keyChannelId != channelId || (model != "" && keyModel != model) {
+			continue
+		}
+		state := normalizeChannelBreakerState(store.getStates([]string{key})[0])
+		store.reset(key)
+		if state.State != ChannelBreakerStateClosed {
+			logChannelBreakerTransition(key, state.State, ChannelBreakerStateClosed, "管理员手动恢复")
+		}
+		count++
+	}
+	return count
+}
+
+type channelBreakerBucket struct {
+	start     int64
+	total     int
+	failures  int
+	latencyMs int64
+}
+
+type memoryChannelBreakerEntry struct {
+	state   channelBreakerState
+	buckets [channelBreakerBuckets]channelBreakerBucket
+}
+
+type memoryChannelBreakerStore struct {
+	mutex   sync.RWMutex
+	entries map[string]*memoryChannelBreakerEntry
+	// probes 熔断器 key -> 最近一轮半开占用的探测名额
+	probes map[string]*channelBreakerProbe
+}
+
+func newMemoryChannelBreakerStore() *memoryChannelBreakerStore {
+	return &memoryChannelBreakerStore{
+		entries: make(map[string]*memoryChannelBreakerEntry),
+		probes:  make(map[string]*channelBreakerProbe),
+	}
+}
+
+var memoryBreakerStore = newMemoryChannelBreakerStore()
+
+func (s *memoryChannelBreakerStore) getStates(keys []string) []channelBreakerState {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	states := make([]channelBreakerState, len(keys))
+	for i, key := range keys {
+		if entry, ok := s.entries[key]; ok {
+			states[i] = entry.state
+		}
+		states[i] = normalizeChannelBreakerState(states[i])
+	}
+	return states
+}
+
+func (s *memoryChannelBreakerStore) getEntry(key string) *memoryChannelBreakerEntry {
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &memoryChannelBreakerEntry{}
+		s.entries[key] = entry
+	}
+	return entry
+}
+
+func (s *memoryChannelBreakerStore) setState(key string, state channelBreakerState) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.getEntry(key).state = state
+}
+
+func (s *memoryChannelBreakerStore) addSample(key string, success bool, latencyMs int64, now int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	bucketSeconds := getChannelBreakerBucketSeconds()
+	start := now - now%bucketSeconds
+	bucket := &s.getEntry(key).buckets[(start/bucketSeconds)%channelBreakerBuckets]
+	if bucket.start != start {
+		*bucket = channelBreakerBucket{start: start}
+	}
+	bucket.total++
+	if !success {
+		bucket.failures++
+	}
+	bucket.latencyMs += latencyMs
+}
+
+func (s *memoryChannelBreakerStore) getStats(key string, now int64) channelBreakerStats {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var stats channelBreakerStats
+	entry, ok := s.entries[key]
+	if !ok {
+		return stats
+	}
+	windowStart := now - getChannelBreakerBucketSeconds()*channelBreakerBuckets
+	for _, bucket := range entry.buckets {
+		if bucket.start > windowStart {
+			stats.Total += bucket.total
+			stats.Failures += bucket.failures
+			stats.LatencyMs += bucket.latencyMs
+		}
+	}
+	return stats
+}
+
+func (s *memoryChannelBreakerStore) reset(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.entries, key)
+}
+
+func (s *memoryChannelBreakerStore) keys() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	keys := make([]string, 0, len(s.entries))
+	for key := range s.entries {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (s *memoryChannelBreakerStore) probeInflight(key string, round int64) int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	probe, ok := s.probes[key]
+	if !ok || probe.round != round {
+		return 0
+	}
+	return probe.inflight
+}
+
+func (s *memoryChannelBreakerStore) acquireProbe(key string, round int64, limit int) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	probe, ok := s.probes[key]
+	if !ok || probe.round != round {
+		// 进入新一轮半开时，上一轮的名额不再计数
+		probe = &channelBreakerProbe{round: round}
+		s.probes[key] = probe
+	}
+	if probe.inflight >= limit {
+		return false
+	}
+	probe.inflight++
+	return true
+}
+
+func (s *memoryChannelBreakerStore) releaseProbe(key string, round int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	probe, ok := s.probes[key]
+	if !ok || probe.round != round {
+		return
+	}
+	probe.inflight--
+	if probe.inflight <= 0 {
+		delete(s.probes, key)
+	}
+}
+
+const (
+	redisChannelBreakerKeys   = "channel_breaker:keys"
+	redisChannelBreakerState  = "channel_breaker:state:"
+	redisChannelBreakerWindow = "channel_breaker:window:"
+	redisChannelBreakerProbe  = "channel_breaker:probe:"
+)
+
+// channelBreakerStateCacheTTL 使用 Redis 时本地缓存熔断状态的时间，其他节点的状态转换最多延迟这么久生效
+const channelBreakerStateCacheTTL = 2 * time.Second
+
+type cachedChannelBreakerState struct {
+	state    channelBreakerState
+	expireAt time.Time
+}
+
+type redisChannelBreakerStore struct {
+	mutex sync.RWMutex
+	cache map[string]cachedChannelBreakerState
+}
+
+var redisBreakerStore = &redisChannelBreakerStore{cache: make(map[string]cachedChannelBreakerState)}
+
+func (s *redisChannelBreakerStore) cacheState(key string, state channelBreakerState, now time.Time) {
+	s.cache[key] = cachedChannelBreakerState{state: state, expireAt: now.Add(channelBreakerStateCacheTTL)}
+}
+
+// getStates 优先读取本地缓存，只有缓存过期的 key 才从 Redis 读取
+func (s *redisChannelBreakerStore) getStates(keys []string) []channelBreakerState {
+	states := make([]channelBreakerState, len(keys))
+	now := time.Now()
+	missing := make([]int, 0)
+	s.mutex.RLock()
+	for i, key := range keys {
+		if cached, ok := s.cache[key]; ok && now.Before(cached.expireAt) {
+			states[i] = cached.state
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	s.mutex.RUnlock()
+	if len(missing) > 0 {
+		redisKeys := make([]string, len(missing))
+		for j, i := range missing {
+			redisKeys[j] = redisChannelBreakerState + keys[i]
+		}
+		values, err := common.RDB.MGet(context.Background(), redisKeys...).Result()
+		if err != nil {
+			common.SysError("failed to get channel breaker states: " + err.Error())
+		}
+		s.mutex.Lock()
+		for j, i := range missing {
+			if err == nil {
+				if value, ok := values[j].(string); ok {
+					_ = json.Unmarshal([]byte(value), &states[i])
+				}
+			}
+			s.cacheState(keys[i], states[i], now)
+		}
+		s.mutex.Unlock()
+	}
+	for i := range states {
+		states[i] = normalizeChannelBreakerState(states[i])
+	}
+	return states
+}
+
+func (s *redisChannelBreakerStore) setState(key string, state channelBreakerState) {
+	s.mutex.Lock()
+	s.cacheState(key, state, time.Now())
+	s.mutex.Unlock()
+	data, _ := json.Marshal(state)
+	ctx := context.Background()
+	pipe := common.RDB.TxPipeline()
+	pipe.Set(ctx, redisChannelBreakerState+key, string(data), 0)
+	pipe.SAdd(ctx, redisChannelBreakerKeys, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		common.SysError("failed to set channel breaker state: " + err.Error())
+	}
+}
+
+func (s *redisChannelBreakerStore) addSample(key string, success bool, latencyMs int64, now int64) {
+	bucketSeconds := getChannelBreakerBucketSeconds()
+	bucketKey := fmt.Sprintf("%s%s:%d", redisChannelBreakerWindow, key, now-now%bucketSeconds)
+	failures := int64(0)
+	if !success {
+		failures = 1
+	}
+	ctx := context.Background()
+	pipe := common.RDB.TxPipeline()
+	pipe.HIncrBy(ctx, bucketKey, "total", 1)
+	pipe.HIncrBy(ctx, bucketKey, "failures", failures)
+	pipe.HIncrBy(ctx, bucketKey, "latency_ms", latencyMs)
+	pipe.Expire(ctx, bucketKey, time.Duration(bucketSeconds*channelBreakerBuckets*2)*time.Second)
+	pipe.SAdd(ctx, redisChannelBreakerKeys, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		common.SysError("failed to add channel breaker sample: " + err.Error())
+	}
+}
+
+func (s *redisChannelBreakerStore) getStats(key string, now int64) channelBreakerStats {
+	var stats channelBreakerStats
+	bucketSeconds := getChannelBreakerBucketSeconds()
+	start := now - now%bucketSeconds
+	ctx := context.Background()
+	pipe := common.RDB.Pipeline()
+	for i := int64(0); i < channelBreakerBuckets; i++ {
+		pipe.HGetAll(ctx, fmt.Sprintf("%s%s:%d", redisChannelBreakerWindow, key, start-i*bucketSeconds))
+	}
+	cmds, err := pipe.Exec(ctx)
+	if err != nil {
+		common.SysError("failed to get channel breaker stats: " + err.Error())
+		return stats
+	}
+	for _, cmd := range cmds {
+		values := cmd.(*redis.StringStringMapCmd).Val()
+		total, _ := strconv.Atoi(values["total"])
+		failures, _ := strconv.Atoi(values["failures"])
+		latencyMs, _ := strconv.ParseInt(values["latency_ms"], 10, 64)
+		stats.Total += total
+		stats.Failures += failures
+		stats.LatencyMs += latencyMs
+	}
+	return stats
+}
+
+func (s *redisChannelBreakerStore) reset(key string) {
+	s.mutex.Lock()
+	delete(s.cache, key)
+	s.mutex.Unlock()
+	ctx := context.Background()
+	bucketSeconds := getChannelBreakerBucketSeconds()
+	now := time.Now().Unix()
+	start := now - now%bucketSeconds
+	redisKeys := []string{redisChannelBreakerState + key}
+	for i := int64(0); i < channelBreakerBuckets; i++ {
+		redisKeys = append(redisKeys, fmt.Sprintf("%s%s:%d", redisChannelBreakerWindow, key, start-i*bucketSeconds))
+	}
+	pipe := common.RDB.TxPipeline()
+	pipe.Del(ctx, redisKeys...)
+	pipe.SRem(ctx, redisChannelBreakerKeys, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		common.SysError("failed to reset channel breaker: " + err.Error())
+	}
+}
+
+func (s *redisChannelBreakerStore) keys() []string {
+	keys, err := common.RDB.SMembers(context.Background(), redisChannelBreakerKeys).Result()
+	if err != nil {
+		common.SysError("failed to get channel breaker keys: " + err.Error())
+		return nil
+	}
+	return keys
+}
+
+func redisChannelBreakerProbeKey(key string, round int64) string {
+	return fmt.Sprintf("%s%s:%d", redisChannelBreakerProbe, key, round)
+}
+
+func (s *redisChannelBreakerStore) probeInflight(key string, round int64) int {
+	inflight, err := common.RDB.Get(context.Background(), redisChannelBreakerProbeKey(key, round)).Int()
+	if err != nil && err != redis.Nil {
+		common.SysError("failed to get channel breaker probes: " + err.Error())
+	}
+	return inflight
+}
+
+// redisChannelBreakerAcquireProbeScript 名额未满时占用一个探测名额，名额在探测超时后过期，避免泄漏
+var redisChannelBreakerAcquireProbeScript = redis.NewScript(`
+local inflight = tonumber(redis.call('GET', KEYS[1]) or '0')
+if inflight >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('INCR', KEYS[1])
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+var redisChannelBreakerReleaseProbeScript = redis.NewScript(`
+if tonumber(redis.call('GET', KEYS[1]) or '0') > 0 then
+	redis.call('DECR', KEYS[1])
+end
+return 0
+`)
+
+func (s *redisChannelBreakerStore) acquireProbe(key string, round int64, limit int) bool {
+	acquired, err := redisChannelBreakerAcquireProbeScript.Run(context.Background(), common.RDB,
+		[]string{redisChannelBreakerProbeKey(key, round)}, limit, channelBreakerProbeTimeoutSeconds).Int()
+	if err != nil {
+		// Redis 不可用时不阻止请求
+		common.SysError("failed to acquire channel breaker probe: " + err.Error())
+		return true
+	}
+	return acquired == 1
+}
+
+func (s *redisChannelBreakerStore) releaseProbe(key string, round int64) {
+	err := redisChannelBreakerReleaseProbeScript.Run(context.Background(), common.RDB, []string{redisChannelBreakerProbeKey(key, round)}).Err()
+	if err != nil && err != redis.Nil {
+		common.SysError("failed to release channel breaker probe: " + err.Error())
+	}
+}
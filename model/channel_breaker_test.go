@@ -0,0 +1,240 @@
+package model
+
+import (
+	"one-api/common"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func setupTestChannelBreaker(t *testing.T) *memoryChannelBreakerStore {
+	t.Helper()
+	errorRate, minRequests, windowSeconds, openSeconds, halfOpenProbes := common.ChannelBreakerErrorRate,
+		common.ChannelBreakerMinRequests, common.ChannelBreakerWindowSeconds, common.ChannelBreakerOpenSeconds, common.ChannelBreakerHalfOpenProbes
+	t.Cleanup(func() {
+		common.ChannelBreakerErrorRate, common.ChannelBreakerMinRequests, common.ChannelBreakerWindowSeconds,
+			common.ChannelBreakerOpenSeconds, common.ChannelBreakerHalfOpenProbes = errorRate, minRequests, windowSeconds, openSeconds, halfOpenProbes
+	})
+	common.ChannelBreakerErrorRate = 0.5
+	common.ChannelBreakerMinRequests = 4
+	common.ChannelBreakerWindowSeconds = 60
+	common.ChannelBreakerOpenSeconds = 30
+	common.ChannelBreakerHalfOpenProbes = 2
+	return newMemoryChannelBreakerStore()
+}
+
+// acquireTestProbe 占用探测名额，占用失败时测试失败
+func acquireTestProbe(t *testing.T, store channelBreakerStore, now int64) func() {
+	t.Helper()
+	release, ok := channelBreakerAcquire(store, 1, "gpt-4o", now)
+	if !ok {
+		t.Fatal("failed to acquire a probe slot")
+	}
+	return release
+}
+
+func channelBreakerStateOf(store channelBreakerStore, channelId int, model string) channelBreakerState {
+	return normalizeChannelBreakerState(store.getStates([]string{channelBreakerKey(channelId, model)})[0])
+}
+
+// openTestChannelBreaker 在 now 时记录足够多的失败使渠道熔断
+func openTestChannelBreaker(t *testing.T, store channelBreakerStore, now int64) {
+	t.Helper()
+	for i := 0; i < common.ChannelBreakerMinRequests; i++ {
+		channelBreakerRecord(store, 1, "gpt-4o", i%2 == 0, time.Second, now)
+	}
+	if state := channelBreakerStateOf(store, 1, "gpt-4o"); state.State != ChannelBreakerStateOpen {
+		t.Fatalf("state after failures = %s, want open", state.State)
+	}
+}
+
+func TestChannelBreakerTransitions(t *testing.T) {
+	store := setupTestChannelBreaker(t)
+	now := int64(1000)
+
+	for i := 0; i < common.ChannelBreakerMinRequests-1; i++ {
+		channelBreakerRecord(store, 1, "gpt-4o", false, time.Second, now)
+	}
+	if !channelBreakerAllow(store, 1, "gpt-4o", now) {
+		t.Fatal("breaker opened before reaching the minimum number of requests")
+	}
+	channelBreakerRecord(store, 1, "gpt-4o", true, time.Second, now)
+	if channelBreakerAllow(store, 1, "gpt-4o", now) {
+		t.Fatal("breaker is not open after the error rate is reached")
+	}
+	if !channelBreakerAllow(store, 2, "gpt-4o", now) {
+		t.Fatal("other channels must not be affected")
+	}
+
+	// 冷却结束后进入半开，最多放行 ChannelBreakerHalfOpenProbes 个探测请求
+	now += int64(common.ChannelBreakerOpenSeconds)
+	if !channelBreakerAllow(store, 1, "gpt-4o", now) {
+		t.Fatal("breaker does not allow probes after the cooldown")
+	}
+	if state := channelBreakerStateOf(store, 1, "gpt-4o"); state.State != ChannelBreakerStateHalfOpen {
+		t.Fatalf("state after cooldown = %s, want half_open", state.State)
+	}
+	releases := []func(){acquireTestProbe(t, store, now), acquireTestProbe(t, store, now)}
+	if channelBreakerAllow(store, 1, "gpt-4o", now) {
+		t.Fatal("breaker allows more probes than ChannelBreakerHalfOpenProbes")
+	}
+	if _, ok := channelBreakerAcquire(store, 1, "gpt-4o", now); ok {
+		t.Fatal("breaker acquires more probe slots than ChannelBreakerHalfOpenProbes")
+	}
+
+	// 探测失败重新熔断
+	channelBreakerRecord(store, 1, "gpt-4o", false, time.Second, now)
+	releases[0]()
+	releases[1]()
+	if state := channelBreakerStateOf(store, 1, "gpt-4o"); state.State != ChannelBreakerStateOpen || state.OpenUntil != now+int64(common.ChannelBreakerOpenSeconds) {
+		t.Fatalf("state after failed probe = %+v, want open until %d", state, now+int64(common.ChannelBreakerOpenSeconds))
+	}
+
+	// 探测全部成功后恢复，统计被清空
+	now += int64(common.ChannelBreakerOpenSeconds)
+	if !channelBreakerAllow(store, 1, "gpt-4o", now) {
+		t.Fatal("breaker does not allow probes after the second cooldown")
+	}
+	for i := 0; i < common.ChannelBreakerHalfOpenProbes; i++ {
+		release := acquireTestProbe(t, store, now)
+		channelBreakerRecord(store, 1, "gpt-4o", true, time.Second, now)
+		release()
+	}
+	if state := channelBreakerStateOf(store, 1, "gpt-4o"); state.State != ChannelBreakerStateClosed {
+		t.Fatalf("state after successful probes = %s, want closed", state.State)
+	}
+	if stats := store.getStats(channelBreakerKey(1, "gpt-4o"), now); stats.Total != 0 {
+		t.Fatalf("stats after recovery = %+v, want empty", stats)
+	}
+	if len(store.probes) != 0 {
+		t.Fatalf("probe slots left after recovery: %v", store.probes)
+	}
+}
+
+func TestChannelBreakerProbeSlotRelease(t *testing.T) {
+	store := setupTestChannelBreaker(t)
+	now := int64(1000)
+	openTestChannelBreaker(t, store, now)
+	now += int64(common.ChannelBreakerOpenSeconds)
+	channelBreakerAllow(store, 1, "gpt-4o", now)
+
+	// 未记录结果就结束的请求（如客户端断开）释放名额后，渠道可以再次被选择
+	for i := 0; i < common.ChannelBreakerHalfOpenProbes; i++ {
+		acquireTestProbe(t, store, now)()
+	}
+	if !channelBreakerAllow(store, 1, "gpt-4o", now) {
+		t.Fatal("released probe slots are still counted")
+	}
+	release := acquireTestProbe(t, store, now)
+	release()
+	release()
+	if inflight := store.probeInflight(channelBreakerKey(1, "gpt-4o"), channelBreakerStateOf(store, 1, "gpt-4o").HalfOpenAt); inflight != 0 {
+		t.Fatalf("inflight probes after double release = %d, want 0", inflight)
+	}
+}
+
+func TestChannelBreakerStaleHalfOpen(t *testing.T) {
+	store := setupTestChannelBreaker(t)
+	now := int64(1000)
+	openTestChannelBreaker(t, store, now)
+	now += int64(common.ChannelBreakerOpenSeconds)
+	channelBreakerAllow(store, 1, "gpt-4o", now)
+
+	// 名额泄漏时，半开状态在探测超时后重新开始
+	var leaked []func()
+	for i := 0; i < common.ChannelBreakerHalfOpenProbes; i++ {
+		leaked = append(leaked, acquireTestProbe(t, store, now))
+	}
+	if channelBreakerAllow(store, 1, "gpt-4o", now+channelBreakerProbeTimeoutSeconds-1) {
+		t.Fatal("breaker allows probes before the probe timeout")
+	}
+	now += channelBreakerProbeTimeoutSeconds
+	if !channelBreakerAllow(store, 1, "gpt-4o", now) {
+		t.Fatal("stale half-open state is not restarted after the probe timeout")
+	}
+	state := channelBreakerStateOf(store, 1, "gpt-4o")
+	if state.State != ChannelBreakerStateHalfOpen || state.HalfOpenAt != now {
+		t.Fatalf("state after probe timeout = %+v, want half_open at %d", state, now)
+	}
+
+	// 上一轮的名额释放后不影响新一轮的计数
+	release := acquireTestProbe(t, store, now)
+	for _, r := range leaked {
+		r()
+	}
+	if inflight := store.probeInflight(channelBreakerKey(1, "gpt-4o"), state.HalfOpenAt); inflight != 1 {
+		t.Fatalf("inflight probes in the new round = %d, want 1", inflight)
+	}
+	release()
+	if inflight := store.probeInflight(channelBreakerKey(1, "gpt-4o"), state.HalfOpenAt); inflight != 0 {
+		t.Fatalf("inflight probes after release = %d, want 0", inflight)
+	}
+}
+
+func TestChannelBreakerProbeAcquireIsAtomic(t *testing.T) {
+	store := setupTestChannelBreaker(t)
+	now := int64(1000)
+	openTestChannelBreaker(t, store, now)
+	now += int64(common.ChannelBreakerOpenSeconds)
+
+	// 冷却刚结束、状态还未转换为半开时并发选择渠道，占用的名额同样计入即将开始的这一轮
+	var wg sync.WaitGroup
+	var acquired int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := channelBreakerAcquire(store, 1, "gpt-4o", now); ok {
+				atomic.AddInt32(&acquired, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if int(acquired) != common.ChannelBreakerHalfOpenProbes {
+		t.Fatalf("acquired %d probe slots, want %d", acquired, common.ChannelBreakerHalfOpenProbes)
+	}
+	state := channelBreakerStateOf(store, 1, "gpt-4o")
+	if state.State != ChannelBreakerStateHalfOpen || store.probeInflight(channelBreakerKey(1, "gpt-4o"), state.HalfOpenAt) != common.ChannelBreakerHalfOpenProbes {
+		t.Fatalf("state after concurrent acquire = %+v, want half_open with all probe slots taken", state)
+	}
+}
+
+func TestAcquireWeightedChannelTakesProbeSlot(t *testing.T) {
+	store := setupTestChannelBreaker(t)
+	breakerStore := memoryBreakerStore
+	memoryBreakerStore = store
+	enabled := common.ChannelBreakerEnabled
+	common.ChannelBreakerEnabled = true
+	defer func() {
+		memoryBreakerStore = breakerStore
+		common.ChannelBreakerEnabled = enabled
+	}()
+	newTestLimitStore(t)
+	now := time.Now().Unix()
+	openTestChannelBreaker(t, store, now-int64(common.ChannelBreakerOpenSeconds))
+
+	channels := []*Channel{{Id: 1}, {Id: 2}}
+	channel := func(i int) *Channel {
+		return channels[i]
+	}
+	// 渠道 1 的探测名额占满后只会选择渠道 2，释放后可以再次选择渠道 1
+	releases := make([]func(), 0)
+	for j := 0; j < common.ChannelBreakerHalfOpenProbes; j++ {
+		i, release := acquireWeightedChannel([]int{0}, []int{1}, channel, "gpt-4o", 0, true)
+		if i != 0 {
+			t.Fatalf("acquireWeightedChannel = %d, want channel 1 while probe slots are free", i)
+		}
+		releases = append(releases, release)
+	}
+	if i, _ := acquireWeightedChannel([]int{0}, []int{1}, channel, "gpt-4o", 0, true); i != -1 {
+		t.Fatalf("acquireWeightedChannel = %d, want -1 when probe slots are full", i)
+	}
+	if i, _ := acquireWeightedChannel([]int{0, 1}, []int{1000, 1}, channel, "gpt-4o", 0, true); i != 1 {
+		t.Fatalf("acquireWeightedChannel = %d, want channel 2 when probe slots are full", i)
+	}
+	releases[0]()
+	if i, _ := acquireWeightedChannel([]int{0}, []int{1}, channel, "gpt-4o", 0, true); i != 0 {
+		t.Fatalf("acquireWeightedChannel = %d, want channel 1 after a probe slot is released", i)
+	}
+}
@@ -0,0 +1,295 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"one-api/common"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// channelCapability 渠道能力位，与 abilities 表中的能力字段一一对应
+type channelCapability uint8
+
+const (
+	capabilityImage channelCapability = 1 << iota
+	capabilityStream
+	capabilitySystemPrompt
+	capabilityNORLogprobs
+	capabilityFunctionCall
+
+	capabilityAll = capabilityImage | capabilityStream | capabilitySystemPrompt | capabilityNORLogprobs | capabilityFunctionCall
+)
+
+func newChannelCapability(isImage bool, isStream bool, isSystemPrompt bool, isNORLogprobs bool, isFunctionCall bool) channelCapability {
+	var capability channelCapability
+	if isImage {
+		capability |= capabilityImage
+	}
+	if isStream {
+		capability |= capabilityStream
+	}
+	if isSystemPrompt {
+		capability |= capabilitySystemPrompt
+	}
+	if isNORLogprobs {
+		capability |= capabilityNORLogprobs
+	}
+	if isFunctionCall {
+		capability |= capabilityFunctionCall
+	}
+	return capability
+}
+
+func boolValue(b *bool) bool {
+	return b != nil && *b
+}
+
+// cachedAbility 是 abilities 表中一条启用记录在内存中的表示
+type cachedAbility struct {
+	group         string
+	model         string
+	priority      int64
+	weight        int
+	capability    channelCapability
+	contextWindow int
+	channel       *Channel
+}
+
+func newCachedAbility(ability *Ability, channel *Channel) *cachedAbility {
+	priority := int64(0)
+	if ability.Priority != nil {
+		priority = *ability.Priority
+	}
+	return &cachedAbility{
+		group:    ability.Group,
+		model:    ability.Model,
+		priority: priority,
+		weight:   int(ability.Weight),
+		capability: newChannelCapability(ability.IsImage, boolValue(ability.IsSupportStream),
+			boolValue(ability.IsSupportSystemPrompt), boolValue(ability.IsSupportNORLogprobs),
+			boolValue(ability.IsSupportFunctionCall)),
+		contextWindow: ability.ContextWindow,
+		channel:       channel,
+	}
+}
+
+func (ability *cachedAbility) fitContextWindow(contextTokens int) bool {
+	return fitContextWindow(ability.contextWindow, ability.model, contextTokens)
+}
+
+// priorityTier 同一分组、模型、优先级下的渠道，按所需能力预先分桶：
+// byCapability[required] 中是具备 required 全部能力的渠道
+type priorityTier struct {
+	priority     int64
+	byCapability [capabilityAll + 1][]*cachedAbility
+}
+
+var cachedAbilities []*cachedAbility
+var group2model2tiers map[string]map[string][]*priorityTier
+var channelsIDM map[int]*Channel
+var channelSyncLock sync.RWMutex
+
+// buildChannelIndex 将启用的能力按 分组 -> 模型 -> 优先级（降序） -> 能力 建立索引
+func buildChannelIndex(abilities []*cachedAbility) map[string]map[string][]*priorityTier {
+	group2model2priority2abilities := make(map[string]map[string]map[int64][]*cachedAbility)
+	for _, ability := range abilities {
+		model2priority2abilities, ok := group2model2priority2abilities[ability.group]
+		if !ok {
+			model2priority2abilities = make(map[string]map[int64][]*cachedAbility)
+			group2model2priority2abilities[ability.group] = model2priority2abilities
+		}
+		priority2abilities, ok := model2priority2abilities[ability.model]
+		if !ok {
+			priority2abilities = make(map[int64][]*cachedAbility)
+			model2priority2abilities[ability.model] = priority2abilities
+		}
+		priority2abilities[ability.priority] = append(priority2abilities[ability.priority], ability)
+	}
+
+	index := make(map[string]map[string][]*priorityTier, len(group2model2priority2abilities))
+	for group, model2priority2abilities := range group2model2priority2abilities {
+		index[group] = make(map[string][]*priorityTier, len(model2priority2abilities))
+		for model, priority2abilities := range model2priority2abilities {
+			tiers := make([]*priorityTier, 0, len(priority2abilities))
+			for priority, tierAbilities := range priority2abilities {
+				// 与 SQL 路径一致，按权重降序
+				sort.SliceStable(tierAbilities, func(i, j int) bool {
+					return tierAbilities[i].weight > tierAbilities[j].weight
+				})
+				tier := &priorityTier{priority: priority}
+				for required := channelCapability(0); required <= capabilityAll; required++ {
+					for _, ability := range tierAbilities {
+						if ability.capability&required == required {
+							tier.byCapability[required] = append(tier.byCapability[required], ability)
+						}
+					}
+				}
+				tiers = append(tiers, tier)
+			}
+			sort.Slice(tiers, func(i, j int) bool {
+				return tiers[i].priority > tiers[j].priority
+			})
+			index[group][model] = tiers
+		}
+	}
+	return index
+}
+
+func InitChannelCache() {
+	var channels []*Channel
+	err := DB.Where("status = ?", common.ChannelStatusEnabled).Find(&channels).Error
+	if err != nil {
+		common.SysError("failed to load channels from database: " + err.Error())
+		return
+	}
+	var abilities []*Ability
+	err = DB.Where("enabled = ?", true).Find(&abilities).Error
+	if err != nil {
+		common.SysError("failed to load abilities from database: " + err.Error())
+		return
+	}
+	newChannelsIDM := make(map[int]*Channel, len(channels))
+	for _, channel := range channels {
+		channel.modelLimits = channel.parseModelLimits()
+		newChannelsIDM[channel.Id] = channel
+	}
+	newCachedAbilities := make([]*cachedAbility, 0, len(abilities))
+	for _, ability := range abilities {
+		channel, ok := newChannelsIDM[ability.ChannelId]
+		if !ok {
+			continue
+		}
+		newCachedAbilities = append(newCachedAbilities, newCachedAbility(ability, channel))
+	}
+	newGroup2model2tiers := buildChannelIndex(newCachedAbilities)
+
+	channelSyncLock.Lock()
+	cachedAbilities = newCachedAbilities
+	group2model2tiers = newGroup2model2tiers
+	channelsIDM = newChannelsIDM
+	channelSyncLock.Unlock()
+	InitChannelKeyCache()
+	common.SysLog("channels synced from database")
+}
+
+func SyncChannelCache(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		common.SysLog("syncing channels from database")
+		InitChannelCache()
+	}
+}
+
+// CacheUpdateChannelStatus 渠道状态变化时立即更新内存索引，不必等待下一次同步
+func CacheUpdateChannelStatus(id int, status int) {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	if status == common.ChannelStatusEnabled {
+		// 被禁用的渠道不在缓存中，需要从数据库重新加载
+		InitChannelCache()
+		return
+	}
+	channelSyncLock.Lock()
+	defer channelSyncLock.Unlock()
+	if _, ok := channelsIDM[id]; !ok {
+		return
+	}
+	newChannelsIDM := make(map[int]*Channel, len(channelsIDM))
+	for channelId, channel := range channelsIDM {
+		if channelId != id {
+			newChannelsIDM[channelId] = channel
+		}
+	}
+	newCachedAbilities := make([]*cachedAbility, 0, len(cachedAbilities))
+	for _, ability := range cachedAbilities {
+		if ability.channel.Id != id {
+			newCachedAbilities = append(newCachedAbilities, ability)
+		}
+	}
+	cachedAbilities = newCachedAbilities
+	group2model2tiers = buildChannelIndex(newCachedAbilities)
+	channelsIDM = newChannelsIDM
+}
+
+// CacheGetRandomSatisfiedChannel inputTokens 为提示词 token 数，用于限流；与 maxTokens 之和用于过滤上下文窗口。
+// 选中的渠道已占用限流额度，返回的函数在请求结束或放弃该渠道时调用以释放
+func CacheGetRandomSatisfiedChannel(group string, model string, retry int, isImage bool, isStream bool, isSystemPrompt bool, isNORLogprobs bool, isFunctionCall bool, inputTokens int, maxTokens int) (*Channel, func(), error) {
+	if strings.HasPrefix(model, "gpt-4-gizmo") {
+		model = "gpt-4-gizmo-*"
+	}
+
+	// if memory cache is disabled, get channel directly from database
+	if !common.MemoryCacheEnabled {
+		return GetRandomSatisfiedChannel(group, model, retry, isImage, isStream, isSystemPrompt, isNORLogprobs, isFunctionCall, inputTokens, maxTokens)
+	}
+	required := newChannelCapability(isImage, isStream, isSystemPrompt, isNORLogprobs, isFunctionCall)
+
+	channelSyncLock.RLock()
+	defer channelSyncLock.RUnlock()
+	tiers := group2model2tiers[group][model]
+	if len(tiers) == 0 {
+		return nil, nil, errors.New("channel not found")
+	}
+	// 与 SQL 路径一致：先按重试次数确定优先级，再在该优先级内按能力与输入长度过滤
+	if retry >= len(tiers) {
+		retry = len(tiers) - 1
+	}
+	// 该优先级的渠道全部达到限流或上下文窗口不足时，依次尝试更低的优先级
+	saturated, exceeded := false, false
+	for tier := retry; tier < len(tiers); tier++ {
+		candidates := make([]*cachedAbility, 0, len(tiers[tier].byCapability[required]))
+		for _, ability := range tiers[tier].byCapability[required] {
+			if ability.fitContextWindow(inputTokens + maxTokens) {
+				candidates = append(candidates, ability)
+			}
+		}
+		if len(candidates) == 0 {
+			exceeded = exceeded || len(tiers[tier].byCapability[required]) > 0
+			continue
+		}
+		indexes, breaker := filterChannelBreaker(len(candidates), func(i int) int {
+			return candidates[i].channel.Id
+		}, model)
+		if len(indexes) == 0 {
+			continue
+		}
+
+		weights := channelRoutingWeights(group, model, indexes, func(i int) int {
+			return candidates[i].channel.Id
+		}, func(i int) int {
+			return candidates[i].weight
+		})
+		i, release := acquireWeightedChannel(indexes, weights, func(i int) *Channel {
+			return candidates[i].channel
+		}, model, inputTokens, breaker)
+		if i >= 0 {
+			return candidates[i].channel, release, nil
+		}
+		saturated = true
+	}
+	if saturated {
+		return nil, nil, ErrChannelSaturated
+	}
+	if exceeded {
+		return nil, nil, ErrContextLengthExceeded
+	}
+	return nil, nil, errors.New("channel not found")
+}
+
+func CacheGetChannel(id int) (*Channel, error) {
+	if !common.MemoryCacheEnabled {
+		return GetChannelById(id, true)
+	}
+	channelSyncLock.RLock()
+	defer channelSyncLock.RUnlock()
+
+	c, ok := channelsIDM[id]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("当前渠道# %d，已不存在", id))
+	}
+	return c, nil
+}
@@ -0,0 +1,171 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"one-api/common"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func initTestDB(t *testing.T) {
+	t.Helper()
+	common.RedisEnabled = false
+	common.SQLitePath = filepath.Join(t.TempDir(), "one-api.db")
+	if err := InitDB(); err != nil {
+		t.Fatalf("failed to init database: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = CloseDB()
+	})
+}
+
+type testChannel struct {
+	group          string
+	models         string
+	priority       int64
+	weight         uint
+	status         int
+	image          bool
+	stream         bool
+	systemPrompt   bool
+	norLogprobs    bool
+	functionCall   bool
+	contextWindows string
+}
+
+func insertTestChannel(t *testing.T, tc testChannel) *Channel {
+	t.Helper()
+	status := tc.status
+	if status == 0 {
+		status = common.ChannelStatusEnabled
+	}
+	channel := &Channel{
+		Key:                   "sk-test",
+		Status:                status,
+		Name:                  fmt.Sprintf("%s-%d", tc.models, tc.priority),
+		Models:                tc.models,
+		Group:                 tc.group,
+		Priority:              &tc.priority,
+		Weight:                &tc.weight,
+		IsImage:               &tc.image,
+		IsSupportStream:       &tc.stream,
+		IsSupportSystemPrompt: &tc.systemPrompt,
+		IsSupportNORLogprobs:  &tc.norLogprobs,
+		IsSupportFunctionCall: &tc.functionCall,
+		ContextWindows:        &tc.contextWindows,
+	}
+	if err := channel.Insert(); err != nil {
+		t.Fatalf("failed to insert channel: %v", err)
+	}
+	return channel
+}
+
+type channelQuery struct {
+	group          string
+	model          string
+	retry          int
+	isImage        bool
+	isStream       bool
+	isSystemPrompt bool
+	isNORLogprobs  bool
+	isFunctionCall bool
+	inputTokens    int
+	maxTokens      int
+}
+
+// selectChannels 多次选择渠道，返回被选中过的渠道 id 与错误类型
+func selectChannels(t *testing.T, query channelQuery) ([]int, string) {
+	t.Helper()
+	selected := make(map[int]bool)
+	for i := 0; i < 300; i++ {
+		channel, release, err := CacheGetRandomSatisfiedChannel(query.group, query.model, query.retry, query.isImage, query.isStream,
+			query.isSystemPrompt, query.isNORLogprobs, query.isFunctionCall, query.inputTokens, query.maxTokens)
+		switch {
+		case errors.Is(err, ErrChannelSaturated):
+			return nil, "saturated"
+		case errors.Is(err, ErrContextLengthExceeded):
+			return nil, "context_length_exceeded"
+		case err != nil:
+			return nil, "not_found"
+		}
+		release()
+		selected[channel.Id] = true
+	}
+	ids := make([]int, 0, len(selected))
+	for id := range selected {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, ""
+}
+
+func TestBuildChannelIndexMatchesSQL(t *testing.T) {
+	initTestDB(t)
+	defer func(enabled bool) {
+		common.MemoryCacheEnabled = enabled
+	}(common.MemoryCacheEnabled)
+
+	ids := make(map[string]int)
+	for name, tc := range map[string]testChannel{
+		"stream-system": {group: "default", models: "gpt-4o", priority: 10, weight: 5, stream: true, systemPrompt: true},
+		"image-tools":   {group: "default", models: "gpt-4o", priority: 10, image: true, stream: true, functionCall: true},
+		"small-window":  {group: "default", models: "gpt-4o", priority: 10, weight: 3, image: true, stream: true, systemPrompt: true, norLogprobs: true, functionCall: true, contextWindows: `{"gpt-4o": 1000}`},
+		"disabled":      {group: "default", models: "gpt-4o", priority: 10, status: common.ChannelStatusManuallyDisabled, stream: true},
+		"backup":        {group: "default", models: "gpt-4o", priority: 5, stream: true},
+		"last":          {group: "default,vip", models: "gpt-4o", weight: 1},
+		"vip-claude":    {group: "vip", models: "claude-3-haiku-20240307", priority: 3},
+	} {
+		ids[name] = insertTestChannel(t, tc).Id
+	}
+
+	tests := []struct {
+		name  string
+		query channelQuery
+		want  []string
+		err   string
+	}{
+		{name: "highest priority", query: channelQuery{group: "default", model: "gpt-4o"}, want: []string{"stream-system", "image-tools", "small-window"}},
+		{name: "stream", query: channelQuery{group: "default", model: "gpt-4o", isStream: true}, want: []string{"stream-system", "image-tools", "small-window"}},
+		{name: "image", query: channelQuery{group: "default", model: "gpt-4o", isImage: true}, want: []string{"image-tools", "small-window"}},
+		{name: "system prompt", query: channelQuery{group: "default", model: "gpt-4o", isSystemPrompt: true}, want: []string{"stream-system", "small-window"}},
+		{name: "function call", query: channelQuery{group: "default", model: "gpt-4o", isFunctionCall: true}, want: []string{"image-tools", "small-window"}},
+		{name: "n or logprobs", query: channelQuery{group: "default", model: "gpt-4o", isNORLogprobs: true}, want: []string{"small-window"}},
+		{name: "context window", query: channelQuery{group: "default", model: "gpt-4o", inputTokens: 900, maxTokens: 200}, want: []string{"stream-system", "image-tools"}},
+		{name: "image within context window", query: channelQuery{group: "default", model: "gpt-4o", isImage: true, inputTokens: 2000}, want: []string{"image-tools"}},
+		{name: "context length exceeded", query: channelQuery{group: "default", model: "gpt-4o", isNORLogprobs: true, inputTokens: 2000}, err: "context_length_exceeded"},
+		{name: "retry", query: channelQuery{group: "default", model: "gpt-4o", retry: 1}, want: []string{"backup"}},
+		{name: "retry without capability", query: channelQuery{group: "default", model: "gpt-4o", retry: 1, isImage: true}, err: "not_found"},
+		{name: "retry beyond priorities", query: channelQuery{group: "default", model: "gpt-4o", retry: 5}, want: []string{"last"}},
+		{name: "other group", query: channelQuery{group: "vip", model: "gpt-4o"}, want: []string{"last"}},
+		{name: "other model", query: channelQuery{group: "vip", model: "claude-3-haiku-20240307"}, want: []string{"vip-claude"}},
+		{name: "unknown model", query: channelQuery{group: "default", model: "unknown"}, err: "not_found"},
+	}
+
+	common.MemoryCacheEnabled = true
+	InitChannelCache()
+	for _, tt := range tests {
+		want := make([]int, 0, len(tt.want))
+		for _, name := range tt.want {
+			want = append(want, ids[name])
+		}
+		sort.Ints(want)
+		if tt.err != "" {
+			want = nil
+		}
+
+		common.MemoryCacheEnabled = true
+		cached, cachedErr := selectChannels(t, tt.query)
+		common.MemoryCacheEnabled = false
+		selected, sqlErr := selectChannels(t, tt.query)
+
+		if cachedErr != tt.err || !reflect.DeepEqual(cached, want) {
+			t.Errorf("%s: cache selected %v (error %q), want %v (error %q)", tt.name, cached, cachedErr, want, tt.err)
+		}
+		if sqlErr != cachedErr || !reflect.DeepEqual(selected, cached) {
+			t.Errorf("%s: SQL selected %v (error %q), cache selected %v (error %q)", tt.name, selected, sqlErr, cached, cachedErr)
+		}
+	}
+}
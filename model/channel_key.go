@@ -0,0 +1,334 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 多密钥渠道：渠道可以拥有一个密钥池（channel_keys 表），每次请求按渠道的 key_selection
+// 轮询（round_robin）或随机（random）选择一个可用密钥。每个密钥单独记录状态与用量，
+// 上游返回密钥无效等错误时只禁用该密钥，返回 429 时该密钥冷却一段时间。
+// 密钥池为空时使用渠道本身的密钥；池中没有可用密钥时同样回退到渠道本身的密钥。
+
+const (
+	ChannelKeySelectionRoundRobin = "round_robin"
+	ChannelKeySelectionRandom     = "random"
+)
+
+type ChannelKey struct {
+	Id           int    `json:"id"`
+	ChannelId    int    `json:"channel_id" gorm:"index"`
+	Key          string `json:"key" gorm:"not null"`
+	Status       int    `json:"status" gorm:"default:1"`
+	StatusReason string `json:"status_reason"`
+	RequestCount int    `json:"request_count" gorm:"default:0"`
+	FailureCount int    `json:"failure_count" gorm:"default:0"`
+	UsedQuota    int64  `json:"used_quota" gorm:"bigint;default:0"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+	// CooldownUntil 429 冷却结束的时间戳，不落库
+	CooldownUntil int64 `json:"cooldown_until" gorm:"-"`
+}
+
+// MaskedKey 返回隐藏中间部分的密钥，用于管理接口展示
+func (key *ChannelKey) MaskedKey() string {
+	return common.MaskSecret(key.Key)
+}
+
+func (channel *Channel) GetKeySelection() string {
+	if channel.KeySelection == nil || *channel.KeySelection == "" {
+		return ChannelKeySelectionRoundRobin
+	}
+	return *channel.KeySelection
+}
+
+var channelKeysCache map[int][]*ChannelKey
+var channelKeysLock sync.RWMutex
+
+// channelKeyCursors 渠道 id -> 轮询游标
+var channelKeyCursors sync.Map
+
+// channelKeyCooldowns 密钥 id -> 冷却结束时间戳，未启用 Redis 时使用
+var channelKeyCooldowns sync.Map
+
+// InitChannelKeyCache 从数据库加载所有启用的密钥，随渠道缓存一起同步
+func InitChannelKeyCache() {
+	var keys []*ChannelKey
+	err := DB.Where("status = ?", common.ChannelStatusEnabled).Order("id").Find(&keys).Error
+	if err != nil {
+		common.SysError("failed to load channel keys from database: " + err.Error())
+		return
+	}
+	newChannelKeysCache := make(map[int][]*ChannelKey)
+	for _, key := range keys {
+		newChannelKeysCache[key.ChannelId] = append(newChannelKeysCache[key.ChannelId], key)
+	}
+	channelKeysLock.Lock()
+	channelKeysCache = newChannelKeysCache
+	channelKeysLock.Unlock()
+}
+
+func refreshChannelKeyCache() {
+	if common.MemoryCacheEnabled {
+		InitChannelKeyCache()
+	}
+}
+
+func getEnabledChannelKeys(channelId int) []*ChannelKey {
+	if common.MemoryCacheEnabled {
+		channelKeysLock.RLock()
+		defer channelKeysLock.RUnlock()
+		return channelKeysCache[channelId]
+	}
+	var keys []*ChannelKey
+	err := DB.Where("channel_id = ? and status = ?", channelId, common.ChannelStatusEnabled).Order("id").Find(&keys).Error
+	if err != nil {
+		common.SysError("failed to load channel keys: " + err.Error())
+		return nil
+	}
+	return keys
+}
+
+func channelKeyCooldownRedisKey(keyId int) string {
+	return fmt.Sprintf("channel_key_cooldown:%d", keyId)
+}
+
+// getChannelKeyCooldowns 返回每个密钥冷却结束的时间戳，未冷却为 0
+func getChannelKeyCooldowns(keys []*ChannelKey) []int64 {
+	cooldowns := make([]int64, len(keys))
+	if common.RedisEnabled {
+		redisKeys := make([]string, len(keys))
+		for i, key := range keys {
+			redisKeys[i] = channelKeyCooldownRedisKey(key.Id)
+		}
+		values, err := common.RDB.MGet(context.Background(), redisKeys...).Result()
+		if err != nil {
+			common.SysError("failed to get channel key cooldowns: " + err.Error())
+			return cooldowns
+		}
+		for i, value := range values {
+			if s, ok := value.(string); ok {
+				cooldowns[i] = int64(common.String2Int(s))
+			}
+		}
+		return cooldowns
+	}
+	for i, key := range keys {
+		if until, ok := channelKeyCooldowns.Load(key.Id); ok {
+			cooldowns[i] = until.(int64)
+		}
+	}
+	return cooldowns
+}
+
+// CooldownChannelKey 上游返回 429 后密钥在 ChannelKeyCooldownSeconds 秒内不再被选择
+func CooldownChannelKey(keyId int) {
+	seconds := common.ChannelKeyCooldownSeconds
+	if keyId == 0 || seconds <= 0 {
+		return
+	}
+	until := time.Now().Unix() + int64(seconds)
+	if common.RedisEnabled {
+		err := common.RDB.Set(context.Background(), channelKeyCooldownRedisKey(keyId), until, time.Duration(seconds)*time.Second).Err()
+		if err != nil {
+			common.SysError("failed to set channel key cooldown: " + err.Error())
+		}
+		return
+	}
+	channelKeyCooldowns.Store(keyId, until)
+}
+
+// SelectChannelKey 按渠道的选择方式从密钥池中选择一个未冷却的可用密钥，preferredKeyId 可用时优先使用，
+// 全部冷却时忽略冷却；渠道没有可用密钥时返回 nil，使用渠道本身的密钥
+func SelectChannelKey(channel *Channel, preferredKeyId int) *ChannelKey {
+	keys := getEnabledChannelKeys(channel.Id)
+	if len(keys) == 0 {
+		return nil
+	}
+	now := time.Now().Unix()
+	cooldowns := getChannelKeyCooldowns(keys)
+	available := make([]*ChannelKey, 0, len(keys))
+	for i, key := range keys {
+		if cooldowns[i] <= now {
+			available = append(available, key)
+		}
+	}
+	if len(available) == 0 {
+		available = keys
+	}
+	for _, key := range available {
+		if preferredKeyId != 0 && key.Id == preferredKeyId {
+			return key
+		}
+	}
+	if channel.GetKeySelection() == ChannelKeySelectionRandom {
+		return available[common.GetRandomInt(len(available))]
+	}
+	cursor, _ := channelKeyCursors.LoadOrStore(channel.Id, new(uint64))
+	next := atomic.AddUint64(cursor.(*uint64), 1)
+	return available[(next-1)%uint64(len(available))]
+}
+
+func GetChannelKeyById(id int) (*ChannelKey, error) {
+	key := ChannelKey{}
+	err := DB.First(&key, "id = ?", id).Error
+	return &key, err
+}
+
+func GetChannelKeys(channelId int) ([]*ChannelKey, error) {
+	var keys []*ChannelKey
+	err := DB.Where("channel_id = ?", channelId).Order("id").Find(&keys).Error
+	if err != nil {
+		return nil, err
+	}
+	cooldowns := getChannelKeyCooldowns(keys)
+	now := time.Now().Unix()
+	for i, key := range keys {
+		if cooldowns[i] > now {
+			key.CooldownUntil = cooldowns[i]
+		}
+	}
+	return keys, nil
+}
+
+// AddChannelKeys 向渠道的密钥池添加密钥，跳过空行与池中已有的密钥，返回添加的数量
+func AddChannelKeys(channelId int, keys []string) (int, error) {
+	var existing []string
+	err := DB.Model(&ChannelKey{}).Where("channel_id = ?", channelId).Pluck("key", &existing).Error
+	if err != nil {
+		return 0, err
+	}
+	seen := make(map[string]bool, len(existing)+len(keys))
+	for _, key := range existing {
+		seen[key] = true
+	}
+	channelKeys := make([]ChannelKey, 0, len(keys))
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		channelKeys = append(channelKeys, ChannelKey{
+			ChannelId:   channelId,
+			Key:         key,
+			Status:      common.ChannelStatusEnabled,
+			CreatedTime: common.GetTimestamp(),
+		})
+	}
+	if len(channelKeys) == 0 {
+		return 0, nil
+	}
+	err = DB.Create(&channelKeys).Error
+	if err != nil {
+		return 0, err
+	}
+	refreshChannelKeyCache()
+	return len(channelKeys), nil
+}
+
+func DeleteChannelKey(channelId int, keyId int) error {
+	result := DB.Where("id = ? and channel_id = ?", keyId, channelId).Delete(&ChannelKey{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("密钥不存在")
+	}
+	channelKeyCooldowns.Delete(keyId)
+	refreshChannelKeyCache()
+	return nil
+}
+
+func deleteChannelKeysByChannelIds(tx *gorm.DB, channelIds []int) error {
+	return tx.Where("channel_id in (?)", channelIds).Delete(&ChannelKey{}).Error
+}
+
+func UpdateChannelKeyStatus(channelId int, keyId int, status int, reason string) error {
+	result := DB.Model(&ChannelKey{}).Where("id = ? and channel_id = ?", keyId, channelId).
+		Select("status", "status_reason").Updates(ChannelKey{Status: status, StatusReason: reason})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("密钥不存在")
+	}
+	if status == common.ChannelStatusEnabled {
+		channelKeyCooldowns.Delete(keyId)
+	}
+	refreshChannelKeyCache()
+	return nil
+}
+
+// DisableChannelKey 自动禁用密钥池中的单个密钥，返回该密钥所在渠道是否还有其他可用密钥
+func DisableChannelKey(keyId int, reason string) (bool, error) {
+	key := ChannelKey{}
+	err := DB.First(&key, "id = ?", keyId).Error
+	if err != nil {
+		return false, err
+	}
+	err = UpdateChannelKeyStatus(key.ChannelId, keyId, common.ChannelStatusAutoDisabled, reason)
+	if err != nil {
+		return false, err
+	}
+	var count int64
+	err = DB.Model(&ChannelKey{}).Where("channel_id = ? and status = ?", key.ChannelId, common.ChannelStatusEnabled).Count(&count).Error
+	return count > 0, err
+}
+
+// ChannelKeyRecord 记录密钥的请求次数与失败次数
+func ChannelKeyRecord(keyId int, success bool) {
+	if keyId == 0 {
+		return
+	}
+	if common.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeChannelKeyRequestCount, keyId, 1)
+		if !success {
+			addNewRecord(BatchUpdateTypeChannelKeyFailureCount, keyId, 1)
+		}
+		return
+	}
+	updateChannelKeyRequestCount(keyId, 1)
+	if !success {
+		updateChannelKeyFailureCount(keyId, 1)
+	}
+}
+
+func UpdateChannelKeyUsedQuota(keyId int, quota int) {
+	if keyId == 0 {
+		return
+	}
+	if common.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeChannelKeyUsedQuota, keyId, quota)
+		return
+	}
+	updateChannelKeyUsedQuota(keyId, quota)
+}
+
+func updateChannelKeyRequestCount(id int, count int) {
+	err := DB.Model(&ChannelKey{}).Where("id = ?", id).Update("request_count", gorm.Expr("request_count + ?", count)).Error
+	if err != nil {
+		common.SysError("failed to update channel key request count: " + err.Error())
+	}
+}
+
+func updateChannelKeyFailureCount(id int, count int) {
+	err := DB.Model(&ChannelKey{}).Where("id = ?", id).Update("failure_count", gorm.Expr("failure_count + ?", count)).Error
+	if err != nil {
+		common.SysError("failed to update channel key failure count: " + err.Error())
+	}
+}
+
+func updateChannelKeyUsedQuota(id int, quota int) {
+	err := DB.Model(&ChannelKey{}).Where("id = ?", id).Update("used_quota", gorm.Expr("used_quota + ?", quota)).Error
+	if err != nil {
+		common.SysError("failed to update channel key used quota: " + err.Error())
+	}
+}
@@ -0,0 +1,411 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"one-api/common"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 渠道限流：渠道以及渠道+模型可以设置最大并发数、每分钟请求数（RPM）与每分钟 token 数（TPM），
+// 选择渠道时检查与占用额度在同一步内原子完成，占用失败时改选同一优先级的其他渠道，
+// 同一优先级的渠道全部达到限制时尝试下一个优先级。
+// 每分钟的用量按前后两个一分钟窗口加权估算，启用 Redis 时由所有节点共享，否则保存在内存中。
+
+// ErrChannelSaturated 所有满足条件的渠道均已达到限流
+var ErrChannelSaturated = errors.New("所有可用渠道均已达到并发或速率限制")
+
+type ChannelLimit struct {
+	MaxConcurrency int `json:"max_concurrency"`
+	RPM            int `json:"rpm"`
+	TPM            int `json:"tpm"`
+}
+
+func (limit ChannelLimit) enabled() bool {
+	return limit.MaxConcurrency > 0 || limit.RPM > 0 || limit.TPM > 0
+}
+
+type channelLimitUsage struct {
+	Concurrency int
+	Requests    int
+	Tokens      int
+}
+
+// exceeded 在当前用量下再发送 tokens 个 token 的请求是否会超过限流
+func (limit ChannelLimit) exceeded(usage channelLimitUsage, tokens int) bool {
+	if limit.MaxConcurrency > 0 && usage.Concurrency >= limit.MaxConcurrency {
+		return true
+	}
+	if limit.RPM > 0 && usage.Requests >= limit.RPM {
+		return true
+	}
+	// 单个请求的 token 数超过 TPM 时，只要窗口内没有其他用量仍然放行，避免永远无法选中
+	return limit.TPM > 0 && usage.Tokens > 0 && usage.Tokens+tokens > limit.TPM
+}
+
+type channelLimitStore interface {
+	// acquire 检查各级限流并占用额度，任意一级会超过限流时不占用任何额度并返回 false；
+	// force 为 true 时不检查限流直接占用
+	acquire(levels []channelLimitLevel, tokens int, now int64, force bool) bool
+	release(key string)
+	addTokens(key string, tokens int, now int64)
+}
+
+func getChannelLimitStore() channelLimitStore {
+	if common.RedisEnabled {
+		return redisChannelLimitStore{}
+	}
+	return memoryLimitStore
+}
+
+func intValue(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+func (channel *Channel) GetChannelLimit() ChannelLimit {
+	return ChannelLimit{
+		MaxConcurrency: intValue(channel.MaxConcurrency),
+		RPM:            intValue(channel.RPMLimit),
+		TPM:            intValue(channel.TPMLimit),
+	}
+}
+
+// parseModelLimits 解析渠道对各模型单独设置的限流
+func (channel *Channel) parseModelLimits() map[string]ChannelLimit {
+	modelLimits := make(map[string]ChannelLimit)
+	if channel.ModelLimits == nil || *channel.ModelLimits == "" || *channel.ModelLimits == "{}" {
+		return modelLimits
+	}
+	err := json.Unmarshal([]byte(*channel.ModelLimits), &modelLimits)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to unmarshal model limits of channel #%d: %s", channel.Id, err.Error()))
+		return map[string]ChannelLimit{}
+	}
+	return modelLimits
+}
+
+// GetModelLimit 返回渠道对指定模型单独设置的限流，缓存中的渠道使用建立索引时解析的结果
+func (channel *Channel) GetModelLimit(model string) ChannelLimit {
+	if channel.modelLimits != nil {
+		return channel.modelLimits[model]
+	}
+	return channel.parseModelLimits()[model]
+}
+
+type channelLimitLevel struct {
+	key   string
+	limit ChannelLimit
+}
+
+// channelLimitLevels 返回渠道与渠道+模型两级中设置了限流的部分
+func channelLimitLevels(channel *Channel, model string) []channelLimitLevel {
+	levels := make([]channelLimitLevel, 0, 2)
+	if limit := channel.GetChannelLimit(); limit.enabled() {
+		levels = append(levels, channelLimitLevel{key: channelBreakerKey(channel.Id, ""), limit: limit})
+	}
+	if limit := channel.GetModelLimit(model); limit.enabled() {
+		levels = append(levels, channelLimitLevel{key: channelBreakerKey(channel.Id, model), limit: limit})
+	}
+	return levels
+}
+
+// channelLimitAcquire 占用渠道发送 inputTokens 个 token 的请求所需的额度，达到限流时返回 false；
+// 返回的函数在请求结束时调用以释放并发数
+func channelLimitAcquire(store channelLimitStore, channel *Channel, model string, inputTokens int, now int64, force bool) (func(), bool) {
+	levels := channelLimitLevels(channel, model)
+	if len(levels) == 0 {
+		return func() {}, true
+	}
+	if !store.acquire(levels, inputTokens, now, force) {
+		return nil, false
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			for _, level := range levels {
+				if level.limit.MaxConcurrency > 0 {
+					store.release(level.key)
+				}
+			}
+		})
+	}, true
+}
+
+// ChannelLimitAcquire 不检查限流直接记录一次发往渠道的请求，用于指定了渠道的请求，
+// 返回的函数在请求结束时调用以释放并发数
+func ChannelLimitAcquire(channel *Channel, model string, inputTokens int) func() {
+	release, _ := channelLimitAcquire(getChannelLimitStore(), channel, model, inputTokens, time.Now().Unix(), true)
+	return release
+}
+
+// channelAcquire 占用渠道的限流额度，breaker 为 true 时同时占用熔断器的半开探测名额，
+// 任一占用失败时释放已占用的部分并返回 false；返回的函数在请求结束时调用以释放
+func channelAcquire(channel *Channel, model string, inputTokens int, now int64, breaker bool) (func(), bool) {
+	breakerRelease := func() {}
+	if breaker {
+		var ok bool
+		breakerRelease, ok = channelBreakerAcquire(getChannelBreakerStore(), channel.Id, model, now)
+		if !ok {
+			return nil, false
+		}
+	}
+	limitRelease, ok := channelLimitAcquire(getChannelLimitStore(), channel, model, inputTokens, now, false)
+	if !ok {
+		breakerRelease()
+		return nil, false
+	}
+	return func() {
+		limitRelease()
+		breakerRelease()
+	}, true
+}
+
+// acquireWeightedChannel 在 indexes 中按权重随机选择渠道并占用其限流额度（breaker 为 true 时还有熔断器的探测名额），
+// 占用失败时在其余渠道中重新选择。返回选中渠道的下标与释放函数，全部占用失败时返回 -1
+func acquireWeightedChannel(indexes []int, weights []int, channel func(i int) *Channel, model string, inputTokens int, breaker bool) (int, func()) {
+	now := time.Now().Unix()
+	indexes = append([]int(nil), indexes...)
+	weights = append([]int(nil), weights...)
+	for len(indexes) > 0 {
+		totalWeight := 0
+		for _, weight := range weights {
+			totalWeight += weight
+		}
+		// Generate a random value in the range [0, totalWeight)
+		randomWeight := rand.Intn(totalWeight)
+		k := 0
+		for ; k < len(indexes)-1; k++ {
+			randomWeight -= weights[k]
+			if randomWeight < 0 {
+				break
+			}
+		}
+		if release, ok := channelAcquire(channel(indexes[k]), model, inputTokens, now, breaker); ok {
+			return indexes[k], release
+		}
+		indexes = append(indexes[:k], indexes[k+1:]...)
+		weights = append(weights[:k], weights[k+1:]...)
+	}
+	return -1, nil
+}
+
+// ChannelLimitAddTokens 请求完成后补充计入输出的 token 数
+func ChannelLimitAddTokens(channelId int, model string, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+	channel, err := CacheGetChannel(channelId)
+	if err != nil {
+		return
+	}
+	store := getChannelLimitStore()
+	now := time.Now().Unix()
+	for _, level := range channelLimitLevels(channel, model) {
+		if level.limit.TPM > 0 {
+			store.addTokens(level.key, tokens, now)
+		}
+	}
+}
+
+// slidingWindowCount 按上一分钟在当前滑动窗口中剩余的比例估算最近一分钟的用量
+func slidingWindowCount(previous int, current int, now int64) int {
+	elapsed := now % 60
+	return previous*int(60-elapsed)/60 + current
+}
+
+type channelLimitMinute struct {
+	start    int64
+	requests int
+	tokens   int
+}
+
+type memoryChannelLimitEntry struct {
+	concurrency int
+	minutes     [2]channelLimitMinute
+}
+
+func (entry *memoryChannelLimitEntry) minute(start int64) *channelLimitMinute {
+	minute := &entry.minutes[(start/60)%2]
+	if minute.start != start {
+		*minute = channelLimitMinute{start: start}
+	}
+	return minute
+}
+
+func (entry *memoryChannelLimitEntry) usage(now int64) channelLimitUsage {
+	start := now - now%60
+	current := entry.minute(start)
+	previous := entry.minute(start - 60)
+	return channelLimitUsage{
+		Concurrency: entry.concurrency,
+		Requests:    slidingWindowCount(previous.requests, current.requests, now),
+		Tokens:      slidingWindowCount(previous.tokens, current.tokens, now),
+	}
+}
+
+type memoryChannelLimitStore struct {
+	mutex   sync.Mutex
+	entries map[string]*memoryChannelLimitEntry
+}
+
+var memoryLimitStore = &memoryChannelLimitStore{entries: make(map[string]*memoryChannelLimitEntry)}
+
+func (s *memoryChannelLimitStore) getEntry(key string) *memoryChannelLimitEntry {
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &memoryChannelLimitEntry{}
+		s.entries[key] = entry
+	}
+	return entry
+}
+
+func (s *memoryChannelLimitStore) acquire(levels []channelLimitLevel, tokens int, now int64, force bool) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !force {
+		for _, level := range levels {
+			if level.limit.exceeded(s.getEntry(level.key).usage(now), tokens) {
+				return false
+			}
+		}
+	}
+	for _, level := range levels {
+		entry := s.getEntry(level.key)
+		if level.limit.MaxConcurrency > 0 {
+			entry.concurrency++
+		}
+		minute := entry.minute(now - now%60)
+		minute.requests++
+		minute.tokens += tokens
+	}
+	return true
+}
+
+func (s *memoryChannelLimitStore) release(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry := s.getEntry(key)
+	if entry.concurrency > 0 {
+		entry.concurrency--
+	}
+}
+
+func (s *memoryChannelLimitStore) addTokens(key string, tokens int, now int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.getEntry(key).minute(now - now%60).tokens += tokens
+}
+
+// redisChannelLimitConcurrencyTTL 并发计数的过期时间，只在计数创建时设置，防止节点异常退出后并发数无法释放
+const redisChannelLimitConcurrencyTTL = time.Hour
+
+type redisChannelLimitStore struct{}
+
+func redisChannelLimitConcurrencyKey(key string) string {
+	return "channel_limit:concurrency:" + key
+}
+
+func redisChannelLimitWindowKey(key string, start int64) string {
+	return fmt.Sprintf("channel_limit:window:%s:%d", key, start)
+}
+
+// redisChannelLimitAcquireScript 原子地检查并占用各级限流额度，计算方式与 ChannelLimit.exceeded 一致。
+// KEYS 每一级依次为并发计数、当前分钟、上一分钟的键；
+// ARGV 依次为当前分钟已过去的秒数、token 数、是否跳过检查、并发计数的过期秒数，之后每一级依次为最大并发数、RPM、TPM
+var redisChannelLimitAcquireScript = redis.NewScript(`
+local elapsed = tonumber(ARGV[1])
+local tokens = tonumber(ARGV[2])
+local levels = #KEYS / 3
+local function field(key, name)
+	return tonumber(redis.call("HGET", key, name) or 0)
+end
+local function sliding(i, name)
+	return math.floor(field(KEYS[i * 3 + 3], name) * (60 - elapsed) / 60) + field(KEYS[i * 3 + 2], name)
+end
+if ARGV[3] ~= "1" then
+	for i = 0, levels - 1 do
+		local maxConcurrency = tonumber(ARGV[i * 3 + 5])
+		local rpm = tonumber(ARGV[i * 3 + 6])
+		local tpm = tonumber(ARGV[i * 3 + 7])
+		if maxConcurrency > 0 and tonumber(redis.call("GET", KEYS[i * 3 + 1]) or 0) >= maxConcurrency then
+			return 0
+		end
+		if rpm > 0 and sliding(i, "requests") >= rpm then
+			return 0
+		end
+		if tpm > 0 then
+			local used = sliding(i, "tokens")
+			if used > 0 and used + tokens > tpm then
+				return 0
+			end
+		end
+	end
+end
+for i = 0, levels - 1 do
+	if tonumber(ARGV[i * 3 + 5]) > 0 then
+		redis.call("SET", KEYS[i * 3 + 1], 0, "EX", ARGV[4], "NX")
+		redis.call("INCR", KEYS[i * 3 + 1])
+	end
+	redis.call("HINCRBY", KEYS[i * 3 + 2], "requests", 1)
+	redis.call("HINCRBY", KEYS[i * 3 + 2], "tokens", tokens)
+	redis.call("EXPIRE", KEYS[i * 3 + 2], 120)
+end
+return 1
+`)
+
+// redisChannelLimitReleaseScript 并发计数大于 0 时减一，不改变计数的过期时间
+var redisChannelLimitReleaseScript = redis.NewScript(`
+if tonumber(redis.call("GET", KEYS[1]) or 0) > 0 then
+	return redis.call("DECR", KEYS[1])
+end
+return 0
+`)
+
+func (redisChannelLimitStore) acquire(levels []channelLimitLevel, tokens int, now int64, force bool) bool {
+	start := now - now%60
+	keys := make([]string, 0, len(levels)*3)
+	args := []interface{}{now % 60, tokens, "0", int64(redisChannelLimitConcurrencyTTL / time.Second)}
+	if force {
+		args[2] = "1"
+	}
+	for _, level := range levels {
+		keys = append(keys, redisChannelLimitConcurrencyKey(level.key),
+			redisChannelLimitWindowKey(level.key, start), redisChannelLimitWindowKey(level.key, start-60))
+		args = append(args, level.limit.MaxConcurrency, level.limit.RPM, level.limit.TPM)
+	}
+	acquired, err := redisChannelLimitAcquireScript.Run(context.Background(), common.RDB, keys, args...).Int()
+	if err != nil {
+		// Redis 不可用时放行，避免限流导致所有请求失败
+		common.SysError("failed to acquire channel limit: " + err.Error())
+		return true
+	}
+	return acquired == 1
+}
+
+func (redisChannelLimitStore) release(key string) {
+	err := redisChannelLimitReleaseScript.Run(context.Background(), common.RDB, []string{redisChannelLimitConcurrencyKey(key)}).Err()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		common.SysError("failed to release channel limit: " + err.Error())
+	}
+}
+
+func (redisChannelLimitStore) addTokens(key string, tokens int, now int64) {
+	ctx := context.Background()
+	windowKey := redisChannelLimitWindowKey(key, now-now%60)
+	pipe := common.RDB.TxPipeline()
+	pipe.HIncrBy(ctx, windowKey, "tokens", int64(tokens))
+	pipe.Expire(ctx, windowKey, 2*time.Minute)
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		common.SysError("failed to add channel limit tokens: " + err.Error())
+	}
+}
@@ -0,0 +1,175 @@
+package model
+
+import (
+	"one-api/common"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestLimitStore(t *testing.T) *memoryChannelLimitStore {
+	t.Helper()
+	common.RedisEnabled = false
+	store := &memoryChannelLimitStore{entries: make(map[string]*memoryChannelLimitEntry)}
+	previous := memoryLimitStore
+	memoryLimitStore = store
+	t.Cleanup(func() {
+		memoryLimitStore = previous
+	})
+	return store
+}
+
+func newLimitedChannel(id int, maxConcurrency int, rpm int, tpm int, modelLimits string) *Channel {
+	return &Channel{
+		Id:             id,
+		MaxConcurrency: &maxConcurrency,
+		RPMLimit:       &rpm,
+		TPMLimit:       &tpm,
+		ModelLimits:    &modelLimits,
+	}
+}
+
+func TestSlidingWindowCount(t *testing.T) {
+	tests := []struct {
+		previous int
+		current  int
+		now      int64
+		want     int
+	}{
+		{previous: 60, current: 10, now: 600, want: 70},
+		{previous: 60, current: 10, now: 630, want: 40},
+		{previous: 60, current: 10, now: 659, want: 11},
+		{previous: 0, current: 5, now: 645, want: 5},
+	}
+	for _, tt := range tests {
+		if got := slidingWindowCount(tt.previous, tt.current, tt.now); got != tt.want {
+			t.Errorf("slidingWindowCount(%d, %d, %d) = %d, want %d", tt.previous, tt.current, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestChannelLimitAcquireIsAtomic(t *testing.T) {
+	store := newTestLimitStore(t)
+	channel := newLimitedChannel(1, 3, 0, 0, "")
+	now := int64(600)
+
+	var acquired int32
+	releases := make(chan func(), 50)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if release, ok := channelLimitAcquire(store, channel, "gpt-4o", 10, now, false); ok {
+				atomic.AddInt32(&acquired, 1)
+				releases <- release
+			}
+		}()
+	}
+	wg.Wait()
+	close(releases)
+	if acquired != 3 {
+		t.Fatalf("concurrent acquires = %d, want 3", acquired)
+	}
+
+	release := <-releases
+	release()
+	release()
+	if _, ok := channelLimitAcquire(store, channel, "gpt-4o", 10, now, false); !ok {
+		t.Fatal("acquire failed after a slot was released")
+	}
+	if _, ok := channelLimitAcquire(store, channel, "gpt-4o", 10, now, false); ok {
+		t.Fatal("releasing twice freed more than one slot")
+	}
+	// 指定渠道的请求不检查限流，但计入用量
+	if _, ok := channelLimitAcquire(store, channel, "gpt-4o", 10, now, true); !ok {
+		t.Fatal("forced acquire failed")
+	}
+	if concurrency := store.getEntry(channelBreakerKey(1, "")).concurrency; concurrency != 4 {
+		t.Fatalf("concurrency after forced acquire = %d, want 4", concurrency)
+	}
+}
+
+func TestChannelLimitRPMSlidingWindow(t *testing.T) {
+	store := newTestLimitStore(t)
+	channel := newLimitedChannel(1, 0, 4, 0, "")
+	now := int64(600)
+	for i := 0; i < 4; i++ {
+		if _, ok := channelLimitAcquire(store, channel, "gpt-4o", 0, now, false); !ok {
+			t.Fatalf("request %d rejected within RPM", i+1)
+		}
+	}
+	if _, ok := channelLimitAcquire(store, channel, "gpt-4o", 0, now+59, false); ok {
+		t.Fatal("request over RPM accepted in the same minute")
+	}
+	// 下一分钟过去一半时，上一分钟的 4 个请求按 2 个计算
+	now += 90
+	for i := 0; i < 2; i++ {
+		if _, ok := channelLimitAcquire(store, channel, "gpt-4o", 0, now, false); !ok {
+			t.Fatalf("request %d rejected in the sliding window", i+1)
+		}
+	}
+	if _, ok := channelLimitAcquire(store, channel, "gpt-4o", 0, now, false); ok {
+		t.Fatal("request over RPM accepted in the sliding window")
+	}
+}
+
+func TestChannelLimitTPM(t *testing.T) {
+	store := newTestLimitStore(t)
+	channel := newLimitedChannel(1, 0, 0, 100, "")
+	now := int64(600)
+	// 单个请求超过 TPM 时，窗口内没有其他用量仍然放行
+	if _, ok := channelLimitAcquire(store, channel, "gpt-4o", 150, now, false); !ok {
+		t.Fatal("first request over TPM rejected")
+	}
+	if _, ok := channelLimitAcquire(store, channel, "gpt-4o", 1, now, false); ok {
+		t.Fatal("request accepted after TPM is used up")
+	}
+}
+
+func TestChannelModelLimit(t *testing.T) {
+	store := newTestLimitStore(t)
+	channel := newLimitedChannel(1, 0, 0, 0, `{"gpt-4o": {"max_concurrency": 1}}`)
+	channel.modelLimits = channel.parseModelLimits()
+	if limit := channel.GetModelLimit("gpt-4o"); limit.MaxConcurrency != 1 {
+		t.Fatalf("model limit = %+v, want max_concurrency 1", limit)
+	}
+	now := int64(600)
+	release, ok := channelLimitAcquire(store, channel, "gpt-4o", 0, now, false)
+	if !ok {
+		t.Fatal("first request rejected")
+	}
+	if _, ok = channelLimitAcquire(store, channel, "gpt-4o", 0, now, false); ok {
+		t.Fatal("request over the model limit accepted")
+	}
+	if _, ok = channelLimitAcquire(store, channel, "gpt-4o-mini", 0, now, false); !ok {
+		t.Fatal("model limit applied to another model")
+	}
+	release()
+	if _, ok = channelLimitAcquire(store, channel, "gpt-4o", 0, now, false); !ok {
+		t.Fatal("request rejected after the model slot was released")
+	}
+}
+
+func TestAcquireWeightedChannelSkipsSaturated(t *testing.T) {
+	store := newTestLimitStore(t)
+	channels := []*Channel{newLimitedChannel(1, 1, 0, 0, ""), newLimitedChannel(2, 1, 0, 0, "")}
+	channel := func(i int) *Channel {
+		return channels[i]
+	}
+	if _, ok := channelLimitAcquire(store, channels[0], "gpt-4o", 0, 600, false); !ok {
+		t.Fatal("failed to saturate channel #1")
+	}
+	// 权重更高的渠道已达到限流时选择其他渠道
+	i, release := acquireWeightedChannel([]int{0, 1}, []int{1000, 1}, channel, "gpt-4o", 0, false)
+	if i != 1 {
+		t.Fatalf("selected index %d, want 1", i)
+	}
+	if i, _ = acquireWeightedChannel([]int{0, 1}, []int{1000, 1}, channel, "gpt-4o", 0, false); i != -1 {
+		t.Fatalf("selected index %d with all channels saturated, want -1", i)
+	}
+	release()
+	if i, _ = acquireWeightedChannel([]int{0, 1}, []int{1000, 1}, channel, "gpt-4o", 0, false); i != 1 {
+		t.Fatalf("selected index %d after release, want 1", i)
+	}
+}
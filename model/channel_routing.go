@@ -0,0 +1,139 @@
+package model
+
+import (
+	"math"
+	"one-api/common"
+	"sync"
+	"time"
+)
+
+// 按延迟路由：统计每个渠道+模型在滑动窗口内的首字时间、总耗时与成功率，
+// 分组的选择策略为 latency 时，据此调整同一优先级内渠道的有效权重，
+// 越快、越稳定的渠道获得越多流量。统计只保存在当前节点内存中。
+
+// channelRoutingBuckets 滑动窗口被切分的桶数
+const channelRoutingBuckets = 10
+
+// 有效权重相对于基础权重的调整范围
+const (
+	channelRoutingMinLatencyFactor = 0.2
+	channelRoutingMaxLatencyFactor = 5
+	// channelRoutingWeightScale 有效权重放大倍数，避免取整后丢失精度
+	channelRoutingWeightScale = 100
+)
+
+type channelRoutingBucket struct {
+	start     int64
+	total     int
+	successes int
+	latencyMs int64
+	frtMs     int64
+}
+
+type channelRoutingStats struct {
+	Total     int
+	Successes int
+	LatencyMs int64
+	FrtMs     int64
+}
+
+var channelRoutingLock sync.RWMutex
+var channelRoutingEntries = make(map[string]*[channelRoutingBuckets]channelRoutingBucket)
+
+func getChannelRoutingBucketSeconds() int64 {
+	bucketSeconds := int64(common.ChannelRoutingWindowSeconds) / channelRoutingBuckets
+	if bucketSeconds <= 0 {
+		bucketSeconds = 1
+	}
+	return bucketSeconds
+}
+
+// ChannelRoutingRecord 记录一次请求的结果，firstResponse 为首字时间，非流式请求与总耗时相同
+func ChannelRoutingRecord(channelId int, model string, success bool, latency time.Duration, firstResponse time.Duration) {
+	now := time.Now().Unix()
+	bucketSeconds := getChannelRoutingBucketSeconds()
+	start := now - now%bucketSeconds
+	key := channelBreakerKey(channelId, model)
+
+	channelRoutingLock.Lock()
+	defer channelRoutingLock.Unlock()
+	buckets, ok := channelRoutingEntries[key]
+	if !ok {
+		buckets = &[channelRoutingBuckets]channelRoutingBucket{}
+		channelRoutingEntries[key] = buckets
+	}
+	bucket := &buckets[(start/bucketSeconds)%channelRoutingBuckets]
+	if bucket.start != start {
+		*bucket = channelRoutingBucket{start: start}
+	}
+	bucket.total++
+	if success {
+		bucket.successes++
+	}
+	bucket.latencyMs += latency.Milliseconds()
+	bucket.frtMs += firstResponse.Milliseconds()
+}
+
+func getChannelRoutingStats(channelId int, model string, now int64) channelRoutingStats {
+	var stats channelRoutingStats
+	buckets, ok := channelRoutingEntries[channelBreakerKey(channelId, model)]
+	if !ok {
+		return stats
+	}
+	windowStart := now - getChannelRoutingBucketSeconds()*channelRoutingBuckets
+	for _, bucket := range buckets {
+		if bucket.start > windowStart {
+			stats.Total += bucket.total
+			stats.Successes += bucket.successes
+			stats.LatencyMs += bucket.latencyMs
+			stats.FrtMs += bucket.frtMs
+		}
+	}
+	return stats
+}
+
+// channelRoutingWeights 返回 indexes 中每个渠道的有效权重，基础权重为 weight + 10。
+// 分组策略为 latency 时，样本足够的渠道按成功率的平方与平均耗时（首字时间与总耗时的均值）
+// 相对于同批渠道平均值的倒数调整权重；样本不足的渠道保持基础权重，以便持续获得探测流量。
+func channelRoutingWeights(group string, model string, indexes []int, channelId func(i int) int, weight func(i int) int) []int {
+	weights := make([]int, len(indexes))
+	for k, i := range indexes {
+		weights[k] = weight(i) + 10
+	}
+	if common.GetGroupRoutingStrategy(group) != common.RoutingStrategyLatency || len(indexes) < 2 {
+		return weights
+	}
+
+	now := time.Now().Unix()
+	successRates := make([]float64, len(indexes))
+	latencies := make([]float64, len(indexes))
+	observed := 0
+	latencySum := 0.0
+	channelRoutingLock.RLock()
+	for k, i := range indexes {
+		stats := getChannelRoutingStats(channelId(i), model, now)
+		if stats.Total == 0 || stats.Total < common.ChannelRoutingMinRequests {
+			continue
+		}
+		// 拉普拉斯平滑，避免少量失败直接把权重降为 0
+		successRates[k] = float64(stats.Successes+1) / float64(stats.Total+2)
+		latencies[k] = float64(stats.LatencyMs+stats.FrtMs)/float64(2*stats.Total) + 1
+		latencySum += latencies[k]
+		observed++
+	}
+	channelRoutingLock.RUnlock()
+	if observed == 0 {
+		return weights
+	}
+
+	avgLatency := latencySum / float64(observed)
+	for k := range indexes {
+		factor := 1.0
+		if latencies[k] > 0 {
+			latencyFactor := math.Min(math.Max(avgLatency/latencies[k], channelRoutingMinLatencyFactor), channelRoutingMaxLatencyFactor)
+			factor = successRates[k] * successRates[k] * latencyFactor
+		}
+		weights[k] = int(math.Max(1, math.Round(float64(weights[k])*factor*channelRoutingWeightScale)))
+	}
+	return weights
+}
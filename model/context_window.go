@@ -0,0 +1,99 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrContextLengthExceeded 有满足能力要求的渠道，但请求的 token 数超过了它们的上下文窗口
+var ErrContextLengthExceeded = errors.New("请求的 token 数超过了所有可用渠道的上下文窗口")
+
+// fitContextWindow 渠道上模型的上下文窗口能否容纳 contextTokens（提示词与 max_tokens 之和），
+// contextWindow 为渠道单独设置的窗口，为 0 时使用全局的模型上下文窗口，窗口未知时不限制
+func fitContextWindow(contextWindow int, model string, contextTokens int) bool {
+	if contextWindow <= 0 {
+		contextWindow = common.GetModelContextWindow(model)
+	}
+	return contextWindow <= 0 || contextTokens <= contextWindow
+}
+
+// whereCapability 按请求需要的能力过滤 abilities，需要的能力为 true 时过滤掉不具备该能力的渠道
+func whereCapability(query *gorm.DB, isImage bool, isStream bool, isSystemPrompt bool, isNORLogprobs bool, isFunctionCall bool) *gorm.DB {
+	if isImage {
+		query = query.Where("is_image = ?", true)
+	}
+	if isStream {
+		query = query.Where("is_support_stream = ?", true)
+	}
+	if isSystemPrompt {
+		query = query.Where("is_support_system_prompt = ?", true)
+	}
+	if isNORLogprobs {
+		query = query.Where("is_support_nor_logprobs = ?", true)
+	}
+	if isFunctionCall {
+		query = query.Where("is_support_function_call = ?", true)
+	}
+	return query
+}
+
+// legacyMaxInputTokensUnlimited 旧版渠道输入 token 上限的默认值，表示不限制
+const legacyMaxInputTokensUnlimited = 9999999
+
+// migrateChannelMaxInputTokens 将旧版渠道的输入 token 范围（max_input_tokens_low/high）迁移为模型上下文窗口：
+// 设置了上限且没有单独设置上下文窗口的渠道，将上限作为渠道上每个模型的上下文窗口；下限没有对应的设置，只记录日志。
+// 迁移后清零旧字段，避免重复迁移
+func migrateChannelMaxInputTokens(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&Channel{}, "max_input_tokens_high") {
+		return nil
+	}
+	var rows []struct {
+		Id                 int
+		Models             string
+		ContextWindows     *string
+		MaxInputTokensLow  int
+		MaxInputTokensHigh int
+	}
+	err := db.Table("channels").Select("id, models, context_windows, max_input_tokens_low, max_input_tokens_high").
+		Where("max_input_tokens_low > 0 or (max_input_tokens_high > 0 and max_input_tokens_high < ?)", legacyMaxInputTokensUnlimited).
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if row.MaxInputTokensLow > 0 {
+			common.SysLog(fmt.Sprintf("channel #%d: max_input_tokens_low %d is no longer supported and has been ignored", row.Id, row.MaxInputTokensLow))
+		}
+		if row.MaxInputTokensHigh > 0 && row.MaxInputTokensHigh < legacyMaxInputTokensUnlimited && (row.ContextWindows == nil || *row.ContextWindows == "") {
+			contextWindows := make(map[string]int)
+			for _, modelName := range strings.Split(row.Models, ",") {
+				if modelName != "" {
+					contextWindows[modelName] = row.MaxInputTokensHigh
+				}
+			}
+			data, _ := json.Marshal(contextWindows)
+			if err = db.Model(&Channel{}).Where("id = ?", row.Id).Update("context_windows", string(data)).Error; err != nil {
+				return err
+			}
+			channel, err := GetChannelById(row.Id, true)
+			if err != nil {
+				return err
+			}
+			if err = channel.UpdateAbilities(); err != nil {
+				return err
+			}
+			common.SysLog(fmt.Sprintf("channel #%d: migrated max_input_tokens_high %d to model context windows", row.Id, row.MaxInputTokensHigh))
+		}
+		err = db.Table("channels").Where("id = ?", row.Id).
+			Updates(map[string]interface{}{"max_input_tokens_low": 0, "max_input_tokens_high": 0}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package model
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"one-api/common"
+)
+
+// File 用户通过令牌上传的文件，内容保存在文件存储后端，StorageKey 为其在后端中的位置
+type File struct {
+	Id          int    `json:"-"`
+	FileId      string `json:"id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId      int    `json:"-" gorm:"index"`
+	TokenId     int    `json:"-"`
+	Filename    string `json:"filename"`
+	Purpose     string `json:"purpose" gorm:"type:varchar(32);index"`
+	Bytes       int64  `json:"bytes"`
+	StorageKey  string `json:"-"`
+	CreatedTime int64  `json:"created_at" gorm:"bigint"`
+	// BilledUntil 存储费用已支付到的时间，上传时预付首日，之后到期时按天收取；为 0 表示上传后首日
+	BilledUntil int64 `json:"-" gorm:"bigint;default:0;index"`
+}
+
+// FileStorageBillingSeconds 文件存储按天计费
+const FileStorageBillingSeconds = 24 * 60 * 60
+
+// UpstreamFile 网关文件在各渠道上游对应的文件 id，文件首次被转发到某个渠道时上传并记录。
+// 密钥池中不同密钥可能属于不同的上游账号，映射按渠道与密钥分别记录
+type UpstreamFile struct {
+	Id             int    `json:"id"`
+	FileId         string `json:"file_id" gorm:"type:varchar(64);uniqueIndex:idx_upstream_file_key"`
+	ChannelId      int    `json:"channel_id" gorm:"uniqueIndex:idx_upstream_file_key"`
+	UpstreamFileId string `json:"upstream_file_id" gorm:"type:varchar(128)"`
+	// ChannelKeyId 上传时使用的密钥池密钥，0 表示渠道本身的密钥，删除上游文件时使用同一个密钥
+	ChannelKeyId int   `json:"channel_key_id" gorm:"default:0;uniqueIndex:idx_upstream_file_key"`
+	CreatedTime  int64 `json:"created_time" gorm:"bigint"`
+}
+
+// migrateUpstreamFileIndex 删除旧版按文件与渠道建立的唯一索引，改为按文件、渠道与密钥建立
+func migrateUpstreamFileIndex(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&UpstreamFile{}) || !db.Migrator().HasIndex(&UpstreamFile{}, "idx_upstream_file") {
+		return nil
+	}
+	return db.Migrator().DropIndex(&UpstreamFile{}, "idx_upstream_file")
+}
+
+func (file *File) Insert() error {
+	file.CreatedTime = common.GetTimestamp()
+	file.BilledUntil = file.CreatedTime + FileStorageBillingSeconds
+	return DB.Create(file).Error
+}
+
+// GetFilesDueForStorageBilling 获取存储费用在 now 之前到期的文件
+func GetFilesDueForStorageBilling(now int64, num int) ([]*File, error) {
+	var files []*File
+	err := DB.Where("billed_until <= ?", now).Order("id").Limit(num).Find(&files).Error
+	return files, err
+}
+
+// AdvanceFileBilledUntil 将文件的存储费用支付时间更新为 billedUntil，文件已删除或已被其他节点更新时返回 false
+func AdvanceFileBilledUntil(file *File, billedUntil int64) (bool, error) {
+	result := DB.Model(&File{}).Where("id = ? and billed_until = ?", file.Id, file.BilledUntil).Update("billed_until", billedUntil)
+	return result.RowsAffected > 0, result.Error
+}
+
+func GetUserFiles(userId int, purpose string, num int) ([]*File, error) {
+	var files []*File
+	tx := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		tx = tx.Where("purpose = ?", purpose)
+	}
+	err := tx.Order("id desc").Limit(num).Find(&files).Error
+	return files, err
+}
+
+func GetUserFileById(userId int, fileId string) (*File, error) {
+	if fileId == "" {
+		return nil, errors.New("file id 为空！")
+	}
+	file := File{}
+	err := DB.Where("user_id = ? and file_id = ?", userId, fileId).First(&file).Error
+	return &file, err
+}
+
+// DeleteFile 删除文件及其上游映射，返回删除前的上游映射以便清理上游文件
+func DeleteFile(file *File) ([]*UpstreamFile, error) {
+	var upstreamFiles []*UpstreamFile
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("file_id = ?", file.FileId).Find(&upstreamFiles).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("file_id = ?", file.FileId).Delete(&UpstreamFile{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(file).Error
+	})
+	return upstreamFiles, err
+}
+
+// GetUpstreamFileId 返回文件通过渠道的指定密钥上传后的上游文件 id，channelKeyId 为 0 表示渠道本身的密钥
+func GetUpstreamFileId(fileId string, channelId int, channelKeyId int) (string, error) {
+	upstreamFile := UpstreamFile{}
+	err := DB.Where("file_id = ? and channel_id = ? and channel_key_id = ?", fileId, channelId, channelKeyId).First(&upstreamFile).Error
+	return upstreamFile.UpstreamFileId, err
+}
+
+func CreateUpstreamFile(fileId string, channelId int, channelKeyId int, upstreamFileId string) error {
+	return DB.Create(&UpstreamFile{
+		FileId:         fileId,
+		ChannelId:      channelId,
+		ChannelKeyId:   channelKeyId,
+		UpstreamFileId: upstreamFileId,
+		CreatedTime:    common.GetTimestamp(),
+	}).Error
+}
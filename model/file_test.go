@@ -0,0 +1,49 @@
+package model
+
+import "testing"
+
+func TestUpstreamFileMappingPerKey(t *testing.T) {
+	initTestDB(t)
+	// 旧版按文件与渠道建立的唯一索引在迁移时被删除
+	if err := DB.Migrator().DropIndex(&UpstreamFile{}, "idx_upstream_file_key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.Exec("CREATE UNIQUE INDEX idx_upstream_file ON upstream_files(file_id, channel_id)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateUpstreamFileIndex(DB); err != nil {
+		t.Fatal(err)
+	}
+	if DB.Migrator().HasIndex(&UpstreamFile{}, "idx_upstream_file") {
+		t.Fatal("legacy upstream file index is not dropped")
+	}
+	if err := DB.AutoMigrate(&UpstreamFile{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CreateUpstreamFile("file-1", 1, 0, "file-channel"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateUpstreamFile("file-1", 1, 10, "file-key-10"); err != nil {
+		t.Fatalf("failed to map the same file for another key of the channel: %v", err)
+	}
+	if err := CreateUpstreamFile("file-1", 1, 10, "file-key-10-again"); err == nil {
+		t.Fatal("duplicate mapping for the same key is accepted")
+	}
+	tests := []struct {
+		channelKeyId int
+		want         string
+	}{
+		{channelKeyId: 0, want: "file-channel"},
+		{channelKeyId: 10, want: "file-key-10"},
+	}
+	for _, tt := range tests {
+		if got, err := GetUpstreamFileId("file-1", 1, tt.channelKeyId); err != nil || got != tt.want {
+			t.Errorf("GetUpstreamFileId(key %d) = %q, %v, want %q", tt.channelKeyId, got, err, tt.want)
+		}
+	}
+	// 其他密钥没有映射，需要用该密钥重新上传
+	if _, err := GetUpstreamFileId("file-1", 1, 11); err == nil {
+		t.Error("GetUpstreamFileId returned a file uploaded with another key")
+	}
+}
@@ -60,10 +60,17 @@ func RecordLog(userId int, logType int, content string) {
 
 func RecordConsumeLog(ctx context.Context, userId int, channelId int, promptTokens int, completionTokens int, modelName string, tokenName string, quota int, content string, tokenId int, userQuota int, useTimeSeconds int, isStream bool, other map[string]interface{}) {
 	common.LogInfo(ctx, fmt.Sprintf("record consume log: userId=%d, 用户调用前余额=%d, channelId=%d, promptTokens=%d, completionTokens=%d, modelName=%s, tokenName=%s, quota=%d, content=%s", userId, userQuota, channelId, promptTokens, completionTokens, modelName, tokenName, quota, content))
+	// 转发请求的 ctx 为 gin.Context，可取到用户分组；异步任务轮询时分组为空
+	group, _ := ctx.Value("group").(string)
+	common.MetricsRecordConsumedQuota(modelName, channelId, group, quota)
+	common.MetricsRecordUpstreamTokens(modelName, channelId, promptTokens, completionTokens)
 	if !common.LogConsumeEnabled {
 		return
 	}
 	username, _ := CacheGetUsername(userId)
+	if captureId := common.GetBodyCaptureId(ctx); captureId != "" && other != nil {
+		other["capture_id"] = captureId
+	}
 	otherStr := common.MapToJsonStr(other)
 	log := &Log{
 		UserId:           userId,
@@ -93,6 +100,12 @@ func RecordConsumeLog(ctx context.Context, userId int, channelId int, promptToke
 	}
 }
 
+func GetLogById(id int) (*Log, error) {
+	log := Log{}
+	err := DB.First(&log, "id = ?", id).Error
+	return &log, err
+}
+
 func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, startIdx int, num int, channel int) (logs []*Log, err error) {
 	var tx *gorm.DB
 	if logType == LogTypeUnknown {
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"errors"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
@@ -82,6 +83,7 @@ func InitDB() (err error) {
 			db = db.Debug()
 		}
 		DB = db
+		registerMetricsCallbacks(DB)
 		sqlDB, err := DB.DB()
 		if err != nil {
 			return err
@@ -124,6 +126,10 @@ func InitDB() (err error) {
 		if err != nil {
 			return err
 		}
+		err = migrateChannelMaxInputTokens(db)
+		if err != nil {
+			return err
+		}
 		err = db.AutoMigrate(&Log{})
 		if err != nil {
 			return err
@@ -144,6 +150,30 @@ func InitDB() (err error) {
 		if err != nil {
 			return err
 		}
+		err = db.AutoMigrate(&File{})
+		if err != nil {
+			return err
+		}
+		err = migrateUpstreamFileIndex(db)
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&UpstreamFile{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&ChannelKey{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&BodyCapture{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&AuditLog{})
+		if err != nil {
+			return err
+		}
 		common.SysLog("database migrated")
 		err = createRootAccountIfNeed()
 		return err
@@ -153,6 +183,24 @@ func InitDB() (err error) {
 	return err
 }
 
+// registerMetricsCallbacks 在各类数据库操作结束后统计失败次数，记录不存在不计为错误
+func registerMetricsCallbacks(db *gorm.DB) {
+	record := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+				common.MetricsRecordDBError(operation)
+			}
+		}
+	}
+	callback := db.Callback()
+	_ = callback.Create().After("gorm:create").Register("metrics:create", record("create"))
+	_ = callback.Query().After("gorm:query").Register("metrics:query", record("query"))
+	_ = callback.Update().After("gorm:update").Register("metrics:update", record("update"))
+	_ = callback.Delete().After("gorm:delete").Register("metrics:delete", record("delete"))
+	_ = callback.Row().After("gorm:row").Register("metrics:row", record("row"))
+	_ = callback.Raw().After("gorm:raw").Register("metrics:raw", record("raw"))
+}
+
 func CloseDB() error {
 	sqlDB, err := DB.DB()
 	if err != nil {
@@ -44,6 +44,18 @@ func InitOptionMap() {
 	common.OptionMap["TaskEnabled"] = strconv.FormatBool(common.TaskEnabled)
 	common.OptionMap["DataExportEnabled"] = strconv.FormatBool(common.DataExportEnabled)
 	common.OptionMap["ChannelDisableThreshold"] = strconv.FormatFloat(common.ChannelDisableThreshold, 'f', -1, 64)
+	common.OptionMap["ChannelBreakerEnabled"] = strconv.FormatBool(common.ChannelBreakerEnabled)
+	common.OptionMap["ChannelBreakerErrorRate"] = strconv.FormatFloat(common.ChannelBreakerErrorRate, 'f', -1, 64)
+	common.OptionMap["ChannelBreakerMinRequests"] = strconv.Itoa(common.ChannelBreakerMinRequests)
+	common.OptionMap["ChannelBreakerWindowSeconds"] = strconv.Itoa(common.ChannelBreakerWindowSeconds)
+	common.OptionMap["ChannelBreakerOpenSeconds"] = strconv.Itoa(common.ChannelBreakerOpenSeconds)
+	common.OptionMap["ChannelBreakerHalfOpenProbes"] = strconv.Itoa(common.ChannelBreakerHalfOpenProbes)
+	common.OptionMap["ChannelRoutingWindowSeconds"] = strconv.Itoa(common.ChannelRoutingWindowSeconds)
+	common.OptionMap["ChannelRoutingMinRequests"] = strconv.Itoa(common.ChannelRoutingMinRequests)
+	common.OptionMap["ChannelKeyCooldownSeconds"] = strconv.Itoa(common.ChannelKeyCooldownSeconds)
+	common.OptionMap["ChannelAffinityEnabled"] = strconv.FormatBool(common.ChannelAffinityEnabled)
+	common.OptionMap["ChannelAffinityHeader"] = common.ChannelAffinityHeader
+	common.OptionMap["ChannelAffinitySeconds"] = strconv.Itoa(common.ChannelAffinitySeconds)
 	common.OptionMap["EmailDomainRestrictionEnabled"] = strconv.FormatBool(common.EmailDomainRestrictionEnabled)
 	common.OptionMap["EmailAliasRestrictionEnabled"] = strconv.FormatBool(common.EmailAliasRestrictionEnabled)
 	common.OptionMap["EmailDomainWhitelist"] = strings.Join(common.EmailDomainWhitelist, ",")
@@ -83,9 +95,16 @@ func InitOptionMap() {
 	common.OptionMap["QuotaForInvitee"] = strconv.Itoa(common.QuotaForInvitee)
 	common.OptionMap["QuotaRemindThreshold"] = strconv.Itoa(common.QuotaRemindThreshold)
 	common.OptionMap["PreConsumedQuota"] = strconv.Itoa(common.PreConsumedQuota)
+	common.OptionMap["FileStorageQuotaPerMB"] = strconv.Itoa(common.FileStorageQuotaPerMB)
+	common.OptionMap["BatchRatio"] = strconv.FormatFloat(common.BatchRatio, 'f', -1, 64)
 	common.OptionMap["ModelRatio"] = common.ModelRatio2JSONString()
 	common.OptionMap["ModelPrice"] = common.ModelPrice2JSONString()
+	common.OptionMap["ModelContextWindow"] = common.ModelContextWindow2JSONString()
 	common.OptionMap["GroupRatio"] = common.GroupRatio2JSONString()
+	common.OptionMap["GroupRoutingStrategy"] = common.GroupRoutingStrategy2JSONString()
+	common.OptionMap["GroupHedgeDelay"] = common.GroupHedgeDelay2JSONString()
+	common.OptionMap["GroupFirstTokenTimeout"] = common.GroupFirstTokenTimeout2JSONString()
+	common.OptionMap["ModelFallback"] = common.ModelFallback2JSONString()
 	common.OptionMap["CompletionRatio"] = common.CompletionRatio2JSONString()
 	common.OptionMap["TopUpLink"] = common.TopUpLink
 	common.OptionMap["ChatLink"] = common.ChatLink
@@ -105,6 +124,22 @@ func InitOptionMap() {
 	common.OptionMap["StopOnSensitiveEnabled"] = strconv.FormatBool(constant.StopOnSensitiveEnabled)
 	common.OptionMap["SensitiveWords"] = constant.SensitiveWordsToString()
 	common.OptionMap["StreamCacheQueueLength"] = strconv.Itoa(constant.StreamCacheQueueLength)
+	common.OptionMap["LogLevel"] = common.MinLogLevel.String()
+	common.OptionMap["LogInfoSampleRate"] = strconv.FormatFloat(common.LogInfoSampleRate, 'f', -1, 64)
+	common.OptionMap["BodyCaptureEnabled"] = strconv.FormatBool(common.BodyCaptureEnabled)
+	common.OptionMap["BodyCaptureUserIds"] = common.IdSet2String(common.BodyCaptureUserIds)
+	common.OptionMap["BodyCaptureTokenIds"] = common.IdSet2String(common.BodyCaptureTokenIds)
+	common.OptionMap["BodyCaptureGroups"] = common.StringSet2String(common.BodyCaptureGroups)
+	common.OptionMap["BodyCaptureSampleRate"] = strconv.FormatFloat(common.BodyCaptureSampleRate, 'f', -1, 64)
+	common.OptionMap["BodyCaptureMaxSize"] = strconv.Itoa(common.BodyCaptureMaxSize)
+	common.OptionMap["BodyCaptureRetentionDays"] = strconv.Itoa(common.BodyCaptureRetentionDays)
+	common.OptionMap["BodyCaptureRedactionRules"] = common.BodyCaptureRedactionRules2String()
+	common.OptionMap["NotificationChannels"] = common.NotificationChannels2JSONString()
+	common.OptionMap["NotificationRules"] = common.NotificationRules2JSONString()
+	common.OptionMap["NotificationTemplates"] = common.NotificationTemplates2JSONString()
+	common.OptionMap["NotificationRateLimitSeconds"] = strconv.Itoa(common.NotificationRateLimitSeconds)
+	common.OptionMap["ChannelBalanceLowThreshold"] = strconv.FormatFloat(common.ChannelBalanceLowThreshold, 'f', -1, 64)
+	common.OptionMap["TaskFailureSpikeThreshold"] = strconv.Itoa(common.TaskFailureSpikeThreshold)
 
 	common.OptionMapRWMutex.Unlock()
 	loadOptionsFromDatabase()
@@ -188,6 +223,10 @@ func updateOptionMap(key string, value string) (err error) {
 			common.AutomaticDisableChannelEnabled = boolValue
 		case "AutomaticEnableChannelEnabled":
 			common.AutomaticEnableChannelEnabled = boolValue
+		case "ChannelBreakerEnabled":
+			common.ChannelBreakerEnabled = boolValue
+		case "ChannelAffinityEnabled":
+			common.ChannelAffinityEnabled = boolValue
 		case "LogConsumeEnabled":
 			common.LogConsumeEnabled = boolValue
 		case "DisplayInCurrencyEnabled":
@@ -218,6 +257,8 @@ func updateOptionMap(key string, value string) (err error) {
 		//	constant.CheckSensitiveOnCompletionEnabled = boolValue
 		case "StopOnSensitiveEnabled":
 			constant.StopOnSensitiveEnabled = boolValue
+		case "BodyCaptureEnabled":
+			common.BodyCaptureEnabled = boolValue
 		case "SMTPSSLEnabled":
 			common.SMTPSSLEnabled = boolValue
 		}
@@ -290,6 +331,10 @@ func updateOptionMap(key string, value string) (err error) {
 		common.QuotaRemindThreshold, _ = strconv.Atoi(value)
 	case "PreConsumedQuota":
 		common.PreConsumedQuota, _ = strconv.Atoi(value)
+	case "FileStorageQuotaPerMB":
+		common.FileStorageQuotaPerMB, _ = strconv.Atoi(value)
+	case "BatchRatio":
+		common.BatchRatio, _ = strconv.ParseFloat(value, 64)
 	case "RetryTimes":
 		common.RetryTimes, _ = strconv.Atoi(value)
 	case "DataExportInterval":
@@ -300,10 +345,20 @@ func updateOptionMap(key string, value string) (err error) {
 		err = common.UpdateModelRatioByJSONString(value)
 	case "GroupRatio":
 		err = common.UpdateGroupRatioByJSONString(value)
+	case "GroupRoutingStrategy":
+		err = common.UpdateGroupRoutingStrategyByJSONString(value)
+	case "GroupHedgeDelay":
+		err = common.UpdateGroupHedgeDelayByJSONString(value)
+	case "GroupFirstTokenTimeout":
+		err = common.UpdateGroupFirstTokenTimeoutByJSONString(value)
+	case "ModelFallback":
+		err = common.UpdateModelFallbackByJSONString(value)
 	case "CompletionRatio":
 		err = common.UpdateCompletionRatioByJSONString(value)
 	case "ModelPrice":
 		err = common.UpdateModelPriceByJSONString(value)
+	case "ModelContextWindow":
+		err = common.UpdateModelContextWindowByJSONString(value)
 	case "TopUpLink":
 		common.TopUpLink = value
 	case "ChatLink":
@@ -312,12 +367,71 @@ func updateOptionMap(key string, value string) (err error) {
 		common.ChatLink2 = value
 	case "ChannelDisableThreshold":
 		common.ChannelDisableThreshold, _ = strconv.ParseFloat(value, 64)
+	case "ChannelBreakerErrorRate":
+		common.ChannelBreakerErrorRate, _ = strconv.ParseFloat(value, 64)
+	case "ChannelBreakerMinRequests":
+		common.ChannelBreakerMinRequests, _ = strconv.Atoi(value)
+	case "ChannelBreakerWindowSeconds":
+		common.ChannelBreakerWindowSeconds, _ = strconv.Atoi(value)
+	case "ChannelBreakerOpenSeconds":
+		common.ChannelBreakerOpenSeconds, _ = strconv.Atoi(value)
+	case "ChannelBreakerHalfOpenProbes":
+		common.ChannelBreakerHalfOpenProbes, _ = strconv.Atoi(value)
+	case "ChannelRoutingWindowSeconds":
+		common.ChannelRoutingWindowSeconds, _ = strconv.Atoi(value)
+	case "ChannelRoutingMinRequests":
+		common.ChannelRoutingMinRequests, _ = strconv.Atoi(value)
+	case "ChannelKeyCooldownSeconds":
+		common.ChannelKeyCooldownSeconds, _ = strconv.Atoi(value)
+	case "ChannelAffinityHeader":
+		common.ChannelAffinityHeader = value
+	case "ChannelAffinitySeconds":
+		common.ChannelAffinitySeconds, _ = strconv.Atoi(value)
 	case "QuotaPerUnit":
 		common.QuotaPerUnit, _ = strconv.ParseFloat(value, 64)
 	case "SensitiveWords":
 		constant.SensitiveWordsFromString(value)
 	case "StreamCacheQueueLength":
 		constant.StreamCacheQueueLength, _ = strconv.Atoi(value)
+	case "LogLevel":
+		err = common.UpdateLogLevel(value)
+	case "LogInfoSampleRate":
+		err = common.UpdateLogInfoSampleRate(value)
+	case "BodyCaptureUserIds":
+		common.BodyCaptureUserIds, err = common.ParseIdSet(value)
+	case "BodyCaptureTokenIds":
+		common.BodyCaptureTokenIds, err = common.ParseIdSet(value)
+	case "BodyCaptureGroups":
+		common.BodyCaptureGroups = common.ParseStringSet(value)
+	case "BodyCaptureSampleRate":
+		common.BodyCaptureSampleRate, _ = strconv.ParseFloat(value, 64)
+	case "BodyCaptureMaxSize":
+		common.BodyCaptureMaxSize, _ = strconv.Atoi(value)
+	case "BodyCaptureRetentionDays":
+		common.BodyCaptureRetentionDays, _ = strconv.Atoi(value)
+	case "BodyCaptureRedactionRules":
+		common.BodyCaptureRedactionRules, err = common.ParseBodyCaptureRedactionRules(value)
+	case "NotificationChannels":
+		var channels []common.NotificationChannel
+		if channels, err = common.ParseNotificationChannels(value); err == nil {
+			common.NotificationChannels = channels
+		}
+	case "NotificationRules":
+		var rules map[string][]string
+		if rules, err = common.ParseNotificationRules(value); err == nil {
+			common.NotificationRules = rules
+		}
+	case "NotificationTemplates":
+		var templates map[string]common.NotificationTemplate
+		if templates, err = common.ParseNotificationTemplates(value); err == nil {
+			common.NotificationTemplates = templates
+		}
+	case "NotificationRateLimitSeconds":
+		common.NotificationRateLimitSeconds, _ = strconv.Atoi(value)
+	case "ChannelBalanceLowThreshold":
+		common.ChannelBalanceLowThreshold, _ = strconv.ParseFloat(value, 64)
+	case "TaskFailureSpikeThreshold":
+		common.TaskFailureSpikeThreshold, _ = strconv.Atoi(value)
 	}
 	return err
 }
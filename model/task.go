@@ -18,6 +18,8 @@ const (
 	TaskStatusFailure               = "FAILURE"
 	TaskStatusSuccess               = "SUCCESS"
 	TaskStatusUnknown               = "UNKNOWN"
+	TaskStatusCancelling            = "CANCELLING"
+	TaskStatusCancelled             = "CANCELLED"
 )
 
 type Task struct {
@@ -170,6 +172,17 @@ func TaskGetAllTasks(startIdx int, num int, queryParams SyncTaskQueryParams) []*
 	return tasks
 }
 
+// TaskGetUserTasksBefore 按 id 倒序返回用户在某平台下 id 小于 beforeId 的任务，beforeId 为 0 时从最新的任务开始
+func TaskGetUserTasksBefore(userId int, platform constant.TaskPlatform, beforeId int64, num int) ([]*Task, error) {
+	var tasks []*Task
+	query := DB.Where("user_id = ? and platform = ?", userId, platform)
+	if beforeId > 0 {
+		query = query.Where("id < ?", beforeId)
+	}
+	err := query.Order("id desc").Limit(num).Find(&tasks).Error
+	return tasks, err
+}
+
 func GetAllUnFinishSyncTasks(limit int) []*Task {
 	var tasks []*Task
 	var err error
@@ -14,6 +14,10 @@ const (
 	BatchUpdateTypeUsedQuota
 	BatchUpdateTypeChannelUsedQuota
 	BatchUpdateTypeRequestCount
+	BatchUpdateTypeChannelKeyRequestCount
+	BatchUpdateTypeChannelKeyFailureCount
+	BatchUpdateTypeChannelKeyUsedQuota
+	BatchUpdateTypeChannelHedgeOverheadQuota
 	BatchUpdateTypeCount // if you add a new type, you need to add a new map and a new lock
 )
 
@@ -72,6 +76,14 @@ func batchUpdate() {
 				updateUserRequestCount(key, value)
 			case BatchUpdateTypeChannelUsedQuota:
 				updateChannelUsedQuota(key, value)
+			case BatchUpdateTypeChannelKeyRequestCount:
+				updateChannelKeyRequestCount(key, value)
+			case BatchUpdateTypeChannelKeyFailureCount:
+				updateChannelKeyFailureCount(key, value)
+			case BatchUpdateTypeChannelKeyUsedQuota:
+				updateChannelKeyUsedQuota(key, value)
+			case BatchUpdateTypeChannelHedgeOverheadQuota:
+				updateChannelHedgeOverheadQuota(key, value)
 			}
 		}
 	}
@@ -20,6 +20,18 @@ type Adaptor interface {
 	GetChannelName() string
 }
 
+// NativeAdaptor 由能直接接收非 OpenAI 原生格式请求（如 Anthropic Messages）的适配器实现，
+// 此时请求体只做必要的改写后转发，响应以原生格式返回给客户端
+type NativeAdaptor interface {
+	SupportNativeFormat(info *relaycommon.RelayInfo) bool
+	ConvertNativeRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody []byte) (io.Reader, error)
+}
+
+// RerankAdaptor 由支持 /v1/rerank 的适配器实现，请求地址与响应处理仍由 GetRequestURL、DoResponse 按 RelayMode 区分
+type RerankAdaptor interface {
+	ConvertRerankRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.RerankRequest) (any, error)
+}
+
 type TaskAdaptor interface {
 	Init(info *relaycommon.TaskRelayInfo)
 
@@ -1,16 +1,24 @@
 package channel
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"io"
 	"net/http"
-	"one-api/relay/common"
+	"one-api/common"
+	relaycommon "one-api/relay/common"
 	"one-api/service"
+	"sync/atomic"
+	"time"
 )
 
-func SetupApiRequestHeader(info *common.RelayInfo, c *gin.Context, req *http.Request) {
+// ErrFirstTokenTimeout 流式请求在首字超时内没有收到上游返回的任何内容
+var ErrFirstTokenTimeout = errors.New("first token timeout")
+
+func SetupApiRequestHeader(info *relaycommon.RelayInfo, c *gin.Context, req *http.Request) {
 	req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
 	req.Header.Set("Accept", c.Request.Header.Get("Accept"))
 	if info.IsStream && c.Request.Header.Get("Accept") == "" {
@@ -18,26 +26,108 @@ func SetupApiRequestHeader(info *common.RelayInfo, c *gin.Context, req *http.Req
 	}
 }
 
-func DoApiRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody io.Reader) (*http.Response, error) {
+func DoApiRequest(a Adaptor, c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
 	fullRequestURL, err := a.GetRequestURL(info)
 	if err != nil {
 		return nil, fmt.Errorf("get request url failed: %w", err)
 	}
-	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
+	ctx := relaycommon.UpstreamContext(c)
+	var firstToken *firstTokenTimer
+	if info.IsStream && info.FirstTokenTimeout > 0 {
+		ctx, firstToken = newFirstTokenTimer(ctx, info.FirstTokenTimeout)
+	}
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, fullRequestURL, requestBody)
 	if err != nil {
+		firstToken.stop()
 		return nil, fmt.Errorf("new request failed: %w", err)
 	}
 	err = a.SetupRequestHeader(c, req, info)
 	if err != nil {
+		firstToken.stop()
 		return nil, fmt.Errorf("setup request header failed: %w", err)
 	}
+	common.InjectTraceContext(c.Request.Context(), req.Header)
 	resp, err := doRequest(c, req)
 	if err != nil {
+		if firstToken.expired() {
+			return nil, ErrFirstTokenTimeout
+		}
+		firstToken.stop()
+		return nil, fmt.Errorf("do request failed: %w", err)
+	}
+	if firstToken != nil {
+		return firstToken.wait(resp)
+	}
+	return resp, nil
+}
+
+// firstTokenTimer 首字超时计时，超时后取消上游请求。计时覆盖等待响应头和响应体首个字节，
+// 在把响应交给处理函数之前完成，因此超时的请求不会向客户端写出任何内容，可以安全地重试
+type firstTokenTimer struct {
+	timer     *time.Timer
+	cancel    context.CancelFunc
+	timedOut  int32
+	cancelled bool
+}
+
+func newFirstTokenTimer(parent context.Context, timeout time.Duration) (context.Context, *firstTokenTimer) {
+	ctx, cancel := context.WithCancel(parent)
+	t := &firstTokenTimer{cancel: cancel}
+	t.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&t.timedOut, 1)
+		cancel()
+	})
+	return ctx, t
+}
+
+func (t *firstTokenTimer) expired() bool {
+	if t == nil {
+		return false
+	}
+	t.timer.Stop()
+	return atomic.LoadInt32(&t.timedOut) == 1
+}
+
+// stop 停止计时并释放 context，只能在不再读取响应体时调用
+func (t *firstTokenTimer) stop() {
+	if t == nil || t.cancelled {
+		return
+	}
+	t.timer.Stop()
+	t.cancelled = true
+	t.cancel()
+}
+
+// wait 等待响应体的首个字节，收到后停止计时，响应体关闭时释放 context
+func (t *firstTokenTimer) wait(resp *http.Response) (*http.Response, error) {
+	reader := bufio.NewReader(resp.Body)
+	_, err := reader.Peek(1)
+	if !t.timer.Stop() && atomic.LoadInt32(&t.timedOut) == 1 {
+		_ = resp.Body.Close()
+		t.stop()
+		return nil, ErrFirstTokenTimeout
+	}
+	if err != nil && err != io.EOF {
+		_ = resp.Body.Close()
+		t.stop()
 		return nil, fmt.Errorf("do request failed: %w", err)
 	}
+	resp.Body = &firstTokenBody{Reader: reader, body: resp.Body, timer: t}
 	return resp, nil
 }
 
+type firstTokenBody struct {
+	*bufio.Reader
+	body  io.ReadCloser
+	timer *firstTokenTimer
+}
+
+func (b *firstTokenBody) Close() error {
+	err := b.body.Close()
+	b.timer.stop()
+	return err
+}
+
 func doRequest(c *gin.Context, req *http.Request) (*http.Response, error) {
 	resp, err := service.GetHttpClient().Do(req)
 	if err != nil {
@@ -51,7 +141,7 @@ func doRequest(c *gin.Context, req *http.Request) (*http.Response, error) {
 	return resp, nil
 }
 
-func DoTaskApiRequest(a TaskAdaptor, c *gin.Context, info *common.TaskRelayInfo, requestBody io.Reader) (*http.Response, error) {
+func DoTaskApiRequest(a TaskAdaptor, c *gin.Context, info *relaycommon.TaskRelayInfo, requestBody io.Reader) (*http.Response, error) {
 	fullRequestURL, err := a.BuildRequestURL(info)
 	if err != nil {
 		return nil, err
@@ -68,6 +158,7 @@ func DoTaskApiRequest(a TaskAdaptor, c *gin.Context, info *common.TaskRelayInfo,
 	if err != nil {
 		return nil, fmt.Errorf("setup request header failed: %w", err)
 	}
+	common.InjectTraceContext(c.Request.Context(), req.Header)
 	resp, err := doRequest(c, req)
 	if err != nil {
 		return nil, fmt.Errorf("do request failed: %w", err)
@@ -1,6 +1,7 @@
 package aws
 
 import (
+	"bytes"
 	"errors"
 	"github.com/gin-gonic/gin"
 	"io"
@@ -8,6 +9,7 @@ import (
 	"one-api/dto"
 	"one-api/relay/channel/claude"
 	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
 	"strings"
 )
 
@@ -18,6 +20,8 @@ const (
 
 type Adaptor struct {
 	RequestMode int
+	// nativeRequestBody Anthropic Messages 原生请求改写后的 Bedrock 请求体
+	nativeRequestBody []byte
 }
 
 func (a *Adaptor) Init(info *relaycommon.RelayInfo, request dto.GeneralOpenAIRequest) {
@@ -53,11 +57,34 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *dto.Gen
 	return claudeReq, err
 }
 
+func (a *Adaptor) SupportNativeFormat(info *relaycommon.RelayInfo) bool {
+	return info.RelayFormat == relayconstant.RelayFormatClaude
+}
+
+func (a *Adaptor) ConvertNativeRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody []byte) (io.Reader, error) {
+	a.RequestMode = RequestModeMessage
+	body, err := nativeRequestBody(requestBody)
+	if err != nil {
+		return nil, err
+	}
+	a.nativeRequestBody = body
+	c.Set("request_model", info.UpstreamModelName)
+	return bytes.NewReader(body), nil
+}
+
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
 	return nil, nil
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode) {
+	if info.NativeRequest {
+		if info.IsStream {
+			err, usage = awsNativeStreamHandler(c, info, a.nativeRequestBody)
+		} else {
+			err, usage = awsNativeHandler(c, info, a.nativeRequestBody)
+		}
+		return
+	}
 	if info.IsStream {
 		err, usage = awsStreamHandler(c, info, a.RequestMode)
 	} else {
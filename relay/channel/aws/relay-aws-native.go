@@ -0,0 +1,120 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"net/http"
+	"one-api/common"
+	relaymodel "one-api/dto"
+	"one-api/relay/channel/claude"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// nativeRequestBody 将 Anthropic Messages 原生请求改写为 Bedrock 请求体：模型与流式由接口决定，需指定 anthropic_version
+func nativeRequestBody(requestBody []byte) ([]byte, error) {
+	var request map[string]json.RawMessage
+	err := json.Unmarshal(requestBody, &request)
+	if err != nil {
+		return nil, err
+	}
+	delete(request, "model")
+	delete(request, "stream")
+	request["anthropic_version"], _ = json.Marshal("bedrock-2023-05-31")
+	return json.Marshal(request)
+}
+
+func awsNativeHandler(c *gin.Context, info *relaycommon.RelayInfo, requestBody []byte) (*relaymodel.OpenAIErrorWithStatusCode, *relaymodel.Usage) {
+	awsCli, err := newAwsClient(c, info)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "newAwsClient")), nil
+	}
+
+	awsModelId, err := awsModelID(c.GetString("request_model"))
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "awsModelID")), nil
+	}
+
+	awsResp, err := awsCli.InvokeModel(c.Request.Context(), &bedrockruntime.InvokeModelInput{
+		ModelId:     aws.String(awsModelId),
+		Accept:      aws.String("application/json"),
+		ContentType: aws.String("application/json"),
+		Body:        requestBody,
+	})
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "InvokeModel")), nil
+	}
+
+	var claudeResponse relaymodel.ClaudeResponse
+	err = json.Unmarshal(awsResp.Body, &claudeResponse)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "unmarshal response")), nil
+	}
+	usage := claude.FinishNativeUsage(&relaymodel.Usage{
+		PromptTokens:     claudeResponse.Usage.InputTokens,
+		CompletionTokens: claudeResponse.Usage.OutputTokens,
+	}, info)
+
+	c.Data(http.StatusOK, "application/json", awsResp.Body)
+	return nil, usage
+}
+
+func awsNativeStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, requestBody []byte) (*relaymodel.OpenAIErrorWithStatusCode, *relaymodel.Usage) {
+	awsCli, err := newAwsClient(c, info)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "newAwsClient")), nil
+	}
+
+	awsModelId, err := awsModelID(c.GetString("request_model"))
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "awsModelID")), nil
+	}
+
+	awsResp, err := awsCli.InvokeModelWithResponseStream(c.Request.Context(), &bedrockruntime.InvokeModelWithResponseStreamInput{
+		ModelId:     aws.String(awsModelId),
+		Accept:      aws.String("application/json"),
+		ContentType: aws.String("application/json"),
+		Body:        requestBody,
+	})
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "InvokeModelWithResponseStream")), nil
+	}
+	stream := awsResp.GetStream()
+	defer stream.Close()
+
+	service.SetEventStreamHeaders(c)
+	usage := &relaymodel.Usage{}
+	isFirst := true
+	for event := range stream.Events() {
+		switch v := event.(type) {
+		case *types.ResponseStreamMemberChunk:
+			if isFirst {
+				isFirst = false
+				info.FirstResponseTime = time.Now()
+			}
+			var claudeEvent relaymodel.ClaudeStreamEvent
+			err := json.Unmarshal(v.Value.Bytes, &claudeEvent)
+			if err != nil {
+				common.SysError("error unmarshalling stream response: " + err.Error())
+				continue
+			}
+			claude.UpdateUsageByNativeEvent(usage, v.Value.Bytes)
+			// Bedrock 按块返回事件 JSON，还原为 Anthropic 的 SSE 格式
+			_, _ = c.Writer.WriteString(fmt.Sprintf("event: %s\ndata: %s\n\n", claudeEvent.Type, v.Value.Bytes))
+			c.Writer.Flush()
+		case *types.UnknownUnionMember:
+			common.LogError(c, "unknown tag: "+v.Tag)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		common.LogError(c, "read stream response failed: "+err.Error())
+	}
+	return nil, claude.FinishNativeUsage(usage, info)
+}
@@ -207,10 +207,10 @@ func awsStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, requestMode i
 			c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonStr)})
 			return true
 		case *types.UnknownUnionMember:
-			fmt.Println("unknown tag:", v.Tag)
+			common.LogWarn(c, "unknown bedrock stream event tag: "+v.Tag)
 			return false
 		default:
-			fmt.Println("union is nil or unknown type")
+			common.LogWarn(c, "bedrock stream event is nil or of unknown type")
 			return false
 		}
 	})
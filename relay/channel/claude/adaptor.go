@@ -1,6 +1,7 @@
 package claude
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -9,6 +10,7 @@ import (
 	"one-api/dto"
 	"one-api/relay/channel"
 	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
 	"strings"
 )
 
@@ -45,6 +47,9 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, info *re
 		anthropicVersion = "2023-06-01"
 	}
 	req.Header.Set("anthropic-version", anthropicVersion)
+	if anthropicBeta := c.Request.Header.Get("anthropic-beta"); anthropicBeta != "" {
+		req.Header.Set("anthropic-beta", anthropicBeta)
+	}
 	return nil
 }
 
@@ -59,11 +64,32 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *dto.Gen
 	}
 }
 
+func (a *Adaptor) SupportNativeFormat(info *relaycommon.RelayInfo) bool {
+	return info.RelayFormat == relayconstant.RelayFormatClaude
+}
+
+func (a *Adaptor) ConvertNativeRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody []byte) (io.Reader, error) {
+	a.RequestMode = RequestModeMessage
+	body, err := nativeRequestBody(requestBody, info.UpstreamModelName)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(body), nil
+}
+
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
 	return channel.DoApiRequest(a, c, info, requestBody)
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode) {
+	if info.NativeRequest {
+		if info.IsStream {
+			err, usage = claudeNativeStreamHandler(c, resp, info)
+		} else {
+			err, usage = claudeNativeHandler(c, resp, info)
+		}
+		return
+	}
 	if info.IsStream {
 		err, usage = claudeStreamHandler(c, resp, info, a.RequestMode)
 	} else {
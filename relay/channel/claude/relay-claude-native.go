@@ -0,0 +1,118 @@
+package claude
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+	"strings"
+	"time"
+)
+
+// nativeRequestBody 原样转发 Anthropic Messages 请求，仅将模型替换为映射后的上游模型
+func nativeRequestBody(requestBody []byte, model string) ([]byte, error) {
+	var request map[string]json.RawMessage
+	err := json.Unmarshal(requestBody, &request)
+	if err != nil {
+		return nil, err
+	}
+	request["model"], err = json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(request)
+}
+
+// UpdateUsageByNativeEvent 根据 Anthropic 原生流式事件更新用量，message_start 携带输入用量，message_delta 携带累计输出用量
+func UpdateUsageByNativeEvent(usage *dto.Usage, data []byte) {
+	var event dto.ClaudeStreamEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return
+	}
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			usage.PromptTokens = event.Message.Usage.InputTokens
+			if event.Message.Usage.OutputTokens > usage.CompletionTokens {
+				usage.CompletionTokens = event.Message.Usage.OutputTokens
+			}
+		}
+	case "message_delta":
+		if event.Usage != nil {
+			usage.CompletionTokens = event.Usage.OutputTokens
+		}
+	}
+}
+
+// FinishNativeUsage 补全原生响应的用量，上游未返回输入用量时使用本地计算的 prompt tokens
+func FinishNativeUsage(usage *dto.Usage, info *relaycommon.RelayInfo) *dto.Usage {
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.PromptTokens
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+func claudeNativeHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var claudeResponse dto.ClaudeResponse
+	err = json.Unmarshal(responseBody, &claudeResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	usage := FinishNativeUsage(&dto.Usage{
+		PromptTokens:     claudeResponse.Usage.InputTokens,
+		CompletionTokens: claudeResponse.Usage.OutputTokens,
+	}, info)
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(responseBody)
+	if err != nil {
+		common.LogError(c, "write response body failed: "+err.Error())
+	}
+	return nil, usage
+}
+
+func claudeNativeStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	usage := &dto.Usage{}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	service.SetEventStreamHeaders(c)
+	isFirst := true
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "data:") {
+			if isFirst {
+				isFirst = false
+				info.FirstResponseTime = time.Now()
+			}
+			UpdateUsageByNativeEvent(usage, []byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))))
+		}
+		// 事件原样转发，空行表示一个事件结束
+		_, _ = c.Writer.WriteString(line + "\n")
+		if line == "" {
+			c.Writer.Flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		common.LogError(c, "read stream response failed: "+err.Error())
+	}
+	c.Writer.Flush()
+	err := resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	return nil, FinishNativeUsage(usage, info)
+}
@@ -0,0 +1,255 @@
+package claude
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	"strings"
+)
+
+// ResponseWriter 将其他渠道输出的 OpenAI 格式响应转换为 Anthropic Messages 格式后写给客户端，
+// 使 /v1/messages 请求可以使用任意渠道
+type ResponseWriter struct {
+	gin.ResponseWriter
+	info   *relaycommon.RelayInfo
+	buffer bytes.Buffer
+
+	messageId     string
+	started       bool
+	blockIndex    int
+	blockType     string
+	toolCallIndex int
+	stopReason    string
+}
+
+func NewResponseWriter(c *gin.Context, info *relaycommon.RelayInfo) *ResponseWriter {
+	return &ResponseWriter{
+		ResponseWriter: c.Writer,
+		info:           info,
+		messageId:      fmt.Sprintf("msg_%s", common.GetUUID()),
+		blockIndex:     -1,
+		toolCallIndex:  -1,
+	}
+}
+
+func (w *ResponseWriter) WriteHeader(code int) {
+	// 转换后的响应长度与上游不同
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *ResponseWriter) WriteHeaderNow() {
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *ResponseWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if w.info.IsStream {
+		w.processStreamLines()
+	}
+	return len(data), nil
+}
+
+func (w *ResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *ResponseWriter) processStreamLines() {
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// 不完整的行留到下次写入时处理
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			return
+		}
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			continue
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			common.SysError("error unmarshalling stream response: " + err.Error())
+			continue
+		}
+		w.handleStreamChunk(&chunk)
+	}
+}
+
+func (w *ResponseWriter) emit(eventType string, event any) {
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		common.SysError("error marshalling stream response: " + err.Error())
+		return
+	}
+	_, _ = w.ResponseWriter.WriteString(fmt.Sprintf("event: %s\ndata: %s\n\n", eventType, jsonData))
+	w.ResponseWriter.Flush()
+}
+
+func (w *ResponseWriter) startMessage() {
+	if w.started {
+		return
+	}
+	w.started = true
+	w.emit("message_start", dto.ClaudeStreamEvent{
+		Type: "message_start",
+		Message: &dto.ClaudeResponse{
+			Id:      w.messageId,
+			Type:    "message",
+			Role:    "assistant",
+			Model:   w.info.OriginMoelName,
+			Content: []dto.ClaudeContentBlock{},
+			Usage:   dto.ClaudeUsage{InputTokens: w.info.PromptTokens},
+		},
+	})
+}
+
+func (w *ResponseWriter) startBlock(blockType string, contentBlock map[string]any) {
+	w.stopBlock()
+	w.blockIndex++
+	w.blockType = blockType
+	w.emit("content_block_start", map[string]any{
+		"type":          "content_block_start",
+		"index":         w.blockIndex,
+		"content_block": contentBlock,
+	})
+}
+
+func (w *ResponseWriter) stopBlock() {
+	if w.blockType == "" {
+		return
+	}
+	index := w.blockIndex
+	w.emit("content_block_stop", dto.ClaudeStreamEvent{Type: "content_block_stop", Index: &index})
+	w.blockType = ""
+}
+
+func (w *ResponseWriter) emitDelta(delta *dto.ClaudeStreamDelta) {
+	index := w.blockIndex
+	w.emit("content_block_delta", dto.ClaudeStreamEvent{Type: "content_block_delta", Index: &index, Delta: delta})
+}
+
+func (w *ResponseWriter) handleStreamChunk(chunk *dto.ChatCompletionsStreamResponse) {
+	w.startMessage()
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if content := choice.Delta.GetContentString(); content != "" {
+			if w.blockType != "text" {
+				w.startBlock("text", map[string]any{"type": "text", "text": ""})
+			}
+			w.emitDelta(&dto.ClaudeStreamDelta{Type: "text_delta", Text: content})
+		}
+		for _, toolCall := range choice.Delta.ToolCalls {
+			index := 0
+			if toolCall.Index != nil {
+				index = *toolCall.Index
+			}
+			if w.blockType != "tool_use" || index != w.toolCallIndex {
+				w.toolCallIndex = index
+				w.startBlock("tool_use", map[string]any{
+					"type":  "tool_use",
+					"id":    toolCall.ID,
+					"name":  toolCall.Function.Name,
+					"input": map[string]any{},
+				})
+			}
+			if arguments := toolCall.Function.Arguments; arguments != "" {
+				w.emitDelta(&dto.ClaudeStreamDelta{Type: "input_json_delta", PartialJson: &arguments})
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			w.stopReason = dto.StopReasonOpenAI2Claude(*choice.FinishReason)
+		}
+	}
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content   json.RawMessage `json:"content"`
+			ToolCalls []dto.ToolCall  `json:"tool_calls"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+func (w *ResponseWriter) convertResponse(usage *dto.Usage) ([]byte, error) {
+	var openAIResponse openAIChatResponse
+	if err := json.Unmarshal(w.buffer.Bytes(), &openAIResponse); err != nil {
+		return nil, err
+	}
+	claudeResponse := dto.ClaudeResponse{
+		Id:      w.messageId,
+		Type:    "message",
+		Role:    "assistant",
+		Model:   w.info.OriginMoelName,
+		Content: []dto.ClaudeContentBlock{},
+		Usage: dto.ClaudeUsage{
+			InputTokens:  usage.PromptTokens,
+			OutputTokens: usage.CompletionTokens,
+		},
+	}
+	stopReason := "end_turn"
+	if len(openAIResponse.Choices) > 0 {
+		choice := openAIResponse.Choices[0]
+		text := dto.Message{Content: choice.Message.Content}.StringContent()
+		if text != "" {
+			claudeResponse.Content = append(claudeResponse.Content, dto.ClaudeContentBlock{Type: "text", Text: text})
+		}
+		for _, toolCall := range choice.Message.ToolCalls {
+			input := json.RawMessage(toolCall.Function.Arguments)
+			if !json.Valid(input) {
+				input = json.RawMessage("{}")
+			}
+			claudeResponse.Content = append(claudeResponse.Content, dto.ClaudeContentBlock{
+				Type:  "tool_use",
+				Id:    toolCall.ID,
+				Name:  toolCall.Function.Name,
+				Input: input,
+			})
+		}
+		stopReason = dto.StopReasonOpenAI2Claude(choice.FinishReason)
+	}
+	claudeResponse.StopReason = &stopReason
+	return json.Marshal(claudeResponse)
+}
+
+// Finish 在渠道响应处理完成后调用，补齐流式响应的结束事件或输出转换后的完整响应
+func (w *ResponseWriter) Finish(usage *dto.Usage) {
+	if usage == nil {
+		usage = &dto.Usage{}
+	}
+	if w.info.IsStream {
+		w.startMessage()
+		w.stopBlock()
+		stopReason := w.stopReason
+		if stopReason == "" {
+			stopReason = "end_turn"
+		}
+		w.emit("message_delta", dto.ClaudeStreamEvent{
+			Type:  "message_delta",
+			Delta: &dto.ClaudeStreamDelta{StopReason: &stopReason},
+			Usage: &dto.ClaudeUsage{InputTokens: usage.PromptTokens, OutputTokens: usage.CompletionTokens},
+		})
+		w.emit("message_stop", dto.ClaudeStreamEvent{Type: "message_stop"})
+		return
+	}
+	jsonResponse, err := w.convertResponse(usage)
+	if err != nil {
+		common.SysError("error converting response to claude format: " + err.Error())
+		jsonResponse = w.buffer.Bytes()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.ResponseWriter.Write(jsonResponse)
+}
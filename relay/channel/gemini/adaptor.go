@@ -1,6 +1,7 @@
 package gemini
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -9,10 +10,13 @@ import (
 	"one-api/dto"
 	"one-api/relay/channel"
 	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
 	"one-api/service"
 )
 
 type Adaptor struct {
+	// nativeSSE 原生请求的客户端指定了 alt=sse
+	nativeSSE bool
 }
 
 func (a *Adaptor) Init(info *relaycommon.RelayInfo, request dto.GeneralOpenAIRequest) {
@@ -40,6 +44,9 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 	if info.IsStream {
 		action = "streamGenerateContent"
 	}
+	if a.nativeSSE {
+		return fmt.Sprintf("%s/%s/models/%s:%s?alt=sse", info.BaseUrl, version, info.UpstreamModelName, action), nil
+	}
 	return fmt.Sprintf("%s/%s/models/%s:%s", info.BaseUrl, version, info.UpstreamModelName, action), nil
 }
 
@@ -56,11 +63,31 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *dto.Gen
 	return CovertGemini2OpenAI(*request), nil
 }
 
+func (a *Adaptor) SupportNativeFormat(info *relaycommon.RelayInfo) bool {
+	return info.RelayFormat == relayconstant.RelayFormatGemini
+}
+
+func (a *Adaptor) ConvertNativeRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody []byte) (io.Reader, error) {
+	// 模型在请求路径中，请求体无需改写
+	a.nativeSSE = info.IsStream && c.Query("alt") == "sse"
+	return bytes.NewReader(requestBody), nil
+}
+
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
 	return channel.DoApiRequest(a, c, info, requestBody)
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode) {
+	if info.NativeRequest {
+		if !info.IsStream {
+			err, usage = geminiNativeHandler(c, resp, info)
+		} else if a.nativeSSE {
+			err, usage = geminiNativeSSEStreamHandler(c, resp, info)
+		} else {
+			err, usage = geminiNativeArrayStreamHandler(c, resp, info)
+		}
+		return
+	}
 	if info.IsStream {
 		var responseText string
 		err, responseText = geminiChatStreamHandler(c, resp, info)
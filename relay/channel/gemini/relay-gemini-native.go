@@ -0,0 +1,146 @@
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+	"strings"
+	"time"
+)
+
+func geminiResponseText(response *dto.GeminiResponse) string {
+	text := ""
+	if len(response.Candidates) > 0 {
+		for _, part := range response.Candidates[0].Content.Parts {
+			text += part.Text
+		}
+	}
+	return text
+}
+
+// nativeUsage 优先使用上游返回的 usageMetadata，缺失时按响应文本计算
+func nativeUsage(usageMetadata *dto.GeminiUsageMetadata, responseText string, info *relaycommon.RelayInfo) *dto.Usage {
+	if usageMetadata != nil && usageMetadata.TotalTokenCount > 0 {
+		return &dto.Usage{
+			PromptTokens:     usageMetadata.PromptTokenCount,
+			CompletionTokens: usageMetadata.CandidatesTokenCount,
+			TotalTokens:      usageMetadata.PromptTokenCount + usageMetadata.CandidatesTokenCount,
+		}
+	}
+	usage, _ := service.ResponseText2Usage(responseText, info.UpstreamModelName, info.PromptTokens)
+	return usage
+}
+
+func geminiNativeHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var geminiResponse dto.GeminiResponse
+	err = json.Unmarshal(responseBody, &geminiResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	usage := nativeUsage(geminiResponse.UsageMetadata, geminiResponseText(&geminiResponse), info)
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(responseBody)
+	if err != nil {
+		common.LogError(c, "write response body failed: "+err.Error())
+	}
+	return nil, usage
+}
+
+// geminiNativeSSEStreamHandler 原样转发 alt=sse 的流式响应，每个事件都是一个完整的 GeminiResponse
+func geminiNativeSSEStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	var usageMetadata *dto.GeminiUsageMetadata
+	responseText := ""
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	service.SetEventStreamHeaders(c)
+	isFirst := true
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "data:") {
+			if isFirst {
+				isFirst = false
+				info.FirstResponseTime = time.Now()
+			}
+			var geminiResponse dto.GeminiResponse
+			if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &geminiResponse); err == nil {
+				responseText += geminiResponseText(&geminiResponse)
+				if geminiResponse.UsageMetadata != nil {
+					usageMetadata = geminiResponse.UsageMetadata
+				}
+			}
+		}
+		_, _ = c.Writer.WriteString(line + "\n")
+		if line == "" {
+			c.Writer.Flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		common.LogError(c, "read stream response failed: "+err.Error())
+	}
+	c.Writer.Flush()
+	err := resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	return nil, nativeUsage(usageMetadata, responseText, info)
+}
+
+// geminiNativeArrayStreamHandler 原样转发未指定 alt=sse 时以 JSON 数组逐步返回的流式响应，结束后解析用量
+func geminiNativeArrayStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	var responseBody bytes.Buffer
+	c.Writer.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	c.Writer.WriteHeader(resp.StatusCode)
+	buffer := make([]byte, 4096)
+	isFirst := true
+	for {
+		n, err := resp.Body.Read(buffer)
+		if n > 0 {
+			if isFirst {
+				isFirst = false
+				info.FirstResponseTime = time.Now()
+			}
+			responseBody.Write(buffer[:n])
+			_, _ = c.Writer.Write(buffer[:n])
+			c.Writer.Flush()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			common.LogError(c, "read stream response failed: "+err.Error())
+			break
+		}
+	}
+	err := resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var usageMetadata *dto.GeminiUsageMetadata
+	responseText := ""
+	var geminiResponses []dto.GeminiResponse
+	if err := json.Unmarshal(responseBody.Bytes(), &geminiResponses); err == nil {
+		for i := range geminiResponses {
+			responseText += geminiResponseText(&geminiResponses[i])
+			if geminiResponses[i].UsageMetadata != nil {
+				usageMetadata = geminiResponses[i].UsageMetadata
+			}
+		}
+	}
+	return nil, nativeUsage(usageMetadata, responseText, info)
+}
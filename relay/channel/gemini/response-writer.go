@@ -0,0 +1,240 @@
+package gemini
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	"sort"
+	"strings"
+)
+
+type pendingToolCall struct {
+	name      string
+	arguments string
+}
+
+// ResponseWriter 将其他渠道输出的 OpenAI 格式响应转换为 Gemini generateContent 格式后写给客户端，
+// 流式响应在客户端指定 alt=sse 时以 SSE 返回，否则与 Gemini 一致以 JSON 数组返回
+type ResponseWriter struct {
+	gin.ResponseWriter
+	info   *relaycommon.RelayInfo
+	sse    bool
+	buffer bytes.Buffer
+
+	chunkCount   int
+	finishReason string
+	toolCalls    map[int]*pendingToolCall
+}
+
+func NewResponseWriter(c *gin.Context, info *relaycommon.RelayInfo) *ResponseWriter {
+	return &ResponseWriter{
+		ResponseWriter: c.Writer,
+		info:           info,
+		sse:            c.Query("alt") == "sse",
+		toolCalls:      make(map[int]*pendingToolCall),
+	}
+}
+
+func (w *ResponseWriter) WriteHeader(code int) {
+	// 转换后的响应长度与上游不同
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *ResponseWriter) WriteHeaderNow() {
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *ResponseWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if w.info.IsStream {
+		w.processStreamLines()
+	}
+	return len(data), nil
+}
+
+func (w *ResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *ResponseWriter) processStreamLines() {
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// 不完整的行留到下次写入时处理
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			return
+		}
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			continue
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			common.SysError("error unmarshalling stream response: " + err.Error())
+			continue
+		}
+		w.handleStreamChunk(&chunk)
+	}
+}
+
+func (w *ResponseWriter) emit(response *dto.GeminiResponse) {
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		common.SysError("error marshalling stream response: " + err.Error())
+		return
+	}
+	if w.sse {
+		if w.chunkCount == 0 {
+			w.Header().Set("Content-Type", "text/event-stream")
+		}
+		_, _ = w.ResponseWriter.WriteString("data: " + string(jsonData) + "\r\n\r\n")
+	} else {
+		if w.chunkCount == 0 {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.ResponseWriter.WriteString("[")
+		} else {
+			_, _ = w.ResponseWriter.WriteString(",\r\n")
+		}
+		_, _ = w.ResponseWriter.Write(jsonData)
+	}
+	w.chunkCount++
+	w.ResponseWriter.Flush()
+}
+
+func (w *ResponseWriter) handleStreamChunk(chunk *dto.ChatCompletionsStreamResponse) {
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		// Gemini 的函数调用在一块中完整返回，先累积参数，结束时一并输出
+		for _, toolCall := range choice.Delta.ToolCalls {
+			index := 0
+			if toolCall.Index != nil {
+				index = *toolCall.Index
+			}
+			pending, ok := w.toolCalls[index]
+			if !ok {
+				pending = &pendingToolCall{}
+				w.toolCalls[index] = pending
+			}
+			if toolCall.Function.Name != "" {
+				pending.name = toolCall.Function.Name
+			}
+			pending.arguments += toolCall.Function.Arguments
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			w.finishReason = dto.FinishReasonOpenAI2Gemini(*choice.FinishReason)
+		}
+		if content := choice.Delta.GetContentString(); content != "" {
+			w.emit(&dto.GeminiResponse{
+				Candidates: []dto.GeminiCandidate{{
+					Content: dto.GeminiContent{Role: "model", Parts: []dto.GeminiPart{{Text: content}}},
+				}},
+			})
+		}
+	}
+}
+
+func functionCallPart(name string, arguments string) dto.GeminiPart {
+	args := json.RawMessage(arguments)
+	if !json.Valid(args) {
+		args = json.RawMessage("{}")
+	}
+	return dto.GeminiPart{FunctionCall: &dto.GeminiFunctionCall{Name: name, Args: args}}
+}
+
+func usageMetadata(usage *dto.Usage) *dto.GeminiUsageMetadata {
+	return &dto.GeminiUsageMetadata{
+		PromptTokenCount:     usage.PromptTokens,
+		CandidatesTokenCount: usage.CompletionTokens,
+		TotalTokenCount:      usage.PromptTokens + usage.CompletionTokens,
+	}
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Index   int `json:"index"`
+		Message struct {
+			Content   json.RawMessage `json:"content"`
+			ToolCalls []dto.ToolCall  `json:"tool_calls"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+func (w *ResponseWriter) convertResponse(usage *dto.Usage) ([]byte, error) {
+	var openAIResponse openAIChatResponse
+	if err := json.Unmarshal(w.buffer.Bytes(), &openAIResponse); err != nil {
+		return nil, err
+	}
+	geminiResponse := dto.GeminiResponse{
+		Candidates:    make([]dto.GeminiCandidate, 0, len(openAIResponse.Choices)),
+		UsageMetadata: usageMetadata(usage),
+	}
+	for _, choice := range openAIResponse.Choices {
+		parts := make([]dto.GeminiPart, 0, 1+len(choice.Message.ToolCalls))
+		if text := (dto.Message{Content: choice.Message.Content}).StringContent(); text != "" {
+			parts = append(parts, dto.GeminiPart{Text: text})
+		}
+		for _, toolCall := range choice.Message.ToolCalls {
+			parts = append(parts, functionCallPart(toolCall.Function.Name, toolCall.Function.Arguments))
+		}
+		geminiResponse.Candidates = append(geminiResponse.Candidates, dto.GeminiCandidate{
+			Content:      dto.GeminiContent{Role: "model", Parts: parts},
+			FinishReason: dto.FinishReasonOpenAI2Gemini(choice.FinishReason),
+			Index:        choice.Index,
+		})
+	}
+	return json.Marshal(geminiResponse)
+}
+
+// Finish 在渠道响应处理完成后调用，输出携带结束原因与用量的最后一块，或输出转换后的完整响应
+func (w *ResponseWriter) Finish(usage *dto.Usage) {
+	if usage == nil {
+		usage = &dto.Usage{}
+	}
+	if w.info.IsStream {
+		parts := make([]dto.GeminiPart, 0, len(w.toolCalls))
+		indexes := make([]int, 0, len(w.toolCalls))
+		for index := range w.toolCalls {
+			indexes = append(indexes, index)
+		}
+		sort.Ints(indexes)
+		for _, index := range indexes {
+			parts = append(parts, functionCallPart(w.toolCalls[index].name, w.toolCalls[index].arguments))
+		}
+		finishReason := w.finishReason
+		if finishReason == "" {
+			finishReason = "STOP"
+		}
+		w.emit(&dto.GeminiResponse{
+			Candidates: []dto.GeminiCandidate{{
+				Content:      dto.GeminiContent{Role: "model", Parts: parts},
+				FinishReason: finishReason,
+			}},
+			UsageMetadata: usageMetadata(usage),
+		})
+		if !w.sse {
+			_, _ = w.ResponseWriter.WriteString("]")
+			w.ResponseWriter.Flush()
+		}
+		return
+	}
+	jsonResponse, err := w.convertResponse(usage)
+	if err != nil {
+		common.SysError("error converting response to gemini format: " + err.Error())
+		jsonResponse = w.buffer.Bytes()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.ResponseWriter.Write(jsonResponse)
+}
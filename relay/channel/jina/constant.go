@@ -0,0 +1,8 @@
+package jina
+
+var ModelList = []string{
+	"jina-reranker-v2-base-multilingual", "jina-reranker-v1-base-en", "jina-reranker-v1-turbo-en",
+	"jina-embeddings-v2-base-en", "jina-embeddings-v2-base-zh",
+}
+
+var ChannelName = "jina"
@@ -9,10 +9,12 @@ import (
 	"one-api/dto"
 	"one-api/relay/channel"
 	"one-api/relay/channel/ai360"
+	"one-api/relay/channel/jina"
 	"one-api/relay/channel/lingyiwanwu"
 	"one-api/relay/channel/minimax"
 	"one-api/relay/channel/moonshot"
 	relaycommon "one-api/relay/common"
+	"one-api/relay/constant"
 	"one-api/service"
 	"strings"
 
@@ -75,13 +77,18 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *dto.Gen
 	return request, nil
 }
 
+func (a *Adaptor) ConvertRerankRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.RerankRequest) (any, error) {
+	return request, nil
+}
+
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
 	return channel.DoApiRequest(a, c, info, requestBody)
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode) {
-
-	if info.IsStream {
+	if info.RelayMode == constant.RelayModeRerank {
+		err, usage = OpenaiRerankHandler(c, resp, info)
+	} else if info.IsStream {
 		var responseText string
 		var toolCount int
 		err, responseText, toolCount = OpenaiStreamHandler(c, resp, info, info.OriginMoelName)
@@ -103,6 +110,8 @@ func (a *Adaptor) GetModelList() []string {
 		return lingyiwanwu.ModelList
 	case common.ChannelTypeMiniMax:
 		return minimax.ModelList
+	case common.ChannelTypeJina:
+		return jina.ModelList
 	default:
 		return ModelList
 	}
@@ -118,6 +127,8 @@ func (a *Adaptor) GetChannelName() string {
 		return lingyiwanwu.ChannelName
 	case common.ChannelTypeMiniMax:
 		return minimax.ChannelName
+	case common.ChannelTypeJina:
+		return jina.ChannelName
 	default:
 		return ChannelName
 	}
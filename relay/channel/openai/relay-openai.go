@@ -70,7 +70,7 @@ func OpenaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.
 	//checkSensitive := constant.ShouldCheckCompletionSensitive()
 	modelName := model
 	if v, ok := modelmapper[model]; ok {
-		fmt.Println("modelName is in modelmapper change to ", v)
+		common.LogDebug(c, "modelName is in modelmapper change to "+v)
 		modelName = v
 	}
 	var responseTextBuilder strings.Builder
@@ -93,8 +93,8 @@ func OpenaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.
 	defer close(stopChan)
 	defer close(dataChan)
 	var wg sync.WaitGroup
+	wg.Add(1)
 	go func() {
-		wg.Add(1)
 		defer wg.Done()
 		var streamItems []string // store stream items
 		for scanner.Scan() {
@@ -340,7 +340,7 @@ func OpenaiHandler(c *gin.Context, resp *http.Response, promptTokens int, model
 
 	modelName := originModel
 	if v, ok := modelmapper[originModel]; ok {
-		fmt.Println("modelName is in modelmapper change to ", v)
+		common.LogDebug(c, "modelName is in modelmapper change to "+v)
 		modelName = v
 	}
 	var simpleResponse dto.SimpleResponse
@@ -434,3 +434,39 @@ func OpenaiHandler(c *gin.Context, resp *http.Response, promptTokens int, model
 	}
 	return nil, &simpleResponse.Usage
 }
+
+// OpenaiRerankHandler 透传 Jina 等 OpenAI 兼容格式的 rerank 响应，上游未返回用量时按本地计数
+func OpenaiRerankHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var rerankResp dto.RerankResponse
+	err = json.Unmarshal(responseBody, &rerankResp)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	usage := rerankResp.Usage
+	if usage.TotalTokens == 0 {
+		usage.PromptTokens = info.PromptTokens
+		usage.TotalTokens = info.PromptTokens
+	} else if usage.PromptTokens == 0 {
+		// Jina 只返回 total_tokens
+		usage.PromptTokens = usage.TotalTokens
+	}
+
+	for k, v := range resp.Header {
+		c.Writer.Header().Set(k, v[0])
+	}
+	c.Writer.Header().Set("Content-Length", fmt.Sprint(len(responseBody)))
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(responseBody)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "write_response_body_failed", http.StatusInternalServerError), nil
+	}
+	return nil, &usage
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"context"
 	"one-api/common"
 	"one-api/relay/constant"
 	"strings"
@@ -12,6 +13,7 @@ import (
 type RelayInfo struct {
 	ChannelType       int
 	ChannelId         int
+	ChannelKeyId      int
 	TokenId           int
 	UserId            int
 	Group             string
@@ -21,6 +23,9 @@ type RelayInfo struct {
 	ApiType           int
 	IsStream          bool
 	RelayMode         int
+	RelayFormat       int
+	// NativeRequest 为 true 时请求以 RelayFormat 对应的原生格式直接转发给上游，响应也原样返回
+	NativeRequest     bool
 	UpstreamModelName string
 	RequestURLPath    string
 	ApiVersion        string
@@ -29,6 +34,29 @@ type RelayInfo struct {
 	Organization      string
 	BaseUrl           string
 	OriginMoelName    string
+	// IsBatch 为 true 时请求来自网关批处理任务，按批处理倍率计费
+	IsBatch bool
+	// FirstTokenTimeout 流式请求等待上游首个字节的最长时间，0 表示不限制
+	FirstTokenTimeout time.Duration
+}
+
+// RelayInfoKey 当前请求的 RelayInfo 在 gin.Context 中的键，供转发结束后读取首字时间等信息
+const RelayInfoKey = "relay_info"
+
+// UpstreamContextKey 上游请求使用的 context 在 gin.Context 中的键，对冲请求通过它取消落败的请求
+const UpstreamContextKey = "upstream_context"
+
+// UpstreamContext 返回上游请求使用的 context，未设置时上游请求不随客户端请求取消
+func UpstreamContext(c *gin.Context) context.Context {
+	if ctx, ok := c.Value(UpstreamContextKey).(context.Context); ok {
+		return ctx
+	}
+	return context.Background()
+}
+
+// UpstreamCancelled 上游请求是否已被取消
+func UpstreamCancelled(c *gin.Context) bool {
+	return UpstreamContext(c).Err() != nil
 }
 
 func GenRelayInfo(c *gin.Context) *RelayInfo {
@@ -45,10 +73,12 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 
 	info := &RelayInfo{
 		RelayMode:         constant.Path2RelayMode(c.Request.URL.Path),
+		RelayFormat:       constant.Path2RelayFormat(c.Request.URL.Path),
 		BaseUrl:           c.GetString("base_url"),
 		RequestURLPath:    c.Request.URL.String(),
 		ChannelType:       channelType,
 		ChannelId:         channelId,
+		ChannelKeyId:      c.GetInt("channel_key_id"),
 		TokenId:           tokenId,
 		UserId:            userId,
 		Group:             group,
@@ -59,13 +89,24 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 		ApiVersion:        c.GetString("api_version"),
 		ApiKey:            strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "),
 		Organization:      c.GetString("channel_organization"),
+		IsBatch:           c.GetBool("batch"),
 	}
 	if info.BaseUrl == "" {
 		info.BaseUrl = common.ChannelBaseURLs[channelType]
 	}
+	if timeout := c.GetInt("channel_first_token_timeout"); timeout > 0 {
+		info.FirstTokenTimeout = time.Duration(timeout) * time.Second
+	} else {
+		info.FirstTokenTimeout = common.GetGroupFirstTokenTimeout(group)
+	}
+	if info.RelayFormat != constant.RelayFormatOpenAI {
+		// 非 OpenAI 格式的请求转换后按对话补全转发
+		info.RequestURLPath = "/v1/chat/completions"
+	}
 	if info.ChannelType == common.ChannelTypeAzure {
 		info.ApiVersion = GetAPIVersion(c)
 	}
+	c.Set(RelayInfoKey, info)
 	return info
 }
 
@@ -80,6 +121,7 @@ func (info *RelayInfo) SetIsStream(isStream bool) {
 type TaskRelayInfo struct {
 	ChannelType       int
 	ChannelId         int
+	ChannelKeyId      int
 	TokenId           int
 	UserId            int
 	Group             string
@@ -114,6 +156,7 @@ func GenTaskRelayInfo(c *gin.Context) *TaskRelayInfo {
 		RequestURLPath: c.Request.URL.String(),
 		ChannelType:    channelType,
 		ChannelId:      channelId,
+		ChannelKeyId:   c.GetInt("channel_key_id"),
 		TokenId:        tokenId,
 		UserId:         userId,
 		Group:          group,
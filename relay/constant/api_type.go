@@ -57,6 +57,8 @@ func ChannelType2APIType(channelType int) (int, bool) {
 		apiType = APITypeAws
 	case common.ChannelTypeCohere:
 		apiType = APITypeCohere
+	case common.ChannelTypeJina:
+		apiType = APITypeOpenAI
 	}
 	if apiType == -1 {
 		return APITypeOpenAI, false
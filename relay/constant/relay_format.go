@@ -0,0 +1,30 @@
+package constant
+
+import "strings"
+
+// 入站请求的协议格式，非 OpenAI 格式的请求在网关内统一转换为 OpenAI 格式处理
+const (
+	RelayFormatOpenAI = iota
+	RelayFormatClaude
+	RelayFormatGemini
+)
+
+func Path2RelayFormat(path string) int {
+	relayFormat := RelayFormatOpenAI
+	if strings.HasPrefix(path, "/v1/messages") {
+		relayFormat = RelayFormatClaude
+	} else if strings.HasPrefix(path, "/v1beta/models/") {
+		relayFormat = RelayFormatGemini
+	}
+	return relayFormat
+}
+
+// ParseGeminiPath 解析 /v1beta/models/{model}:{action} 中的模型与操作
+func ParseGeminiPath(path string) (model string, action string) {
+	path = strings.TrimPrefix(path, "/v1beta/models/")
+	i := strings.LastIndex(path, ":")
+	if i < 0 {
+		return path, ""
+	}
+	return path[:i], path[i+1:]
+}
@@ -93,6 +93,7 @@ func AudioHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 			return service.OpenAIErrorWrapperLocal(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 		}
 	}
+	common.MetricsRecordPreConsumedQuota(audioRequest.Model, channelId, group, preConsumedQuota)
 
 	succeed := false
 	defer func() {
@@ -155,6 +156,7 @@ func AudioHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 
 	req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
 	req.Header.Set("Accept", c.Request.Header.Get("Accept"))
+	common.InjectTraceContext(c.Request.Context(), req.Header)
 
 	resp, err := service.GetHttpClient().Do(req)
 	if err != nil {
@@ -209,6 +211,7 @@ func AudioHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 				model.UpdateUserUsedQuotaAndRequestCount(userId, quota)
 				channelId := c.GetInt("channel_id")
 				model.UpdateChannelUsedQuota(channelId, quota)
+				model.UpdateChannelKeyUsedQuota(c.GetInt("channel_key_id"), quota)
 			}
 		}()
 	}(c.Request.Context())
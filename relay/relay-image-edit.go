@@ -0,0 +1,241 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/service"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// buildImageEditRequestBody 按表单重新构造 multipart 请求体，模型替换为映射后的上游模型
+func buildImageEditRequestBody(form *multipart.Form, upstreamModel string) (*bytes.Buffer, string, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for key, values := range form.Value {
+		if key == "model" {
+			continue
+		}
+		for _, value := range values {
+			if err := writer.WriteField(key, value); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	if err := writer.WriteField("model", upstreamModel); err != nil {
+		return nil, "", err
+	}
+	for key, fileHeaders := range form.File {
+		for _, fileHeader := range fileHeaders {
+			file, err := fileHeader.Open()
+			if err != nil {
+				return nil, "", err
+			}
+			part, err := writer.CreatePart(fileHeader.Header)
+			if err == nil {
+				_, err = io.Copy(part, file)
+			}
+			_ = file.Close()
+			if err != nil {
+				return nil, "", fmt.Errorf("copy file %s failed: %w", key, err)
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return body, writer.FormDataContentType(), nil
+}
+
+func getFormValue(form *multipart.Form, key string) string {
+	if values := form.Value[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// RelayImageEditHelper 转发 /v1/images/edits 与 /v1/images/variations 的 multipart 请求，仅支持 OpenAI 与 Azure 渠道
+func RelayImageEditHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
+	relayInfo := relaycommon.GenRelayInfo(c)
+	if relayInfo.ApiType != relayconstant.APITypeOpenAI {
+		return service.OpenAIErrorWrapperLocal(errors.New("image edits and variations are only supported by OpenAI and Azure channels"), "invalid_api_type", http.StatusBadRequest)
+	}
+
+	form, err := common.ParseMultipartFormReusable(c)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "parse_multipart_form_failed", http.StatusBadRequest)
+	}
+	defer form.RemoveAll()
+
+	imageModel := getFormValue(form, "model")
+	if imageModel == "" {
+		imageModel = "dall-e-2"
+	}
+	size := getFormValue(form, "size")
+	if size == "" {
+		size = "1024x1024"
+	}
+	n := 1
+	if value := getFormValue(form, "n"); value != "" {
+		n, err = strconv.Atoi(value)
+		if err != nil || n < 1 || n > 10 {
+			return service.OpenAIErrorWrapperLocal(errors.New("n must be between 1 and 10"), "invalid_field_value", http.StatusBadRequest)
+		}
+	}
+	if len(form.File["image"]) == 0 && len(form.File["image[]"]) == 0 {
+		return service.OpenAIErrorWrapperLocal(errors.New("image is required"), "required_field_missing", http.StatusBadRequest)
+	}
+	prompt := getFormValue(form, "prompt")
+	if relayMode == relayconstant.RelayModeImagesEdits && prompt == "" {
+		return service.OpenAIErrorWrapperLocal(errors.New("prompt is required"), "required_field_missing", http.StatusBadRequest)
+	}
+	if prompt != "" && constant.ShouldCheckPromptSensitive() {
+		err = service.CheckSensitiveInput(prompt)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "sensitive_words_detected", http.StatusBadRequest)
+		}
+	}
+	if imageModel == "dall-e-2" || imageModel == "dall-e" {
+		if size != "256x256" && size != "512x512" && size != "1024x1024" {
+			return service.OpenAIErrorWrapperLocal(errors.New("size must be one of 256x256, 512x512, or 1024x1024"), "invalid_field_value", http.StatusBadRequest)
+		}
+	}
+
+	// map model name
+	relayInfo.OriginMoelName = imageModel
+	modelMapping := c.GetString("model_mapping")
+	if modelMapping != "" && modelMapping != "{}" {
+		modelMap := make(map[string]string)
+		err := json.Unmarshal([]byte(modelMapping), &modelMap)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "unmarshal_model_mapping_failed", http.StatusInternalServerError)
+		}
+		if modelMap[imageModel] != "" {
+			imageModel = modelMap[imageModel]
+		}
+	}
+	relayInfo.UpstreamModelName = imageModel
+
+	modelPrice := getImageModelPrice(imageModel)
+	groupRatio := common.GetGroupRatio(relayInfo.Group)
+	sizeRatio := getImageSizeRatio(size)
+	quota := int(modelPrice*groupRatio*common.QuotaPerUnit*sizeRatio) * n
+
+	preConsumedQuota, userQuota, openaiErr := preConsumeQuota(c, quota, relayInfo)
+	if openaiErr != nil {
+		return openaiErr
+	}
+
+	fullRequestURL := relaycommon.GetFullRequestURL(relayInfo.BaseUrl, relayInfo.RequestURLPath, relayInfo.ChannelType)
+	if relayInfo.ChannelType == common.ChannelTypeAzure {
+		action := "edits"
+		if relayMode == relayconstant.RelayModeImagesVariations {
+			action = "variations"
+		}
+		fullRequestURL = fmt.Sprintf("%s/openai/deployments/%s/images/%s?api-version=%s", relayInfo.BaseUrl, imageModel, action, relayInfo.ApiVersion)
+	}
+	requestBody, contentType, err := buildImageEditRequestBody(form, imageModel)
+	if err != nil {
+		returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
+		return service.OpenAIErrorWrapperLocal(err, "build_request_body_failed", http.StatusInternalServerError)
+	}
+	req, err := http.NewRequest(http.MethodPost, fullRequestURL, requestBody)
+	if err != nil {
+		returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
+		return service.OpenAIErrorWrapperLocal(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	if relayInfo.ChannelType == common.ChannelTypeAzure {
+		req.Header.Set("api-key", relayInfo.ApiKey)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+relayInfo.ApiKey)
+		if relayInfo.Organization != "" {
+			req.Header.Set("OpenAI-Organization", relayInfo.Organization)
+		}
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	common.InjectTraceContext(c.Request.Context(), req.Header)
+
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+	resp, err := service.GetHttpClient().Do(req)
+	if err != nil {
+		returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
+		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
+		openaiErr := service.RelayErrorHandler(resp)
+		// reset status code 重置状态码
+		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+		return openaiErr
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	var imageResponse dto.ImageResponse
+	err = json.Unmarshal(responseBody, &imageResponse)
+	if err != nil {
+		returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+
+	for k, v := range resp.Header {
+		c.Writer.Header().Set(k, v[0])
+	}
+	c.Writer.Header().Del("Content-Length")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(responseBody)
+	if err != nil {
+		common.LogError(c, "write image response failed: "+err.Error())
+	}
+
+	postConsumeImageQuota(c, relayInfo, imageModel, quota, preConsumedQuota, userQuota, modelPrice, groupRatio, size)
+	return nil
+}
+
+func postConsumeImageQuota(c *gin.Context, relayInfo *relaycommon.RelayInfo, imageModel string, quota int, preConsumedQuota int,
+	userQuota int, modelPrice float64, groupRatio float64, size string) {
+	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
+	quotaDelta := quota - preConsumedQuota
+	if quotaDelta != 0 {
+		err := model.PostConsumeTokenQuota(relayInfo.TokenId, userQuota, quotaDelta, preConsumedQuota, true)
+		if err != nil {
+			common.LogError(c, "error consuming token remain quota: "+err.Error())
+		}
+	}
+	err := model.CacheUpdateUserQuota(relayInfo.UserId)
+	if err != nil {
+		common.LogError(c, "error update user quota cache: "+err.Error())
+	}
+	if quota != 0 {
+		action := "编辑"
+		if strings.HasPrefix(relayInfo.RequestURLPath, "/v1/images/variations") {
+			action = "变体"
+		}
+		logContent := fmt.Sprintf("模型价格 %.2f，分组倍率 %.2f, 大小 %s, 图片%s", modelPrice, groupRatio, size, action)
+		other := make(map[string]interface{})
+		other["model_price"] = modelPrice
+		other["group_ratio"] = groupRatio
+		model.RecordConsumeLog(c, relayInfo.UserId, relayInfo.ChannelId, 0, 0, imageModel, c.GetString("token_name"), quota, logContent, relayInfo.TokenId, userQuota, int(useTimeSeconds), false, other)
+		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
+		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		model.UpdateChannelKeyUsedQuota(relayInfo.ChannelKeyId, quota)
+	}
+}
@@ -114,27 +114,11 @@ func RelayImageHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusC
 		requestBody = c.Request.Body
 	}
 
-	modelPrice, success := common.GetModelPrice(imageRequest.Model, true)
-	if !success {
-		modelRatio := common.GetModelRatio(imageRequest.Model)
-		// modelRatio 16 = modelPrice $0.04
-		// per 1 modelRatio = $0.04 / 16
-		modelPrice = 0.0025 * modelRatio
-	}
+	modelPrice := getImageModelPrice(imageRequest.Model)
 	groupRatio := common.GetGroupRatio(group)
 	userQuota, err := model.CacheGetUserQuota(userId)
 
-	sizeRatio := 1.0
-	// Size
-	if imageRequest.Size == "256x256" {
-		sizeRatio = 0.4
-	} else if imageRequest.Size == "512x512" {
-		sizeRatio = 0.45
-	} else if imageRequest.Size == "1024x1024" {
-		sizeRatio = 1
-	} else if imageRequest.Size == "1024x1792" || imageRequest.Size == "1792x1024" {
-		sizeRatio = 2
-	}
+	sizeRatio := getImageSizeRatio(imageRequest.Size)
 
 	qualityRatio := 1.0
 	if imageRequest.Model == "dall-e-3" && imageRequest.Quality == "hd" {
@@ -164,6 +148,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusC
 	}
 	req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
 	req.Header.Set("Accept", c.Request.Header.Get("Accept"))
+	common.InjectTraceContext(c.Request.Context(), req.Header)
 
 	resp, err := service.GetHttpClient().Do(req)
 	if err != nil {
@@ -211,6 +196,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusC
 			model.UpdateUserUsedQuotaAndRequestCount(userId, quota)
 			channelId := c.GetInt("channel_id")
 			model.UpdateChannelUsedQuota(channelId, quota)
+			model.UpdateChannelKeyUsedQuota(c.GetInt("channel_key_id"), quota)
 		}
 	}(c.Request.Context())
 
@@ -245,3 +231,29 @@ func RelayImageHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusC
 	}
 	return nil
 }
+
+func getImageModelPrice(modelName string) float64 {
+	modelPrice, success := common.GetModelPrice(modelName, true)
+	if !success {
+		modelRatio := common.GetModelRatio(modelName)
+		// modelRatio 16 = modelPrice $0.04
+		// per 1 modelRatio = $0.04 / 16
+		modelPrice = 0.0025 * modelRatio
+	}
+	return modelPrice
+}
+
+func getImageSizeRatio(size string) float64 {
+	sizeRatio := 1.0
+	// Size
+	if size == "256x256" {
+		sizeRatio = 0.4
+	} else if size == "512x512" {
+		sizeRatio = 0.45
+	} else if size == "1024x1024" {
+		sizeRatio = 1
+	} else if size == "1024x1792" || size == "1792x1024" {
+		sizeRatio = 2
+	}
+	return sizeRatio
+}
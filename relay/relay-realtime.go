@@ -0,0 +1,489 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/model"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/service"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+var realtimeUpgrader = websocket.Upgrader{
+	// 浏览器客户端通过子协议传递令牌，握手时只回应 realtime
+	Subprotocols: []string{"realtime"},
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+type realtimeSession struct {
+	c            *gin.Context
+	relayInfo    *relaycommon.RelayInfo
+	clientConn   *websocket.Conn
+	upstreamConn *websocket.Conn
+	closeOnce    sync.Once
+	// clientWriteMutex 转发上游消息与预扣失败时发送错误事件可能同时写客户端连接
+	clientWriteMutex sync.Mutex
+
+	modelRatio            float64
+	groupRatio            float64
+	completionRatio       float64
+	audioRatio            float64
+	audioCompletionRatio  float64
+	modelPrice            float64
+	usePrice              bool
+	tokenUnlimitedQuota   bool
+	firstResponseReceived bool
+
+	mutex sync.Mutex
+	// reservations 已预扣额度、尚未结算的响应，按创建顺序在 response.done 时结算
+	reservations []*realtimeReservation
+	// maxOutputTokens 会话设置的最大输出 token 数，0 表示未设置
+	maxOutputTokens int
+	// lastInputQuota 上一次响应的输入用量对应的额度，用于预估下一次响应的输入
+	lastInputQuota int
+}
+
+// realtimeReservation 一次响应预扣的额度，estimate 为预估额度，preConsumedQuota 为实际预扣的额度（额度充足时不预扣）
+type realtimeReservation struct {
+	estimate         int
+	preConsumedQuota int
+	userQuota        int
+	// started 已收到上游的 response.created
+	started bool
+}
+
+// realtimeMaxOutputTokens 未设置最大输出 token 数时按上游的上限预估
+const realtimeMaxOutputTokens = 4096
+
+func getRealtimeRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	baseURL := info.BaseUrl
+	if strings.HasPrefix(baseURL, "https://") {
+		baseURL = "wss://" + strings.TrimPrefix(baseURL, "https://")
+	} else if strings.HasPrefix(baseURL, "http://") {
+		baseURL = "ws://" + strings.TrimPrefix(baseURL, "http://")
+	}
+	if info.ChannelType == common.ChannelTypeAzure {
+		return fmt.Sprintf("%s/openai/realtime?api-version=%s&deployment=%s", baseURL, info.ApiVersion, url.QueryEscape(info.UpstreamModelName)), nil
+	}
+	return fmt.Sprintf("%s/v1/realtime?model=%s", baseURL, url.QueryEscape(info.UpstreamModelName)), nil
+}
+
+// RealtimeHelper 将 /v1/realtime 的 WebSocket 会话双向转发到上游。每次响应开始前按预估用量预扣额度，
+// 额度不足以支付预估用量时中断会话；收到 response.done 时按实际用量结算
+func RealtimeHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
+	relayInfo := relaycommon.GenRelayInfo(c)
+	relayInfo.IsStream = true
+	if relayInfo.ApiType != relayconstant.APITypeOpenAI {
+		return service.OpenAIErrorWrapperLocal(errors.New("realtime is only supported by OpenAI and Azure channels"), "invalid_api_type", http.StatusBadRequest)
+	}
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		return service.OpenAIErrorWrapperLocal(errors.New("websocket upgrade required"), "invalid_request", http.StatusBadRequest)
+	}
+
+	// map model name
+	realtimeModel := c.GetString("original_model")
+	relayInfo.OriginMoelName = realtimeModel
+	modelMapping := c.GetString("model_mapping")
+	if modelMapping != "" && modelMapping != "{}" {
+		modelMap := make(map[string]string)
+		err := json.Unmarshal([]byte(modelMapping), &modelMap)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "unmarshal_model_mapping_failed", http.StatusInternalServerError)
+		}
+		if modelMap[realtimeModel] != "" {
+			realtimeModel = modelMap[realtimeModel]
+		}
+	}
+	relayInfo.UpstreamModelName = realtimeModel
+
+	// 会话开始前只检查额度是否充足，实际用量在会话中逐次扣除
+	_, _, openaiErr := preConsumeQuota(c, 0, relayInfo)
+	if openaiErr != nil {
+		return openaiErr
+	}
+
+	fullRequestURL, err := getRealtimeRequestURL(relayInfo)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "get_request_url_failed", http.StatusInternalServerError)
+	}
+	header := http.Header{}
+	if relayInfo.ChannelType == common.ChannelTypeAzure {
+		header.Set("api-key", relayInfo.ApiKey)
+	} else {
+		header.Set("Authorization", "Bearer "+relayInfo.ApiKey)
+		if relayInfo.Organization != "" {
+			header.Set("OpenAI-Organization", relayInfo.Organization)
+		}
+	}
+	header.Set("OpenAI-Beta", "realtime=v1")
+	common.InjectTraceContext(c.Request.Context(), header)
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 10 * time.Second,
+	}
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+	upstreamConn, resp, err := dialer.Dial(fullRequestURL, header)
+	if err != nil {
+		if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+			openaiErr := service.RelayErrorHandler(resp)
+			// reset status code 重置状态码
+			service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+			return openaiErr
+		}
+		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+
+	// 握手成功后响应已被接管，之后的错误只能通过 WebSocket 事件返回，不再参与重试
+	clientConn, err := realtimeUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		_ = upstreamConn.Close()
+		common.LogError(c, "upgrade realtime connection failed: "+err.Error())
+		return nil
+	}
+
+	modelPrice, usePrice := common.GetModelPrice(realtimeModel, false)
+	session := &realtimeSession{
+		c:                    c,
+		relayInfo:            relayInfo,
+		clientConn:           clientConn,
+		upstreamConn:         upstreamConn,
+		modelRatio:           common.GetModelRatio(realtimeModel),
+		groupRatio:           common.GetGroupRatio(relayInfo.Group),
+		completionRatio:      common.GetCompletionRatio(realtimeModel),
+		audioRatio:           common.GetAudioRatio(realtimeModel),
+		audioCompletionRatio: common.GetAudioCompletionRatio(realtimeModel),
+		modelPrice:           modelPrice,
+		usePrice:             usePrice,
+		tokenUnlimitedQuota:  c.GetBool("token_unlimited_quota"),
+	}
+	session.run()
+	return nil
+}
+
+func (s *realtimeSession) close(closeCode int, reason string) {
+	s.closeOnce.Do(func() {
+		message := websocket.FormatCloseMessage(closeCode, reason)
+		deadline := time.Now().Add(time.Second)
+		_ = s.clientConn.WriteControl(websocket.CloseMessage, message, deadline)
+		_ = s.upstreamConn.WriteControl(websocket.CloseMessage, message, deadline)
+		_ = s.clientConn.Close()
+		_ = s.upstreamConn.Close()
+	})
+}
+
+func getRealtimeCloseCode(err error) (int, string) {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		switch closeErr.Code {
+		case websocket.CloseNoStatusReceived, websocket.CloseAbnormalClosure, websocket.CloseTLSHandshake:
+			// 这些状态码不能出现在关闭帧中
+		default:
+			return closeErr.Code, closeErr.Text
+		}
+	}
+	return websocket.CloseNormalClosure, ""
+}
+
+func (s *realtimeSession) run() {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// 客户端 -> 上游
+		for {
+			messageType, message, err := s.clientConn.ReadMessage()
+			if err != nil {
+				s.close(getRealtimeCloseCode(err))
+				return
+			}
+			if messageType == websocket.TextMessage && !s.handleClientEvent(message) {
+				s.close(websocket.ClosePolicyViolation, "insufficient quota")
+				return
+			}
+			err = s.upstreamConn.WriteMessage(messageType, message)
+			if err != nil {
+				s.close(websocket.CloseInternalServerErr, "write upstream failed")
+				return
+			}
+		}
+	}()
+	// 上游 -> 客户端
+	for {
+		messageType, message, err := s.upstreamConn.ReadMessage()
+		if err != nil {
+			s.close(getRealtimeCloseCode(err))
+			break
+		}
+		if !s.firstResponseReceived {
+			s.firstResponseReceived = true
+			s.relayInfo.FirstResponseTime = time.Now()
+		}
+		var event dto.RealtimeEvent
+		if messageType == websocket.TextMessage {
+			_ = json.Unmarshal(message, &event)
+		}
+		// 服务端 VAD 自动创建的响应没有对应的 response.create，在转发输出前预扣
+		if event.Type == dto.RealtimeEventTypeResponseCreated && !s.startResponse() {
+			s.close(websocket.ClosePolicyViolation, "insufficient quota")
+			break
+		}
+		s.clientWriteMutex.Lock()
+		err = s.clientConn.WriteMessage(messageType, message)
+		s.clientWriteMutex.Unlock()
+		if err != nil {
+			s.close(websocket.CloseGoingAway, "write client failed")
+			break
+		}
+		if event.Type != dto.RealtimeEventTypeResponseDone || event.Response == nil || event.Response.Usage == nil {
+			continue
+		}
+		if !s.consumeUsage(event.Response.Usage, s.finishResponse()) {
+			s.sendError(quotaExhaustedError())
+			s.close(websocket.ClosePolicyViolation, "insufficient quota")
+			break
+		}
+	}
+	<-done
+	s.releaseReservations()
+}
+
+// handleClientEvent 记录会话的最大输出 token 数，并在转发 response.create 前预扣额度，额度不足时返回 false
+func (s *realtimeSession) handleClientEvent(message []byte) bool {
+	var event dto.RealtimeEvent
+	if err := json.Unmarshal(message, &event); err != nil {
+		return true
+	}
+	switch event.Type {
+	case dto.RealtimeEventTypeSessionUpdate:
+		if event.Session != nil && event.Session.MaxResponseOutputTokens != nil {
+			s.mutex.Lock()
+			s.maxOutputTokens = parseRealtimeMaxOutputTokens(event.Session.MaxResponseOutputTokens)
+			s.mutex.Unlock()
+		}
+	case dto.RealtimeEventTypeResponseCreate:
+		maxOutputTokens := -1
+		if event.Response != nil && event.Response.MaxResponseOutputTokens != nil {
+			maxOutputTokens = parseRealtimeMaxOutputTokens(event.Response.MaxResponseOutputTokens)
+		}
+		return s.reserve(maxOutputTokens, false)
+	}
+	return true
+}
+
+// parseRealtimeMaxOutputTokens 解析整数形式的最大输出 token 数，"inf" 等其他值返回 0
+func parseRealtimeMaxOutputTokens(value any) int {
+	if tokens, ok := value.(float64); ok && tokens > 0 {
+		return int(tokens)
+	}
+	return 0
+}
+
+// reserve 按预估用量预扣一次响应的额度，maxOutputTokens 为 -1 时使用会话的设置，额度不足时通知客户端并返回 false
+func (s *realtimeSession) reserve(maxOutputTokens int, started bool) bool {
+	s.mutex.Lock()
+	if maxOutputTokens < 0 {
+		maxOutputTokens = s.maxOutputTokens
+	}
+	estimate := s.estimateQuota(maxOutputTokens)
+	s.mutex.Unlock()
+	preConsumedQuota, userQuota, openaiErr := preConsumeQuota(s.c, estimate, s.relayInfo)
+	if openaiErr != nil {
+		common.LogError(s.c, "realtime pre-consume quota failed: "+openaiErr.Error.Message)
+		s.sendError(&openaiErr.Error)
+		return false
+	}
+	s.mutex.Lock()
+	s.reservations = append(s.reservations, &realtimeReservation{
+		estimate:         estimate,
+		preConsumedQuota: preConsumedQuota,
+		userQuota:        userQuota,
+		started:          started,
+	})
+	s.mutex.Unlock()
+	return true
+}
+
+// startResponse 将响应关联到客户端 response.create 时的预扣，没有时按会话设置预扣
+func (s *realtimeSession) startResponse() bool {
+	s.mutex.Lock()
+	for _, reservation := range s.reservations {
+		if !reservation.started {
+			reservation.started = true
+			s.mutex.Unlock()
+			return true
+		}
+	}
+	s.mutex.Unlock()
+	return s.reserve(-1, true)
+}
+
+// finishResponse 取出最早开始的响应的预扣
+func (s *realtimeSession) finishResponse() *realtimeReservation {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, reservation := range s.reservations {
+		if reservation.started {
+			s.reservations = append(s.reservations[:i], s.reservations[i+1:]...)
+			return reservation
+		}
+	}
+	return &realtimeReservation{}
+}
+
+// releaseReservations 会话结束时退还未开始的响应的预扣；已开始但未收到 response.done 的响应按预估额度计费
+func (s *realtimeSession) releaseReservations() {
+	s.mutex.Lock()
+	reservations := s.reservations
+	s.reservations = nil
+	s.mutex.Unlock()
+	for _, reservation := range reservations {
+		if !reservation.started {
+			returnPreConsumedQuota(s.c, s.relayInfo.TokenId, reservation.userQuota, reservation.preConsumedQuota)
+			continue
+		}
+		s.chargeQuota(reservation.estimate, reservation)
+		modelPrice := -1.0
+		if s.usePrice {
+			modelPrice = s.modelPrice
+		}
+		other := service.GenerateTextOtherInfo(s.c, s.relayInfo, s.modelRatio, s.groupRatio, s.completionRatio, modelPrice)
+		other["realtime"] = true
+		useTimeSeconds := time.Now().Unix() - s.relayInfo.StartTime.Unix()
+		model.RecordConsumeLog(s.c, s.relayInfo.UserId, s.relayInfo.ChannelId, 0, 0, s.relayInfo.UpstreamModelName,
+			s.c.GetString("token_name"), reservation.estimate, "会话在响应完成前中断，按预估额度计费", s.relayInfo.TokenId, reservation.userQuota, int(useTimeSeconds), true, other)
+	}
+}
+
+func quotaExhaustedError() *dto.OpenAIError {
+	return &dto.OpenAIError{
+		Message: "user quota is not enough",
+		Type:    "insufficient_quota",
+		Code:    "insufficient_user_quota",
+	}
+}
+
+func (s *realtimeSession) sendError(err *dto.OpenAIError) {
+	event := dto.RealtimeEvent{
+		Type:  dto.RealtimeEventTypeError,
+		Error: err,
+	}
+	s.clientWriteMutex.Lock()
+	defer s.clientWriteMutex.Unlock()
+	_ = s.clientConn.WriteJSON(event)
+}
+
+// estimateQuota 预估一次响应的额度：输入按上一次响应的输入用量，输出按最大输出 token 数且全部为音频计算，调用方需持有 mutex
+func (s *realtimeSession) estimateQuota(maxOutputTokens int) int {
+	if s.usePrice {
+		return int(s.modelPrice * common.QuotaPerUnit * s.groupRatio)
+	}
+	if maxOutputTokens <= 0 || maxOutputTokens > realtimeMaxOutputTokens {
+		maxOutputTokens = realtimeMaxOutputTokens
+	}
+	outputRatio := s.audioCompletionRatio
+	if outputRatio < 1 {
+		outputRatio = 1
+	}
+	return s.lastInputQuota + int(math.Ceil(float64(maxOutputTokens)*outputRatio*s.completionRatio*s.modelRatio*s.groupRatio))
+}
+
+func (s *realtimeSession) getQuota(usage *dto.RealtimeUsage) (quota int, inputQuota int) {
+	if s.usePrice {
+		return int(s.modelPrice * common.QuotaPerUnit * s.groupRatio), 0
+	}
+	inputTokens := float64(usage.InputTokenDetails.TextTokens) + float64(usage.InputTokenDetails.AudioTokens)*s.audioRatio
+	outputTokens := float64(usage.OutputTokenDetails.TextTokens) + float64(usage.OutputTokenDetails.AudioTokens)*s.audioCompletionRatio
+	ratio := s.modelRatio * s.groupRatio
+	quota = int(math.Round((inputTokens + outputTokens*s.completionRatio) * ratio))
+	if ratio != 0 && quota <= 0 && usage.TotalTokens > 0 {
+		quota = 1
+	}
+	return quota, int(math.Ceil(inputTokens * ratio))
+}
+
+// chargeQuota 按实际额度结算一次响应，扣除与预扣额度的差额
+func (s *realtimeSession) chargeQuota(quota int, reservation *realtimeReservation) {
+	c := s.c
+	relayInfo := s.relayInfo
+	if quotaDelta := quota - reservation.preConsumedQuota; quotaDelta != 0 {
+		err := model.PostConsumeTokenQuota(relayInfo.TokenId, reservation.userQuota, quotaDelta, reservation.preConsumedQuota, true)
+		if err != nil {
+			common.LogError(c, "error consuming token remain quota: "+err.Error())
+		}
+	}
+	err := model.CacheUpdateUserQuota(relayInfo.UserId)
+	if err != nil {
+		common.LogError(c, "error update user quota cache: "+err.Error())
+	}
+	if quota != 0 {
+		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
+		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		model.UpdateChannelKeyUsedQuota(relayInfo.ChannelKeyId, quota)
+	}
+}
+
+// consumeUsage 按一次 response.done 的用量结算，返回剩余额度是否还能继续会话
+func (s *realtimeSession) consumeUsage(usage *dto.RealtimeUsage, reservation *realtimeReservation) bool {
+	c := s.c
+	relayInfo := s.relayInfo
+	quota, inputQuota := s.getQuota(usage)
+	s.mutex.Lock()
+	s.lastInputQuota = inputQuota
+	s.mutex.Unlock()
+	userQuota, err := model.CacheGetUserQuota(relayInfo.UserId)
+	if err != nil {
+		common.LogError(c, "error get user quota: "+err.Error())
+	}
+	s.chargeQuota(quota, reservation)
+
+	var logContent string
+	modelPrice := s.modelPrice
+	if !s.usePrice {
+		modelPrice = -1
+		logContent = fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f，补全倍率 %.2f，音频倍率 %.2f，音频补全倍率 %.2f", s.modelRatio, s.groupRatio, s.completionRatio, s.audioRatio, s.audioCompletionRatio)
+	} else {
+		logContent = fmt.Sprintf("模型价格 %.2f，分组倍率 %.2f", s.modelPrice, s.groupRatio)
+	}
+	logContent += fmt.Sprintf("，文本输入 %d，音频输入 %d，文本输出 %d，音频输出 %d",
+		usage.InputTokenDetails.TextTokens, usage.InputTokenDetails.AudioTokens, usage.OutputTokenDetails.TextTokens, usage.OutputTokenDetails.AudioTokens)
+	other := service.GenerateTextOtherInfo(c, relayInfo, s.modelRatio, s.groupRatio, s.completionRatio, modelPrice)
+	other["audio_ratio"] = s.audioRatio
+	other["audio_completion_ratio"] = s.audioCompletionRatio
+	other["realtime"] = true
+	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
+	model.RecordConsumeLog(c, relayInfo.UserId, relayInfo.ChannelId, usage.InputTokens, usage.OutputTokens, relayInfo.UpstreamModelName,
+		c.GetString("token_name"), quota, logContent, relayInfo.TokenId, userQuota, int(useTimeSeconds), true, other)
+
+	userQuota, err = model.CacheGetUserQuota(relayInfo.UserId)
+	if err != nil {
+		common.LogError(c, "error get user quota: "+err.Error())
+		return true
+	}
+	if userQuota <= 0 {
+		return false
+	}
+	if !s.tokenUnlimitedQuota {
+		token, err := model.GetTokenById(relayInfo.TokenId)
+		if err != nil {
+			common.LogError(c, "error get token: "+err.Error())
+			return true
+		}
+		if token.RemainQuota <= 0 {
+			return false
+		}
+	}
+	return true
+}
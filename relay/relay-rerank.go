@@ -0,0 +1,175 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rerankDocumentsPerSearchUnit 按 Cohere 的计费规则，一次查询最多 100 个文档计为一个搜索单元
+const rerankDocumentsPerSearchUnit = 100
+
+func getRerankDocumentText(document any) string {
+	switch v := document.(type) {
+	case string:
+		return v
+	case map[string]any:
+		if text, ok := v["text"].(string); ok {
+			return text
+		}
+	}
+	jsonStr, _ := json.Marshal(document)
+	return string(jsonStr)
+}
+
+func getRerankPromptTokens(rerankRequest *dto.RerankRequest) (int, error) {
+	texts := make([]string, 0, len(rerankRequest.Documents)+1)
+	texts = append(texts, rerankRequest.Query)
+	for _, document := range rerankRequest.Documents {
+		texts = append(texts, getRerankDocumentText(document))
+	}
+	return service.CountTokenInput(texts, rerankRequest.Model)
+}
+
+func getRerankSearchUnits(rerankRequest *dto.RerankRequest) int {
+	return (len(rerankRequest.Documents) + rerankDocumentsPerSearchUnit - 1) / rerankDocumentsPerSearchUnit
+}
+
+// RerankHelper 处理 /v1/rerank 请求，设置了模型价格时按搜索单元计费，否则按模型倍率与 token 计费
+func RerankHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
+	relayInfo := relaycommon.GenRelayInfo(c)
+
+	var rerankRequest dto.RerankRequest
+	err := common.UnmarshalBodyReusable(c, &rerankRequest)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "invalid_rerank_request", http.StatusBadRequest)
+	}
+	if rerankRequest.Model == "" {
+		return service.OpenAIErrorWrapperLocal(errors.New("model is required"), "invalid_rerank_request", http.StatusBadRequest)
+	}
+	if rerankRequest.Query == "" {
+		return service.OpenAIErrorWrapperLocal(errors.New("field query is required"), "invalid_rerank_request", http.StatusBadRequest)
+	}
+	if len(rerankRequest.Documents) == 0 {
+		return service.OpenAIErrorWrapperLocal(errors.New("field documents is required"), "invalid_rerank_request", http.StatusBadRequest)
+	}
+	if rerankRequest.TopN < 0 {
+		return service.OpenAIErrorWrapperLocal(errors.New("top_n is invalid"), "invalid_rerank_request", http.StatusBadRequest)
+	}
+
+	// map model name
+	modelMapping := c.GetString("model_mapping")
+	relayInfo.OriginMoelName = rerankRequest.Model
+	if modelMapping != "" && modelMapping != "{}" {
+		modelMap := make(map[string]string)
+		err := json.Unmarshal([]byte(modelMapping), &modelMap)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "unmarshal_model_mapping_failed", http.StatusInternalServerError)
+		}
+		if modelMap[rerankRequest.Model] != "" {
+			rerankRequest.Model = modelMap[rerankRequest.Model]
+		}
+	}
+	relayInfo.UpstreamModelName = rerankRequest.Model
+
+	if constant.ShouldCheckPromptSensitive() {
+		err = service.CheckSensitiveInput(rerankRequest.Query)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "sensitive_words_detected", http.StatusBadRequest)
+		}
+	}
+
+	promptTokens, err := getRerankPromptTokens(&rerankRequest)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "count_token_messages_failed", http.StatusInternalServerError)
+	}
+	relayInfo.SetPromptTokens(promptTokens)
+
+	modelPrice, usePrice := common.GetModelPrice(rerankRequest.Model, false)
+	groupRatio := common.GetGroupRatio(relayInfo.Group)
+	if relayInfo.IsBatch {
+		groupRatio = groupRatio * common.BatchRatio
+	}
+	searchUnits := getRerankSearchUnits(&rerankRequest)
+	var modelRatio float64
+	var ratio float64
+	var preConsumedQuota int
+	if usePrice {
+		// 价格按单个搜索单元设置，记录日志时使用折算后的单次请求价格
+		modelPrice = modelPrice * float64(searchUnits)
+		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatio)
+	} else {
+		modelRatio = common.GetModelRatio(rerankRequest.Model)
+		ratio = modelRatio * groupRatio
+		preConsumedQuota = int(float64(promptTokens) * ratio)
+	}
+
+	preConsumedQuota, userQuota, openaiErr := preConsumeQuota(c, preConsumedQuota, relayInfo)
+	if openaiErr != nil {
+		return openaiErr
+	}
+
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+	rerankAdaptor, ok := adaptor.(channel.RerankAdaptor)
+	if !ok {
+		returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("rerank is not supported by api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(relayInfo, dto.GeneralOpenAIRequest{Model: rerankRequest.Model})
+	span, endSpan := common.StartRequestSpan(c, "ConvertRequest")
+	convertedRequest, err := rerankAdaptor.ConvertRerankRequest(c, relayInfo, rerankRequest)
+	common.SetSpanError(span, err)
+	endSpan()
+	if err != nil {
+		returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
+		return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
+		return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+	}
+
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+	span, endSpan = common.StartRequestSpan(c, "DoRequest")
+	resp, err := adaptor.DoRequest(c, relayInfo, bytes.NewBuffer(jsonData))
+	common.SetSpanError(span, err)
+	endSpan()
+	if err != nil {
+		returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
+		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
+		openaiErr := service.RelayErrorHandler(resp)
+		// reset status code 重置状态码
+		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+		return openaiErr
+	}
+
+	span, endSpan = common.StartRequestSpan(c, "DoResponse")
+	usage, openaiErr := adaptor.DoResponse(c, resp, relayInfo)
+	endSpan()
+	if openaiErr != nil {
+		returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
+		// reset status code 重置状态码
+		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+		return openaiErr
+	}
+	postConsumeQuota(c, relayInfo, dto.GeneralOpenAIRequest{Model: rerankRequest.Model}, usage, ratio, preConsumedQuota, userQuota, modelRatio, groupRatio, modelPrice, usePrice)
+	return nil
+}
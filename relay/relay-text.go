@@ -13,6 +13,9 @@ import (
 	"one-api/constant"
 	"one-api/dto"
 	"one-api/model"
+	"one-api/relay/channel"
+	"one-api/relay/channel/claude"
+	"one-api/relay/channel/gemini"
 	relaycommon "one-api/relay/common"
 	relayconstant "one-api/relay/constant"
 	"one-api/service"
@@ -20,14 +23,15 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func getAndValidateTextRequest(c *gin.Context, relayInfo *relaycommon.RelayInfo) (*dto.GeneralOpenAIRequest, error) {
-	textRequest := &dto.GeneralOpenAIRequest{}
-	err := common.UnmarshalBodyReusable(c, textRequest)
-	if err != nil {
-		return nil, err
+	meta := service.GetRequestMeta(c)
+	if meta.ParseError != nil {
+		return nil, meta.ParseError
 	}
+	textRequest := meta.CloneRequest()
 	if relayInfo.RelayMode == relayconstant.RelayModeModerations && textRequest.Model == "" {
 		textRequest.Model = "text-moderation-latest"
 	}
@@ -94,6 +98,9 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 	relayInfo.UpstreamModelName = textRequest.Model
 	modelPrice, success := common.GetModelPrice(textRequest.Model, false)
 	groupRatio := common.GetGroupRatio(relayInfo.Group)
+	if relayInfo.IsBatch {
+		groupRatio = groupRatio * common.BatchRatio
+	}
 
 	var preConsumedQuota int
 	var ratio float64
@@ -107,7 +114,7 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 		}
 	}
 
-	promptTokens, err := getPromptTokens(textRequest, relayInfo)
+	promptTokens, err := getPromptTokens(c, textRequest.Model, relayInfo)
 	// count messages token error 计算promptTokens错误
 	if err != nil {
 		return service.OpenAIErrorWrapper(err, "count_token_messages_failed", http.StatusInternalServerError)
@@ -137,18 +144,45 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 	}
 	adaptor.Init(relayInfo, *textRequest)
 	var requestBody io.Reader
-	if relayInfo.ApiType == relayconstant.APITypeOpenAI {
-		if isModelMapped {
+	if nativeAdaptor, ok := adaptor.(channel.NativeAdaptor); ok && nativeAdaptor.SupportNativeFormat(relayInfo) {
+		body, err := common.GetRequestBody(c)
+		if err != nil {
+			returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
+			return service.OpenAIErrorWrapperLocal(err, "read_request_body_failed", http.StatusInternalServerError)
+		}
+		span, endSpan := common.StartRequestSpan(c, "ConvertRequest", attribute.Bool("native", true))
+		requestBody, err = nativeAdaptor.ConvertNativeRequest(c, relayInfo, body)
+		common.SetSpanError(span, err)
+		endSpan()
+		if err != nil {
+			returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
+			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+		relayInfo.NativeRequest = true
+	} else if relayInfo.ApiType == relayconstant.APITypeOpenAI {
+		filesReplaced, err := service.ResolveUpstreamFiles(c, relayInfo, textRequest)
+		if err != nil {
+			returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
+			return service.OpenAIErrorWrapperLocal(err, "upload_file_to_upstream_failed", http.StatusInternalServerError)
+		}
+		if isModelMapped || filesReplaced || relayInfo.RelayFormat != relayconstant.RelayFormatOpenAI {
 			jsonStr, err := json.Marshal(textRequest)
 			if err != nil {
 				return service.OpenAIErrorWrapperLocal(err, "marshal_text_request_failed", http.StatusInternalServerError)
 			}
 			requestBody = bytes.NewBuffer(jsonStr)
 		} else {
-			requestBody = c.Request.Body
+			body, err := common.GetRequestBody(c)
+			if err != nil {
+				return service.OpenAIErrorWrapperLocal(err, "read_request_body_failed", http.StatusInternalServerError)
+			}
+			requestBody = bytes.NewBuffer(body)
 		}
 	} else {
+		span, endSpan := common.StartRequestSpan(c, "ConvertRequest")
 		convertedRequest, err := adaptor.ConvertRequest(c, relayInfo.RelayMode, textRequest)
+		common.SetSpanError(span, err)
+		endSpan()
 		if err != nil {
 			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
 		}
@@ -160,8 +194,18 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 	}
 
 	statusCodeMappingStr := c.GetString("status_code_mapping")
+	span, endSpan := common.StartRequestSpan(c, "DoRequest")
 	resp, err := adaptor.DoRequest(c, relayInfo, requestBody)
+	common.SetSpanError(span, err)
+	if resp != nil {
+		span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	}
+	endSpan()
 	if err != nil {
+		returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
+		if errors.Is(err, channel.ErrFirstTokenTimeout) {
+			return service.OpenAIErrorWrapper(err, "first_token_timeout", http.StatusGatewayTimeout)
+		}
 		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
 
@@ -176,35 +220,61 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 		}
 	}
 
+	var formatWriter responseFormatWriter
+	writer := c.Writer
+	if !relayInfo.NativeRequest {
+		formatWriter = newResponseFormatWriter(c, relayInfo)
+	}
+	if formatWriter != nil {
+		c.Writer = formatWriter
+	}
+	span, endSpan = common.StartRequestSpan(c, "DoResponse", attribute.Bool("is_stream", relayInfo.IsStream))
 	usage, openaiErr := adaptor.DoResponse(c, resp, relayInfo)
+	if openaiErr != nil {
+		common.SetSpanError(span, errors.New(openaiErr.Error.Message))
+	}
+	endSpan()
+	if formatWriter != nil {
+		c.Writer = writer
+		if openaiErr == nil {
+			formatWriter.Finish(usage)
+		}
+	}
 	if openaiErr != nil {
 		returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
 		// reset status code 重置状态码
 		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
 		return openaiErr
 	}
+	if relaycommon.UpstreamCancelled(c) {
+		// 落败的对冲请求被取消，由胜出的请求计费
+		returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
+		return service.OpenAIErrorWrapperLocal(errors.New("upstream request cancelled"), "upstream_request_cancelled", http.StatusInternalServerError)
+	}
 	postConsumeQuota(c, relayInfo, *textRequest, usage, ratio, preConsumedQuota, userQuota, modelRatio, groupRatio, modelPrice, success)
 	return nil
 }
 
-func getPromptTokens(textRequest *dto.GeneralOpenAIRequest, info *relaycommon.RelayInfo) (int, error) {
-	var promptTokens int
-	var err error
-	switch info.RelayMode {
-	case relayconstant.RelayModeChatCompletions:
-		promptTokens, err = service.CountTokenChatRequest(*textRequest, textRequest.Model)
-	case relayconstant.RelayModeCompletions:
-		promptTokens, err = service.CountTokenInput(textRequest.Prompt, textRequest.Model)
-	case relayconstant.RelayModeModerations:
-		promptTokens, err = service.CountTokenInput(textRequest.Input, textRequest.Model)
-	case relayconstant.RelayModeEmbeddings:
-		promptTokens, err = service.CountTokenInput(textRequest.Input, textRequest.Model)
-	default:
-		err = errors.New("unknown relay mode")
-		promptTokens = 0
+// responseFormatWriter 将渠道输出的 OpenAI 格式响应转换为入站请求的原生格式
+type responseFormatWriter interface {
+	gin.ResponseWriter
+	Finish(usage *dto.Usage)
+}
+
+func newResponseFormatWriter(c *gin.Context, info *relaycommon.RelayInfo) responseFormatWriter {
+	switch info.RelayFormat {
+	case relayconstant.RelayFormatClaude:
+		return claude.NewResponseWriter(c, info)
+	case relayconstant.RelayFormatGemini:
+		return gemini.NewResponseWriter(c, info)
 	}
+	return nil
+}
+
+// getPromptTokens 按模型映射后的模型计算提示词 token 数
+func getPromptTokens(c *gin.Context, model string, info *relaycommon.RelayInfo) (int, error) {
+	promptTokens, err := service.GetRequestMeta(c).CountPromptTokens(model)
 	info.PromptTokens = promptTokens
-	fmt.Println("promptTokens: ", promptTokens)
 	return promptTokens, err
 }
 
@@ -225,6 +295,8 @@ func checkRequestSensitive(textRequest *dto.GeneralOpenAIRequest, info *relaycom
 
 // 预扣费并返回用户剩余配额
 func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommon.RelayInfo) (int, int, *dto.OpenAIErrorWithStatusCode) {
+	span, endSpan := common.StartRequestSpan(c, "PreConsumeQuota")
+	defer endSpan()
 	userQuota, err := model.CacheGetUserQuota(relayInfo.UserId)
 	if err != nil {
 		return 0, 0, service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError)
@@ -259,6 +331,8 @@ func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 			return 0, 0, service.OpenAIErrorWrapperLocal(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 		}
 	}
+	common.MetricsRecordPreConsumedQuota(relayInfo.UpstreamModelName, relayInfo.ChannelId, relayInfo.Group, preConsumedQuota)
+	span.SetAttributes(attribute.Int("pre_consumed_quota", preConsumedQuota))
 	return preConsumedQuota, userQuota, nil
 }
 
@@ -277,10 +351,14 @@ func returnPreConsumedQuota(c *gin.Context, tokenId int, userQuota int, preConsu
 func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, textRequest dto.GeneralOpenAIRequest,
 	usage *dto.Usage, ratio float64, preConsumedQuota int, userQuota int, modelRatio float64, groupRatio float64,
 	modelPrice float64, usePrice bool) {
+	span, endSpan := common.StartRequestSpan(ctx, "PostConsumeQuota")
+	defer endSpan()
 
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
+	// 选择渠道时已按输入 token 数计入 TPM，这里补充输出的 token 数
+	model.ChannelLimitAddTokens(relayInfo.ChannelId, ctx.GetString("original_model"), completionTokens)
 
 	tokenName := ctx.GetString("token_name")
 	completionRatio := common.GetCompletionRatio(textRequest.Model)
@@ -302,6 +380,9 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, textRe
 	} else {
 		logContent = fmt.Sprintf("模型价格 %.2f，分组倍率 %.2f", modelPrice, groupRatio)
 	}
+	if relayInfo.IsBatch {
+		logContent += fmt.Sprintf("（含批处理倍率 %.2f）", common.BatchRatio)
+	}
 
 	// record all the consume log even if quota is 0
 	if totalTokens == 0 {
@@ -327,6 +408,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, textRe
 		}
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		model.UpdateChannelKeyUsedQuota(relayInfo.ChannelKeyId, quota)
 	}
 
 	logModel := textRequest.Model
@@ -334,6 +416,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, textRe
 		logModel = "gpt-4-gizmo-*"
 		logContent += fmt.Sprintf("，模型 %s", textRequest.Model)
 	}
+	span.SetAttributes(attribute.Int("quota", quota), attribute.Int("prompt_tokens", promptTokens), attribute.Int("completion_tokens", completionTokens))
 	other := service.GenerateTextOtherInfo(ctx, relayInfo, modelRatio, groupRatio, completionRatio, modelPrice)
 	model.RecordConsumeLog(ctx, relayInfo.UserId, relayInfo.ChannelId, promptTokens, completionTokens, logModel, tokenName, quota, logContent, relayInfo.TokenId, userQuota, int(useTimeSeconds), relayInfo.IsStream, other)
 
@@ -96,7 +96,10 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 		return
 	}
 	// do request
+	span, endSpan := common.StartRequestSpan(c, "DoRequest")
 	resp, err := adaptor.DoRequest(c, relayInfo, requestBody)
+	common.SetSpanError(span, err)
+	endSpan()
 	if err != nil {
 		taskErr = service.TaskErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 		return
@@ -128,11 +131,14 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 				model.RecordConsumeLog(ctx, relayInfo.UserId, relayInfo.ChannelId, 0, 0, modelName, tokenName, quota, logContent, relayInfo.TokenId, userQuota, 0, false, other)
 				model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 				model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+				model.UpdateChannelKeyUsedQuota(relayInfo.ChannelKeyId, quota)
 			}
 		}
 	}(c.Request.Context())
 
+	span, endSpan = common.StartRequestSpan(c, "DoResponse")
 	taskID, taskData, taskErr := adaptor.DoResponse(c, resp, relayInfo)
+	endSpan()
 	if taskErr != nil {
 		return
 	}
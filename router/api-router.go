@@ -73,6 +73,7 @@ func SetApiRouter(router *gin.Engine) {
 			optionRoute.GET("/", controller.GetOptions)
 			optionRoute.PUT("/", controller.UpdateOption)
 			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
+			optionRoute.POST("/notification/test", controller.TestNotification)
 		}
 		channelRoute := apiRouter.Group("/channel")
 		channelRoute.Use(middleware.AdminAuth())
@@ -80,9 +81,12 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/", controller.GetAllChannels)
 			channelRoute.GET("/search", controller.SearchChannels)
 			channelRoute.GET("/models", controller.ChannelListModels)
+			channelRoute.GET("/breaker", controller.GetChannelBreakers)
+			channelRoute.POST("/breaker/reset", controller.ResetChannelBreaker)
 			channelRoute.GET("/:id", controller.GetChannel)
 			channelRoute.GET("/test", controller.TestAllChannels)
 			channelRoute.GET("/test/:id", controller.TestChannel)
+			channelRoute.POST("/test/:id/probe", controller.ProbeChannel)
 			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
 			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
 			channelRoute.POST("/", controller.AddChannel)
@@ -92,6 +96,10 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.POST("/batch", controller.DeleteChannelBatch)
 			channelRoute.POST("/fix", controller.FixChannelsAbilities)
 			channelRoute.GET("/fetch_models/:id", controller.FetchUpstreamModels)
+			channelRoute.GET("/:id/keys", controller.GetChannelKeys)
+			channelRoute.POST("/:id/keys", controller.AddChannelKeys)
+			channelRoute.PUT("/:id/keys/:key_id/status", controller.UpdateChannelKeyStatus)
+			channelRoute.DELETE("/:id/keys/:key_id", controller.DeleteChannelKey)
 
 		}
 		tokenRoute := apiRouter.Group("/token")
@@ -120,9 +128,17 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/:id/capture", middleware.AdminAuth(), controller.GetLogBodyCapture)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
 
+		auditRoute := apiRouter.Group("/audit")
+		auditRoute.Use(middleware.RootAuth())
+		{
+			auditRoute.GET("/", controller.GetAuditLogs)
+			auditRoute.GET("/export", controller.ExportAuditLogs)
+		}
+
 		dataRoute := apiRouter.Group("/data")
 		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
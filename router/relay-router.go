@@ -16,25 +16,42 @@ func SetRelayRouter(router *gin.Engine) {
 		modelsRouter.GET("", controller.ListModels)
 		modelsRouter.GET("/:model", controller.RetrieveModel)
 	}
+	// 文件接口不需要选择渠道，文件在被请求引用时才按渠道上传
+	filesRouter := router.Group("/v1/files")
+	filesRouter.Use(middleware.TokenAuth())
+	{
+		filesRouter.GET("", controller.ListFiles)
+		filesRouter.POST("", controller.UploadFile)
+		filesRouter.GET("/:id", controller.RetrieveFile)
+		filesRouter.DELETE("/:id", controller.DeleteFile)
+		filesRouter.GET("/:id/content", controller.RetrieveFileContent)
+	}
+	// 批处理任务由网关自行执行，每条请求按普通接口选择渠道
+	batchesRouter := router.Group("/v1/batches")
+	batchesRouter.Use(middleware.TokenAuth())
+	{
+		batchesRouter.POST("", controller.CreateBatch)
+		batchesRouter.GET("", controller.ListBatches)
+		batchesRouter.GET("/:id", controller.RetrieveBatch)
+		batchesRouter.POST("/:id/cancel", controller.CancelBatch)
+	}
 	relayV1Router := router.Group("/v1")
 	relayV1Router.Use(middleware.TokenAuth(), middleware.Distribute())
 	{
 		relayV1Router.POST("/completions", controller.Relay)
 		relayV1Router.POST("/chat/completions", controller.Relay)
+		relayV1Router.POST("/messages", controller.Relay)
 		relayV1Router.POST("/edits", controller.Relay)
 		relayV1Router.POST("/images/generations", controller.Relay)
-		relayV1Router.POST("/images/edits", controller.RelayNotImplemented)
-		relayV1Router.POST("/images/variations", controller.RelayNotImplemented)
+		relayV1Router.POST("/images/edits", controller.Relay)
+		relayV1Router.POST("/images/variations", controller.Relay)
 		relayV1Router.POST("/embeddings", controller.Relay)
 		relayV1Router.POST("/engines/:model/embeddings", controller.Relay)
+		relayV1Router.POST("/rerank", controller.Relay)
+		relayV1Router.GET("/realtime", controller.Relay)
 		relayV1Router.POST("/audio/transcriptions", controller.Relay)
 		relayV1Router.POST("/audio/translations", controller.Relay)
 		relayV1Router.POST("/audio/speech", controller.Relay)
-		relayV1Router.GET("/files", controller.RelayNotImplemented)
-		relayV1Router.POST("/files", controller.RelayNotImplemented)
-		relayV1Router.DELETE("/files/:id", controller.RelayNotImplemented)
-		relayV1Router.GET("/files/:id", controller.RelayNotImplemented)
-		relayV1Router.GET("/files/:id/content", controller.RelayNotImplemented)
 		relayV1Router.POST("/fine-tunes", controller.RelayNotImplemented)
 		relayV1Router.GET("/fine-tunes", controller.RelayNotImplemented)
 		relayV1Router.GET("/fine-tunes/:id", controller.RelayNotImplemented)
@@ -44,6 +61,13 @@ func SetRelayRouter(router *gin.Engine) {
 		relayV1Router.POST("/moderations", controller.Relay)
 	}
 
+	// Gemini generateContent 原生接口，路径形如 /v1beta/models/{model}:generateContent
+	relayGeminiRouter := router.Group("/v1beta")
+	relayGeminiRouter.Use(middleware.TokenAuth(), middleware.Distribute())
+	{
+		relayGeminiRouter.POST("/models/:model", controller.Relay)
+	}
+
 	relayMjRouter := router.Group("/mj")
 	registerMjRouterGroup(relayMjRouter)
 
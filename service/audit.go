@@ -0,0 +1,139 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"one-api/common"
+	"one-api/model"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditChange 审计日志中单个字段的变更
+type AuditChange struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// secretFieldSuffixes 字段名的最后一个单词为其中之一时视为密钥类字段，如 key、password、access_token、GitHubClientSecret、SMTPToken
+var secretFieldSuffixes = map[string]bool{"key": true, "secret": true, "password": true, "token": true}
+
+// IsSecretField 判断字段名是否为密钥类字段，支持驼峰与下划线命名
+func IsSecretField(name string) bool {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || r == '-' || r == '.'
+	})
+	if len(words) == 0 {
+		return false
+	}
+	last := []rune(words[len(words)-1])
+	start := 0
+	for i := 1; i < len(last); i++ {
+		// 驼峰命名在小写字母后的大写字母，或连续大写字母中最后一个后接小写字母处开始新的单词
+		if unicode.IsUpper(last[i]) && (unicode.IsLower(last[i-1]) || (i+1 < len(last) && unicode.IsLower(last[i+1]))) {
+			start = i
+		}
+	}
+	return secretFieldSuffixes[strings.ToLower(string(last[start:]))]
+}
+
+// secretAuditFields 值中包含密钥的字段，整体脱敏
+var secretAuditFields = map[string]bool{"NotificationChannels": true}
+
+func maskAuditValue(field string, value any) any {
+	if !IsSecretField(field) && !secretAuditFields[field] {
+		return value
+	}
+	if s, ok := value.(string); ok {
+		return common.MaskSecret(s)
+	}
+	if value == nil {
+		return nil
+	}
+	return "********"
+}
+
+func auditFields(v any) map[string]any {
+	fields := make(map[string]any)
+	if v == nil {
+		return fields
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fields
+	}
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
+
+func isEmptyAuditValue(v any) bool {
+	return v == nil || v == "" || v == float64(0) || v == false
+}
+
+// AuditDiff 比较两个对象 JSON 序列化后的顶层字段，返回发生变化的字段，密钥类字段已脱敏。
+// before 为 nil 时表示新建，after 为 nil 时表示删除，此时忽略空值字段
+func AuditDiff(before any, after any) []AuditChange {
+	beforeFields, afterFields := auditFields(before), auditFields(after)
+	keys := make([]string, 0, len(beforeFields)+len(afterFields))
+	for key := range beforeFields {
+		keys = append(keys, key)
+	}
+	for key := range afterFields {
+		if _, ok := beforeFields[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	changes := make([]AuditChange, 0)
+	for _, key := range keys {
+		beforeValue, afterValue := beforeFields[key], afterFields[key]
+		if reflect.DeepEqual(beforeValue, afterValue) {
+			continue
+		}
+		if isEmptyAuditValue(beforeValue) && isEmptyAuditValue(afterValue) {
+			continue
+		}
+		changes = append(changes, AuditChange{
+			Field:  key,
+			Before: maskAuditValue(key, beforeValue),
+			After:  maskAuditValue(key, afterValue),
+		})
+	}
+	return changes
+}
+
+// AuditValueChange 记录单个值的变更，用于系统设置等键值形式的配置
+func AuditValueChange(field string, before any, after any) []AuditChange {
+	return []AuditChange{{
+		Field:  field,
+		Before: maskAuditValue(field, before),
+		After:  maskAuditValue(field, after),
+	}}
+}
+
+// RecordAudit 记录当前管理员的操作，targetId 为空时表示不针对单个对象的操作
+func RecordAudit(c *gin.Context, action string, targetType string, targetId any, content string, changes []AuditChange) {
+	auditLog := &model.AuditLog{
+		OperatorId:   c.GetInt("id"),
+		OperatorName: c.GetString("username"),
+		Ip:           c.ClientIP(),
+		Action:       action,
+		TargetType:   targetType,
+		Content:      content,
+	}
+	if targetId != nil {
+		auditLog.TargetId = fmt.Sprint(targetId)
+	}
+	if len(changes) > 0 {
+		data, _ := json.Marshal(changes)
+		auditLog.Changes = string(data)
+	}
+	if err := auditLog.Insert(); err != nil {
+		common.LogError(c.Request.Context(), fmt.Sprintf("failed to record audit log %s: %s", action, err.Error()))
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import "testing"
+
+func TestIsSecretField(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "key", want: true},
+		{name: "Key", want: true},
+		{name: "password", want: true},
+		{name: "access_token", want: true},
+		{name: "GitHubClientSecret", want: true},
+		{name: "SMTPToken", want: true},
+		{name: "TelegramBotToken", want: true},
+		{name: "TurnstileSecretKey", want: true},
+		{name: "webhook-secret", want: true},
+		{name: "config.api_key", want: true},
+		{name: "APIKey", want: true},
+		// 仅最后一个单词为密钥类单词时才视为密钥字段
+		{name: "key_id", want: false},
+		{name: "channel_key_id", want: false},
+		{name: "TokenLimit", want: false},
+		{name: "SecretExpiredAt", want: false},
+		{name: "monkey", want: false},
+		{name: "tokens", want: false},
+		{name: "SMTPServer", want: false},
+		{name: "name", want: false},
+		{name: "", want: false},
+		{name: "__", want: false},
+	}
+	for _, tt := range tests {
+		if got := IsSecretField(tt.name); got != tt.want {
+			t.Errorf("IsSecretField(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMaskAuditValue(t *testing.T) {
+	tests := []struct {
+		field string
+		value any
+		want  any
+	}{
+		{field: "key", value: "sk-1234567890abcdef", want: "sk-1********cdef"},
+		{field: "password", value: "12345678", want: "********"},
+		{field: "SMTPToken", value: "", want: ""},
+		{field: "key", value: nil, want: nil},
+		{field: "key", value: float64(123), want: "********"},
+		{field: "NotificationChannels", value: `[{"name":"ops","type":"webhook","secret":"abc"}]`, want: "[{\"n********c\"}]"},
+		// 非密钥字段原样返回
+		{field: "name", value: "sk-1234567890abcdef", want: "sk-1234567890abcdef"},
+		{field: "key_id", value: float64(3), want: float64(3)},
+		{field: "status", value: nil, want: nil},
+	}
+	for _, tt := range tests {
+		if got := maskAuditValue(tt.field, tt.value); got != tt.want {
+			t.Errorf("maskAuditValue(%q, %v) = %v, want %v", tt.field, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestAuditDiffMasksSecretFields(t *testing.T) {
+	type channel struct {
+		Name string `json:"name"`
+		Key  string `json:"key"`
+	}
+	changes := AuditDiff(channel{Name: "a", Key: "sk-aaaaaaaaaaaaaaaa"}, channel{Name: "b", Key: "sk-bbbbbbbbbbbbbbbb"})
+	if len(changes) != 2 {
+		t.Fatalf("AuditDiff returned %d changes, want 2", len(changes))
+	}
+	if changes[0].Field != "key" || changes[0].Before != "sk-a********aaaa" || changes[0].After != "sk-b********bbbb" {
+		t.Errorf("key change = %+v, want masked values", changes[0])
+	}
+	if changes[1].Field != "name" || changes[1].Before != "a" || changes[1].After != "b" {
+		t.Errorf("name change = %+v, want unmasked values", changes[1])
+	}
+}
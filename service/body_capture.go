@@ -0,0 +1,145 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"one-api/common"
+	"one-api/model"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type redactionRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// builtinRedactionRules 始终生效的脱敏规则：邮箱、手机号与常见的密钥格式
+var builtinRedactionRules = []redactionRule{
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[EMAIL]"},
+	{regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/-]+=*`), "Bearer [KEY]"},
+	{regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{16,}`), "[KEY]"},
+	{regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`), "[KEY]"},
+	{regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`), "[KEY]"},
+	{regexp.MustCompile(`\+\d{1,3}[\s-]?\d{6,14}\b`), "[PHONE]"},
+	{regexp.MustCompile(`\b1[3-9]\d{9}\b`), "[PHONE]"},
+	{regexp.MustCompile(`\(?\b\d{3}\)?[\s.-]\d{3}[\s.-]\d{4}\b`), "[PHONE]"},
+}
+
+// RedactBody 按内置规则与自定义规则对保存的内容脱敏
+func RedactBody(body string) string {
+	for _, rule := range builtinRedactionRules {
+		body = rule.pattern.ReplaceAllString(body, rule.replacement)
+	}
+	for _, rule := range common.BodyCaptureRedactionRules {
+		body = rule.ReplaceAllString(body, "[REDACTED]")
+	}
+	return body
+}
+
+// shouldCaptureBody 判断请求是否命中保存条件并按比例采样
+func shouldCaptureBody(c *gin.Context) bool {
+	if !common.BodyCaptureEnabled {
+		return false
+	}
+	userIds, tokenIds, groups := common.BodyCaptureUserIds, common.BodyCaptureTokenIds, common.BodyCaptureGroups
+	if len(userIds) > 0 || len(tokenIds) > 0 || len(groups) > 0 {
+		if !userIds[c.GetInt("id")] && !tokenIds[c.GetInt("token_id")] && !groups[c.GetString("group")] {
+			return false
+		}
+	}
+	rate := common.BodyCaptureSampleRate
+	return rate >= 1 || rand.Float64() < rate
+}
+
+// bodyCaptureWriter 在写给客户端的同时保留响应体的前 limit 个字节
+type bodyCaptureWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (w *bodyCaptureWriter) capture(data []byte) {
+	remain := w.limit - w.body.Len()
+	if len(data) > remain {
+		data = data[:remain]
+		w.truncated = true
+	}
+	w.body.Write(data)
+}
+
+func (w *bodyCaptureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// StartBodyCapture 请求命中保存条件时开始记录响应体，并以请求 Id 作为捕获 id 写入请求 context，
+// 返回的函数在请求结束后调用，保存请求体与响应体。请求未命中时返回的函数不做任何事
+func StartBodyCapture(c *gin.Context) func() {
+	if !shouldCaptureBody(c) {
+		return func() {}
+	}
+	captureId := c.GetString(common.RequestIdKey)
+	if captureId == "" {
+		return func() {}
+	}
+	writer := &bodyCaptureWriter{ResponseWriter: c.Writer, limit: common.BodyCaptureMaxSize}
+	c.Writer = writer
+	c.Request = c.Request.WithContext(common.WithBodyCaptureId(c.Request.Context(), captureId))
+	return func() {
+		c.Writer = writer.ResponseWriter
+		requestBody, _ := common.GetRequestBody(c)
+		capture := &model.BodyCapture{
+			RequestId:         captureId,
+			UserId:            c.GetInt("id"),
+			TokenId:           c.GetInt("token_id"),
+			ChannelId:         c.GetInt("channel_id"),
+			ModelName:         c.GetString("original_model"),
+			Path:              c.Request.URL.Path,
+			StatusCode:        writer.Status(),
+			ResponseTruncated: writer.truncated,
+		}
+		capture.RequestBody, capture.RequestTruncated = captureRequestBody(c.Request.Header.Get("Content-Type"), requestBody)
+		capture.ResponseBody = captureResponseBody(writer.Header().Get("Content-Type"), writer.body.Bytes())
+		ctx := c.Request.Context()
+		common.SafeGoroutine(func() {
+			capture.RequestBody = RedactBody(capture.RequestBody)
+			capture.ResponseBody = RedactBody(capture.ResponseBody)
+			if err := capture.Insert(); err != nil {
+				common.LogError(ctx, "failed to save body capture: "+err.Error())
+			}
+		})
+	}
+}
+
+// isTextContentType 只保存文本内容，音频、图片等二进制内容只记录类型与大小
+func isTextContentType(contentType string) bool {
+	return contentType == "" || strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "json") || strings.Contains(contentType, "xml")
+}
+
+func captureRequestBody(contentType string, body []byte) (string, bool) {
+	if !isTextContentType(contentType) {
+		return fmt.Sprintf("[%s body omitted, %d bytes]", contentType, len(body)), false
+	}
+	if len(body) > common.BodyCaptureMaxSize {
+		return strings.ToValidUTF8(string(body[:common.BodyCaptureMaxSize]), ""), true
+	}
+	return strings.ToValidUTF8(string(body), ""), false
+}
+
+func captureResponseBody(contentType string, body []byte) string {
+	if !isTextContentType(contentType) {
+		return fmt.Sprintf("[%s body omitted]", contentType)
+	}
+	return strings.ToValidUTF8(string(body), "")
+}
@@ -6,22 +6,64 @@ import (
 	"one-api/common"
 	relaymodel "one-api/dto"
 	"one-api/model"
+	"strconv"
 	"strings"
 )
 
 // disable & notify
 func DisableChannel(channelId int, channelName string, reason string) {
 	model.UpdateChannelStatusById(channelId, common.ChannelStatusAutoDisabled, reason)
-	subject := fmt.Sprintf("通道「%s」（#%d）已被禁用", channelName, channelId)
-	content := fmt.Sprintf("通道「%s」（#%d）已被禁用，原因：%s", channelName, channelId, reason)
-	notifyRootUser(subject, content)
+	common.MetricsRecordChannelAutoDisabled(channelId, "channel")
+	Notify(Notification{
+		Event: common.NotifyEventChannelDisabled,
+		Key:   strconv.Itoa(channelId),
+		Data:  map[string]any{"channel_id": channelId, "channel_name": channelName, "reason": reason},
+	})
+}
+
+// DisableChannelKey 禁用多密钥渠道中的单个密钥，密钥池中没有其他可用密钥时禁用整个渠道
+func DisableChannelKey(channelId int, channelName string, keyId int, reason string) {
+	hasAvailable, err := model.DisableChannelKey(keyId, reason)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to disable channel key #%d: %s", keyId, err.Error()))
+		return
+	}
+	common.MetricsRecordChannelAutoDisabled(channelId, "key")
+	Notify(Notification{
+		Event: common.NotifyEventChannelKeyDisabled,
+		Key:   strconv.Itoa(keyId),
+		Data:  map[string]any{"channel_id": channelId, "channel_name": channelName, "key_id": keyId, "reason": reason},
+	})
+	if !hasAvailable {
+		DisableChannel(channelId, channelName, "密钥池中已没有可用密钥："+reason)
+	}
 }
 
 func EnableChannel(channelId int, channelName string) {
 	model.UpdateChannelStatusById(channelId, common.ChannelStatusEnabled, "")
-	subject := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
-	content := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
-	notifyRootUser(subject, content)
+	Notify(Notification{
+		Event: common.NotifyEventChannelEnabled,
+		Key:   strconv.Itoa(channelId),
+		Data:  map[string]any{"channel_id": channelId, "channel_name": channelName},
+	})
+}
+
+// NotifyChannelBalanceLow 渠道余额低于 ChannelBalanceLowThreshold 时发送余额不足通知
+func NotifyChannelBalanceLow(channelId int, channelName string, balance float64) {
+	threshold := common.ChannelBalanceLowThreshold
+	if threshold <= 0 || balance >= threshold {
+		return
+	}
+	Notify(Notification{
+		Event: common.NotifyEventChannelBalanceLow,
+		Key:   strconv.Itoa(channelId),
+		Data: map[string]any{
+			"channel_id":   channelId,
+			"channel_name": channelName,
+			"balance":      fmt.Sprintf("%.2f", balance),
+			"threshold":    fmt.Sprintf("%.2f", threshold),
+		},
+	})
 }
 
 func ShouldDisableChannel(channelType int, err *relaymodel.OpenAIErrorWithStatusCode) bool {
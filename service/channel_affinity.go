@@ -0,0 +1,63 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"one-api/common"
+	"one-api/dto"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ChannelAffinitySourceHeader = "header"
+	ChannelAffinitySourceUser   = "user"
+	ChannelAffinitySourcePrompt = "prompt"
+)
+
+// GetChannelAffinityKey 返回请求所属会话的标识与识别方式，依次使用 ChannelAffinityHeader 请求头、
+// user 字段、系统提示词与首条对话消息；未启用渠道亲和或无法识别会话时返回空字符串
+func GetChannelAffinityKey(c *gin.Context, group string, model string) (string, string) {
+	if !common.ChannelAffinityEnabled {
+		return "", ""
+	}
+	source, session := "", ""
+	if common.ChannelAffinityHeader != "" {
+		if value := c.Request.Header.Get(common.ChannelAffinityHeader); value != "" {
+			source, session = ChannelAffinitySourceHeader, value
+		}
+	}
+	if request := GetRequestMeta(c).Request; session == "" && request != nil {
+		if request.User != "" {
+			source, session = ChannelAffinitySourceUser, request.User
+		} else if prompt := conversationPrefix(request.Messages); prompt != "" {
+			source, session = ChannelAffinitySourcePrompt, prompt
+		}
+	}
+	if session == "" {
+		return "", ""
+	}
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%d\n%s\n%s\n%s\n%s", c.GetInt("id"), group, model, source, session)))
+	return hex.EncodeToString(hash[:]), source
+}
+
+// conversationPrefix 返回系统提示词与首条对话消息，多轮对话中这部分保持不变
+func conversationPrefix(messages []dto.Message) string {
+	prefix := make([]dto.Message, 0, 2)
+	for _, message := range messages {
+		prefix = append(prefix, message)
+		if message.Role != "system" {
+			break
+		}
+	}
+	if len(prefix) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(prefix)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/model"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+)
+
+// UploadFileToUpstream 将网关文件上传到 OpenAI 兼容的上游，返回上游文件 id
+func UploadFileToUpstream(baseUrl string, key string, file *model.File) (string, error) {
+	reader, err := fileStorage.Open(file.StorageKey)
+	if err != nil {
+		return "", err
+	}
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		defer reader.Close()
+		err := writer.WriteField("purpose", file.Purpose)
+		if err == nil {
+			var part io.Writer
+			part, err = writer.CreateFormFile("file", file.Filename)
+			if err == nil {
+				_, err = io.Copy(part, reader)
+			}
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		_ = pw.CloseWithError(err)
+	}()
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/v1/files", baseUrl), pr)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("upload file to upstream failed, status code %d: %s", resp.StatusCode, string(responseBody))
+	}
+	var upstreamFile dto.OpenAIFile
+	err = json.Unmarshal(responseBody, &upstreamFile)
+	if err != nil {
+		return "", err
+	}
+	if upstreamFile.Id == "" {
+		return "", errors.New("upstream file id is empty")
+	}
+	return upstreamFile.Id, nil
+}
+
+// DeleteUpstreamFiles 使用上传时的密钥删除网关文件在各渠道上游的副本，失败只记录日志
+func DeleteUpstreamFiles(upstreamFiles []*model.UpstreamFile) {
+	for _, upstreamFile := range upstreamFiles {
+		channel, err := model.GetChannelById(upstreamFile.ChannelId, true)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to get channel #%d for deleting upstream file: %s", upstreamFile.ChannelId, err.Error()))
+			continue
+		}
+		key := channel.Key
+		if upstreamFile.ChannelKeyId != 0 {
+			channelKey, err := model.GetChannelKeyById(upstreamFile.ChannelKeyId)
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to get key #%d of channel #%d for deleting upstream file %s: %s", upstreamFile.ChannelKeyId, channel.Id, upstreamFile.UpstreamFileId, err.Error()))
+				continue
+			}
+			key = channelKey.Key
+		}
+		baseUrl := channel.GetBaseURL()
+		if baseUrl == "" {
+			baseUrl = common.ChannelBaseURLs[channel.Type]
+		}
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/v1/files/%s", baseUrl, upstreamFile.UpstreamFileId), nil)
+		if err != nil {
+			common.SysError("failed to create delete upstream file request: " + err.Error())
+			continue
+		}
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := GetHttpClient().Do(req)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to delete upstream file %s of channel #%d: %s", upstreamFile.UpstreamFileId, channel.Id, err.Error()))
+			continue
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			common.SysError(fmt.Sprintf("failed to delete upstream file %s of channel #%d, status code %d", upstreamFile.UpstreamFileId, channel.Id, resp.StatusCode))
+		}
+	}
+}
+
+// getUpstreamFileId 返回网关文件在当前渠道与密钥的上游文件 id，首次使用时用当前密钥上传；不是网关文件时返回空字符串
+func getUpstreamFileId(c *gin.Context, info *relaycommon.RelayInfo, fileId string) (string, error) {
+	file, err := model.GetUserFileById(info.UserId, fileId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	upstreamFileId, err := model.GetUpstreamFileId(fileId, info.ChannelId, info.ChannelKeyId)
+	if err == nil {
+		return upstreamFileId, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	upstreamFileId, err = UploadFileToUpstream(info.BaseUrl, info.ApiKey, file)
+	if err != nil {
+		return "", err
+	}
+	err = model.CreateUpstreamFile(fileId, info.ChannelId, info.ChannelKeyId, upstreamFileId)
+	if err != nil {
+		// 并发上传时映射可能已被其他请求写入，本次上传的文件仍然可用
+		common.LogError(c, "failed to save upstream file mapping: "+err.Error())
+	}
+	common.LogInfo(c, fmt.Sprintf("file %s uploaded to channel #%d with key #%d as %s", fileId, info.ChannelId, info.ChannelKeyId, upstreamFileId))
+	return upstreamFileId, nil
+}
+
+// ResolveUpstreamFiles 将请求消息中引用的网关文件替换为当前渠道的上游文件 id，返回请求是否被修改
+func ResolveUpstreamFiles(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (bool, error) {
+	if info.ApiType != relayconstant.APITypeOpenAI || info.ChannelType == common.ChannelTypeAzure {
+		return false, nil
+	}
+	replaced := false
+	for i, message := range request.Messages {
+		if len(message.Content) == 0 || message.IsStringContent() {
+			continue
+		}
+		var parts []map[string]json.RawMessage
+		if err := json.Unmarshal(message.Content, &parts); err != nil {
+			continue
+		}
+		changed := false
+		for _, part := range parts {
+			var partType string
+			if err := json.Unmarshal(part["type"], &partType); err != nil || partType != "file" {
+				continue
+			}
+			var filePart map[string]any
+			if err := json.Unmarshal(part["file"], &filePart); err != nil {
+				continue
+			}
+			fileId, _ := filePart["file_id"].(string)
+			if fileId == "" {
+				continue
+			}
+			upstreamFileId, err := getUpstreamFileId(c, info, fileId)
+			if err != nil {
+				return false, err
+			}
+			if upstreamFileId == "" {
+				continue
+			}
+			filePart["file_id"] = upstreamFileId
+			part["file"], _ = json.Marshal(filePart)
+			changed = true
+		}
+		if changed {
+			request.Messages[i].Content, _ = json.Marshal(parts)
+			replaced = true
+		}
+	}
+	return replaced, nil
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"one-api/common"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileStorage 文件存储后端，默认使用本地磁盘，可通过 SetFileStorage 替换为对象存储等实现
+type FileStorage interface {
+	Save(key string, reader io.Reader) (int64, error)
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+var fileStorage FileStorage = &LocalFileStorage{Dir: common.FileStorageDir}
+
+func SetFileStorage(storage FileStorage) {
+	fileStorage = storage
+}
+
+func GetFileStorage() FileStorage {
+	return fileStorage
+}
+
+// LocalFileStorage 将文件保存在本地目录 Dir 下
+type LocalFileStorage struct {
+	Dir string
+}
+
+func (s *LocalFileStorage) path(key string) (string, error) {
+	if key == "" || strings.Contains(key, "..") || filepath.IsAbs(key) {
+		return "", errors.New("invalid file key")
+	}
+	return filepath.Join(s.Dir, key), nil
+}
+
+func (s *LocalFileStorage) Save(key string, reader io.Reader) (int64, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return 0, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(file, reader)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return 0, err
+	}
+	return n, nil
+}
+
+func (s *LocalFileStorage) Open(key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (s *LocalFileStorage) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"github.com/gin-gonic/gin"
+	"one-api/common"
 	relaycommon "one-api/relay/common"
 )
 
@@ -12,8 +13,18 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	other["completion_ratio"] = completionRatio
 	other["model_price"] = modelPrice
 	other["frt"] = float64(relayInfo.FirstResponseTime.UnixMilli() - relayInfo.StartTime.UnixMilli())
+	if relayInfo.IsBatch {
+		other["batch_ratio"] = common.BatchRatio
+	}
+	if fallbackFrom := ctx.GetString("model_fallback_from"); fallbackFrom != "" {
+		other["model_fallback_from"] = fallbackFrom
+	}
 	adminInfo := make(map[string]interface{})
 	adminInfo["use_channel"] = ctx.GetStringSlice("use_channel")
+	if affinity := ctx.GetString("channel_affinity"); affinity != "" {
+		adminInfo["channel_affinity"] = affinity
+		adminInfo["channel_affinity_source"] = ctx.GetString("channel_affinity_source")
+	}
 	other["admin_info"] = adminInfo
 	return other
 }
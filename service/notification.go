@@ -0,0 +1,308 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Notification 一次通知，按 NotificationRules 发送到事件配置的各个通知渠道
+type Notification struct {
+	Event string
+	// Key 限流的对象，如渠道 id、用户 id，同一事件的同一对象在限流时间内只发送一次
+	Key string
+	// UserId 用户事件对应的用户，内置的邮件渠道发送给该用户；为 0 时发送给超级管理员
+	UserId int
+	// Data 模板中可引用的字段
+	Data map[string]any
+}
+
+var notificationSentAt = struct {
+	sync.Mutex
+	times map[string]time.Time
+}{times: make(map[string]time.Time)}
+
+// notificationAllowed 判断限流时间内是否已发送过相同的通知，启用 Redis 时多个节点共享限流状态
+func notificationAllowed(event string, key string) bool {
+	limit := time.Duration(common.NotificationRateLimitSeconds) * time.Second
+	if limit <= 0 {
+		return true
+	}
+	limitKey := "notification:" + event + ":" + key
+	if common.RedisEnabled {
+		ok, err := common.RDB.SetNX(context.Background(), limitKey, "1", limit).Result()
+		if err == nil {
+			return ok
+		}
+		common.SysError("failed to check notification rate limit: " + err.Error())
+	}
+	now := time.Now()
+	notificationSentAt.Lock()
+	defer notificationSentAt.Unlock()
+	if sentAt, ok := notificationSentAt.times[limitKey]; ok && now.Sub(sentAt) < limit {
+		return false
+	}
+	for k, sentAt := range notificationSentAt.times {
+		if now.Sub(sentAt) >= limit {
+			delete(notificationSentAt.times, k)
+		}
+	}
+	notificationSentAt.times[limitKey] = now
+	return true
+}
+
+func renderNotificationTemplate(name string, text string, data map[string]any) string {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to parse notification template %s: %s", name, err.Error()))
+		return text
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, data); err != nil {
+		common.SysError(fmt.Sprintf("failed to render notification template %s: %s", name, err.Error()))
+		return text
+	}
+	return buf.String()
+}
+
+// Notify 异步发送通知，事件没有配置通知渠道或处于限流时间内时不发送
+func Notify(notification Notification) {
+	channelNames := common.NotificationRules[notification.Event]
+	if len(channelNames) == 0 {
+		return
+	}
+	if !notificationAllowed(notification.Event, notification.Key) {
+		return
+	}
+	tmpl := common.GetNotificationTemplate(notification.Event)
+	title := renderNotificationTemplate(notification.Event, tmpl.Title, notification.Data)
+	content := renderNotificationTemplate(notification.Event, tmpl.Content, notification.Data)
+	for _, name := range channelNames {
+		channel, ok := common.GetNotificationChannel(name)
+		if !ok {
+			common.SysError(fmt.Sprintf("notification channel %s for event %s not found", name, notification.Event))
+			continue
+		}
+		common.SafeGoroutine(func() {
+			err := sendNotification(channel, notification, title, content)
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to send %s notification via %s: %s", notification.Event, channel.Name, err.Error()))
+			}
+		})
+	}
+}
+
+// SendTestNotification 向指定的通知渠道同步发送一条测试通知
+func SendTestNotification(name string) error {
+	channel, ok := common.GetNotificationChannel(name)
+	if !ok {
+		return fmt.Errorf("通知渠道 %s 不存在", name)
+	}
+	notification := Notification{Event: "test", Data: map[string]any{}}
+	return sendNotification(channel, notification, "测试通知", fmt.Sprintf("这是一条来自 %s 的测试通知", common.SystemName))
+}
+
+func sendNotification(channel common.NotificationChannel, notification Notification, title string, content string) error {
+	switch channel.Type {
+	case common.NotifyChannelTypeEmail:
+		return sendEmailNotification(channel, notification, title, content)
+	case common.NotifyChannelTypeWebhook:
+		return sendWebhookNotification(channel, notification, title, content)
+	case common.NotifyChannelTypeTelegram:
+		return sendTelegramNotification(channel, title, content)
+	case common.NotifyChannelTypeDingTalk:
+		return sendDingTalkNotification(channel, title, content)
+	case common.NotifyChannelTypeFeishu:
+		return sendFeishuNotification(channel, title, content)
+	case common.NotifyChannelTypeSlack:
+		return sendSlackNotification(channel, title, content)
+	default:
+		return fmt.Errorf("unknown notification channel type: %s", channel.Type)
+	}
+}
+
+func sendEmailNotification(channel common.NotificationChannel, notification Notification, title string, content string) error {
+	receiver := channel.To
+	if receiver == "" && notification.UserId != 0 {
+		email, err := model.GetUserEmail(notification.UserId)
+		if err != nil {
+			return err
+		}
+		// 用户没有绑定邮箱时不发送
+		if email == "" {
+			return nil
+		}
+		receiver = email
+	}
+	if receiver == "" {
+		if common.RootUserEmail == "" {
+			common.RootUserEmail = model.GetRootUserEmail()
+		}
+		receiver = common.RootUserEmail
+	}
+	return common.SendEmail(title, receiver, content)
+}
+
+// sendWebhookNotification 以 JSON 发送通知，配置了密钥时在 X-Notification-Signature 请求头中附带
+// HMAC-SHA256(secret, timestamp + "." + body) 的十六进制签名，timestamp 为 X-Notification-Timestamp 请求头的值
+func sendWebhookNotification(channel common.NotificationChannel, notification Notification, title string, content string) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	body, err := json.Marshal(map[string]any{
+		"event":     notification.Event,
+		"title":     title,
+		"content":   content,
+		"data":      notification.Data,
+		"timestamp": timestamp,
+	})
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{"X-Notification-Timestamp": timestamp}
+	if channel.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(channel.Secret))
+		mac.Write([]byte(timestamp + "." + string(body)))
+		headers["X-Notification-Signature"] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	_, err = postNotification(channel.Url, body, headers)
+	return err
+}
+
+func sendTelegramNotification(channel common.NotificationChannel, title string, content string) error {
+	token := channel.Token
+	if token == "" {
+		token = common.TelegramBotToken
+	}
+	if token == "" || channel.ChatId == "" {
+		return errors.New("telegram bot token or chat id is empty")
+	}
+	body, _ := json.Marshal(map[string]any{
+		"chat_id": channel.ChatId,
+		"text":    title + "\n\n" + content,
+	})
+	respBody, err := postNotification(fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", token), body, nil)
+	if err != nil {
+		return err
+	}
+	var response struct {
+		Ok          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err = json.Unmarshal(respBody, &response); err != nil {
+		return err
+	}
+	if !response.Ok {
+		return errors.New(response.Description)
+	}
+	return nil
+}
+
+// sendDingTalkNotification 发送到钉钉群机器人，配置了加签密钥时在地址中附带 timestamp 与 sign
+func sendDingTalkNotification(channel common.NotificationChannel, title string, content string) error {
+	requestUrl := channel.Url
+	if channel.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		mac := hmac.New(sha256.New, []byte(channel.Secret))
+		mac.Write([]byte(timestamp + "\n" + channel.Secret))
+		sign := url.QueryEscape(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+		requestUrl = fmt.Sprintf("%s&timestamp=%s&sign=%s", requestUrl, timestamp, sign)
+	}
+	body, _ := json.Marshal(map[string]any{
+		"msgtype": "text",
+		"text":    map[string]string{"content": title + "\n" + content},
+	})
+	respBody, err := postNotification(requestUrl, body, nil)
+	if err != nil {
+		return err
+	}
+	var response struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err = json.Unmarshal(respBody, &response); err != nil {
+		return err
+	}
+	if response.ErrCode != 0 {
+		return errors.New(response.ErrMsg)
+	}
+	return nil
+}
+
+// sendFeishuNotification 发送到飞书群机器人，配置了签名校验密钥时在请求体中附带 timestamp 与 sign
+func sendFeishuNotification(channel common.NotificationChannel, title string, content string) error {
+	request := map[string]any{
+		"msg_type": "text",
+		"content":  map[string]string{"text": title + "\n" + content},
+	}
+	if channel.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(timestamp+"\n"+channel.Secret))
+		request["timestamp"] = timestamp
+		request["sign"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	body, _ := json.Marshal(request)
+	respBody, err := postNotification(channel.Url, body, nil)
+	if err != nil {
+		return err
+	}
+	var response struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err = json.Unmarshal(respBody, &response); err != nil {
+		return err
+	}
+	if response.Code != 0 {
+		return errors.New(response.Msg)
+	}
+	return nil
+}
+
+func sendSlackNotification(channel common.NotificationChannel, title string, content string) error {
+	body, _ := json.Marshal(map[string]string{
+		"text": "*" + title + "*\n" + content,
+	})
+	_, err := postNotification(channel.Url, body, nil)
+	return err
+}
+
+// postNotification 以 JSON 发送请求，响应状态码不是 2xx 时返回错误
+func postNotification(requestUrl string, body []byte, headers map[string]string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, requestUrl, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("status code %d: %s", resp.StatusCode, string(respBody))
+	}
+	return respBody, nil
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"one-api/common"
+	"one-api/dto"
+	relayconstant "one-api/relay/constant"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const keyRequestMeta = "key_request_meta"
+
+// RequestMeta 每个请求只解析一次的请求元信息，由选路、重试与 TextHelper 共用
+type RequestMeta struct {
+	RelayMode   int
+	RelayFormat int
+	// Request 为解析后的请求（非 OpenAI 格式的请求已转换为 OpenAI 格式），解析失败时为 nil，错误记录在 ParseError
+	Request    *dto.GeneralOpenAIRequest
+	ParseError error
+
+	IsImage        bool
+	IsStream       bool
+	IsSystemPrompt bool
+	IsNORLogprobs  bool
+	IsFunctionCall bool
+
+	PromptTokens      int
+	PromptTokensError error
+	// MaxTokens 请求的最大补全 token 数，与 PromptTokens 之和需要在渠道的上下文窗口内
+	MaxTokens int
+}
+
+// GetRequestMeta 获取当前请求的元信息，首次调用时解析请求体并缓存到 gin context 中
+func GetRequestMeta(c *gin.Context) *RequestMeta {
+	if meta, ok := c.Get(keyRequestMeta); ok {
+		return meta.(*RequestMeta)
+	}
+	meta := newRequestMeta(c)
+	c.Set(keyRequestMeta, meta)
+	return meta
+}
+
+func newRequestMeta(c *gin.Context) *RequestMeta {
+	meta := &RequestMeta{
+		RelayMode:   relayconstant.Path2RelayMode(c.Request.URL.Path),
+		RelayFormat: relayconstant.Path2RelayFormat(c.Request.URL.Path),
+	}
+	request, err := parseOpenAIRequest(c, meta.RelayFormat)
+	if err != nil {
+		meta.ParseError = err
+		return meta
+	}
+	meta.Request = request
+	meta.IsStream = request.Stream
+	meta.IsNORLogprobs = request.LogProbs
+	meta.MaxTokens = int(request.MaxTokens)
+	for _, message := range request.Messages {
+		if message.Role == "system" {
+			meta.IsSystemPrompt = true
+		}
+		if !meta.IsImage && hasImageContent(message) {
+			meta.IsImage = true
+		}
+	}
+	if meta.RelayFormat == relayconstant.RelayFormatOpenAI {
+		// OpenAI 格式按原始请求体判断，n 为 0 或 tool_calls 为 null 时解析后的请求无法区分
+		isNOR, isFunctionCall := parseRawRequestFlags(c)
+		meta.IsNORLogprobs = meta.IsNORLogprobs || isNOR
+		meta.IsFunctionCall = isFunctionCall
+	} else {
+		meta.IsNORLogprobs = meta.IsNORLogprobs || request.N > 1
+		for _, message := range request.Messages {
+			if message.ToolCalls != nil {
+				meta.IsFunctionCall = true
+			}
+		}
+	}
+	meta.PromptTokens, meta.PromptTokensError = countRequestPromptTokens(meta.RelayMode, request, request.Model)
+	return meta
+}
+
+// parseRawRequestFlags 按原始请求体判断 n 字段存在且不为 1，以及消息中是否存在 tool_calls 字段
+func parseRawRequestFlags(c *gin.Context) (isNOR bool, isFunctionCall bool) {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return false, false
+	}
+	var request struct {
+		N        json.RawMessage              `json:"n"`
+		Messages []map[string]json.RawMessage `json:"messages"`
+	}
+	if err = json.Unmarshal(requestBody, &request); err != nil {
+		return false, false
+	}
+	if len(request.N) > 0 {
+		var n any
+		_ = json.Unmarshal(request.N, &n)
+		// 转换成 int 类型，转换失败视为 1
+		count, err := strconv.Atoi(fmt.Sprintf("%v", n))
+		if err != nil {
+			count = 1
+		}
+		isNOR = count != 1
+	}
+	for _, message := range request.Messages {
+		if _, ok := message["tool_calls"]; ok {
+			isFunctionCall = true
+		}
+	}
+	return isNOR, isFunctionCall
+}
+
+func parseOpenAIRequest(c *gin.Context, relayFormat int) (*dto.GeneralOpenAIRequest, error) {
+	switch relayFormat {
+	case relayconstant.RelayFormatClaude:
+		claudeRequest := &dto.ClaudeRequest{}
+		if err := common.UnmarshalBodyReusable(c, claudeRequest); err != nil {
+			return nil, err
+		}
+		return claudeRequest.ToOpenAIRequest()
+	case relayconstant.RelayFormatGemini:
+		geminiRequest := &dto.GeminiRequest{}
+		if err := common.UnmarshalBodyReusable(c, geminiRequest); err != nil {
+			return nil, err
+		}
+		model, action := relayconstant.ParseGeminiPath(c.Request.URL.Path)
+		return geminiRequest.ToOpenAIRequest(model, action == "streamGenerateContent"), nil
+	}
+	request := &dto.GeneralOpenAIRequest{}
+	if err := common.UnmarshalBodyReusable(c, request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// CloneRequest 返回解析后请求的副本，调用方可以修改（如模型映射）而不影响重试
+func (meta *RequestMeta) CloneRequest() *dto.GeneralOpenAIRequest {
+	request := *meta.Request
+	if meta.Request.Messages != nil {
+		request.Messages = make([]dto.Message, len(meta.Request.Messages))
+		copy(request.Messages, meta.Request.Messages)
+	}
+	return &request
+}
+
+func hasImageContent(message dto.Message) bool {
+	if len(message.Content) == 0 || message.IsStringContent() {
+		return false
+	}
+	var contentList []struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(message.Content, &contentList); err != nil {
+		return false
+	}
+	for _, content := range contentList {
+		if content.Type == dto.ContentTypeImageURL {
+			return true
+		}
+	}
+	return false
+}
+
+func countRequestPromptTokens(relayMode int, request *dto.GeneralOpenAIRequest, model string) (int, error) {
+	switch relayMode {
+	case relayconstant.RelayModeChatCompletions:
+		return CountTokenChatRequest(*request, model)
+	case relayconstant.RelayModeCompletions:
+		return CountTokenInput(request.Prompt, model)
+	case relayconstant.RelayModeModerations:
+		return CountTokenInput(request.Input, model)
+	case relayconstant.RelayModeEmbeddings:
+		return CountTokenInput(request.Input, model)
+	}
+	return 0, errors.New("unknown relay mode")
+}
+
+// CountPromptTokens 返回按指定模型计算的提示词 token 数。选路时按请求的模型计算，
+// 渠道的模型映射改用其他模型时按映射后的模型重新计算
+func (meta *RequestMeta) CountPromptTokens(model string) (int, error) {
+	if meta.Request == nil || model == meta.Request.Model {
+		return meta.PromptTokens, meta.PromptTokensError
+	}
+	return countRequestPromptTokens(meta.RelayMode, meta.Request, model)
+}
+
+// SupportsModelFallback 请求是否可以改用其他模型转发，Gemini 格式的模型在路径中，不支持
+func (meta *RequestMeta) SupportsModelFallback() bool {
+	if meta.Request == nil || meta.RelayFormat == relayconstant.RelayFormatGemini {
+		return false
+	}
+	switch meta.RelayMode {
+	case relayconstant.RelayModeChatCompletions, relayconstant.RelayModeCompletions, relayconstant.RelayModeEmbeddings:
+		return true
+	}
+	return false
+}
+
+// SetRequestModel 将请求改为使用指定模型，同时修改缓存的请求体，用于模型降级
+func SetRequestModel(c *gin.Context, model string) error {
+	meta := GetRequestMeta(c)
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	body := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(requestBody, &body); err != nil {
+		return err
+	}
+	body["model"], _ = json.Marshal(model)
+	requestBody, err = json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	c.Set(common.KeyRequestBody, requestBody)
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	if meta.Request != nil && meta.Request.Model != model {
+		meta.Request.Model = model
+		// 不同模型的分词器不同，降级后的选路与计费按新模型重新计算提示词 token 数
+		meta.PromptTokens, meta.PromptTokensError = countRequestPromptTokens(meta.RelayMode, meta.Request, model)
+	}
+	return nil
+}
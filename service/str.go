@@ -2,8 +2,8 @@ package service
 
 import (
 	"bytes"
-	"fmt"
 	goahocorasick "github.com/anknown/ahocorasick"
+	"one-api/common"
 	"one-api/constant"
 	"strings"
 )
@@ -61,7 +61,7 @@ func InitAc() *goahocorasick.Machine {
 	m := new(goahocorasick.Machine)
 	dict := readRunes()
 	if err := m.Build(dict); err != nil {
-		fmt.Println(err)
+		common.SysError("failed to build sensitive words matcher: " + err.Error())
 		return nil
 	}
 	return m
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"one-api/common"
+	"sync"
+	"time"
+)
+
+var taskFailures = struct {
+	sync.Mutex
+	times map[string][]time.Time
+}{times: make(map[string][]time.Time)}
+
+// RecordTaskFailure 记录一次异步任务失败，最近 TaskFailureSpikeWindowMinutes 分钟内的失败数达到阈值时发送通知
+func RecordTaskFailure(platform string) {
+	threshold := common.TaskFailureSpikeThreshold
+	if threshold <= 0 {
+		return
+	}
+	now := time.Now()
+	window := time.Duration(common.TaskFailureSpikeWindowMinutes) * time.Minute
+	taskFailures.Lock()
+	times := append(taskFailures.times[platform], now)
+	start := 0
+	for start < len(times) && now.Sub(times[start]) > window {
+		start++
+	}
+	times = times[start:]
+	taskFailures.times[platform] = times
+	count := len(times)
+	taskFailures.Unlock()
+	if count < threshold {
+		return
+	}
+	Notify(Notification{
+		Event: common.NotifyEventTaskFailureSpike,
+		Key:   platform,
+		Data: map[string]any{
+			"platform":       platform,
+			"count":          count,
+			"window_minutes": common.TaskFailureSpikeWindowMinutes,
+		},
+	})
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"github.com/pkoukk/tiktoken-go"
 	"image"
-	"log"
 	"math"
 	"one-api/common"
 	"one-api/dto"
@@ -98,7 +97,7 @@ func getImageToken(imageUrl *dto.MessageImageUrl, model string, stream bool) (in
 	if strings.HasPrefix(imageUrl.Url, "http") {
 		config, format, err = DecodeUrlImageData(imageUrl.Url)
 	} else {
-		common.SysLog(fmt.Sprintf("decoding image"))
+		common.DebugLog("decoding image")
 		config, format, _, err = DecodeBase64ImageData(imageUrl.Url)
 	}
 	if err != nil {
@@ -119,7 +118,7 @@ func getImageToken(imageUrl *dto.MessageImageUrl, model string, stream bool) (in
 
 	shortSide := config.Width
 	otherSide := config.Height
-	log.Printf("format: %s, width: %d, height: %d", format, config.Width, config.Height)
+	common.DebugLog(fmt.Sprintf("format: %s, width: %d, height: %d", format, config.Width, config.Height))
 	// 缩放倍数
 	scale := 1.0
 	if config.Height < shortSide {
@@ -134,10 +133,10 @@ func getImageToken(imageUrl *dto.MessageImageUrl, model string, stream bool) (in
 	}
 	// 将另一边按照相同的比例缩小，向上取整
 	otherSide = int(math.Ceil(float64(otherSide) / scale))
-	log.Printf("shortSide: %d, otherSide: %d, scale: %f", shortSide, otherSide, scale)
+	common.DebugLog(fmt.Sprintf("shortSide: %d, otherSide: %d, scale: %f", shortSide, otherSide, scale))
 	// 计算图片的token数量(边的长度除以512，向上取整)
 	tiles := (shortSide + 511) / 512 * ((otherSide + 511) / 512)
-	log.Printf("tiles: %d", tiles)
+	common.DebugLog(fmt.Sprintf("tiles: %d", tiles))
 	return tiles*170 + 85, nil
 }
 
@@ -215,7 +214,7 @@ func CountTokenMessages(messages []dto.Message, model string, stream bool) (int,
 							return 0, err
 						}
 						tokenNum += imageTokenNum
-						log.Printf("image token num: %d", imageTokenNum)
+						common.DebugLog(fmt.Sprintf("image token num: %d", imageTokenNum))
 					} else {
 						tokenNum += getTokenNum(tokenEncoder, m.Text)
 					}
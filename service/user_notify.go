@@ -3,15 +3,28 @@ package service
 import (
 	"fmt"
 	"one-api/common"
+	"one-api/constant"
 	"one-api/model"
 )
 
-func notifyRootUser(subject string, content string) {
-	if common.RootUserEmail == "" {
-		common.RootUserEmail = model.GetRootUserEmail()
-	}
-	err := common.SendEmail(subject, common.RootUserEmail, content)
-	if err != nil {
-		common.SysError(fmt.Sprintf("failed to send email: %s", err.Error()))
+func init() {
+	model.NotifyUserQuotaLow = notifyUserQuotaLow
+}
+
+func notifyUserQuotaLow(userId int, userQuota int, exhausted bool) {
+	prompt := "您的额度即将用尽"
+	if exhausted {
+		prompt = "您的额度已用尽"
 	}
+	Notify(Notification{
+		Event:  common.NotifyEventUserQuotaLow,
+		Key:    fmt.Sprintf("%d:%t", userId, exhausted),
+		UserId: userId,
+		Data: map[string]any{
+			"user_id":     userId,
+			"prompt":      prompt,
+			"quota":       userQuota,
+			"top_up_link": fmt.Sprintf("%s/topup", constant.ServerAddress),
+		},
+	})
 }
@@ -21,6 +21,7 @@ import {
   Dropdown,
   Form,
   InputNumber,
+  Modal,
   Popconfirm,
   Space,
   SplitButtonGroup,
@@ -129,7 +130,14 @@ const ChannelsTable = () => {
         return (
           <div>
             <Space spacing={1}>
-              <Tooltip content={'已用额度'}>
+              <Tooltip
+                content={
+                  record.hedge_overhead_quota > 0
+                    ? '已用额度，对冲请求开销至少 ' +
+                      renderQuota(record.hedge_overhead_quota)
+                    : '已用额度'
+                }
+              >
                 <Tag color='white' type='ghost' size='large'>
                   {renderQuota(record.used_quota)}
                 </Tag>
@@ -223,6 +231,18 @@ const ChannelsTable = () => {
             </Dropdown>
           </SplitButtonGroup>
           {/*<Button theme='light' type='primary' style={{marginRight: 1}} onClick={()=>testChannel(record)}>测试</Button>*/}
+          <Popconfirm
+            title='确定要探测此渠道的能力吗？'
+            content='将对渠道的每个模型发送流式、系统提示词、工具调用、n=2/logprobs、图片与约 8K/32K/128K token 的上下文请求（第一次被拒绝时停止），并按结果更新渠道能力。每个模型最多约消耗 168K 提示词 token 的上游费用'
+            position={'left'}
+            onConfirm={() => {
+              probeChannel(record);
+            }}
+          >
+            <Button theme='light' type='tertiary' style={{ marginRight: 1 }}>
+              探测
+            </Button>
+          </Popconfirm>
           <Popconfirm
             title='确定是否要删除此渠道？'
             content='此修改将不可逆'
@@ -386,6 +406,7 @@ const ChannelsTable = () => {
     channelToCopy.created_time = null;
     channelToCopy.balance = 0;
     channelToCopy.used_quota = 0;
+    channelToCopy.hedge_overhead_quota = 0;
     if (!channelToCopy) {
       showError('渠道未找到，请刷新页面后重试。');
       return;
@@ -570,6 +591,69 @@ const ChannelsTable = () => {
     }
   };
 
+  const probeResultText = {
+    passed: '通过',
+    failed: '不支持',
+    unknown: '未知',
+  };
+
+  const probeChannel = async (record) => {
+    showInfo(`正在探测渠道 ${record.name} 的能力，请稍候...`);
+    const res = await API.post(`/api/channel/test/${record.id}/probe`);
+    const { success, message, data } = res.data;
+    if (!success) {
+      showError(message);
+    }
+    if (!data) {
+      return;
+    }
+    Modal.info({
+      title: `渠道 ${record.name} 能力探测结果`,
+      width: 720,
+      content: (
+        <div>
+          {data.map((report) => (
+            <div key={report.model} style={{ marginBottom: 12 }}>
+              <Typography.Text strong>{report.model}</Typography.Text>
+              {report.error ? (
+                <div>
+                  <Typography.Text type='danger'>{report.error}</Typography.Text>
+                </div>
+              ) : (
+                <div>
+                  {report.probes.map((probe) => (
+                    <Tooltip key={probe.name} content={probe.message || '-'}>
+                      <Tag
+                        color={
+                          probe.result === 'passed'
+                            ? 'green'
+                            : probe.result === 'failed'
+                              ? 'red'
+                              : 'grey'
+                        }
+                        style={{ marginRight: 4, marginTop: 4 }}
+                      >
+                        {probe.name}: {probeResultText[probe.result]}
+                      </Tag>
+                    </Tooltip>
+                  ))}
+                  {report.context_window > 0 && (
+                    <Tag style={{ marginTop: 4 }}>
+                      上下文窗口: {report.context_window}
+                    </Tag>
+                  )}
+                </div>
+              )}
+            </div>
+          ))}
+        </div>
+      ),
+    });
+    if (success) {
+      await refresh();
+    }
+  };
+
   const testAllChannels = async () => {
     const res = await API.get(`/api/channel/test`);
     const { success, message } = res.data;
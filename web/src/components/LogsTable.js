@@ -392,16 +392,29 @@ const LogsTable = () => {
           other.group_ratio,
         );
         return (
-          <Tooltip content={content}>
-            <Paragraph
-              ellipsis={{
-                rows: 2,
-              }}
-              style={{ maxWidth: 240 }}
-            >
-              {text}
-            </Paragraph>
-          </Tooltip>
+          <>
+            <Tooltip content={content}>
+              <Paragraph
+                ellipsis={{
+                  rows: 2,
+                }}
+                style={{ maxWidth: 240 }}
+              >
+                {text}
+              </Paragraph>
+            </Tooltip>
+            {isAdminUser && other.capture_id ? (
+              <Button
+                size='small'
+                theme='borderless'
+                onClick={() => showBodyCapture(record.id)}
+              >
+                查看请求体
+              </Button>
+            ) : (
+              <></>
+            )}
+          </>
         );
       },
     },
@@ -509,6 +522,44 @@ const LogsTable = () => {
     }
   };
 
+  const showBodyCapture = async (logId) => {
+    if (!isAdminUser) {
+      return;
+    }
+    const res = await API.get(`/api/log/${logId}/capture`);
+    const { success, message, data } = res.data;
+    if (success) {
+      const bodyStyle = {
+        maxHeight: 240,
+        overflow: 'auto',
+        whiteSpace: 'pre-wrap',
+        wordBreak: 'break-all',
+        fontFamily: 'JetBrains Mono, Consolas',
+      };
+      Modal.info({
+        title: '请求体与响应体',
+        width: 800,
+        content: (
+          <div style={{ padding: 12 }}>
+            <p>
+              请求：{data.path}
+              {data.request_truncated ? '（已截断）' : ''}
+            </p>
+            <pre style={bodyStyle}>{data.request_body}</pre>
+            <p>
+              响应：状态码 {data.status_code}
+              {data.response_truncated ? '（已截断）' : ''}
+            </p>
+            <pre style={bodyStyle}>{data.response_body}</pre>
+          </div>
+        ),
+        centered: true,
+      });
+    } else {
+      showError(message);
+    }
+  };
+
   const setLogsFormat = (logs) => {
     for (let i = 0; i < logs.length; i++) {
       logs[i].timestamp2string = timestamp2string(logs[i].created_at);
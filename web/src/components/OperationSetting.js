@@ -4,6 +4,8 @@ import SettingsGeneral from '../pages/Setting/Operation/SettingsGeneral.js';
 import SettingsDrawing from '../pages/Setting/Operation/SettingsDrawing.js';
 import SettingsSensitiveWords from '../pages/Setting/Operation/SettingsSensitiveWords.js';
 import SettingsLog from '../pages/Setting/Operation/SettingsLog.js';
+import SettingsBodyCapture from '../pages/Setting/Operation/SettingsBodyCapture.js';
+import SettingsNotification from '../pages/Setting/Operation/SettingsNotification.js';
 import SettingsDataDashboard from '../pages/Setting/Operation/SettingsDataDashboard.js';
 import SettingsMonitoring from '../pages/Setting/Operation/SettingsMonitoring.js';
 import SettingsCreditLimit from '../pages/Setting/Operation/SettingsCreditLimit.js';
@@ -18,11 +20,18 @@ const OperationSetting = () => {
     QuotaForInvitee: 0,
     QuotaRemindThreshold: 0,
     PreConsumedQuota: 0,
+    FileStorageQuotaPerMB: 0,
+    BatchRatio: 0.5,
     StreamCacheQueueLength: 0,
     ModelRatio: '',
     CompletionRatio: '',
     ModelPrice: '',
     GroupRatio: '',
+    GroupRoutingStrategy: '',
+    ModelFallback: '',
+    GroupHedgeDelay: '',
+    GroupFirstTokenTimeout: '',
+    ModelContextWindow: '',
     TopUpLink: '',
     ChatLink: '',
     ChatLink2: '', // 添加的新状态变量
@@ -30,7 +39,35 @@ const OperationSetting = () => {
     AutomaticDisableChannelEnabled: false,
     AutomaticEnableChannelEnabled: false,
     ChannelDisableThreshold: 0,
+    ChannelBreakerEnabled: false,
+    ChannelBreakerErrorRate: 0.5,
+    ChannelBreakerMinRequests: 20,
+    ChannelBreakerWindowSeconds: 60,
+    ChannelBreakerOpenSeconds: 60,
+    ChannelBreakerHalfOpenProbes: 3,
+    ChannelRoutingWindowSeconds: 300,
+    ChannelRoutingMinRequests: 10,
+    ChannelKeyCooldownSeconds: 60,
+    ChannelAffinityEnabled: false,
+    ChannelAffinityHeader: '',
+    ChannelAffinitySeconds: 3600,
     LogConsumeEnabled: false,
+    LogLevel: 'info',
+    LogInfoSampleRate: 1,
+    BodyCaptureEnabled: false,
+    BodyCaptureUserIds: '',
+    BodyCaptureTokenIds: '',
+    BodyCaptureGroups: '',
+    BodyCaptureSampleRate: 1,
+    BodyCaptureMaxSize: 65536,
+    BodyCaptureRetentionDays: 7,
+    BodyCaptureRedactionRules: '',
+    NotificationChannels: '',
+    NotificationRules: '',
+    NotificationTemplates: '',
+    NotificationRateLimitSeconds: 300,
+    ChannelBalanceLowThreshold: 0,
+    TaskFailureSpikeThreshold: 0,
     DisplayInCurrencyEnabled: false,
     DisplayTokenStatEnabled: false,
     CheckSensitiveEnabled: false,
@@ -61,8 +98,16 @@ const OperationSetting = () => {
         if (
           item.key === 'ModelRatio' ||
           item.key === 'GroupRatio' ||
+          item.key === 'GroupRoutingStrategy' ||
+          item.key === 'ModelFallback' ||
+          item.key === 'GroupHedgeDelay' ||
+          item.key === 'GroupFirstTokenTimeout' ||
+          item.key === 'ModelContextWindow' ||
           item.key === 'CompletionRatio' ||
-          item.key === 'ModelPrice'
+          item.key === 'ModelPrice' ||
+          item.key === 'NotificationChannels' ||
+          item.key === 'NotificationRules' ||
+          item.key === 'NotificationTemplates'
         ) {
           item.value = JSON.stringify(JSON.parse(item.value), null, 2);
         }
@@ -116,6 +161,14 @@ const OperationSetting = () => {
         <Card style={{ marginTop: '10px' }}>
           <SettingsLog options={inputs} refresh={onRefresh} />
         </Card>
+        {/* 请求体保存 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsBodyCapture options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 通知设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsNotification options={inputs} refresh={onRefresh} />
+        </Card>
         {/* 数据看板 */}
         <Card style={{ marginTop: '10px' }}>
           <SettingsDataDashboard options={inputs} refresh={onRefresh} />
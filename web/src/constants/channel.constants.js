@@ -21,6 +21,13 @@ export const CHANNEL_OPTIONS = [
     color: 'purple',
     label: 'Suno API',
   },
+  {
+    key: 37,
+    text: 'Jina',
+    value: 37,
+    color: 'blue',
+    label: 'Jina',
+  },
   { key: 4, text: 'Ollama', value: 4, color: 'grey', label: 'Ollama' },
   {
     key: 14,
@@ -70,8 +70,6 @@ const EditChannel = (props) => {
     type: 1,
     key: '',
     openai_organization: '',
-    max_input_tokens_low: 0,
-    max_input_tokens_high: 9999999,
     base_url: '',
     other: '',
     model_mapping: '',
@@ -90,12 +88,18 @@ const EditChannel = (props) => {
     is_support_nor_logprobs: false,
     is_support_function_call: false,
     test_model: '',
+    key_selection: 'round_robin',
+    max_concurrency: 0,
+    rpm_limit: 0,
+    tpm_limit: 0,
+    model_limits: '',
+    first_token_timeout: 0,
+    context_windows: '',
     groups: ['default'],
   };
   const [batch, setBatch] = useState(false);
+  const [multiKey, setMultiKey] = useState(false);
   const [is_image, setImage] = useState(false)
-  const [max_input_tokens_low, setMaxInputTokensLow] = useState(0)
-  const [max_input_tokens_high, setMaxInputTokensHigh] = useState(9999999)
   const [is_support_stream, setIsSupportStream] = useState(false)
   const [is_support_system_prompt, setIsSupportSystemPrompt] = useState(false)
   const [is_support_nor_logprobs, setIsSupportNOrLogprobs] = useState(false)
@@ -199,12 +203,6 @@ const EditChannel = (props) => {
       } else {
         setImage(true);
       }
-      if (data.max_input_tokens_low){
-        setMaxInputTokensLow(data.max_input_tokens_low)
-      }
-      if (data.max_input_tokens_high){
-        setMaxInputTokensHigh(data.max_input_tokens_high)
-      }
       if (data.is_support_stream){
         setIsSupportStream(data.is_support_stream)
       }
@@ -349,6 +347,14 @@ const EditChannel = (props) => {
       showInfo('请至少选择一个模型！');
       return;
     }
+    if (inputs.model_limits && !verifyJSON(inputs.model_limits)) {
+      showInfo('模型限流必须是合法的 JSON 格式！');
+      return;
+    }
+    if (inputs.context_windows && !verifyJSON(inputs.context_windows)) {
+      showInfo('模型上下文窗口必须是合法的 JSON 格式！');
+      return;
+    }
     if (inputs.model_mapping !== '' && !verifyJSON(inputs.model_mapping)) {
       showInfo('模型映射必须是合法的 JSON 格式！');
       return;
@@ -374,8 +380,11 @@ const EditChannel = (props) => {
     }
     localInputs.auto_ban = autoBan ? 1 : 0;
     localInputs.is_image = is_image ? true : false;
-    localInputs.max_input_tokens_low = parseInt(max_input_tokens_low);
-    localInputs.max_input_tokens_high = parseInt(max_input_tokens_high);
+    localInputs.max_concurrency = parseInt(localInputs.max_concurrency) || 0;
+    localInputs.rpm_limit = parseInt(localInputs.rpm_limit) || 0;
+    localInputs.tpm_limit = parseInt(localInputs.tpm_limit) || 0;
+    localInputs.first_token_timeout =
+      parseInt(localInputs.first_token_timeout) || 0;
     localInputs.is_support_stream = is_support_stream;
     localInputs.is_support_system_prompt = is_support_system_prompt;
     localInputs.is_support_nor_logprobs = is_support_nor_logprobs;
@@ -388,7 +397,10 @@ const EditChannel = (props) => {
         id: parseInt(channelId),
       });
     } else {
-      res = await API.post(`/api/channel/`, localInputs);
+      res = await API.post(`/api/channel/`, {
+        ...localInputs,
+        multi_key: batch && multiKey,
+      });
     }
     const { success, message } = res.data;
     if (success) {
@@ -793,6 +805,19 @@ const EditChannel = (props) => {
               />
             </>
           )}
+          <div style={{ marginTop: 10 }}>
+            <Typography.Text strong>密钥池选择方式：</Typography.Text>
+          </div>
+          <Select
+            name='key_selection'
+            optionList={[
+              { label: '轮询', value: 'round_robin' },
+              { label: '随机', value: 'random' },
+            ]}
+            value={inputs.key_selection || 'round_robin'}
+            onChange={(value) => handleInputChange('key_selection', value)}
+            style={{ width: '50%' }}
+          />
           <div style={{ marginTop: 10 }}>
             <Typography.Text strong>默认测试模型：</Typography.Text>
           </div>
@@ -833,6 +858,21 @@ const EditChannel = (props) => {
               </Space>
             </div>
           )}
+          {!isEdit && batch && (
+            <div style={{ marginTop: 10, display: 'flex' }}>
+              <Space>
+                <Checkbox
+                  checked={multiKey}
+                  label='作为密钥池'
+                  name='multi_key'
+                  onChange={() => setMultiKey(!multiKey)}
+                />
+                <Typography.Text strong>
+                  作为密钥池（只创建一个渠道，每次请求从多个密钥中选择一个）
+                </Typography.Text>
+              </Space>
+            </div>
+          )}
           <div style={{ marginTop: 10, display: 'flex' }}>
             <Space>
               <Checkbox
@@ -844,34 +884,19 @@ const EditChannel = (props) => {
               <Typography.Text strong>is_image</Typography.Text>
             </Space>
           </div>
-          <div style={{ marginTop: 10 , display: 'flex'}}>
-            <Space>
-              <Input
-                label='最小请求token'
-                name='max_input_tokens_low'
-                placeholder='最低下限'
-                onChange={(value) => {
-                  setMaxInputTokensLow(value);
-                }}
-                value={max_input_tokens_low}
-              />
-              <Typography.Text strong>最小请求token</Typography.Text>
-            </Space>
-          </div>
-          <div style={{ marginTop: 10 , display: 'flex'}}>
-            <Space>
-              <Input
-                label='最大请求token'
-                name='max_input_tokens_high'
-                placeholder='最高上限'
-                onChange={(value) => {
-                  setMaxInputTokensHigh(value);
-                }}
-                value={max_input_tokens_high}
-              />
-              <Typography.Text strong>最大请求token</Typography.Text>
-            </Space>
+          <div style={{ marginTop: 10 }}>
+            <Typography.Text strong>模型上下文窗口：</Typography.Text>
           </div>
+          <TextArea
+            placeholder={`此项可选，为一个 JSON 字符串，键为模型名称，值为该渠道上模型的上下文窗口，覆盖运营设置中的模型上下文窗口，例如：\n${JSON.stringify({ 'gpt-4o': 128000 }, null, 2)}`}
+            name='context_windows'
+            onChange={(value) => {
+              handleInputChange('context_windows', value);
+            }}
+            autosize
+            value={inputs.context_windows}
+            autoComplete='new-password'
+          />
           <div style={{ marginTop: 10 , display: 'flex'}}>
             <Space>
               <Checkbox
@@ -982,6 +1007,65 @@ const EditChannel = (props) => {
           >
             填入模板
           </Typography.Text>
+          <div style={{ marginTop: 10 }}>
+            <Typography.Text strong>
+              渠道限流（0 表示不限制，达到限制时选择其他渠道）：
+            </Typography.Text>
+          </div>
+          <div style={{ marginTop: 10, display: 'flex' }}>
+            <Space>
+              <Input
+                addonBefore='最大并发'
+                name='max_concurrency'
+                onChange={(value) => {
+                  handleInputChange('max_concurrency', value);
+                }}
+                value={inputs.max_concurrency}
+              />
+              <Input
+                addonBefore='RPM'
+                name='rpm_limit'
+                onChange={(value) => {
+                  handleInputChange('rpm_limit', value);
+                }}
+                value={inputs.rpm_limit}
+              />
+              <Input
+                addonBefore='TPM'
+                name='tpm_limit'
+                onChange={(value) => {
+                  handleInputChange('tpm_limit', value);
+                }}
+                value={inputs.tpm_limit}
+              />
+            </Space>
+          </div>
+          <div style={{ marginTop: 10 }}>
+            <Typography.Text strong>模型限流：</Typography.Text>
+          </div>
+          <TextArea
+            placeholder={`此项可选，为一个 JSON 字符串，键为模型名称，值为该模型单独的限流，例如：\n${JSON.stringify({ 'gpt-4': { max_concurrency: 5, rpm: 60, tpm: 40000 } }, null, 2)}`}
+            name='model_limits'
+            onChange={(value) => {
+              handleInputChange('model_limits', value);
+            }}
+            autosize
+            value={inputs.model_limits}
+            autoComplete='new-password'
+          />
+          <div style={{ marginTop: 10 }}>
+            <Typography.Text strong>
+              首字超时（秒，0 表示使用分组设置）：
+            </Typography.Text>
+          </div>
+          <Input
+            name='first_token_timeout'
+            placeholder='流式请求在此时间内没有收到上游返回的内容时，中断请求并重试其他渠道'
+            onChange={(value) => {
+              handleInputChange('first_token_timeout', value);
+            }}
+            value={inputs.first_token_timeout}
+          />
           {/*<div style={{ marginTop: 10 }}>*/}
           {/*  <Typography.Text strong>*/}
           {/*    最大请求token（0表示不限制）：*/}
@@ -0,0 +1,218 @@
+import React, { useEffect, useState, useRef } from 'react';
+import { Button, Col, Form, Row, Spin } from '@douyinfe/semi-ui';
+import {
+  compareObjects,
+  API,
+  showError,
+  showSuccess,
+  showWarning,
+} from '../../../helpers';
+
+export default function SettingsBodyCapture(props) {
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState({
+    BodyCaptureEnabled: false,
+    BodyCaptureUserIds: '',
+    BodyCaptureTokenIds: '',
+    BodyCaptureGroups: '',
+    BodyCaptureSampleRate: 1,
+    BodyCaptureMaxSize: 65536,
+    BodyCaptureRetentionDays: 7,
+    BodyCaptureRedactionRules: '',
+  });
+  const refForm = useRef();
+  const [inputsRow, setInputsRow] = useState(inputs);
+
+  function onSubmit() {
+    const updateArray = compareObjects(inputs, inputsRow);
+    if (!updateArray.length) return showWarning('你似乎并没有修改什么');
+    const requestQueue = updateArray.map((item) => {
+      let value = '';
+      if (typeof inputs[item.key] === 'boolean') {
+        value = String(inputs[item.key]);
+      } else {
+        value = inputs[item.key];
+      }
+      return API.put('/api/option/', {
+        key: item.key,
+        value,
+      });
+    });
+    setLoading(true);
+    Promise.all(requestQueue)
+      .then((res) => {
+        if (requestQueue.length === 1) {
+          if (res.includes(undefined)) return;
+        } else if (requestQueue.length > 1) {
+          if (res.includes(undefined)) return showError('部分保存失败，请重试');
+        }
+        showSuccess('保存成功');
+        props.refresh();
+      })
+      .catch(() => {
+        showError('保存失败，请重试');
+      })
+      .finally(() => {
+        setLoading(false);
+      });
+  }
+
+  useEffect(() => {
+    const currentInputs = {};
+    for (let key in props.options) {
+      if (Object.keys(inputs).includes(key)) {
+        currentInputs[key] = props.options[key];
+      }
+    }
+    setInputs(currentInputs);
+    setInputsRow(structuredClone(currentInputs));
+    refForm.current.setValues(currentInputs);
+  }, [props.options]);
+  return (
+    <>
+      <Spin spinning={loading}>
+        <Form
+          values={inputs}
+          getFormApi={(formAPI) => (refForm.current = formAPI)}
+          style={{ marginBottom: 15 }}
+        >
+          <Form.Section text={'请求体保存设置'}>
+            <Row gutter={16}>
+              <Col span={8}>
+                <Form.Switch
+                  field={'BodyCaptureEnabled'}
+                  label={'保存请求体与响应体'}
+                  extraText={'用于排查问题与处理争议，可在消费日志中查看'}
+                  size='large'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={(value) => {
+                    setInputs({
+                      ...inputs,
+                      BodyCaptureEnabled: value,
+                    });
+                  }}
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col span={8}>
+                <Form.Input
+                  label={'用户 ID'}
+                  field={'BodyCaptureUserIds'}
+                  placeholder={'例如：1,2,3'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      BodyCaptureUserIds: value,
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.Input
+                  label={'令牌 ID'}
+                  field={'BodyCaptureTokenIds'}
+                  placeholder={'例如：1,2,3'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      BodyCaptureTokenIds: value,
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.Input
+                  label={'分组'}
+                  field={'BodyCaptureGroups'}
+                  placeholder={'例如：default,vip'}
+                  extraText={'英文逗号分隔，请求命中任意一项即保存，三项均为空时保存所有请求'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      BodyCaptureGroups: value,
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'采样比例'}
+                  step={0.1}
+                  min={0}
+                  max={1}
+                  field={'BodyCaptureSampleRate'}
+                  extraText={'命中条件的请求中保存的比例'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      BodyCaptureSampleRate: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'最大保存字节数'}
+                  step={1024}
+                  min={1}
+                  field={'BodyCaptureMaxSize'}
+                  extraText={'请求体与响应体各自保存的最大字节数，超出部分截断'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      BodyCaptureMaxSize: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'保存天数'}
+                  step={1}
+                  min={0}
+                  field={'BodyCaptureRetentionDays'}
+                  extraText={'过期后自动删除，为 0 时不删除'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      BodyCaptureRetentionDays: String(value),
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Col span={16}>
+                <Form.TextArea
+                  label={'自定义脱敏规则'}
+                  extraText={
+                    '一行一个正则表达式，匹配的内容替换为 [REDACTED]；邮箱、手机号与密钥始终会被脱敏'
+                  }
+                  placeholder={'一行一个正则表达式'}
+                  field={'BodyCaptureRedactionRules'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      BodyCaptureRedactionRules: value,
+                    })
+                  }
+                  style={{ fontFamily: 'JetBrains Mono, Consolas' }}
+                  autosize={{ minRows: 4, maxRows: 12 }}
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Button size='large' onClick={onSubmit}>
+                保存请求体保存设置
+              </Button>
+            </Row>
+          </Form.Section>
+        </Form>
+      </Spin>
+    </>
+  );
+}
@@ -15,6 +15,8 @@ export default function SettingsCreditLimit(props) {
     PreConsumedQuota: '',
     QuotaForInviter: '',
     QuotaForInvitee: '',
+    FileStorageQuotaPerMB: '',
+    BatchRatio: '',
   });
   const refForm = useRef();
   const [inputsRow, setInputsRow] = useState(inputs);
@@ -142,6 +144,41 @@ export default function SettingsCreditLimit(props) {
                 />
               </Col>
             </Row>
+            <Row gutter={16}>
+              <Col span={6}>
+                <Form.InputNumber
+                  label={'文件存储额度（每 MB 每天）'}
+                  field={'FileStorageQuotaPerMB'}
+                  step={1}
+                  min={0}
+                  suffix={'Token'}
+                  extraText={'通过 /v1/files 上传的文件按大小每天扣除，上传时预付首日，删除文件后停止收费，0 表示不收费'}
+                  placeholder={''}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      FileStorageQuotaPerMB: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col span={6}>
+                <Form.InputNumber
+                  label={'批处理倍率'}
+                  field={'BatchRatio'}
+                  step={0.1}
+                  min={0}
+                  extraText={'通过 /v1/batches 执行的请求在分组倍率上再乘以该倍率'}
+                  placeholder={'例如：0.5'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      BatchRatio: String(value),
+                    })
+                  }
+                />
+              </Col>
+            </Row>
 
             <Row>
               <Button size='large' onClick={onSubmit}>
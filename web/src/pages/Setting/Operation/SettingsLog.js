@@ -9,11 +9,20 @@ import {
   showWarning,
 } from '../../../helpers';
 
+const optionsLogLevel = [
+  { key: 'debug', label: 'debug', value: 'debug' },
+  { key: 'info', label: 'info', value: 'info' },
+  { key: 'warn', label: 'warn', value: 'warn' },
+  { key: 'error', label: 'error', value: 'error' },
+];
+
 export default function SettingsLog(props) {
   const [loading, setLoading] = useState(false);
   const [loadingCleanHistoryLog, setLoadingCleanHistoryLog] = useState(false);
   const [inputs, setInputs] = useState({
     LogConsumeEnabled: false,
+    LogLevel: 'info',
+    LogInfoSampleRate: 1,
     historyTimestamp: dayjs().subtract(1, 'month').toDate(),
   });
   const refForm = useRef();
@@ -133,6 +142,39 @@ export default function SettingsLog(props) {
                 </Spin>
               </Col>
             </Row>
+            <Row gutter={16}>
+              <Col span={8}>
+                <Form.Select
+                  label='系统日志级别'
+                  optionList={optionsLogLevel}
+                  field={'LogLevel'}
+                  extraText={'低于此级别的系统日志不输出，修改后立即生效'}
+                  style={{ width: 180 }}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      LogLevel: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label='请求 info 日志采样比例'
+                  step={0.1}
+                  min={0}
+                  max={1}
+                  extraText={'按请求采样，同一请求的日志全部保留或全部丢弃，warn 及以上级别不采样'}
+                  field={'LogInfoSampleRate'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      LogInfoSampleRate: String(value),
+                    })
+                  }
+                />
+              </Col>
+            </Row>
 
             <Row>
               <Button size='large' onClick={onSubmit}>
@@ -16,7 +16,12 @@ export default function SettingsMagnification(props) {
     ModelPrice: '',
     ModelRatio: '',
     CompletionRatio: '',
-    GroupRatio: ''
+    GroupRatio: '',
+    GroupRoutingStrategy: '',
+    ModelFallback: '',
+    GroupHedgeDelay: '',
+    GroupFirstTokenTimeout: '',
+    ModelContextWindow: ''
   });
   const refForm = useRef();
   const [inputsRow, setInputsRow] = useState(inputs);
@@ -213,6 +218,141 @@ export default function SettingsMagnification(props) {
               />
             </Col>
           </Row>
+          <Row gutter={16}>
+            <Col span={16}>
+              <Form.TextArea
+                label={'分组渠道选择策略'}
+                extraText={'weighted 按渠道权重随机选择（默认）；latency 结合近期首字时间、总耗时与成功率调整渠道权重'}
+                placeholder={'为一个 JSON 文本，键为分组名称，值为 weighted 或 latency'}
+                field={'GroupRoutingStrategy'}
+                autosize={{ minRows: 3, maxRows: 12 }}
+                trigger='blur'
+                stopValidateWithError
+                rules={[
+                  {
+                    validator: (rule, value) => {
+                      return verifyJSON(value);
+                    },
+                    message: '不是合法的 JSON 字符串'
+                  }
+                ]}
+                onChange={(value) =>
+                  setInputs({
+                    ...inputs,
+                    GroupRoutingStrategy: value
+                  })
+                }
+              />
+            </Col>
+          </Row>
+          <Row gutter={16}>
+            <Col span={16}>
+              <Form.TextArea
+                label={'分组模型降级链'}
+                extraText={'请求的模型无可用渠道或全部重试失败时，依次改用备用模型并按备用模型计费，仅对开启模型降级的令牌生效'}
+                placeholder={'为一个 JSON 文本，键为分组名称，值为模型到备用模型列表的映射，例如 {"default": {"gpt-4o": ["gpt-4-turbo", "claude-3-5-sonnet-20240620"]}}'}
+                field={'ModelFallback'}
+                autosize={{ minRows: 3, maxRows: 12 }}
+                trigger='blur'
+                stopValidateWithError
+                rules={[
+                  {
+                    validator: (rule, value) => {
+                      return verifyJSON(value);
+                    },
+                    message: '不是合法的 JSON 字符串'
+                  }
+                ]}
+                onChange={(value) =>
+                  setInputs({
+                    ...inputs,
+                    ModelFallback: value
+                  })
+                }
+              />
+            </Col>
+          </Row>
+          <Row gutter={16}>
+            <Col span={16}>
+              <Form.TextArea
+                label={'分组对冲请求延迟'}
+                extraText={'对话与补全请求在此时间（毫秒）内没有输出首个 token 时，向另一个渠道发送相同的请求，先输出的请求胜出，落败请求不计费'}
+                placeholder={'为一个 JSON 文本，键为分组名称，值为延迟毫秒数，例如 {"vip": 1500}'}
+                field={'GroupHedgeDelay'}
+                autosize={{ minRows: 3, maxRows: 12 }}
+                trigger='blur'
+                stopValidateWithError
+                rules={[
+                  {
+                    validator: (rule, value) => {
+                      return verifyJSON(value);
+                    },
+                    message: '不是合法的 JSON 字符串'
+                  }
+                ]}
+                onChange={(value) =>
+                  setInputs({
+                    ...inputs,
+                    GroupHedgeDelay: value
+                  })
+                }
+              />
+            </Col>
+          </Row>
+          <Row gutter={16}>
+            <Col span={16}>
+              <Form.TextArea
+                label={'分组首字超时'}
+                extraText={'流式请求在此时间（秒）内没有收到上游返回的任何内容时，中断请求并重试其他渠道，渠道单独设置了首字超时时以渠道为准'}
+                placeholder={'为一个 JSON 文本，键为分组名称，值为超时秒数，例如 {"default": 15}'}
+                field={'GroupFirstTokenTimeout'}
+                autosize={{ minRows: 3, maxRows: 12 }}
+                trigger='blur'
+                stopValidateWithError
+                rules={[
+                  {
+                    validator: (rule, value) => {
+                      return verifyJSON(value);
+                    },
+                    message: '不是合法的 JSON 字符串'
+                  }
+                ]}
+                onChange={(value) =>
+                  setInputs({
+                    ...inputs,
+                    GroupFirstTokenTimeout: value
+                  })
+                }
+              />
+            </Col>
+          </Row>
+          <Row gutter={16}>
+            <Col span={16}>
+              <Form.TextArea
+                label={'模型上下文窗口'}
+                extraText={'提示词与 max_tokens 之和超过窗口的渠道不会被选择，所有渠道都容纳不下时返回 context_length_exceeded 错误；模型名称可使用 * 通配符，如 gpt-4-turbo-*，未列出的模型不限制，渠道中可单独设置'}
+                placeholder={'为一个 JSON 文本，键为模型名称，值为上下文窗口 token 数'}
+                field={'ModelContextWindow'}
+                autosize={{ minRows: 6, maxRows: 12 }}
+                trigger='blur'
+                stopValidateWithError
+                rules={[
+                  {
+                    validator: (rule, value) => {
+                      return verifyJSON(value);
+                    },
+                    message: '不是合法的 JSON 字符串'
+                  }
+                ]}
+                onChange={(value) =>
+                  setInputs({
+                    ...inputs,
+                    ModelContextWindow: value
+                  })
+                }
+              />
+            </Col>
+          </Row>
         </Form.Section>
       </Form>
       <Space>
@@ -15,6 +15,18 @@ export default function SettingsMonitoring(props) {
     QuotaRemindThreshold: '',
     AutomaticDisableChannelEnabled: false,
     AutomaticEnableChannelEnabled: false,
+    ChannelBreakerEnabled: false,
+    ChannelBreakerErrorRate: '',
+    ChannelBreakerMinRequests: '',
+    ChannelBreakerWindowSeconds: '',
+    ChannelBreakerOpenSeconds: '',
+    ChannelBreakerHalfOpenProbes: '',
+    ChannelRoutingWindowSeconds: '',
+    ChannelRoutingMinRequests: '',
+    ChannelKeyCooldownSeconds: '',
+    ChannelAffinityEnabled: false,
+    ChannelAffinityHeader: '',
+    ChannelAffinitySeconds: '',
   });
   const refForm = useRef();
   const [inputsRow, setInputsRow] = useState(inputs);
@@ -141,6 +153,212 @@ export default function SettingsMonitoring(props) {
                 />
               </Col>
             </Row>
+            <Row gutter={16}>
+              <Col span={8}>
+                <Form.Switch
+                  field={'ChannelBreakerEnabled'}
+                  label={'启用渠道熔断'}
+                  size='large'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelBreakerEnabled: value,
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'熔断失败率'}
+                  step={0.05}
+                  min={0}
+                  max={1}
+                  extraText={'统计窗口内失败率达到此值时熔断渠道'}
+                  placeholder={''}
+                  field={'ChannelBreakerErrorRate'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelBreakerErrorRate: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'最小请求数'}
+                  step={1}
+                  min={1}
+                  suffix={'次'}
+                  extraText={'统计窗口内请求数达到此值才会判断是否熔断'}
+                  placeholder={''}
+                  field={'ChannelBreakerMinRequests'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelBreakerMinRequests: String(value),
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'统计窗口'}
+                  step={1}
+                  min={1}
+                  suffix={'秒'}
+                  extraText={'按此时间内的请求统计失败率'}
+                  placeholder={''}
+                  field={'ChannelBreakerWindowSeconds'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelBreakerWindowSeconds: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'熔断时长'}
+                  step={1}
+                  min={1}
+                  suffix={'秒'}
+                  extraText={'熔断后经过此时间进入半开状态'}
+                  placeholder={''}
+                  field={'ChannelBreakerOpenSeconds'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelBreakerOpenSeconds: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'探测请求数'}
+                  step={1}
+                  min={1}
+                  suffix={'次'}
+                  extraText={'半开状态下放行的探测请求数，全部成功后恢复'}
+                  placeholder={''}
+                  field={'ChannelBreakerHalfOpenProbes'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelBreakerHalfOpenProbes: String(value),
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'延迟路由统计窗口'}
+                  step={1}
+                  min={1}
+                  suffix={'秒'}
+                  extraText={'选择策略为 latency 的分组按此时间内的首字时间、耗时与成功率调整渠道权重'}
+                  placeholder={''}
+                  field={'ChannelRoutingWindowSeconds'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelRoutingWindowSeconds: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'延迟路由最小请求数'}
+                  step={1}
+                  min={1}
+                  suffix={'次'}
+                  extraText={'统计窗口内请求数达到此值的渠道才会调整权重'}
+                  placeholder={''}
+                  field={'ChannelRoutingMinRequests'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelRoutingMinRequests: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'密钥限流冷却时间'}
+                  step={1}
+                  min={0}
+                  suffix={'秒'}
+                  extraText={'多密钥渠道中的密钥返回 429 后，在此时间内不再被选择'}
+                  placeholder={''}
+                  field={'ChannelKeyCooldownSeconds'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelKeyCooldownSeconds: String(value),
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col span={8}>
+                <Form.Switch
+                  field={'ChannelAffinityEnabled'}
+                  label={'启用渠道亲和'}
+                  size='large'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  extraText={'同一会话的后续请求优先使用上次的渠道与密钥，便于命中上游提示词缓存'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelAffinityEnabled: value,
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.Input
+                  label={'会话请求头'}
+                  extraText={'优先按此请求头识别会话，其次为 user 字段、系统提示词与首条消息'}
+                  placeholder={'X-Session-Id'}
+                  field={'ChannelAffinityHeader'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelAffinityHeader: value,
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'会话有效期'}
+                  step={1}
+                  min={1}
+                  suffix={'秒'}
+                  extraText={'会话在此时间内没有新的请求时失效'}
+                  placeholder={''}
+                  field={'ChannelAffinitySeconds'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelAffinitySeconds: String(value),
+                    })
+                  }
+                />
+              </Col>
+            </Row>
             <Row>
               <Button size='large' onClick={onSubmit}>
                 保存监控设置
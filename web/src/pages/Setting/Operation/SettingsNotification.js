@@ -0,0 +1,249 @@
+import React, { useEffect, useState, useRef } from 'react';
+import { Button, Col, Form, Input, Row, Space, Spin } from '@douyinfe/semi-ui';
+import {
+  compareObjects,
+  API,
+  showError,
+  showSuccess,
+  showWarning,
+  verifyJSON,
+} from '../../../helpers';
+
+export default function SettingsNotification(props) {
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState({
+    NotificationChannels: '',
+    NotificationRules: '',
+    NotificationTemplates: '',
+    NotificationRateLimitSeconds: 300,
+    ChannelBalanceLowThreshold: 0,
+    TaskFailureSpikeThreshold: 0,
+  });
+  const refForm = useRef();
+  const [inputsRow, setInputsRow] = useState(inputs);
+  const [testChannel, setTestChannel] = useState('');
+
+  async function onSubmit() {
+    try {
+      await refForm.current.validate();
+    } catch {
+      return showError('请检查输入');
+    }
+    const updateArray = compareObjects(inputs, inputsRow);
+    if (!updateArray.length) return showWarning('你似乎并没有修改什么');
+    setLoading(true);
+    try {
+      // 通知规则引用的渠道需要先保存，因此按顺序逐项保存
+      for (const item of updateArray) {
+        const res = await API.put('/api/option/', {
+          key: item.key,
+          value: inputs[item.key],
+        });
+        if (!res.data.success) {
+          return showError(res.data.message);
+        }
+      }
+      showSuccess('保存成功');
+      props.refresh();
+    } catch {
+      showError('保存失败，请重试');
+    } finally {
+      setLoading(false);
+    }
+  }
+
+  async function onTest() {
+    if (!testChannel) return showWarning('请输入通知渠道名称');
+    setLoading(true);
+    try {
+      const res = await API.post('/api/option/notification/test', {
+        channel: testChannel,
+      });
+      const { success, message } = res.data;
+      if (success) {
+        showSuccess('测试通知已发送');
+      } else {
+        showError(message);
+      }
+    } finally {
+      setLoading(false);
+    }
+  }
+
+  useEffect(() => {
+    const currentInputs = {};
+    for (let key in props.options) {
+      if (Object.keys(inputs).includes(key)) {
+        currentInputs[key] = props.options[key];
+      }
+    }
+    setInputs(currentInputs);
+    setInputsRow(structuredClone(currentInputs));
+    refForm.current.setValues(currentInputs);
+  }, [props.options]);
+  return (
+    <>
+      <Spin spinning={loading}>
+        <Form
+          values={inputs}
+          getFormApi={(formAPI) => (refForm.current = formAPI)}
+          style={{ marginBottom: 15 }}
+        >
+          <Form.Section text={'通知设置'}>
+            <Row gutter={16}>
+              <Col span={16}>
+                <Form.TextArea
+                  label={'通知渠道'}
+                  extraText={
+                    '类型可选 webhook、telegram、dingtalk、feishu、slack、email；内置的 email 渠道无需配置，系统事件发送给超级管理员，用户事件发送给对应用户；secret 与 token 隐藏显示，不修改时保持原样即可'
+                  }
+                  placeholder={
+                    '例如：[{"name": "ops", "type": "feishu", "url": "https://open.feishu.cn/open-apis/bot/v2/hook/xxx", "secret": "xxx"}]'
+                  }
+                  field={'NotificationChannels'}
+                  autosize={{ minRows: 6, maxRows: 12 }}
+                  trigger='blur'
+                  stopValidateWithError
+                  rules={[
+                    {
+                      validator: (rule, value) => verifyJSON(value),
+                      message: '不是合法的 JSON 字符串',
+                    },
+                  ]}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      NotificationChannels: value,
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col span={16}>
+                <Form.TextArea
+                  label={'通知规则'}
+                  extraText={
+                    '事件 -> 通知渠道名称列表，可选事件：channel_disabled、channel_key_disabled、channel_enabled、channel_balance_low、user_quota_low、task_failure_spike、payment_received'
+                  }
+                  placeholder={'例如：{"channel_disabled": ["email", "ops"]}'}
+                  field={'NotificationRules'}
+                  autosize={{ minRows: 6, maxRows: 12 }}
+                  trigger='blur'
+                  stopValidateWithError
+                  rules={[
+                    {
+                      validator: (rule, value) => verifyJSON(value),
+                      message: '不是合法的 JSON 字符串',
+                    },
+                  ]}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      NotificationRules: value,
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col span={16}>
+                <Form.TextArea
+                  label={'通知模板'}
+                  extraText={
+                    '事件 -> {"title", "content"}，使用 Go 模板语法引用事件字段，如 {{.channel_name}}，未配置的事件使用默认模板'
+                  }
+                  placeholder={
+                    '例如：{"channel_disabled": {"title": "渠道 {{.channel_name}} 已禁用", "content": "原因：{{.reason}}"}}'
+                  }
+                  field={'NotificationTemplates'}
+                  autosize={{ minRows: 6, maxRows: 12 }}
+                  trigger='blur'
+                  stopValidateWithError
+                  rules={[
+                    {
+                      validator: (rule, value) => verifyJSON(value),
+                      message: '不是合法的 JSON 字符串',
+                    },
+                  ]}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      NotificationTemplates: value,
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'通知限流时间'}
+                  step={60}
+                  min={0}
+                  suffix={'秒'}
+                  field={'NotificationRateLimitSeconds'}
+                  extraText={'同一事件的同一对象在此时间内只通知一次，为 0 时不限制'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      NotificationRateLimitSeconds: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'渠道余额提醒阈值'}
+                  step={1}
+                  min={0}
+                  suffix={'$'}
+                  field={'ChannelBalanceLowThreshold'}
+                  extraText={'更新渠道余额时低于该值发送 channel_balance_low 通知，为 0 时不提醒'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelBalanceLowThreshold: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'任务失败数阈值'}
+                  step={1}
+                  min={0}
+                  field={'TaskFailureSpikeThreshold'}
+                  extraText={'最近 10 分钟内失败的异步任务数达到该值时发送 task_failure_spike 通知，为 0 时不提醒'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      TaskFailureSpikeThreshold: String(value),
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Space>
+                <Button size='large' onClick={onSubmit}>
+                  保存通知设置
+                </Button>
+                <Input
+                  size='large'
+                  placeholder={'通知渠道名称'}
+                  value={testChannel}
+                  onChange={setTestChannel}
+                  style={{ width: 200 }}
+                />
+                <Button size='large' onClick={onTest}>
+                  发送测试通知
+                </Button>
+              </Space>
+            </Row>
+          </Form.Section>
+        </Form>
+      </Spin>
+    </>
+  );
+}
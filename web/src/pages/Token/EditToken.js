@@ -34,6 +34,7 @@ const EditToken = (props) => {
     unlimited_quota: false,
     model_limits_enabled: false,
     model_limits: [],
+    model_fallback_enabled: false,
   };
   const [inputs, setInputs] = useState(originInputs);
   const {
@@ -43,6 +44,7 @@ const EditToken = (props) => {
     unlimited_quota,
     model_limits_enabled,
     model_limits,
+    model_fallback_enabled,
   } = inputs;
   // const [visible, setVisible] = useState(false);
   const [models, setModels] = useState({});
@@ -404,6 +406,21 @@ const EditToken = (props) => {
             optionList={models}
             disabled={!model_limits_enabled}
           />
+          <Divider />
+          <div style={{ marginTop: 10, display: 'flex' }}>
+            <Space>
+              <Checkbox
+                name='model_fallback_enabled'
+                checked={model_fallback_enabled}
+                onChange={(e) =>
+                  handleInputChange('model_fallback_enabled', e.target.checked)
+                }
+              ></Checkbox>
+              <Typography.Text>
+                启用模型降级（模型不可用时按分组配置的降级链改用其他模型）
+              </Typography.Text>
+            </Space>
+          </div>
         </Spin>
       </SideSheet>
     </>